@@ -199,7 +199,7 @@ func getProgramsHandler(w http.ResponseWriter, r *http.Request) {
 type GenerateProgramRequest struct {
 	StateSize   int      `json:"state_size"`
 	MaxLength   int      `json:"max_length"`
-	StartTokens []string `json:"start_tokens",omitempty`
+	StartTokens []string `json:"start_tokens,omitempty"`
 }
 
 func generateProgramHandler(w http.ResponseWriter, r *http.Request) {
@@ -248,7 +248,7 @@ type GenerateMixedProgramRequest struct {
 	StateSizes   []int     `json:"state_sizes"`
 	StateWeights []float32 `json:"state_weights"`
 	MaxLength    int       `json:"max_length"`
-	StartTokens  []string  `json:"start_tokens",omitempty`
+	StartTokens  []string  `json:"start_tokens,omitempty"`
 }
 
 func generateMixedProgramHandler(w http.ResponseWriter, r *http.Request) {
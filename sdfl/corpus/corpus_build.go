@@ -0,0 +1,208 @@
+// Package corpus converts directories of scenes into sequence corpora for
+// training the generator, and back.
+package corpus
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	sdfl "../sdfl"
+)
+
+type Entry struct {
+	Path    string
+	Hash    string // canonical AST hash, equal scenes written differently share it
+	Program sdfl.Program
+}
+
+type Skipped struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+type Result struct {
+	Entries    []Entry
+	Skipped    []Skipped
+	Duplicates int
+}
+
+// FindScenes returns the .sdfl files in the given files and directories, sorted
+func FindScenes(roots []string) ([]string, error) {
+	paths := []string{}
+	for _, root := range roots {
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, root)
+			continue
+		}
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && filepath.Ext(path) == ".sdfl" {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// parseScene parses and analyzes source with its own front end, so the
+// workers do not share diagnostics or the functions the scenes define. The
+// program is returned as written, the analyzed copy is only checked.
+func parseScene(source string) (sdfl.Program, string, error) {
+	fe := sdfl.NewFrontend()
+	parser := fe.NewParser(fe.Tokenize(source))
+	prog := parser.Parse()
+	if diagnostics := fe.Diagnostics(); len(diagnostics) > 0 && fe.HasErrors() {
+		return prog, "", fmt.Errorf("%d diagnostics, first: %v", len(diagnostics), diagnostics[0])
+	} else if parser.IsThereError() {
+		return prog, "", fmt.Errorf("syntax error")
+	}
+
+	analyzed := sdfl.CopyProgram(prog)
+	fe.Analyze(&analyzed)
+	for _, d := range fe.Diagnostics() {
+		if d.Severity == sdfl.SEVERITY_ERROR {
+			return prog, "", fmt.Errorf("does not compile: %v", d)
+		}
+	}
+	return prog, fe.CanonicalHash(prog), nil
+}
+
+// Build parses the scenes with the given number of workers and drops the
+// duplicates, the first path (in sorted order) of every scene is kept
+func Build(paths []string, workers int) Result {
+	if workers < 1 {
+		workers = 1
+	}
+
+	type parsed struct {
+		entry Entry
+		err   error
+	}
+	results := make([]parsed, len(paths))
+	// the rules of the lexer are shared, they are only read by the workers
+	sdfl.InitRules()
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				source, err := os.ReadFile(paths[i])
+				if err != nil {
+					results[i].err = err
+					continue
+				}
+				prog, hash, err := parseScene(string(source))
+				if err != nil {
+					results[i].err = err
+					continue
+				}
+				results[i].entry = Entry{Path: paths[i], Hash: hash, Program: prog}
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	result := Result{}
+	entries := []Entry{}
+	for i, r := range results {
+		if r.err != nil {
+			result.Skipped = append(result.Skipped, Skipped{Path: paths[i], Error: r.err.Error()})
+			continue
+		}
+		entries = append(entries, r.entry)
+	}
+	result.Entries, result.Duplicates = Dedupe(entries)
+	return result
+}
+
+// Dedupe keeps the first entry of every canonical hash
+func Dedupe(entries []Entry) ([]Entry, int) {
+	unique := []Entry{}
+	seen := map[string]string{}
+	for _, entry := range entries {
+		if first, ok := seen[entry.Hash]; ok {
+			sdfl.Debugf("%s is a duplicate of %s", entry.Path, first)
+			continue
+		}
+		seen[entry.Hash] = entry.Path
+		unique = append(unique, entry)
+	}
+	return unique, len(entries) - len(unique)
+}
+
+func Programs(entries []Entry) []sdfl.Program {
+	programs := []sdfl.Program{}
+	for _, entry := range entries {
+		programs = append(programs, entry.Program)
+	}
+	return programs
+}
+
+// Read loads a corpus file and keys its programs by their canonical hash
+func Read(path string) ([]Entry, error) {
+	programs, err := sdfl.ReadMultipleSequencesFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	entries := []Entry{}
+	for i, prog := range programs {
+		entries = append(entries, Entry{Path: path + "#" + strconv.Itoa(i), Hash: sdfl.CanonicalHash(prog), Program: prog})
+	}
+	return entries, nil
+}
+
+// Split assigns every entry to the validation set when its hash falls into
+// the val fraction, so the split is stable when the corpus grows. The seed
+// selects a different split of the same corpus.
+func Split(entries []Entry, val float64, seed int64) ([]Entry, []Entry) {
+	train, validation := []Entry{}, []Entry{}
+	for _, entry := range entries {
+		h := sdfl.HashContent(strconv.FormatInt(seed, 10) + ":" + entry.Hash)
+		bucket, _ := strconv.ParseUint(h[:8], 16, 64)
+		if float64(bucket)/float64(1<<32) < val {
+			validation = append(validation, entry)
+		} else {
+			train = append(train, entry)
+		}
+	}
+	return train, validation
+}
+
+// Extract writes every program back as .sdfl source into dir
+func Extract(entries []Entry, dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for i, entry := range entries {
+		path := filepath.Join(dir, fmt.Sprintf("scene_%04d.sdfl", i))
+		if err := os.WriteFile(path, []byte(sdfl.FormatProgram(entry.Program)), 0644); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
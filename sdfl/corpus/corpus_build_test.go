@@ -0,0 +1,84 @@
+package corpus
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeScenes writes the scenes into a temporary directory and returns their paths
+func writeScenes(t *testing.T, scenes map[string]string) []string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range scenes {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	paths, err := FindScenes([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func TestBuildSkipsScenesThatFail(t *testing.T) {
+	scenes := map[string]string{
+		"undefined.sdfl": "scene(camera: camera(), children: [blob()])",
+		"syntax.sdfl":    "scene(camera: camera(), children: [sphere(radius: ])",
+		"missing.sdfl":   "def blob(a) { sphere(radius: a) }\nscene(camera: camera(), children: [blob()])",
+		"copy.sdfl":      "scene(camera: camera(),   children: [sphere(radius: 1)])",
+	}
+	for i := 0; i < 16; i++ {
+		// the scenes define functions of the same name, every parser has its own
+		scenes[fmt.Sprintf("scene%02d.sdfl", i)] = fmt.Sprintf("def blob(r = %d) { sphere(radius: r) }\nscene(camera: camera(), children: [blob()])", i+1)
+	}
+	scenes["scene00.sdfl"] = "scene(camera: camera(), children: [sphere(radius: 1)])"
+	paths := writeScenes(t, scenes)
+
+	result := Build(paths, 4)
+	if len(result.Entries) != 16 || result.Duplicates != 1 {
+		t.Errorf("%d entries and %d duplicates, want 16 and 1", len(result.Entries), result.Duplicates)
+	}
+	skipped := map[string]string{}
+	for _, s := range result.Skipped {
+		skipped[filepath.Base(s.Path)] = s.Error
+	}
+	for name, want := range map[string]string{
+		"undefined.sdfl": "does not compile",
+		"syntax.sdfl":    "",
+		"missing.sdfl":   "missing argument a",
+	} {
+		err, ok := skipped[name]
+		if !ok || !strings.Contains(err, want) {
+			t.Errorf("%s: skipped %v with %q, want an error containing %q", name, ok, err, want)
+		}
+	}
+	if len(skipped) != 3 {
+		t.Errorf("skipped %v", skipped)
+	}
+}
+
+func TestBuildParallel(t *testing.T) {
+	scenes := map[string]string{}
+	for i := 0; i < 32; i++ {
+		scenes[fmt.Sprintf("scene%02d.sdfl", i)] = fmt.Sprintf("def blob(r = %d) { sphere(radius: r) }\nscene(camera: camera(), children: [blob(), box(size: (1, %d, 1))])", i+1, i+1)
+	}
+	paths := writeScenes(t, scenes)
+
+	serial := Build(paths, 1)
+	parallel := Build(paths, 8)
+	if len(serial.Skipped) > 0 || len(parallel.Skipped) > 0 {
+		t.Fatalf("skipped %v and %v", serial.Skipped, parallel.Skipped)
+	}
+	if len(serial.Entries) != len(parallel.Entries) {
+		t.Fatalf("%d entries with one worker, %d with eight", len(serial.Entries), len(parallel.Entries))
+	}
+	for i := range serial.Entries {
+		if serial.Entries[i].Path != parallel.Entries[i].Path || serial.Entries[i].Hash != parallel.Entries[i].Hash {
+			t.Errorf("entry %d: %s %s with one worker, %s %s with eight", i, serial.Entries[i].Path, serial.Entries[i].Hash, parallel.Entries[i].Path, parallel.Entries[i].Hash)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package corpus
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	sdfl "../sdfl"
+)
+
+// statistics of a corpus, to see what the generator is trained on
+
+type Stats struct {
+	Programs    int            `json:"programs"`
+	Lines       int            `json:"lines"`
+	Vocabulary  map[string]int `json:"vocabulary"`   // sequence line to count
+	Functions   map[string]int `json:"functions"`    // function id to number of calls
+	Depth       map[int]int    `json:"depth"`        // AST depth to number of programs
+	CallArity   map[int]int    `json:"call_arity"`   // number of arguments to number of calls
+	ArrayLength map[int]int    `json:"array_length"` // number of elements to number of arrays
+}
+
+func exprDepth(expr *sdfl.Expr) int {
+	depth := 0
+	switch expr.Type {
+	case sdfl.AST_FUN_CALL:
+		for i := range expr.FunCall.Args {
+			depth = max(depth, exprDepth(&expr.FunCall.Args[i].Expr))
+		}
+	case sdfl.AST_ARR_EXPR:
+		for i := range expr.ArrExpr.Exprs {
+			depth = max(depth, exprDepth(&expr.ArrExpr.Exprs[i]))
+		}
+	case sdfl.AST_BINOP_TERM:
+		depth = max(exprDepth(&expr.BinopTerm.Left), exprDepth(&expr.BinopTerm.Right))
+	case sdfl.AST_BINOP_FACTOR:
+		depth = max(exprDepth(&expr.BinopFactor.Left), exprDepth(&expr.BinopFactor.Right))
+	case sdfl.AST_BINOP_COMPARE:
+		depth = max(exprDepth(&expr.BinopCompare.Left), exprDepth(&expr.BinopCompare.Right))
+	case sdfl.AST_BINOP_LOGIC:
+		depth = max(exprDepth(&expr.BinopLogic.Left), exprDepth(&expr.BinopLogic.Right))
+	case sdfl.AST_UNOP_NOT:
+		depth = exprDepth(&expr.UnopNot.Expr)
+	case sdfl.AST_COND:
+		depth = max(exprDepth(&expr.Cond.Cond), exprDepth(&expr.Cond.Then), exprDepth(&expr.Cond.Else))
+	case sdfl.AST_VEC:
+		for i := range expr.Vec.Exprs {
+			depth = max(depth, exprDepth(&expr.Vec.Exprs[i]))
+		}
+	case sdfl.AST_FOR:
+		depth = max(exprDepth(&expr.For.From), exprDepth(&expr.For.To))
+		for i := range expr.For.Body.Exprs {
+			depth = max(depth, exprDepth(&expr.For.Body.Exprs[i]))
+		}
+	}
+	return depth + 1
+}
+
+func (s *Stats) addExpr(expr *sdfl.Expr) {
+	switch expr.Type {
+	case sdfl.AST_FUN_CALL:
+		s.Functions[expr.FunCall.Id]++
+		s.CallArity[len(expr.FunCall.Args)]++
+		for i := range expr.FunCall.Args {
+			s.addExpr(&expr.FunCall.Args[i].Expr)
+		}
+	case sdfl.AST_ARR_EXPR:
+		s.ArrayLength[len(expr.ArrExpr.Exprs)]++
+		for i := range expr.ArrExpr.Exprs {
+			s.addExpr(&expr.ArrExpr.Exprs[i])
+		}
+	case sdfl.AST_BINOP_TERM:
+		s.addExpr(&expr.BinopTerm.Left)
+		s.addExpr(&expr.BinopTerm.Right)
+	case sdfl.AST_BINOP_FACTOR:
+		s.addExpr(&expr.BinopFactor.Left)
+		s.addExpr(&expr.BinopFactor.Right)
+	case sdfl.AST_BINOP_COMPARE:
+		s.addExpr(&expr.BinopCompare.Left)
+		s.addExpr(&expr.BinopCompare.Right)
+	case sdfl.AST_BINOP_LOGIC:
+		s.addExpr(&expr.BinopLogic.Left)
+		s.addExpr(&expr.BinopLogic.Right)
+	case sdfl.AST_UNOP_NOT:
+		s.addExpr(&expr.UnopNot.Expr)
+	case sdfl.AST_COND:
+		s.addExpr(&expr.Cond.Cond)
+		s.addExpr(&expr.Cond.Then)
+		s.addExpr(&expr.Cond.Else)
+	case sdfl.AST_VEC:
+		for i := range expr.Vec.Exprs {
+			s.addExpr(&expr.Vec.Exprs[i])
+		}
+	case sdfl.AST_FOR:
+		s.addExpr(&expr.For.From)
+		s.addExpr(&expr.For.To)
+		for i := range expr.For.Body.Exprs {
+			s.addExpr(&expr.For.Body.Exprs[i])
+		}
+	}
+}
+
+func ComputeStats(entries []Entry) Stats {
+	s := Stats{
+		Vocabulary:  map[string]int{},
+		Functions:   map[string]int{},
+		Depth:       map[int]int{},
+		CallArity:   map[int]int{},
+		ArrayLength: map[int]int{},
+	}
+
+	for _, entry := range entries {
+		prog := entry.Program
+		s.Programs++
+		for _, line := range strings.Split(sdfl.AST2Seq(prog), "\n") {
+			s.Lines++
+			s.Vocabulary[line]++
+		}
+
+		depth := exprDepth(&prog.Expr)
+		for _, stmt := range prog.Stmts {
+			if stmt.FunDef != nil && stmt.FunDef.Expr != nil {
+				depth = max(depth, exprDepth(stmt.FunDef.Expr))
+				s.addExpr(stmt.FunDef.Expr)
+			}
+		}
+		s.Depth[depth]++
+		s.addExpr(&prog.Expr)
+	}
+	return s
+}
+
+// byCount sorts the keys of counts by decreasing count, then by key
+func byCount(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// histogramWidth is the length of the bar of the largest count
+const histogramWidth = 60
+
+// printHistogram draws a bar per key, scaled to the largest count, a count
+// that is not zero gets at least one #
+func printHistogram(w io.Writer, title string, histogram map[int]int) {
+	fmt.Fprintf(w, "\n%s:\n", title)
+	keys := []int{}
+	maxCount := 0
+	for key, count := range histogram {
+		keys = append(keys, key)
+		maxCount = max(maxCount, count)
+	}
+	sort.Ints(keys)
+	for _, key := range keys {
+		bar := 0
+		if count := histogram[key]; count > 0 {
+			bar = max(1, count*histogramWidth/maxCount)
+		}
+		fmt.Fprintf(w, "  %4d  %6d  %s\n", key, histogram[key], strings.Repeat("#", bar))
+	}
+}
+
+// Print writes a readable summary, with the top most frequent vocabulary lines
+func (s Stats) Print(w io.Writer, top int) {
+	fmt.Fprintf(w, "programs:   %d\n", s.Programs)
+	fmt.Fprintf(w, "lines:      %d\n", s.Lines)
+	fmt.Fprintf(w, "vocabulary: %d distinct lines\n", len(s.Vocabulary))
+
+	fmt.Fprintf(w, "\nmost frequent lines:\n")
+	for i, line := range byCount(s.Vocabulary) {
+		if i == top {
+			break
+		}
+		fmt.Fprintf(w, "  %6d  %s\n", s.Vocabulary[line], line)
+	}
+
+	fmt.Fprintf(w, "\nfunctions:\n")
+	for _, id := range byCount(s.Functions) {
+		fmt.Fprintf(w, "  %6d  %s\n", s.Functions[id], id)
+	}
+
+	printHistogram(w, "depth", s.Depth)
+	printHistogram(w, "call arity", s.CallArity)
+	printHistogram(w, "array length", s.ArrayLength)
+}
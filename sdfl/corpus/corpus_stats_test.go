@@ -0,0 +1,29 @@
+package corpus
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPrintHistogram(t *testing.T) {
+	var out bytes.Buffer
+	printHistogram(&out, "depth", map[int]int{1: 1, 2: 300, 3: 150, 4: 2})
+	bars := map[string]int{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n")[1:] {
+		fields := strings.Fields(line)
+		bar := ""
+		if len(fields) == 3 {
+			bar = fields[2]
+		}
+		bars[fields[0]] = len(bar)
+	}
+	// the largest count fills the width, the others are in proportion and
+	// small ones stay visible
+	want := map[string]int{"1": 1, "2": histogramWidth, "3": histogramWidth / 2, "4": 1}
+	for key, n := range want {
+		if bars[key] != n {
+			t.Errorf("bar of %s has %d #, want %d\n%s", key, bars[key], n, out.String())
+		}
+	}
+}
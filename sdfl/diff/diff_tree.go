@@ -0,0 +1,323 @@
+// Package diff compares two scenes as trees. Argument order, layout,
+// parentheses, @tweak marks and number spelling do not count as changes, every
+// change is reported with its path like scene.children[2].smoothUnion.child1.radius.
+package diff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	sdfl "../sdfl"
+)
+
+type ChangeKind string
+
+const (
+	ADDED   ChangeKind = "added"
+	REMOVED ChangeKind = "removed"
+	CHANGED ChangeKind = "changed"
+	MOVED   ChangeKind = "moved"
+)
+
+type Change struct {
+	Kind     ChangeKind `json:"kind"`
+	Path     string     `json:"path"`                // path in the new scene, in the old one for removed nodes
+	FromPath string     `json:"from_path,omitempty"` // path in the old scene of moved nodes
+	From     string     `json:"from,omitempty"`
+	To       string     `json:"to,omitempty"`
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case ADDED:
+		return "+ " + c.Path + valueSuffix(c.Path, c.To)
+	case REMOVED:
+		return "- " + c.Path + valueSuffix(c.Path, c.From)
+	case MOVED:
+		return "> " + c.FromPath + " -> " + c.Path
+	}
+	return "~ " + c.Path + ": " + c.From + " -> " + c.To
+}
+
+// valueSuffix shows added and removed values, unless the path already names the node
+func valueSuffix(path string, value string) string {
+	if value == "" || strings.HasSuffix(path, "."+strings.SplitN(value, "(", 2)[0]) {
+		return ""
+	}
+	return ": " + value
+}
+
+// oneLine formats expr as source on a single line
+func oneLine(expr sdfl.Expr) string {
+	source := strings.Join(strings.Fields(sdfl.FormatExpr(expr)), " ")
+	return strings.NewReplacer("( ", "(", " )", ")", "[ ", "[", " ]", "]").Replace(source)
+}
+
+// nodeName names the calls and the control flow of a list in paths, like
+// sphere, if or for i
+func nodeName(expr sdfl.Expr) string {
+	switch expr.Type {
+	case sdfl.AST_FUN_CALL:
+		return expr.FunCall.Id
+	case sdfl.AST_COND:
+		return "if"
+	case sdfl.AST_FOR:
+		return "for " + expr.For.Var
+	}
+	return ""
+}
+
+func elementPath(path string, i int, expr sdfl.Expr) string {
+	path = fmt.Sprintf("%s[%d]", path, i)
+	if name := nodeName(expr); name != "" {
+		path += "." + name
+	}
+	return path
+}
+
+func funDefs(prog sdfl.Program) map[string]*sdfl.FunDef {
+	defs := map[string]*sdfl.FunDef{}
+	for _, stmt := range prog.Stmts {
+		if stmt.FunDef != nil {
+			defs[stmt.FunDef.Id] = stmt.FunDef
+		}
+	}
+	return defs
+}
+
+func signature(funDef *sdfl.FunDef) string {
+	return "def " + funDef.Id + "(" + sdfl.FormatParams(funDef) + ")"
+}
+
+// Programs returns the changes that turn a into b, an empty list when both
+// describe the same scene
+func Programs(a sdfl.Program, b sdfl.Program) []Change {
+	changes := []Change{}
+
+	defsA, defsB := funDefs(a), funDefs(b)
+	ids := []string{}
+	for id := range defsA {
+		ids = append(ids, id)
+	}
+	for id := range defsB {
+		if _, ok := defsA[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		defA, okA := defsA[id]
+		defB, okB := defsB[id]
+		switch {
+		case !okB:
+			changes = append(changes, Change{Kind: REMOVED, Path: id, From: signature(defA)})
+		case !okA:
+			changes = append(changes, Change{Kind: ADDED, Path: id, To: signature(defB)})
+		default:
+			if signature(defA) != signature(defB) {
+				changes = append(changes, Change{Kind: CHANGED, Path: id, From: signature(defA), To: signature(defB)})
+			}
+			if defA.Expr != nil && defB.Expr != nil {
+				changes = exprs(changes, id, *defA.Expr, *defB.Expr)
+			}
+		}
+	}
+
+	path := "scene"
+	if b.Expr.Type == sdfl.AST_FUN_CALL {
+		path = b.Expr.FunCall.Id
+	}
+	return exprs(changes, path, a.Expr, b.Expr)
+}
+
+func exprs(changes []Change, path string, a sdfl.Expr, b sdfl.Expr) []Change {
+	if sdfl.CanonicalExpr(a) == sdfl.CanonicalExpr(b) {
+		return changes
+	}
+
+	switch {
+	case a.Type == sdfl.AST_FUN_CALL && b.Type == sdfl.AST_FUN_CALL && a.FunCall.Id == b.FunCall.Id:
+		return args(changes, path, a.FunCall, b.FunCall)
+	case a.Type == sdfl.AST_ARR_EXPR && b.Type == sdfl.AST_ARR_EXPR:
+		return elements(changes, path, a.ArrExpr.Exprs, b.ArrExpr.Exprs)
+	case a.Type == sdfl.AST_FOR && b.Type == sdfl.AST_FOR && a.For.Var == b.For.Var:
+		changes = exprs(changes, path+".from", a.For.From, b.For.From)
+		changes = exprs(changes, path+".to", a.For.To, b.For.To)
+		return elements(changes, path+".body", a.For.Body.Exprs, b.For.Body.Exprs)
+	case a.Type == sdfl.AST_COND && b.Type == sdfl.AST_COND:
+		changes = exprs(changes, path+".cond", a.Cond.Cond, b.Cond.Cond)
+		changes = exprs(changes, path+".then", a.Cond.Then, b.Cond.Then)
+		return exprs(changes, path+".else", a.Cond.Else, b.Cond.Else)
+	}
+	return append(changes, Change{Kind: CHANGED, Path: path, From: oneLine(a), To: oneLine(b)})
+}
+
+func args(changes []Change, path string, a *sdfl.FunCall, b *sdfl.FunCall) []Change {
+	names := []string{}
+	for _, arg := range a.Args {
+		names = append(names, arg.ArgName)
+	}
+	for _, arg := range b.Args {
+		if _, ok := a.Arg(arg.ArgName); !ok {
+			names = append(names, arg.ArgName)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		argA, okA := a.Arg(name)
+		argB, okB := b.Arg(name)
+		switch {
+		case !okB:
+			changes = append(changes, Change{Kind: REMOVED, Path: path + "." + name, From: oneLine(argA.Expr)})
+		case !okA:
+			changes = append(changes, Change{Kind: ADDED, Path: path + "." + name, To: oneLine(argB.Expr)})
+		default:
+			changes = exprs(changes, path+"."+name, argA.Expr, argB.Expr)
+		}
+	}
+	return changes
+}
+
+// lcs returns the pairs of indices of a longest common subsequence of keys
+func lcs(a []string, b []string) [][2]int {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	pairs := [][2]int{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			pairs = append(pairs, [2]int{i, j})
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return pairs
+}
+
+// elements matches the elements of two arrays: equal elements are paired
+// first, in order where they can be, then the rest by name and compared, the
+// elements left are added and removed. The pairs that keep their order are the
+// ones in place, the others are moved, so an added or removed element does not
+// move the ones after it.
+func elements(changes []Change, path string, a []sdfl.Expr, b []sdfl.Expr) []Change {
+	keysA, keysB := []string{}, []string{}
+	for _, e := range a {
+		keysA = append(keysA, sdfl.CanonicalExpr(e))
+	}
+	for _, e := range b {
+		keysB = append(keysB, sdfl.CanonicalExpr(e))
+	}
+
+	const unmatched = -1
+	matchA, matchB := make([]int, len(a)), make([]int, len(b))
+	for i := range matchA {
+		matchA[i] = unmatched
+	}
+	for j := range matchB {
+		matchB[j] = unmatched
+	}
+	match := func(i, j int) {
+		matchA[i], matchB[j] = j, i
+	}
+
+	for _, pair := range lcs(keysA, keysB) {
+		match(pair[0], pair[1])
+	}
+	for j := range b {
+		for i := range a {
+			if matchB[j] == unmatched && matchA[i] == unmatched && keysA[i] == keysB[j] {
+				match(i, j)
+			}
+		}
+	}
+	for j := range b {
+		for i := range a {
+			if matchB[j] == unmatched && matchA[i] == unmatched && nodeName(a[i]) == nodeName(b[j]) {
+				match(i, j)
+			}
+		}
+	}
+	inPlace := aligned(matchB, func(i, j int) bool { return keysA[i] == keysB[j] })
+
+	for i := range a {
+		if matchA[i] == unmatched {
+			changes = append(changes, Change{Kind: REMOVED, Path: elementPath(path, i, a[i]), From: oneLine(a[i])})
+		}
+	}
+	for j := range b {
+		i := matchB[j]
+		switch {
+		case i == unmatched:
+			changes = append(changes, Change{Kind: ADDED, Path: elementPath(path, j, b[j]), To: oneLine(b[j])})
+		case !inPlace[j]:
+			changes = append(changes, Change{Kind: MOVED, Path: elementPath(path, j, b[j]), FromPath: elementPath(path, i, a[i])})
+			changes = exprs(changes, elementPath(path, j, b[j]), a[i], b[j])
+		default:
+			changes = exprs(changes, elementPath(path, j, b[j]), a[i], b[j])
+		}
+	}
+	return changes
+}
+
+// aligned returns the elements of b whose pairs keep their order, the most of
+// them and among those the most equal ones. matchB is the index in a paired
+// with each element of b, or -1.
+func aligned(matchB []int, equal func(i, j int) bool) map[int]bool {
+	type score struct{ pairs, equal int }
+	better := func(x, y score) bool {
+		return x.pairs > y.pairs || x.pairs == y.pairs && x.equal > y.equal
+	}
+
+	// best[j] is the best alignment ending with the pair of j, previous[j] its pair before
+	best := make([]score, len(matchB))
+	previous := make([]int, len(matchB))
+	last := -1
+	for j, i := range matchB {
+		previous[j] = -1
+		if i < 0 {
+			continue
+		}
+		own := score{1, 0}
+		if equal(i, j) {
+			own.equal = 1
+		}
+		best[j] = own
+		for k := 0; k < j; k++ {
+			if matchB[k] < 0 || matchB[k] >= i {
+				continue
+			}
+			candidate := score{best[k].pairs + own.pairs, best[k].equal + own.equal}
+			if better(candidate, best[j]) {
+				best[j], previous[j] = candidate, k
+			}
+		}
+		if last < 0 || better(best[j], best[last]) {
+			last = j
+		}
+	}
+
+	inPlace := map[int]bool{}
+	for j := last; j >= 0; j = previous[j] {
+		inPlace[j] = true
+	}
+	return inPlace
+}
@@ -0,0 +1,99 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	sdfl "../sdfl"
+)
+
+func parse(t *testing.T, src string) sdfl.Program {
+	t.Helper()
+	sdfl.ResetDiagnostics()
+	sdfl.InitRules()
+	parser := sdfl.NewParser(sdfl.Tokenize(src))
+	prog := parser.Parse()
+	if parser.IsThereError() || sdfl.HasErrors() {
+		t.Fatalf("parse: %v", sdfl.GetDiagnostics())
+	}
+	return prog
+}
+
+// scene returns a scene with the children
+func scene(children string) string {
+	return "scene(camera: camera(position: (0, 0, 5)), children: [" + children + "])"
+}
+
+// changesOf returns the printed changes that turn the children a into b
+func changesOf(t *testing.T, a string, b string) string {
+	t.Helper()
+	lines := []string{}
+	for _, change := range Programs(parse(t, scene(a)), parse(t, scene(b))) {
+		lines = append(lines, change.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestElements(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want string
+	}{
+		{"sphere(radius: 1, position: (0, 1, 0))", "sphere(position: (0, 1, 0), radius: 1.0)", ""},
+		{
+			"sphere(radius: 1), box(size: (1, 1, 1)), torus(radius: 1)",
+			"torus(radius: 1)",
+			"- scene.children[0].sphere\n- scene.children[1].box",
+		},
+		{
+			"sphere(radius: 1)",
+			"box(size: (1, 1, 1)), sphere(radius: 1)",
+			"+ scene.children[0].box",
+		},
+		{
+			"sphere(radius: 1), box(size: (1, 1, 1))",
+			"box(size: (1, 1, 1)), sphere(radius: 2)",
+			"> scene.children[0].sphere -> scene.children[1].sphere\n~ scene.children[1].sphere.radius: 1 -> 2",
+		},
+		{
+			"sphere(radius: 1), box(size: (1, 1, 1))",
+			"sphere(radius: 1), box(size: (1, 2, 1))",
+			"~ scene.children[1].box.size: (1, 1, 1) -> (1, 2, 1)",
+		},
+		{
+			// the elements after an insertion are in place
+			"sphere(radius: 1), box(size: (1, 1, 1)), torus(radius: 1), plane(height: -1)",
+			"sphere(radius: 1), cylinder(radius: 1), box(size: (1, 1, 1)), torus(radius: 1), plane(height: -1)",
+			"+ scene.children[1].cylinder",
+		},
+		{
+			"sphere(radius: 1), box(size: (1, 1, 1)), torus(radius: 1), plane(height: -1)",
+			"sphere(radius: 1), box(size: (1, 1, 1)), plane(height: -1)",
+			"- scene.children[2].torus",
+		},
+		{
+			"sphere(radius: 1), box(size: (1, 1, 1)), torus(radius: 1)",
+			"cylinder(radius: 1), sphere(radius: 1), box(size: (1, 2, 1)), torus(radius: 1)",
+			"+ scene.children[0].cylinder\n~ scene.children[2].box.size: (1, 1, 1) -> (1, 2, 1)",
+		},
+		{
+			"sphere(radius: 1), box(size: (1, 1, 1)), torus(radius: 1)",
+			"torus(radius: 1), sphere(radius: 1), box(size: (1, 1, 1))",
+			"> scene.children[2].torus -> scene.children[0].torus",
+		},
+		{
+			"sphere(radius: 1), for i in 0..3 { sphere(position: (i, 0, 0)) }",
+			"sphere(radius: 1), for i in 0..4 { sphere(position: (i, 1, 0)) }",
+			"~ scene.children[1].for i.to: 3 -> 4\n~ scene.children[1].for i.body[0].sphere.position: (i, 0, 0) -> (i, 1, 0)",
+		},
+		{
+			"box(size: (1, 1, 1)), time() > 1 ? sphere(radius: 1) : box(size: (1, 1, 1))",
+			"box(size: (1, 1, 1)), time() > 2 ? sphere(radius: 2) : box(size: (1, 1, 1))",
+			"~ scene.children[1].if.cond: time() > 1 -> time() > 2\n~ scene.children[1].if.then.radius: 1 -> 2",
+		},
+	} {
+		if got := changesOf(t, tc.a, tc.b); got != tc.want {
+			t.Errorf("[%s] -> [%s]:\n%s\nwant\n%s", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
@@ -1,12 +1,20 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
 
+	"./corpus"
+	"./diff"
+	"./mutate"
+	"./render"
 	"./sdfl"
 )
 
@@ -44,12 +52,36 @@ func (a *Args) ParseFlag(flag string) (string, string) {
 	return flag, ""
 }
 
+// Value returns the value of a flag given as --flag=value or --flag value
+func (a *Args) Value(flag string, value string) string {
+	if value == "" && a.HasNext() {
+		value = a.GetNext()
+	}
+	if value == "" {
+		fmt.Fprintf(os.Stderr, "Error: %s requires a value\n", flag)
+		os.Exit(1)
+	}
+	return value
+}
+
 type Config struct {
 	FilePath  string
 	WatchMode bool
 	FromSeq   bool
+	Strict    bool
+	Optimize  bool
+	Cull      bool
+	Modes     string
+	Lens      string
+	Target    string
 	Interval  int
 	ShowHelp  bool
+	TweakMode sdfl.TweakMode
+	OutDir    string
+	LogLevel  sdfl.LogLevel
+	LogFile   string
+	Traces    []string
+	JSON      bool
 }
 
 func check(e error) {
@@ -58,72 +90,204 @@ func check(e error) {
 	}
 }
 
-func compileFromSeq(filePath string) {
-	sdfl.ParseSeq(filePath)
-	program := sdfl.Seq2AST()
-	sdfl.PrintAST(program)
+// Manifest describes the result of a compile for build scripts and the runtime
+type Manifest struct {
+	Version     int                  `json:"version"`
+	Input       string               `json:"input"`
+	Success     bool                 `json:"success"`
+	Outputs     map[string]string    `json:"outputs"`
+	Diagnostics []sdfl.Diagnostic    `json:"diagnostics"`
+	Uniforms    []sdfl.ShaderUniform `json:"uniforms"`
+	RenderModes []string             `json:"render_modes"`
+	Materials   []sdfl.Material      `json:"materials"`
+	Scene       sdfl.SceneBounds     `json:"scene"`
+}
+
+// newManifest returns the manifest of a failed compile, the lists are empty
+// and not null so readers do not have to check
+func newManifest(config *Config) *Manifest {
+	return &Manifest{
+		Version:     1,
+		Input:       config.FilePath,
+		Outputs:     map[string]string{},
+		Diagnostics: []sdfl.Diagnostic{},
+		Uniforms:    []sdfl.ShaderUniform{},
+		RenderModes: []string{},
+		Materials:   []sdfl.Material{},
+	}
+}
+
+func outputPath(config *Config, name string) string {
+	return filepath.Join(config.OutDir, name)
+}
+
+func compileFromSeq(config *Config) *Manifest {
+	manifest := newManifest(config)
+	sdfl.ResetDiagnostics()
+
+	// sampled sequences are often malformed, repair them unless asked not to
+	sdfl.SetSeqRepair(!config.Strict)
+	err := sdfl.ParseSeq(config.FilePath)
+	var program sdfl.Program
+	if err == nil {
+		program, err = sdfl.Seq2AST()
+	}
+	if err != nil {
+		manifest.Diagnostics = []sdfl.Diagnostic{{Severity: sdfl.SEVERITY_ERROR, Message: err.Error()}}
+		return manifest
+	}
+	sdfl.Analyze(&program)
+	if sdfl.HasErrors() {
+		manifest.Diagnostics = sdfl.GetDiagnostics()
+		return manifest
+	}
+	if config.Optimize {
+		sdfl.Optimize(&program)
+	}
+	sdfl.FprintAST(sdfl.TraceWriter(sdfl.TRACE_AST), program)
 
 	sdfl.Reset()
 	sdfl.Generate(&program)
 
-	f, err := os.Create("out_frag.glsl")
-	check(err)
-	defer f.Close()
-	len, err := f.WriteString(sdfl.GetFragmentCode())
-	check(err)
-	fmt.Println(len, "bytes written successfully")
-
-	genComputeShader()
+	finishCompile(config, manifest, &program)
+	return manifest
 }
 
-func compile(filePath string) {
+func compile(config *Config) *Manifest {
+	manifest := newManifest(config)
+	sdfl.ResetDiagnostics()
+
 	sdfl.InitRules()
-	source, err := os.ReadFile(filePath)
-	check(err)
-	fmt.Println(string(source))
+	source, err := os.ReadFile(config.FilePath)
+	if err != nil {
+		manifest.Diagnostics = []sdfl.Diagnostic{{Severity: sdfl.SEVERITY_ERROR, Message: err.Error()}}
+		return manifest
+	}
+	sdfl.Debugf("compiling %s (%d bytes)", config.FilePath, len(source))
 
 	tokens := sdfl.Tokenize(string(source))
 
-	for _, t := range tokens {
-		fmt.Printf("Token:%d:%d %-10s Value: %q\n", t.Row, t.Col, sdfl.TokenName[t.Kind], t.Value)
-	}
 	parser := sdfl.NewParser(tokens)
 	program := parser.Parse()
 
-	if parser.IsThereError() {
-		fmt.Printf("ERROR: Syntax error!\n")
-		return
+	if parser.IsThereError() || sdfl.HasErrors() {
+		manifest.Diagnostics = sdfl.GetDiagnostics()
+		return manifest
 	}
-
-	sdfl.PrintAST(program)
-	// convert to sequence
+	// convert to sequence, with the loops as they were written
 	sequence := sdfl.AST2Seq(program)
-	// fmt.Println(sequence)
-	err = sdfl.WriteSequenceToFile(program, "ast_sequence.txt", sequence)
-	if err != nil {
-		fmt.Printf("Error writing to file: %v\n", err)
+	sdfl.Analyze(&program)
+	if sdfl.HasErrors() {
+		manifest.Diagnostics = sdfl.GetDiagnostics()
+		return manifest
+	}
+	if config.Optimize {
+		sdfl.Optimize(&program)
+	}
+
+	sdfl.FprintAST(sdfl.TraceWriter(sdfl.TRACE_AST), program)
+	sequencePath := outputPath(config, "ast_sequence.txt")
+	if _, err = writeIfChanged(sequencePath, sequence); err != nil {
+		sdfl.Errorf("writing %s: %v", sequencePath, err)
+	} else {
+		manifest.Outputs["sequence"] = sequencePath
 	}
 
 	sdfl.Reset()
 	sdfl.Generate(&program)
 	// fmt.Println(sdfl.GetCode())
-	f, err := os.Create("out_frag.glsl")
-	check(err)
-	defer f.Close()
-	len, err := f.WriteString(sdfl.GetFragmentCode())
-	check(err)
-	fmt.Println(len, "bytes written successfully")
+	finishCompile(config, manifest, &program)
+	return manifest
+}
+
+// finishCompile writes the generated shaders, unless generation failed so the
+// runtime keeps the last working ones, and fills in the manifest
+func finishCompile(config *Config, manifest *Manifest, program *sdfl.Program) {
+	manifest.Diagnostics = sdfl.GetDiagnostics()
+	if sdfl.HasErrors() {
+		return
+	}
+
+	hits, misses := sdfl.GetCacheStats()
+	if hits > 0 {
+		sdfl.Infof("%d cached subtrees reused, %d regenerated", hits, misses)
+	}
+
+	for _, shader := range sdfl.GetShaders() {
+		manifest.Outputs[shader.Stage] = writeShader(config, shader.Name, shader.Code)
+	}
+
+	if len(sdfl.GetTweakUniforms()) > 0 {
+		table, err := sdfl.GetTweakTable()
+		check(err)
+		manifest.Outputs["tweaks"] = writeShader(config, "out_tweaks.json", table)
+	}
 
-	genComputeShader()
+	manifest.Success = true
+	manifest.Uniforms = sdfl.GetDeclaredUniforms()
+	manifest.RenderModes = sdfl.GetRenderModes()
+	manifest.Materials = sdfl.GetMaterials()
+	manifest.Scene = sdfl.GetSceneBounds(program)
 }
 
-func genComputeShader() {
-	f, err := os.Create("out_compute.glsl")
-	check(err)
-	defer f.Close()
-	len, err := f.WriteString(sdfl.GetComputeCode())
+func writeShader(config *Config, name string, code string) string {
+	path := outputPath(config, name)
+	written, err := writeIfChanged(path, code)
 	check(err)
-	fmt.Println(len, "bytes written successfully")
+	if written {
+		sdfl.Infof("%s: %d bytes written successfully", path, len(code))
+	} else {
+		sdfl.Infof("%s unchanged, skipped", path)
+	}
+	return path
+}
+
+// report prints the result of a compile, diagnostics always go to stderr
+func report(config *Config, manifest *Manifest) {
+	if config.JSON {
+		bytes, err := json.Marshal(manifest)
+		check(err)
+		fmt.Println(string(bytes))
+		return
+	}
+
+	for _, d := range manifest.Diagnostics {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", config.FilePath, d)
+	}
+}
+
+func compileOnce(config *Config) *Manifest {
+	var manifest *Manifest
+	if config.FromSeq {
+		manifest = compileFromSeq(config)
+	} else {
+		manifest = compile(config)
+	}
+	report(config, manifest)
+	return manifest
+}
+
+// last written content hash of each output file
+var outputHashes = map[string]string{}
+
+// writeIfChanged only touches the file if its content would change, the
+// runtime hot reloads shaders on every write.
+func writeIfChanged(path string, content string) (bool, error) {
+	hash := sdfl.HashContent(content)
+	if outputHashes[path] == "" {
+		if existing, err := os.ReadFile(path); err == nil {
+			outputHashes[path] = sdfl.HashContent(string(existing))
+		}
+	}
+	if outputHashes[path] == hash {
+		return false, nil
+	}
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return false, err
+	}
+	outputHashes[path] = hash
+	return true, nil
 }
 
 func main() {
@@ -132,9 +296,37 @@ func main() {
 		os.Exit(1)
 	}
 
+	commands := map[string]func(*Args) error{
+		"corpus":      runCorpus,
+		"mutate":      runMutate,
+		"diff":        runDiff,
+		"render-anim": runRenderAnim,
+		"export":      runExport,
+	}
+	if run, ok := commands[os.Args[1]]; ok {
+		if err := run(NewArgs(os.Args[2:])); err != nil {
+			if err == errScenesDiffer {
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			if os.Args[1] == "diff" {
+				// like diff, 1 means the scenes differ
+				os.Exit(2)
+			}
+			os.Exit(1)
+		}
+		return
+	}
+
 	args := NewArgs(os.Args[1:])
 	config := &Config{
 		Interval: 1000, // default 1 second
+		Optimize: true,
+		Cull:     true,
+		Lens:     "cardboard",
+		Target:   "glsl430",
+		OutDir:   ".",
+		LogLevel: sdfl.LOG_WARN,
 	}
 
 	// Parse arguments
@@ -149,6 +341,20 @@ func main() {
 				config.WatchMode = true
 			case "--seq", "-s":
 				config.FromSeq = true
+			case "--strict":
+				config.Strict = true
+			case "--no-optimize":
+				config.Optimize = false
+			case "--no-cull":
+				config.Cull = false
+			case "--no-stereo":
+				config.Modes = "normal"
+			case "--modes":
+				config.Modes = args.Value(flag, value)
+			case "--lens":
+				config.Lens = args.Value(flag, value)
+			case "--target":
+				config.Target = args.Value(flag, value)
 			case "--interval", "-i":
 				if value == "" && args.HasNext() {
 					value = args.GetNext()
@@ -163,6 +369,49 @@ func main() {
 					os.Exit(1)
 				}
 				config.Interval = interval
+			case "--tweak", "-t":
+				switch value {
+				case "", "marked":
+					config.TweakMode = sdfl.TWEAK_MARKED
+				case "all":
+					config.TweakMode = sdfl.TWEAK_ALL
+				default:
+					fmt.Fprintf(os.Stderr, "Error: invalid tweak mode: %s (expected marked or all)\n", value)
+					os.Exit(1)
+				}
+			case "--out-dir", "-o":
+				if value == "" && args.HasNext() {
+					value = args.GetNext()
+				}
+				if value == "" {
+					fmt.Fprintf(os.Stderr, "Error: %s requires a value\n", flag)
+					os.Exit(1)
+				}
+				config.OutDir = value
+			case "--quiet", "-q":
+				config.LogLevel = sdfl.LOG_ERROR
+			case "--verbose", "-v":
+				config.LogLevel = sdfl.LOG_DEBUG
+			case "--trace":
+				if value == "" && args.HasNext() {
+					value = args.GetNext()
+				}
+				if value == "" {
+					fmt.Fprintf(os.Stderr, "Error: %s requires a value\n", flag)
+					os.Exit(1)
+				}
+				config.Traces = append(config.Traces, strings.Split(value, ",")...)
+			case "--log-file":
+				if value == "" && args.HasNext() {
+					value = args.GetNext()
+				}
+				if value == "" {
+					fmt.Fprintf(os.Stderr, "Error: %s requires a value\n", flag)
+					os.Exit(1)
+				}
+				config.LogFile = value
+			case "--json":
+				config.JSON = true
 			case "--help", "-h":
 				config.ShowHelp = true
 			default:
@@ -191,17 +440,51 @@ func main() {
 		os.Exit(1)
 	}
 
+	sdfl.SetTweakMode(config.TweakMode)
+	sdfl.SetCulling(config.Cull)
+	sdfl.SetShaderOptimization(config.Optimize)
+	if err := sdfl.SetRenderModes(config.Modes); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := sdfl.SetLensProfile(config.Lens); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := sdfl.SetTarget(config.Target); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	sdfl.SetLogLevel(config.LogLevel)
+	if err := sdfl.EnableTrace(config.Traces...); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if config.LogFile != "" {
+		logFile, err := os.Create(config.LogFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer logFile.Close()
+		sdfl.SetLogOutput(logFile)
+	}
+	if err := os.MkdirAll(config.OutDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Execute based on configuration
 	if config.WatchMode {
 		fw, err := sdfl.NewFileWatcher(config.FilePath)
 		check(err)
 
-		fmt.Println("Watching", config.FilePath, "for changes... (Ctrl+C to exit)")
-		fmt.Printf("Check interval: %dms\n", config.Interval)
+		sdfl.Infof("Watching %s for changes... (Ctrl+C to exit)", config.FilePath)
+		sdfl.Infof("Check interval: %dms", config.Interval)
 		if config.FromSeq {
-			fmt.Println("Mode: compile from sequence")
+			sdfl.Infof("Mode: compile from sequence")
 		} else {
-			fmt.Println("Mode: normal compile")
+			sdfl.Infof("Mode: normal compile")
 		}
 
 		for {
@@ -209,39 +492,663 @@ func main() {
 			check(err)
 
 			if changed {
-				fmt.Println("File changed, recompiling...")
-				if config.FromSeq {
-					compileFromSeq(config.FilePath)
-				} else {
-					compile(config.FilePath)
-				}
+				sdfl.Infof("File changed, recompiling...")
+				compileOnce(config)
 			}
 			time.Sleep(time.Duration(config.Interval) * time.Millisecond)
 		}
 	} else {
 		// Single compilation
-		if config.FromSeq {
-			compileFromSeq(config.FilePath)
+		if !compileOnce(config).Success {
+			os.Exit(1)
+		}
+	}
+}
+
+type CorpusConfig struct {
+	Command string
+	Inputs  []string
+	Output  string
+	Workers int
+	Val     float64
+	Seed    int64
+	JSON    bool
+	Top     int
+}
+
+// loadCorpus reads the scenes of .sdfl files and directories, or the programs of a corpus file
+func loadCorpus(config *CorpusConfig) ([]corpus.Entry, error) {
+	if len(config.Inputs) == 1 {
+		if info, err := os.Stat(config.Inputs[0]); err == nil && !info.IsDir() && filepath.Ext(config.Inputs[0]) != ".sdfl" {
+			entries, err := corpus.Read(config.Inputs[0])
+			if err != nil {
+				return nil, err
+			}
+			entries, duplicates := corpus.Dedupe(entries)
+			if duplicates > 0 {
+				sdfl.Warnf("dropped %d duplicate programs of %s", duplicates, config.Inputs[0])
+			}
+			return entries, nil
+		}
+	}
+
+	paths, err := corpus.FindScenes(config.Inputs)
+	if err != nil {
+		return nil, err
+	}
+	result := corpus.Build(paths, config.Workers)
+	for _, skipped := range result.Skipped {
+		sdfl.Warnf("skipping %s: %s", skipped.Path, skipped.Error)
+	}
+	sdfl.Infof("%d scenes, %d skipped, %d duplicates", len(paths), len(result.Skipped), result.Duplicates)
+	return result.Entries, nil
+}
+
+func runCorpus(args *Args) error {
+	config := &CorpusConfig{Command: args.GetNext(), Workers: runtime.NumCPU(), Val: 0.1, Top: 20}
+	logLevel := sdfl.LOG_WARN
+
+	for args.HasNext() {
+		arg := args.GetNext()
+		if !args.IsFlag(arg) {
+			config.Inputs = append(config.Inputs, arg)
+			continue
+		}
+
+		flag, value := args.ParseFlag(arg)
+		switch flag {
+		case "--out", "-o":
+			config.Output = args.Value(flag, value)
+		case "--workers", "-j":
+			value = args.Value(flag, value)
+			workers, err := strconv.Atoi(value)
+			if err != nil || workers < 1 {
+				return fmt.Errorf("invalid worker count: %s", value)
+			}
+			config.Workers = workers
+		case "--val":
+			value = args.Value(flag, value)
+			val, err := strconv.ParseFloat(value, 64)
+			if err != nil || val < 0 || val > 1 {
+				return fmt.Errorf("invalid validation fraction: %s (expected 0 to 1)", value)
+			}
+			config.Val = val
+		case "--seed":
+			value = args.Value(flag, value)
+			seed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid seed: %s", value)
+			}
+			config.Seed = seed
+		case "--top":
+			value = args.Value(flag, value)
+			top, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid top count: %s", value)
+			}
+			config.Top = top
+		case "--json":
+			config.JSON = true
+		case "--quiet", "-q":
+			logLevel = sdfl.LOG_ERROR
+		case "--verbose", "-v":
+			logLevel = sdfl.LOG_DEBUG
+		case "--help", "-h":
+			printUsage()
+			return nil
+		default:
+			return fmt.Errorf("unknown flag: %s", flag)
+		}
+	}
+	sdfl.SetLogLevel(logLevel)
+
+	if len(config.Inputs) == 0 {
+		return fmt.Errorf("corpus %s needs an input", config.Command)
+	}
+
+	switch config.Command {
+	case "build":
+		if config.Output == "" {
+			return fmt.Errorf("corpus build needs an output file (-o corpus.seq)")
+		}
+		entries, err := loadCorpus(config)
+		if err != nil {
+			return err
+		}
+		if err := sdfl.WriteMultipleSequencesToFile(corpus.Programs(entries), config.Output); err != nil {
+			return err
+		}
+		fmt.Printf("%s: %d programs\n", config.Output, len(entries))
+	case "split":
+		if config.Output == "" {
+			config.Output = "."
+		}
+		entries, err := loadCorpus(config)
+		if err != nil {
+			return err
+		}
+		train, val := corpus.Split(entries, config.Val, config.Seed)
+		if err := os.MkdirAll(config.Output, 0755); err != nil {
+			return err
+		}
+		trainPath, valPath := filepath.Join(config.Output, "train.seq"), filepath.Join(config.Output, "val.seq")
+		if err := sdfl.WriteMultipleSequencesToFile(corpus.Programs(train), trainPath); err != nil {
+			return err
+		}
+		if err := sdfl.WriteMultipleSequencesToFile(corpus.Programs(val), valPath); err != nil {
+			return err
+		}
+		fmt.Printf("%s: %d programs\n%s: %d programs\n", trainPath, len(train), valPath, len(val))
+	case "stats":
+		entries, err := loadCorpus(config)
+		if err != nil {
+			return err
+		}
+		stats := corpus.ComputeStats(entries)
+		if config.JSON {
+			bytes, err := json.MarshalIndent(stats, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(bytes))
 		} else {
-			compile(config.FilePath)
+			stats.Print(os.Stdout, config.Top)
+		}
+	case "extract":
+		if config.Output == "" {
+			return fmt.Errorf("corpus extract needs an output directory (-o dir)")
+		}
+		entries, err := loadCorpus(config)
+		if err != nil {
+			return err
+		}
+		paths, err := corpus.Extract(entries, config.Output)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %d scenes\n", config.Output, len(paths))
+	default:
+		return fmt.Errorf("unknown corpus command: %s (expected build, split, stats or extract)", config.Command)
+	}
+	return nil
+}
+
+// loadScene parses a .sdfl scene, any other file is read as a sequence
+func loadScene(path string) (sdfl.Program, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return sdfl.Program{}, err
+	}
+	if filepath.Ext(path) != ".sdfl" {
+		return sdfl.DecodeSeq(string(source))
+	}
+
+	sdfl.ResetDiagnostics()
+	sdfl.InitRules()
+	parser := sdfl.NewParser(sdfl.Tokenize(string(source)))
+	program := parser.Parse()
+	if parser.IsThereError() || sdfl.HasErrors() {
+		for _, d := range sdfl.GetDiagnostics() {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, d)
+		}
+		return program, fmt.Errorf("%s does not parse", path)
+	}
+	return program, nil
+}
+
+type MutateConfig struct {
+	FilePath  string
+	OutDir    string
+	Seed      int64
+	Count     int
+	Mutations int
+	Jitter    float64
+	JSON      bool
+}
+
+func runMutate(args *Args) error {
+	config := &MutateConfig{OutDir: ".", Seed: time.Now().UnixNano(), Count: 1, Mutations: 3, Jitter: 0.25}
+	logLevel := sdfl.LOG_WARN
+
+	for args.HasNext() {
+		arg := args.GetNext()
+		if !args.IsFlag(arg) {
+			if config.FilePath != "" {
+				return fmt.Errorf("unexpected argument: %s", arg)
+			}
+			config.FilePath = arg
+			continue
+		}
+
+		flag, value := args.ParseFlag(arg)
+		switch flag {
+		case "--out-dir", "-o":
+			config.OutDir = args.Value(flag, value)
+		case "--seed":
+			value = args.Value(flag, value)
+			seed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid seed: %s", value)
+			}
+			config.Seed = seed
+		case "-n":
+			value = args.Value(flag, value)
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 1 {
+				return fmt.Errorf("invalid variant count: %s", value)
+			}
+			config.Count = count
+		case "--mutations", "-m":
+			value = args.Value(flag, value)
+			mutations, err := strconv.Atoi(value)
+			if err != nil || mutations < 1 {
+				return fmt.Errorf("invalid mutation count: %s", value)
+			}
+			config.Mutations = mutations
+		case "--jitter":
+			value = args.Value(flag, value)
+			jitter, err := strconv.ParseFloat(value, 64)
+			if err != nil || jitter <= 0 {
+				return fmt.Errorf("invalid jitter: %s", value)
+			}
+			config.Jitter = jitter
+		case "--json":
+			config.JSON = true
+		case "--quiet", "-q":
+			logLevel = sdfl.LOG_ERROR
+		case "--verbose", "-v":
+			logLevel = sdfl.LOG_DEBUG
+		case "--help", "-h":
+			printUsage()
+			return nil
+		default:
+			return fmt.Errorf("unknown flag: %s", flag)
 		}
 	}
+	sdfl.SetLogLevel(logLevel)
+
+	if config.FilePath == "" {
+		return fmt.Errorf("mutate needs an input scene")
+	}
+	program, err := loadScene(config.FilePath)
+	if err != nil {
+		return err
+	}
+
+	mutator := mutate.New(config.Seed)
+	mutator.Mutations = config.Mutations
+	mutator.Jitter = config.Jitter
+	variants, err := mutator.Variants(program, config.Count)
+	if err != nil && len(variants) == 0 {
+		return err
+	} else if err != nil {
+		sdfl.Warnf("%v", err)
+	}
+
+	if err := os.MkdirAll(config.OutDir, 0755); err != nil {
+		return err
+	}
+	type output struct {
+		Path    string          `json:"path"`
+		Changes []mutate.Change `json:"changes"`
+	}
+	outputs := []output{}
+	base := strings.TrimSuffix(filepath.Base(config.FilePath), filepath.Ext(config.FilePath))
+	for i, variant := range variants {
+		path := filepath.Join(config.OutDir, fmt.Sprintf("%s_%03d.sdfl", base, i))
+		if err := os.WriteFile(path, []byte(sdfl.FormatProgram(variant.Program)), 0644); err != nil {
+			return err
+		}
+		for _, change := range variant.Changes {
+			sdfl.Debugf("%s: %s", path, change)
+		}
+		outputs = append(outputs, output{Path: path, Changes: variant.Changes})
+	}
+
+	if config.JSON {
+		bytes, err := json.Marshal(map[string]any{"input": config.FilePath, "seed": config.Seed, "variants": outputs})
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(bytes))
+	} else {
+		fmt.Printf("%s: %d variants of %s (seed %d)\n", config.OutDir, len(variants), config.FilePath, config.Seed)
+	}
+	return nil
+}
+
+// errScenesDiffer ends diff with exit status 1 after the changes are printed
+var errScenesDiffer = errors.New("the scenes differ")
+
+func runDiff(args *Args) error {
+	paths := []string{}
+	asJSON := false
+	for args.HasNext() {
+		arg := args.GetNext()
+		if !args.IsFlag(arg) {
+			paths = append(paths, arg)
+			continue
+		}
+		flag, _ := args.ParseFlag(arg)
+		switch flag {
+		case "--json":
+			asJSON = true
+		case "--help", "-h":
+			printUsage()
+			return nil
+		default:
+			return fmt.Errorf("unknown flag: %s", flag)
+		}
+	}
+	if len(paths) != 2 {
+		return fmt.Errorf("diff needs two scenes, got %d", len(paths))
+	}
+
+	a, err := loadScene(paths[0])
+	if err != nil {
+		return err
+	}
+	b, err := loadScene(paths[1])
+	if err != nil {
+		return err
+	}
+	changes := diff.Programs(a, b)
+
+	if asJSON {
+		bytes, err := json.Marshal(map[string]any{"a": paths[0], "b": paths[1], "equal": len(changes) == 0, "changes": changes})
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(bytes))
+	} else {
+		for _, change := range changes {
+			fmt.Println(change)
+		}
+	}
+	if len(changes) > 0 {
+		return errScenesDiffer
+	}
+	return nil
+}
+
+// parseSeconds reads a duration like 4s or 1500ms, a plain number is in seconds
+func parseSeconds(value string) (float64, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return seconds, nil
+	}
+	duration, err := time.ParseDuration(value)
+	return duration.Seconds(), err
+}
+
+func runRenderAnim(args *Args) error {
+	filePath := ""
+	output := "frames/%04d.png"
+	anim := &render.Animation{Width: 320, Height: 180, FPS: 24, Duration: 4, Workers: runtime.NumCPU()}
+	logLevel := sdfl.LOG_WARN
+
+	for args.HasNext() {
+		arg := args.GetNext()
+		if !args.IsFlag(arg) {
+			if filePath != "" {
+				return fmt.Errorf("unexpected argument: %s", arg)
+			}
+			filePath = arg
+			continue
+		}
+
+		flag, value := args.ParseFlag(arg)
+		switch flag {
+		case "--out", "-o":
+			output = args.Value(flag, value)
+		case "--fps":
+			value = args.Value(flag, value)
+			fps, err := strconv.ParseFloat(value, 64)
+			if err != nil || fps <= 0 {
+				return fmt.Errorf("invalid frame rate: %s", value)
+			}
+			anim.FPS = fps
+		case "--duration", "-d":
+			value = args.Value(flag, value)
+			duration, err := parseSeconds(value)
+			if err != nil || duration <= 0 {
+				return fmt.Errorf("invalid duration: %s (expected seconds like 4s)", value)
+			}
+			anim.Duration = duration
+		case "--size":
+			value = args.Value(flag, value)
+			var width, height int
+			if _, err := fmt.Sscanf(value, "%dx%d", &width, &height); err != nil || width < 1 || height < 1 {
+				return fmt.Errorf("invalid size: %s (expected WIDTHxHEIGHT)", value)
+			}
+			anim.Width, anim.Height = width, height
+		case "--workers", "-j":
+			value = args.Value(flag, value)
+			workers, err := strconv.Atoi(value)
+			if err != nil || workers < 1 {
+				return fmt.Errorf("invalid worker count: %s", value)
+			}
+			anim.Workers = workers
+		case "--quiet", "-q":
+			logLevel = sdfl.LOG_ERROR
+		case "--verbose", "-v":
+			logLevel = sdfl.LOG_DEBUG
+		case "--help", "-h":
+			printUsage()
+			return nil
+		default:
+			return fmt.Errorf("unknown flag: %s", flag)
+		}
+	}
+	sdfl.SetLogLevel(logLevel)
+
+	if filePath == "" {
+		return fmt.Errorf("render-anim needs an input scene")
+	}
+	if _, err := render.OutputFormat(output); err != nil {
+		return err
+	}
+	program, err := loadScene(filePath)
+	if err != nil {
+		return err
+	}
+	var scene *sdfl.SceneEval
+	if sdfl.Analyze(&program); !sdfl.HasErrors() {
+		scene = sdfl.CompileEval(&program)
+	}
+	if sdfl.HasErrors() {
+		for _, d := range sdfl.GetDiagnostics() {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", filePath, d)
+		}
+		return fmt.Errorf("%s does not compile", filePath)
+	}
+
+	start := time.Now()
+	if err := anim.Write(scene, output); err != nil {
+		return err
+	}
+	sdfl.Infof("%d frames of %dx%d rendered in %v", anim.FrameCount(), anim.Width, anim.Height, time.Since(start).Round(time.Millisecond))
+	fmt.Printf("%s: %d frames\n", output, anim.FrameCount())
+	return nil
+}
+
+// export formats and the targets generating them
+var exportTargets = map[string]string{
+	"--shadertoy": "shadertoy",
+}
+
+func runExport(args *Args) error {
+	filePath := ""
+	output := ""
+	target := ""
+	optimize, cull := true, true
+	logLevel := sdfl.LOG_WARN
+
+	for args.HasNext() {
+		arg := args.GetNext()
+		if !args.IsFlag(arg) {
+			if filePath != "" {
+				return fmt.Errorf("unexpected argument: %s", arg)
+			}
+			filePath = arg
+			continue
+		}
+
+		flag, value := args.ParseFlag(arg)
+		if name, ok := exportTargets[flag]; ok {
+			target = name
+			continue
+		}
+		switch flag {
+		case "--out", "-o":
+			output = args.Value(flag, value)
+		case "--no-optimize":
+			optimize = false
+		case "--no-cull":
+			cull = false
+		case "--quiet", "-q":
+			logLevel = sdfl.LOG_ERROR
+		case "--verbose", "-v":
+			logLevel = sdfl.LOG_DEBUG
+		case "--help", "-h":
+			printUsage()
+			return nil
+		default:
+			return fmt.Errorf("unknown flag: %s", flag)
+		}
+	}
+	sdfl.SetLogLevel(logLevel)
+
+	if filePath == "" {
+		return fmt.Errorf("export needs an input scene")
+	}
+	if target == "" {
+		return fmt.Errorf("export needs a format, like --shadertoy")
+	}
+	program, err := loadScene(filePath)
+	if err != nil {
+		return err
+	}
+	if sdfl.Analyze(&program); !sdfl.HasErrors() {
+		if optimize {
+			sdfl.Optimize(&program)
+		}
+		sdfl.SetCulling(cull)
+		sdfl.SetShaderOptimization(optimize)
+		check(sdfl.SetTarget(target))
+		sdfl.Generate(&program)
+	}
+	if sdfl.HasErrors() {
+		for _, d := range sdfl.GetDiagnostics() {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", filePath, d)
+		}
+		return fmt.Errorf("%s does not compile", filePath)
+	}
+
+	code := sdfl.GetShaders()[0].Code
+	if output == "" {
+		fmt.Print(code)
+		return nil
+	}
+	if err := os.WriteFile(output, []byte(code), 0644); err != nil {
+		return err
+	}
+	sdfl.Infof("%s: %d bytes written successfully", output, len(code))
+	return nil
 }
 
 func printUsage() {
 	fmt.Printf(`Usage: sdflc [flags] <input.sdfl>
+       sdflc corpus <build|split|stats|extract> [flags] <inputs...>
+       sdflc mutate [flags] <input.sdfl>
+       sdflc diff [--json] <a.sdfl> <b.sdfl>
+       sdflc render-anim [flags] <input.sdfl>
+       sdflc export --shadertoy [flags] <input.sdfl>
 
 Flags:
-  --seq, -s              Compile from sequence file
+  --seq, -s              Compile from sequence file, malformed sequences are
+                         repaired and the repairs reported as warnings
+  --strict               Fail on malformed sequences instead of repairing them
+  --no-optimize          Generate expressions as written, without folding constants,
+                         sharing repeated values or dropping unused functions
+  --no-cull              Evaluate every scene child at every step, without
+                         skipping the ones whose bounding box is farther away
+  --modes <list>         Render modes to generate, a comma separated list of
+                         normal, anaglyph and vr, instead of the render
+                         argument of scene (default: all three)
+  --no-stereo            Only generate the normal render mode, like --modes normal
+  --lens <profile>       Lens distortion of the vr mode: cardboard (default),
+                         dk1 or flat
+  --target <name>        Shading language: glsl430 (default, fragment and compute
+                         shaders), glsl-es300, wgsl, hlsl, msl or shadertoy (one
+                         fragment shader with the normal render mode)
   --watch, -w            Watch mode - recompile on file changes
   --interval, -i <ms>    Watch interval in milliseconds (default: 1000)
+  --tweak[=marked|all]   Hoist @tweak marked (or all) number literals into uniforms,
+                         described in out_tweaks.json
+  --out-dir, -o <dir>    Directory for the generated files (default: .)
+  --json                 Print a JSON manifest of the outputs, diagnostics,
+                         uniforms, render modes, materials and scene bounds
+  --quiet, -q            Only log errors
+  --verbose, -v          Log progress and debug messages
+  --trace <categories>   Trace the given comma separated categories:
+                         lexer, parser, ast, gen, seq or all
+  --log-file <path>      Write logs and traces to a file instead of stderr
   --help, -h             Show this help
 
+Corpus commands, inputs are .sdfl files, directories or one corpus file:
+  corpus build -o <file>   Parse the scenes in parallel (--workers, -j <n>) and
+                           write the unique ones as one sequence corpus
+  corpus split -o <dir>    Write train.seq and val.seq, --val <fraction> of the
+                           programs (default: 0.1) go to val.seq, --seed <n>
+                           selects another split
+  corpus stats [--json]    Print vocabulary, function counts and depth, arity and
+                           array length histograms (--top <n> frequent lines)
+  corpus extract -o <dir>  Write every program back as a .sdfl scene
+
+Mutate, writes random variants of a scene that all compile:
+  --seed <n>               Seed, equal seeds give equal variants (default: time)
+  -n <count>               Number of variants (default: 1)
+  --mutations, -m <n>      Changes per variant (default: 3)
+  --jitter <f>             Relative size of literal changes (default: 0.25)
+  --out-dir, -o <dir>      Directory for the variants (default: .)
+  --json                   Print the variants and their changes as JSON
+
+Diff, compares two scenes (or sequences) as trees and prints one change per line:
+  + path    added node or argument      - path  removed node or argument
+  ~ path    changed value               > a -> b  node moved from path a to b
+  --json                   Print the changes as JSON
+
+Render-anim, renders an animated scene on the CPU, time() is the time of each frame:
+  --fps <n>                Frames per second (default: 24)
+  --duration, -d <time>    Length like 4s or 1500ms (default: 4s)
+  --size <w>x<h>           Size of the frames (default: 320x180)
+  --workers, -j <n>        Frames rendered in parallel (default: number of CPUs)
+  --out, -o <path>         A pattern like frames/%%04d.png writes one PNG per frame,
+                           a .gif or .png (.apng) path one animated file
+                           (default: frames/%%04d.png)
+
+Export, writes one self-contained shader for another host:
+  --shadertoy              A mainImage shader for the Image tab of Shadertoy,
+                           reading iTime and iResolution
+  --out, -o <path>         Output file (default: standard output)
+  --no-optimize            Generate expressions as written
+  --no-cull                Evaluate every scene child at every step
+
 Examples:
   sdflc input.sdfl                    # Normal compile
   sdflc --seq sequence.txt            # Compile from sequence
   sdflc --watch input.sdfl            # Watch and compile
   sdflc --watch --seq --interval=500  sequence.txt  # Watch sequence with 500ms interval
   sdflc -w -s -i 2000 input.sdfl      # Short flags
+  sdflc --watch --tweak=all input.sdfl  # Live tweak every literal
+  sdflc --json -o build/ input.sdfl   # Compile into build/ and print a manifest
+  sdflc --trace=parser,gen --log-file=trace.txt input.sdfl  # Trace for a bug report
+  sdflc corpus build scenes/ -o corpus.seq   # Collect a training corpus
+  sdflc corpus split corpus.seq -o data/     # Train and validation sets
+  sdflc mutate scene.sdfl --seed 42 -n 100 -o out/   # 100 variants of a scene
+  sdflc diff old.sdfl new.sdfl        # What changed in a scene, exits 1 when something did
+  sdflc render-anim scene.sdfl --fps 24 --duration 4s -o frames/%%04d.png
+  sdflc render-anim scene.sdfl -o preview.gif   # Animated preview for the gallery
+  sdflc export --shadertoy scene.sdfl -o scene.glsl   # Paste into Shadertoy
 `)
 }
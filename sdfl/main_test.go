@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// manifestOf compiles src and returns its manifest as JSON values
+func manifestOf(t *testing.T, src string) map[string]any {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "scene.sdfl")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bytes, err := json.Marshal(compile(&Config{FilePath: path, OutDir: dir}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := map[string]any{}
+	if err := json.Unmarshal(bytes, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	return manifest
+}
+
+func TestManifestHasNoNulls(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		src     string
+		success bool
+	}{
+		{"syntax error", "scene(", false},
+		{"undefined function", "scene(camera: camera(), children: [blob()])", false},
+		{"unbounded", "scene(camera: camera(), children: [plane()])", true},
+	} {
+		manifest := manifestOf(t, tc.src)
+		if manifest["success"] != tc.success {
+			t.Errorf("%s: success is %v", tc.name, manifest["success"])
+		}
+		for _, key := range []string{"diagnostics", "uniforms", "render_modes", "materials"} {
+			if _, ok := manifest[key].([]any); !ok {
+				t.Errorf("%s: %s is %v, want a list", tc.name, key, manifest[key])
+			}
+		}
+		if _, ok := manifest["outputs"].(map[string]any); !ok {
+			t.Errorf("%s: outputs is %v, want an object", tc.name, manifest["outputs"])
+		}
+		scene, _ := manifest["scene"].(map[string]any)
+		if _, ok := scene["bounds"].(map[string]any); !ok {
+			t.Errorf("%s: the bounds of the scene are %v, want an object", tc.name, scene["bounds"])
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Package mutate derives random variations of a scene, for dataset
+// augmentation and for "surprise me" in the editor. Every variation it returns
+// type-checks against the builtin signatures and compiles.
+//
+// The compiler front end keeps its state in package variables, so a Mutator
+// must not be used from several goroutines at once.
+package mutate
+
+import (
+	"fmt"
+	"sort"
+
+	sdfl "../sdfl"
+)
+
+// site is an expression of a program together with what its position expects
+type site struct {
+	path    string       // like scene.children[2].smoothUnion.child1.radius
+	expr    sdfl.Expr    // shares its nodes with the program, changes to them are kept
+	kind    sdfl.ArgKind // kind of value expected at this position
+	argName string       // argument the expression is passed to, empty inside arrays and operators
+	list    *sdfl.ArrExpr
+	index   int
+	set     func(sdfl.Expr) // replaces the expression in the program
+}
+
+func sortedArgNames(funCall *sdfl.FunCall) []string {
+	names := []string{}
+	for _, arg := range funCall.Args {
+		names = append(names, arg.ArgName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func argKinds(funId string) map[string]sdfl.ArgKind {
+	kinds := map[string]sdfl.ArgKind{}
+	signature, _ := sdfl.Signature(funId)
+	for _, arg := range signature {
+		kinds[arg.Name] = arg.Kind
+	}
+	return kinds
+}
+
+// collect returns every expression of prog in a deterministic order
+func collect(prog *sdfl.Program) []site {
+	sites := []site{}
+
+	var visit func(s site)
+	visit = func(s site) {
+		sites = append(sites, s)
+		expr := s.expr
+		switch expr.Type {
+		case sdfl.AST_FUN_CALL:
+			funCall := expr.FunCall
+			kinds := argKinds(funCall.Id)
+			for _, name := range sortedArgNames(funCall) {
+				name := name
+				kind, ok := kinds[name]
+				if !ok {
+					kind = sdfl.ARG_ANY
+				}
+				visit(site{path: s.path + "." + name, expr: funCall.ArgExpr(name), kind: kind, argName: name, set: func(e sdfl.Expr) {
+					funCall.SetArg(name, e)
+				}})
+			}
+		case sdfl.AST_ARR_EXPR:
+			// the keys of animate are checked by Analyze
+			arr := expr.ArrExpr
+			kind := sdfl.ARG_SHAPE
+			switch sdfl.ExprKind(&expr) {
+			case sdfl.ARG_KEY_LIST:
+				kind = sdfl.ARG_ANY
+			case sdfl.ARG_EFFECT_LIST:
+				kind = sdfl.ARG_EFFECT
+			}
+			for i, e := range arr.Exprs {
+				i := i
+				path := fmt.Sprintf("%s[%d]", s.path, i)
+				if e.Type == sdfl.AST_FUN_CALL {
+					path += "." + e.FunCall.Id
+				}
+				visit(site{path: path, expr: e, kind: kind, list: arr, index: i, set: func(e sdfl.Expr) {
+					arr.Exprs[i] = e
+				}})
+			}
+		case sdfl.AST_BINOP_TERM:
+			binop := expr.BinopTerm
+			visit(site{path: s.path + ".left", expr: binop.Left, kind: sdfl.ARG_FLOAT, set: func(e sdfl.Expr) { binop.Left = e }})
+			visit(site{path: s.path + ".right", expr: binop.Right, kind: sdfl.ARG_FLOAT, set: func(e sdfl.Expr) { binop.Right = e }})
+		case sdfl.AST_BINOP_FACTOR:
+			binop := expr.BinopFactor
+			visit(site{path: s.path + ".left", expr: binop.Left, kind: sdfl.ARG_FLOAT, set: func(e sdfl.Expr) { binop.Left = e }})
+			visit(site{path: s.path + ".right", expr: binop.Right, kind: sdfl.ARG_FLOAT, set: func(e sdfl.Expr) { binop.Right = e }})
+		case sdfl.AST_BINOP_COMPARE:
+			binop := expr.BinopCompare
+			visit(site{path: s.path + ".left", expr: binop.Left, kind: sdfl.ARG_FLOAT, set: func(e sdfl.Expr) { binop.Left = e }})
+			visit(site{path: s.path + ".right", expr: binop.Right, kind: sdfl.ARG_FLOAT, set: func(e sdfl.Expr) { binop.Right = e }})
+		case sdfl.AST_BINOP_LOGIC:
+			binop := expr.BinopLogic
+			visit(site{path: s.path + ".left", expr: binop.Left, kind: sdfl.ARG_BOOL, set: func(e sdfl.Expr) { binop.Left = e }})
+			visit(site{path: s.path + ".right", expr: binop.Right, kind: sdfl.ARG_BOOL, set: func(e sdfl.Expr) { binop.Right = e }})
+		case sdfl.AST_UNOP_NOT:
+			unop := expr.UnopNot
+			visit(site{path: s.path + ".not", expr: unop.Expr, kind: sdfl.ARG_BOOL, set: func(e sdfl.Expr) { unop.Expr = e }})
+		case sdfl.AST_COND:
+			// both branches take the place of the conditional
+			cond := expr.Cond
+			visit(site{path: s.path + ".cond", expr: cond.Cond, kind: sdfl.ARG_BOOL, set: func(e sdfl.Expr) { cond.Cond = e }})
+			visit(site{path: s.path + ".then", expr: cond.Then, kind: s.kind, argName: s.argName, set: func(e sdfl.Expr) { cond.Then = e }})
+			visit(site{path: s.path + ".else", expr: cond.Else, kind: s.kind, argName: s.argName, set: func(e sdfl.Expr) { cond.Else = e }})
+		case sdfl.AST_VEC:
+			vec := expr.Vec
+			for i, e := range vec.Exprs {
+				i := i
+				visit(site{path: fmt.Sprintf("%s[%d]", s.path, i), expr: e, kind: sdfl.ARG_FLOAT, set: func(e sdfl.Expr) { vec.Exprs[i] = e }})
+			}
+		case sdfl.AST_FOR:
+			// the body is a list of shapes or keys like an array
+			loop := expr.For
+			body := sdfl.Expr{Type: sdfl.AST_ARR_EXPR, ArrExpr: &loop.Body}
+			visit(site{path: s.path + ".from", expr: loop.From, kind: sdfl.ARG_FLOAT, set: func(e sdfl.Expr) { loop.From = e }})
+			visit(site{path: s.path + ".to", expr: loop.To, kind: sdfl.ARG_FLOAT, set: func(e sdfl.Expr) { loop.To = e }})
+			visit(site{path: s.path + ".body", expr: body, kind: sdfl.ExprKind(&body), set: func(e sdfl.Expr) {
+				if e.Type == sdfl.AST_ARR_EXPR {
+					loop.Body = *e.ArrExpr
+				}
+			}})
+		}
+	}
+
+	for _, stmt := range prog.Stmts {
+		funDef := stmt.FunDef
+		if funDef == nil || funDef.Expr == nil {
+			continue
+		}
+		visit(site{path: funDef.Id, expr: *funDef.Expr, kind: sdfl.ARG_LOCAL, set: func(e sdfl.Expr) { *funDef.Expr = e }})
+	}
+	path := "scene"
+	if prog.Expr.Type == sdfl.AST_FUN_CALL {
+		path = prog.Expr.FunCall.Id
+	}
+	visit(site{path: path, expr: prog.Expr, kind: sdfl.ARG_SCENE, set: func(e sdfl.Expr) { prog.Expr = e }})
+	return sites
+}
+
+// typeCheck compares every call of prog with the signature of its function
+func typeCheck(prog *sdfl.Program) error {
+	// loop variables are numbers, the parameters of functions can be anything
+	params := map[string]bool{}
+	for _, stmt := range prog.Stmts {
+		if stmt.FunDef != nil {
+			for _, name := range stmt.FunDef.FunDefArgNames {
+				params[name] = true
+			}
+		}
+	}
+	for _, s := range collect(prog) {
+		if s.expr.Type == sdfl.AST_VAR && params[s.expr.Var.Name] {
+			continue
+		}
+		actual := sdfl.ExprKind(&s.expr)
+		if !sdfl.KindMatches(s.kind, actual) {
+			return fmt.Errorf("%s: expected %s, got %s", s.path, s.kind, actual)
+		}
+		if n, ok := sdfl.VectorLen(&s.expr); ok && s.kind == sdfl.ARG_VEC3 && n != 3 {
+			return fmt.Errorf("%s: expected 3 values, got %d", s.path, n)
+		}
+		if s.expr.Type != sdfl.AST_FUN_CALL {
+			continue
+		}
+
+		funCall := s.expr.FunCall
+		signature, ok := sdfl.Signature(funCall.Id)
+		if !ok {
+			return fmt.Errorf("%s: function %s is not defined", s.path, funCall.Id)
+		}
+		known := map[string]bool{}
+		for _, arg := range signature {
+			known[arg.Name] = true
+			if _, ok := funCall.Arg(arg.Name); !ok && !arg.Optional {
+				return fmt.Errorf("%s: missing argument %s", s.path, arg.Name)
+			}
+		}
+		for _, name := range sortedArgNames(funCall) {
+			if !known[name] {
+				return fmt.Errorf("%s: unknown argument %s", s.path, name)
+			}
+		}
+	}
+	return nil
+}
+
+// Check type-checks prog and compiles its formatted source, a program passing
+// it can be written out and loaded by the runtime
+func Check(prog sdfl.Program) (err error) {
+	if err := typeCheck(&prog); err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("compiler panic: %v", r)
+		}
+	}()
+
+	sdfl.ResetDiagnostics()
+	sdfl.InitRules()
+	parser := sdfl.NewParser(sdfl.Tokenize(sdfl.FormatProgram(prog)))
+	parsed := parser.Parse()
+	if parser.IsThereError() || sdfl.HasErrors() {
+		return fmt.Errorf("formatted source does not parse: %v", sdfl.GetDiagnostics())
+	}
+	if !sdfl.EqualAST(parsed, prog) {
+		return fmt.Errorf("formatted source parses to a different program")
+	}
+
+	sdfl.Analyze(&parsed)
+	sdfl.Reset()
+	sdfl.Generate(&parsed)
+	for _, d := range sdfl.GetDiagnostics() {
+		if d.Severity == sdfl.SEVERITY_ERROR {
+			return fmt.Errorf("%s", d.Message)
+		}
+	}
+	return nil
+}
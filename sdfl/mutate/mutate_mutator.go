@@ -0,0 +1,456 @@
+package mutate
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	sdfl "../sdfl"
+)
+
+// mutation operators
+//
+//   jitter  changes a number or tuple literal within a range fitting its argument
+//   swap    replaces a shape by another shape (or an operator by another operator)
+//           taking over the arguments both have in common
+//   wrap    puts a shape into a rotateAround, or combines it with a new shape
+//   prune   drops an element of a children list, or replaces an operator or
+//           rotateAround by one of its children
+
+type Change struct {
+	Op     string `json:"op"`
+	Path   string `json:"path"`
+	Detail string `json:"detail"`
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s %s: %s", c.Op, c.Path, c.Detail)
+}
+
+type Variant struct {
+	Program sdfl.Program
+	Changes []Change
+}
+
+type Mutator struct {
+	Mutations int     // changes applied to every variant
+	Jitter    float64 // relative size of literal changes
+	Attempts  int     // tries per variant before giving up
+	r         *rand.Rand
+}
+
+// New returns a mutator with the default settings, equal seeds give equal variants
+func New(seed int64) *Mutator {
+	return &Mutator{Mutations: 3, Jitter: 0.25, Attempts: 50, r: rand.New(rand.NewSource(seed))}
+}
+
+// literal ranges per argument name, positive values are scaled while the
+// others are moved by Jitter * scale (and clamped when max > min)
+type literalRange struct {
+	positive bool
+	scale    float64
+	min, max float64
+	decimals int
+}
+
+var argRanges = map[string]literalRange{
+	"radius":            {positive: true, decimals: 3},
+	"thickness":         {positive: true, decimals: 3},
+	"size":              {positive: true, decimals: 3},
+	"smooth_transition": {positive: true, decimals: 3},
+	"position":          {scale: 2, decimals: 3},
+	"begin":             {scale: 2, decimals: 3},
+	"end":               {scale: 2, decimals: 3},
+	"height":            {scale: 1, decimals: 3},
+	"rotation":          {scale: 90, decimals: 1},
+	"background":        {scale: 0.4, min: 0, max: 1, decimals: 3},
+}
+
+type operator struct {
+	name   string
+	weight int
+	apply  func(m *Mutator, sites []site) (Change, bool)
+}
+
+var operators = []operator{
+	{"jitter", 4, (*Mutator).jitter},
+	{"swap", 2, (*Mutator).swap},
+	{"wrap", 1, (*Mutator).wrap},
+	{"prune", 1, (*Mutator).prune},
+}
+
+// shape groups swaps stay in, computed from the builtin signatures
+var primitives, combinators []string
+
+func initGroups() {
+	if primitives != nil {
+		return
+	}
+	for _, id := range sdfl.BuiltinFunctions() {
+		if sdfl.ReturnKind(id) != sdfl.ARG_SHAPE {
+			continue
+		}
+		kinds := argKinds(id)
+		if kinds["child1"] == sdfl.ARG_SHAPE && kinds["child2"] == sdfl.ARG_SHAPE {
+			combinators = append(combinators, id)
+			continue
+		}
+		hasShape := false
+		for _, kind := range kinds {
+			hasShape = hasShape || kind == sdfl.ARG_SHAPE
+		}
+		if !hasShape {
+			primitives = append(primitives, id)
+		}
+	}
+}
+
+func (m *Mutator) pick(sites []site) site {
+	return sites[m.r.Intn(len(sites))]
+}
+
+func (m *Mutator) round(v float64, decimals int) string {
+	p := math.Pow(10, float64(decimals))
+	v = math.Round(v*p) / p
+	if v == 0 {
+		v = 0 // no -0
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// jitterValue moves v within the range of argName, outside of arguments (in
+// operators) the value is scaled, keeping its sign
+func (m *Mutator) jitterValue(value string, argName string) string {
+	v, err := sdfl.ParseNumberLiteral(value)
+	if err != nil {
+		return value
+	}
+	rng, ok := argRanges[argName]
+	if !ok {
+		rng = literalRange{positive: true, decimals: 3}
+	}
+
+	if rng.positive {
+		if v == 0 {
+			v = m.r.NormFloat64() * m.Jitter
+		} else {
+			v *= math.Exp(m.r.NormFloat64() * m.Jitter)
+		}
+		if ok && v < 0.01 {
+			v = 0.01
+		}
+	} else {
+		v += m.r.NormFloat64() * m.Jitter * rng.scale
+		if rng.max > rng.min {
+			v = math.Max(rng.min, math.Min(rng.max, v))
+		}
+	}
+	return m.round(v, rng.decimals)
+}
+
+func (m *Mutator) jitter(sites []site) (Change, bool) {
+	literals := []site{}
+	for _, s := range sites {
+		if s.expr.Type == sdfl.AST_NUMBER || s.expr.Type == sdfl.AST_TUPLE {
+			literals = append(literals, s)
+		}
+	}
+	if len(literals) == 0 {
+		return Change{}, false
+	}
+
+	s := m.pick(literals)
+	if s.expr.Type == sdfl.AST_NUMBER {
+		before := s.expr.Number.Value
+		s.expr.Number.Value = m.jitterValue(before, s.argName)
+		return Change{"jitter", s.path, before + " -> " + s.expr.Number.Value}, true
+	}
+	before := "(" + strings.Join(s.expr.Tuple.Values, ", ") + ")"
+	for i, value := range s.expr.Tuple.Values {
+		s.expr.Tuple.Values[i] = m.jitterValue(value, s.argName)
+	}
+	return Change{"jitter", s.path, before + " -> (" + strings.Join(s.expr.Tuple.Values, ", ") + ")"}, true
+}
+
+func contains(ids []string, id string) bool {
+	for _, other := range ids {
+		if other == id {
+			return true
+		}
+	}
+	return false
+}
+
+// convertArg adapts the value of an argument to another kind where that is
+// obvious: a float radius becomes an equal vec3 radius and the other way round
+func convertArg(expr sdfl.Expr, kind sdfl.ArgKind) (sdfl.Expr, bool) {
+	actual := sdfl.ExprKind(&expr)
+	if kind == sdfl.ARG_ANY || actual == kind {
+		return expr, true
+	}
+	if kind == sdfl.ARG_VEC3 && expr.Type == sdfl.AST_NUMBER {
+		v := expr.Number.Value
+		return sdfl.Expr{Type: sdfl.AST_TUPLE, Tuple: &sdfl.Tuple{Values: []string{v, v, v}}}, true
+	}
+	if kind == sdfl.ARG_FLOAT && expr.Type == sdfl.AST_TUPLE && len(expr.Tuple.Values) > 0 {
+		return sdfl.Expr{Type: sdfl.AST_NUMBER, Number: &sdfl.Number{Value: expr.Tuple.Values[0]}}, true
+	}
+	return expr, false
+}
+
+// argsInCommon counts the arguments of to that can be taken over from a call to from
+func argsInCommon(from string, to string) int {
+	fromKinds, count := argKinds(from), 0
+	for name, kind := range argKinds(to) {
+		if fromKind, ok := fromKinds[name]; ok && (fromKind == kind || kind != sdfl.ARG_SHAPE && fromKind != sdfl.ARG_SHAPE) {
+			count++
+		}
+	}
+	return count
+}
+
+// sameArgs returns a call to funId with the arguments of funCall it can use,
+// the others get their default value
+func sameArgs(funCall *sdfl.FunCall, funId string) sdfl.Expr {
+	call := sdfl.DefaultCall(funId)
+	signature, _ := sdfl.Signature(funId)
+	aliases := map[string]string{"position": "begin", "begin": "position"}
+	for _, arg := range signature {
+		old, ok := funCall.Arg(arg.Name)
+		if !ok {
+			old, ok = funCall.Arg(aliases[arg.Name])
+		}
+		if !ok {
+			continue
+		}
+		if expr, ok := convertArg(old.Expr, arg.Kind); ok {
+			call.FunCall.SetArg(arg.Name, expr)
+		}
+	}
+	return call
+}
+
+func (m *Mutator) swap(sites []site) (Change, bool) {
+	initGroups()
+	type swap struct {
+		s  site
+		to []string
+	}
+	swaps := []swap{}
+	for _, s := range sites {
+		if s.expr.Type != sdfl.AST_FUN_CALL {
+			continue
+		}
+		id := s.expr.FunCall.Id
+		group := primitives
+		if contains(combinators, id) {
+			group = combinators
+		} else if !contains(primitives, id) {
+			continue
+		}
+		to := []string{}
+		for _, other := range group {
+			if other != id && argsInCommon(id, other) > 0 {
+				to = append(to, other)
+			}
+		}
+		if len(to) > 0 {
+			swaps = append(swaps, swap{s, to})
+		}
+	}
+	if len(swaps) == 0 {
+		return Change{}, false
+	}
+
+	sw := swaps[m.r.Intn(len(swaps))]
+	to := sw.to[m.r.Intn(len(sw.to))]
+	sw.s.set(sameArgs(sw.s.expr.FunCall, to))
+	return Change{"swap", sw.s.path, sw.s.expr.FunCall.Id + " -> " + to}, true
+}
+
+// center is the position argument of a shape, or the origin for conditional shapes
+func center(funCall *sdfl.FunCall) []float64 {
+	if funCall == nil {
+		return []float64{0, 0, 0}
+	}
+	for _, name := range []string{"position", "begin"} {
+		if arg, ok := funCall.Arg(name); ok && arg.Expr.Type == sdfl.AST_TUPLE && len(arg.Expr.Tuple.Values) == 3 {
+			c := []float64{}
+			for _, value := range arg.Expr.Tuple.Values {
+				v, err := sdfl.ParseNumberLiteral(value)
+				if err != nil {
+					return []float64{0, 0, 0}
+				}
+				c = append(c, v)
+			}
+			return c
+		}
+	}
+	return []float64{0, 0, 0}
+}
+
+func (m *Mutator) tuple(values ...float64) sdfl.Expr {
+	strs := []string{}
+	for _, v := range values {
+		strs = append(strs, m.round(v, 3))
+	}
+	return sdfl.Expr{Type: sdfl.AST_TUPLE, Tuple: &sdfl.Tuple{Values: strs}}
+}
+
+func setArg(call sdfl.Expr, name string, expr sdfl.Expr) {
+	call.FunCall.SetArg(name, expr)
+}
+
+func (m *Mutator) wrap(sites []site) (Change, bool) {
+	initGroups()
+	shapes := []site{}
+	for _, s := range sites {
+		if s.kind == sdfl.ARG_SHAPE && sdfl.ExprKind(&s.expr) == sdfl.ARG_SHAPE {
+			shapes = append(shapes, s)
+		}
+	}
+	if len(shapes) == 0 {
+		return Change{}, false
+	}
+
+	s := m.pick(shapes)
+	c := center(s.expr.FunCall)
+
+	if m.r.Intn(2) == 0 {
+		rotation := []float64{0, 0, 0}
+		rotation[m.r.Intn(3)] = float64(m.r.Intn(12)+1) * 30
+		wrapper := sdfl.DefaultCall("rotateAround")
+		setArg(wrapper, "position", m.tuple(c...))
+		setArg(wrapper, "rotation", m.tuple(rotation...))
+		setArg(wrapper, "child", s.expr)
+		s.set(wrapper)
+		return Change{"wrap", s.path, fmt.Sprintf("rotateAround by (%g, %g, %g)", rotation[0], rotation[1], rotation[2])}, true
+	}
+
+	// combine with a new shape next to the old one
+	shapes2 := []string{}
+	for _, id := range primitives {
+		if _, ok := argKinds(id)["position"]; ok {
+			shapes2 = append(shapes2, id)
+		}
+	}
+	if len(shapes2) == 0 || len(combinators) == 0 {
+		return Change{}, false
+	}
+	shapeId := shapes2[m.r.Intn(len(shapes2))]
+	shape := sdfl.DefaultCall(shapeId)
+	offset := []float64{}
+	for _, v := range c {
+		offset = append(offset, v+m.r.NormFloat64()*0.5)
+	}
+	setArg(shape, "position", m.tuple(offset...))
+
+	opId := combinators[m.r.Intn(len(combinators))]
+	op := sdfl.DefaultCall(opId)
+	setArg(op, "child1", s.expr)
+	setArg(op, "child2", shape)
+	if _, ok := op.FunCall.Arg("smooth_transition"); ok {
+		setArg(op, "smooth_transition", sdfl.Expr{Type: sdfl.AST_NUMBER, Number: &sdfl.Number{Value: m.round(0.1+m.r.Float64()*0.7, 3)}})
+	}
+	s.set(op)
+	return Change{"wrap", s.path, opId + " with " + shapeId}, true
+}
+
+func (m *Mutator) prune(sites []site) (Change, bool) {
+	initGroups()
+	prunable := []site{}
+	for _, s := range sites {
+		if s.list != nil && len(s.list.Exprs) > 1 {
+			prunable = append(prunable, s)
+		} else if s.expr.Type == sdfl.AST_FUN_CALL && (contains(combinators, s.expr.FunCall.Id) || s.expr.FunCall.Id == "rotateAround") {
+			prunable = append(prunable, s)
+		}
+	}
+	if len(prunable) == 0 {
+		return Change{}, false
+	}
+
+	s := m.pick(prunable)
+	replaceable := s.expr.Type == sdfl.AST_FUN_CALL && (contains(combinators, s.expr.FunCall.Id) || s.expr.FunCall.Id == "rotateAround")
+	if s.list != nil && len(s.list.Exprs) > 1 && (!replaceable || m.r.Intn(2) == 0) {
+		s.list.Exprs = append(s.list.Exprs[:s.index:s.index], s.list.Exprs[s.index+1:]...)
+		return Change{"prune", s.path, "removed"}, true
+	}
+
+	child := "child"
+	if s.expr.FunCall.Id != "rotateAround" {
+		child = []string{"child1", "child2"}[m.r.Intn(2)]
+	}
+	arg, ok := s.expr.FunCall.Arg(child)
+	if !ok {
+		return Change{}, false
+	}
+	s.set(arg.Expr)
+	return Change{"prune", s.path, "replaced by " + child}, true
+}
+
+// apply makes one random change to prog
+func (m *Mutator) apply(prog *sdfl.Program) (Change, bool) {
+	total := 0
+	for _, op := range operators {
+		total += op.weight
+	}
+	pick := m.r.Intn(total)
+	for _, op := range operators {
+		pick -= op.weight
+		if pick < 0 {
+			return op.apply(m, collect(prog))
+		}
+	}
+	return Change{}, false
+}
+
+// Mutate returns a changed copy of prog which passes Check
+func (m *Mutator) Mutate(prog sdfl.Program) (Variant, error) {
+	for attempt := 0; attempt < m.Attempts; attempt++ {
+		mutated := sdfl.CopyProgram(prog)
+		changes := []Change{}
+		for tries := 0; len(changes) < m.Mutations && tries < 10*m.Mutations; tries++ {
+			if change, ok := m.apply(&mutated); ok {
+				changes = append(changes, change)
+			}
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		if err := Check(mutated); err != nil {
+			sdfl.Debugf("variant rejected: %v", err)
+			continue
+		}
+		return Variant{Program: mutated, Changes: changes}, nil
+	}
+	return Variant{}, fmt.Errorf("no valid variant after %d attempts", m.Attempts)
+}
+
+// Variants returns n variants of prog which differ from prog and from each other
+func (m *Mutator) Variants(prog sdfl.Program, n int) ([]Variant, error) {
+	if err := Check(prog); err != nil {
+		return nil, fmt.Errorf("the input does not compile: %v", err)
+	}
+
+	seen := map[string]bool{sdfl.CanonicalHash(prog): true}
+	variants := []Variant{}
+	for tries := 0; len(variants) < n && tries < m.Attempts*n; tries++ {
+		variant, err := m.Mutate(prog)
+		if err != nil {
+			return variants, err
+		}
+		hash := sdfl.CanonicalHash(variant.Program)
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		variants = append(variants, variant)
+	}
+	if len(variants) < n {
+		return variants, fmt.Errorf("only %d distinct variants found", len(variants))
+	}
+	return variants, nil
+}
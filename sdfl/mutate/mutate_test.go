@@ -0,0 +1,137 @@
+package mutate
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	sdfl "../sdfl"
+)
+
+// parseScene parses src like sdflc mutate loads its input
+func parseScene(t *testing.T, src string) sdfl.Program {
+	t.Helper()
+	sdfl.ResetDiagnostics()
+	sdfl.InitRules()
+	parser := sdfl.NewParser(sdfl.Tokenize(src))
+	prog := parser.Parse()
+	if parser.IsThereError() || sdfl.HasErrors() {
+		t.Fatalf("parse: %v", sdfl.GetDiagnostics())
+	}
+	return prog
+}
+
+func parseFile(t *testing.T, name string) sdfl.Program {
+	t.Helper()
+	src, err := os.ReadFile("../sdfl/testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parseScene(t, string(src))
+}
+
+// sources formats variants, with their changes
+func sources(variants []Variant) []string {
+	formatted := []string{}
+	for _, variant := range variants {
+		changes := []string{}
+		for _, change := range variant.Changes {
+			changes = append(changes, change.String())
+		}
+		formatted = append(formatted, strings.Join(changes, "\n")+"\n"+sdfl.FormatProgram(variant.Program))
+	}
+	return formatted
+}
+
+func TestVariantsReproducible(t *testing.T) {
+	prog := parseFile(t, "reflections.sdfl")
+	first, err := New(7).Variants(prog, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := New(7).Variants(prog, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sources(first), sources(second)) {
+		t.Errorf("the same seed gives other variants")
+	}
+	other, err := New(8).Variants(prog, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(sources(first), sources(other)) {
+		t.Errorf("another seed gives the same variants")
+	}
+}
+
+func TestVariantsCompile(t *testing.T) {
+	for _, name := range []string{"features.sdfl", "reflections.sdfl"} {
+		prog := parseFile(t, name)
+		input := sdfl.FormatProgram(prog)
+		variants, err := New(1).Variants(prog, 5)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if sdfl.FormatProgram(prog) != input {
+			t.Errorf("%s: the mutator changed its input", name)
+		}
+		seen := map[string]bool{sdfl.CanonicalHash(prog): true}
+		for i, variant := range variants {
+			if len(variant.Changes) == 0 {
+				t.Errorf("%s: variant %d has no changes", name, i)
+			}
+			if hash := sdfl.CanonicalHash(variant.Program); seen[hash] {
+				t.Errorf("%s: variant %d is not new", name, i)
+			} else {
+				seen[hash] = true
+			}
+			// the source written out compiles on its own
+			src := sdfl.FormatProgram(variant.Program)
+			reparsed := parseScene(t, src)
+			sdfl.Analyze(&reparsed)
+			if sdfl.HasErrors() {
+				t.Errorf("%s: variant %d: %v\n%s", name, i, sdfl.GetDiagnostics(), src)
+			}
+		}
+	}
+}
+
+func TestCheckRejects(t *testing.T) {
+	// each case breaks the first site of a kind, like a faulty mutation would
+	for _, tc := range []struct {
+		name string
+		kind sdfl.ArgKind
+		arg  string // argument of the site, empty for any
+		with string // expression put at the site
+		want string // part of the error
+	}{
+		{"tuple for a float", sdfl.ARG_FLOAT, "", "(1, 2, 3)", "expected"},
+		{"number for a shape", sdfl.ARG_SHAPE, "", "1", "expected"},
+		{"short vector", sdfl.ARG_VEC3, "", "(1, 2)", "expected 3 values"},
+		{"unknown function", sdfl.ARG_SHAPE, "", "pebble()", "is not defined"},
+		{"unknown argument", sdfl.ARG_SHAPE, "", "sphere(bogus: 1)", "unknown argument bogus"},
+		{"division by zero", sdfl.ARG_FLOAT, "radius", "1 / 0", "division by zero"},
+	} {
+		prog := parseFile(t, "reflections.sdfl")
+		if err := Check(prog); err != nil {
+			t.Fatalf("the input does not pass: %v", err)
+		}
+		replacement := parseScene(t, tc.with).Expr
+		found := false
+		for _, s := range collect(&prog) {
+			if s.kind == tc.kind && (tc.arg == "" || s.argName == tc.arg) && s.set != nil {
+				s.set(replacement)
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("%s: no site of kind %s", tc.name, tc.kind)
+		}
+		if err := Check(prog); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: Check returned %v, want an error with %q", tc.name, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	sdfl "../sdfl"
+)
+
+// Animation describes the frames of an animated scene, frame i shows the scene at i / FPS seconds
+type Animation struct {
+	Width    int
+	Height   int
+	FPS      float64
+	Duration float64 // in seconds
+	Workers  int     // frames rendered at once
+}
+
+func (anim *Animation) FrameCount() int {
+	return int(math.Max(1, math.Round(anim.Duration*anim.FPS)))
+}
+
+func (anim *Animation) FrameTime(i int) float64 {
+	return float64(i) / anim.FPS
+}
+
+// Render renders the frames of scene in parallel and passes each to done,
+// which is called by the workers at the same time and in no particular order
+func (anim *Animation) Render(scene *sdfl.SceneEval, done func(i int, img *image.RGBA) error) error {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var firstErr error
+
+	workers := anim.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				err := done(i, Frame(scene, anim.Width, anim.Height, anim.FrameTime(i)))
+				if err != nil {
+					lock.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					lock.Unlock()
+				}
+			}
+		}()
+	}
+	for i := 0; i < anim.FrameCount(); i++ {
+		lock.Lock()
+		failed := firstErr != nil
+		lock.Unlock()
+		if failed {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return firstErr
+}
+
+// Format is how the frames of an animation are written
+type Format int
+
+const (
+	FORMAT_FRAMES Format = iota // one PNG per frame
+	FORMAT_GIF
+	FORMAT_APNG
+)
+
+// OutputFormat picks the format of an output path: a printf pattern like
+// frames/%04d.png is a sequence of PNGs, .gif an animated GIF and .png or .apng an animated PNG
+func OutputFormat(path string) (Format, error) {
+	if strings.Contains(path, "%") {
+		return FORMAT_FRAMES, nil
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gif":
+		return FORMAT_GIF, nil
+	case ".png", ".apng":
+		return FORMAT_APNG, nil
+	}
+	return 0, fmt.Errorf("unknown output format of %s (expected a pattern like frames/%%04d.png, .gif, .png or .apng)", path)
+}
+
+// Write renders scene and writes its frames to path in the format of the path
+func (anim *Animation) Write(scene *sdfl.SceneEval, path string) error {
+	format, err := OutputFormat(path)
+	if err != nil {
+		return err
+	}
+	if format == FORMAT_FRAMES {
+		return anim.Render(scene, func(i int, img *image.RGBA) error {
+			return writePNG(fmt.Sprintf(path, i), img)
+		})
+	}
+
+	// animated files need all frames at once
+	frames := make([]*image.RGBA, anim.FrameCount())
+	err = anim.Render(scene, func(i int, img *image.RGBA) error {
+		frames[i] = img
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if format == FORMAT_GIF {
+		err = EncodeGIF(file, frames, anim.FPS)
+	} else {
+		err = EncodeAPNG(file, frames, anim.FPS)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func writePNG(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(file, img)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// EncodeGIF writes frames as an endlessly looping GIF, the colors are
+// dithered to the Plan 9 palette as GIF frames have at most 256 of them
+func EncodeGIF(w io.Writer, frames []*image.RGBA, fps float64) error {
+	// GIF delays are in hundredths of a second
+	delay := int(math.Max(1, math.Round(100/fps)))
+	anim := &gif.GIF{}
+	for _, img := range frames {
+		paletted := image.NewPaletted(img.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, img.Bounds(), img, image.Point{})
+		anim.Image = append(anim.Image, paletted)
+		anim.Delay = append(anim.Delay, delay)
+	}
+	return gif.EncodeAll(w, anim)
+}
@@ -0,0 +1,196 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	sdfl "../sdfl"
+)
+
+// the sphere moves from the left to the right, the two frames differ
+const movingScene = `scene(
+  camera: camera(position: (0, 0, 5)),
+  children: [sphere(position: (4 * time() - 2, 0, 0), radius: 1.5)]
+)`
+
+// tinyAnimation compiles the moving scene and renders its frames the way Write would
+func tinyAnimation(t *testing.T) (*Animation, *sdfl.SceneEval, []*image.RGBA) {
+	t.Helper()
+	sdfl.ResetDiagnostics()
+	sdfl.InitRules()
+	parser := sdfl.NewParser(sdfl.Tokenize(movingScene))
+	prog := parser.Parse()
+	if parser.IsThereError() || sdfl.HasErrors() {
+		t.Fatalf("parse: %v", sdfl.GetDiagnostics())
+	}
+	sdfl.Analyze(&prog)
+	scene := sdfl.CompileEval(&prog)
+	if sdfl.HasErrors() {
+		t.Fatalf("compile: %v", sdfl.GetDiagnostics())
+	}
+
+	anim := &Animation{Width: 12, Height: 8, FPS: 1, Duration: 2, Workers: 2}
+	if anim.FrameCount() != 2 {
+		t.Fatalf("%d frames, want 2", anim.FrameCount())
+	}
+	frames := []*image.RGBA{}
+	for i := 0; i < anim.FrameCount(); i++ {
+		frames = append(frames, Frame(scene, anim.Width, anim.Height, anim.FrameTime(i)))
+	}
+	if distance(frames[0], frames[1]) == 0 {
+		t.Fatalf("the frames of the moving scene are equal")
+	}
+	return anim, scene, frames
+}
+
+// distance is the mean difference of the color channels of two images
+func distance(a image.Image, b image.Image) float64 {
+	sum, n := 0.0, 0
+	bounds := a.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r1, g1, b1, _ := a.At(x, y).RGBA()
+			r2, g2, b2, _ := b.At(x, y).RGBA()
+			sum += math.Abs(float64(r1)-float64(r2)) + math.Abs(float64(g1)-float64(g2)) + math.Abs(float64(b1)-float64(b2))
+			n += 3
+		}
+	}
+	return sum / float64(n)
+}
+
+// closest is the index of the frame img is most like
+func closest(img image.Image, frames []*image.RGBA) int {
+	best := 0
+	for i := range frames {
+		if distance(img, frames[i]) < distance(img, frames[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+func TestWriteFrames(t *testing.T) {
+	anim, scene, frames := tinyAnimation(t)
+	dir := t.TempDir()
+	if err := anim.Write(scene, filepath.Join(dir, "frames", "%02d.png")); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range frames {
+		file, err := os.Open(filepath.Join(dir, "frames", fmt.Sprintf("%02d.png", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(file)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := distance(img, want); d != 0 {
+			t.Errorf("frame %d differs from the scene at %gs by %g", i, anim.FrameTime(i), d)
+		}
+	}
+}
+
+func TestWriteGIF(t *testing.T) {
+	anim, scene, frames := tinyAnimation(t)
+	path := filepath.Join(t.TempDir(), "anim.gif")
+	if err := anim.Write(scene, path); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	decoded, err := gif.DecodeAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Image) != len(frames) {
+		t.Fatalf("%d frames, want %d", len(decoded.Image), len(frames))
+	}
+	if decoded.LoopCount != 0 {
+		t.Errorf("loop count %d, want 0 to loop forever", decoded.LoopCount)
+	}
+	for i, img := range decoded.Image {
+		if size := img.Bounds().Size(); size != image.Pt(anim.Width, anim.Height) {
+			t.Errorf("frame %d is %v, want %dx%d", i, size, anim.Width, anim.Height)
+		}
+		if decoded.Delay[i] != 100 {
+			t.Errorf("frame %d is shown %d/100s, want 100", i, decoded.Delay[i])
+		}
+		// the colors are dithered, the frame is still most like its own
+		if j := closest(img, frames); j != i {
+			t.Errorf("frame %d shows frame %d", i, j)
+		}
+	}
+}
+
+func TestWriteAPNG(t *testing.T) {
+	anim, scene, frames := tinyAnimation(t)
+	path := filepath.Join(t.TempDir(), "anim.png")
+	if err := anim.Write(scene, path); err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := pngChunks(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var header []byte
+	controls := 0
+	data := [][]byte{} // the image data of each frame, in the order of the file
+	for _, chunk := range chunks {
+		switch chunk.Type {
+		case "IHDR":
+			header = chunk.Data
+		case "acTL":
+			if n := binary.BigEndian.Uint32(chunk.Data); int(n) != len(frames) {
+				t.Errorf("acTL has %d frames, want %d", n, len(frames))
+			}
+		case "fcTL":
+			controls++
+			data = append(data, nil)
+			if w, h := binary.BigEndian.Uint32(chunk.Data[4:]), binary.BigEndian.Uint32(chunk.Data[8:]); int(w) != anim.Width || int(h) != anim.Height {
+				t.Errorf("fcTL of frame %d is %dx%d, want %dx%d", controls-1, w, h, anim.Width, anim.Height)
+			}
+		case "IDAT":
+			data[len(data)-1] = append(data[len(data)-1], chunk.Data...)
+		case "fdAT":
+			data[len(data)-1] = append(data[len(data)-1], chunk.Data[4:]...)
+		}
+	}
+	if controls != len(frames) {
+		t.Fatalf("%d fcTL chunks, want %d", controls, len(frames))
+	}
+
+	// every frame is a still PNG of its own with the header of the animation
+	for i, want := range frames {
+		var still bytes.Buffer
+		still.Write(pngSignature)
+		for _, chunk := range []pngChunk{{"IHDR", header}, {"IDAT", data[i]}, {"IEND", nil}} {
+			if err := writePNGChunk(&still, chunk.Type, chunk.Data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		img, err := png.Decode(&still)
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if d := distance(img, want); d != 0 {
+			t.Errorf("frame %d differs from the scene at %gs by %g", i, anim.FrameTime(i), d)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"math"
+)
+
+// animated PNG
+//
+// image/png only writes still images. Every frame is encoded on its own and
+// its image data moved into the animation: the IDAT chunks of the first frame
+// stay as they are, the ones of the other frames become fdAT chunks. Each
+// frame is preceded by an fcTL chunk with its delay, the frames cover the
+// whole image and replace the previous one.
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+type pngChunk struct {
+	Type string
+	Data []byte
+}
+
+// pngChunks splits an encoded PNG into its chunks
+func pngChunks(encoded []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(encoded, pngSignature) {
+		return nil, fmt.Errorf("not a PNG")
+	}
+	chunks := []pngChunk{}
+	rest := encoded[len(pngSignature):]
+	for len(rest) >= 12 {
+		length := int(binary.BigEndian.Uint32(rest[:4]))
+		if len(rest) < 12+length {
+			return nil, fmt.Errorf("truncated PNG chunk")
+		}
+		chunks = append(chunks, pngChunk{Type: string(rest[4:8]), Data: rest[8 : 8+length]})
+		rest = rest[12+length:]
+	}
+	return chunks, nil
+}
+
+func writePNGChunk(w io.Writer, chunkType string, data []byte) error {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header[:4], uint32(len(data)))
+	copy(header[4:], chunkType)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	footer := make([]byte, 4)
+	binary.BigEndian.PutUint32(footer, crc.Sum32())
+
+	for _, b := range [][]byte{header, data, footer} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EncodeAPNG writes frames as an endlessly looping animated PNG, all frames have the size of the first one
+func EncodeAPNG(w io.Writer, frames []*image.RGBA, fps float64) error {
+	if len(frames) == 0 {
+		return fmt.Errorf("no frames")
+	}
+	// the delay is a fraction of a second of two 16 bit numbers
+	delayNum, delayDen := uint16(100), uint16(math.Min(math.Round(fps*100), math.MaxUint16))
+	bounds := frames[0].Bounds()
+
+	if _, err := w.Write(pngSignature); err != nil {
+		return err
+	}
+	var header []byte
+	sequence := uint32(0)
+	for i, img := range frames {
+		if img.Bounds() != bounds {
+			return fmt.Errorf("frame %d is %v, the animation is %v", i, img.Bounds().Size(), bounds.Size())
+		}
+		var encoded bytes.Buffer
+		if err := png.Encode(&encoded, img); err != nil {
+			return err
+		}
+		chunks, err := pngChunks(encoded.Bytes())
+		if err != nil {
+			return err
+		}
+
+		if i == 0 {
+			header = chunks[0].Data
+			if err := writePNGChunk(w, "IHDR", header); err != nil {
+				return err
+			}
+			actl := make([]byte, 8)
+			binary.BigEndian.PutUint32(actl[:4], uint32(len(frames)))
+			// 0 plays loop forever
+			if err := writePNGChunk(w, "acTL", actl); err != nil {
+				return err
+			}
+		} else if !bytes.Equal(chunks[0].Data, header) {
+			// image/png picks the color type from the pixels, an opaque frame among transparent ones would differ
+			return fmt.Errorf("frame %d is encoded differently than the first one", i)
+		}
+
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl[0:], sequence)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(bounds.Dx()))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(bounds.Dy()))
+		binary.BigEndian.PutUint16(fctl[20:], delayNum)
+		binary.BigEndian.PutUint16(fctl[22:], delayDen)
+		// offsets, dispose and blend operations stay 0: at the origin, keep the frame, replace the pixels
+		sequence++
+		if err := writePNGChunk(w, "fcTL", fctl); err != nil {
+			return err
+		}
+
+		for _, chunk := range chunks {
+			if chunk.Type != "IDAT" {
+				continue
+			}
+			if i == 0 {
+				err = writePNGChunk(w, "IDAT", chunk.Data)
+			} else {
+				data := make([]byte, 4, 4+len(chunk.Data))
+				binary.BigEndian.PutUint32(data, sequence)
+				sequence++
+				err = writePNGChunk(w, "fdAT", append(data, chunk.Data...))
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return writePNGChunk(w, "IEND", nil)
+}
@@ -0,0 +1,192 @@
+// Package render draws compiled scenes on the CPU the way the generated
+// fragment shader does in its normal render mode, for previews on machines
+// without OpenGL.
+package render
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	sdfl "../sdfl"
+)
+
+// SDFL_MAX_STEPS, SDFL_HIT_DISTANCE and SDFL_SHADOW_CAST_DISTANCE of the
+// fragment shader and the samples its ambient occlusion takes at most
+const (
+	MAX_STEPS             = 100
+	HIT_DISTANCE          = .01
+	SHADOW_CAST_DISTANCE  = .05
+	MAX_OCCLUSION_SAMPLES = 16
+)
+
+var (
+	lightPos   = vec3{0, 8, 8}
+	lightColor = vec3{1.0, 0.95, 0.8}
+)
+
+type vec3 = [3]float64
+
+// frame is one image of a scene at a time
+type frame struct {
+	scene  *sdfl.SceneEval
+	time   float64
+	camera vec3
+}
+
+func (f *frame) dist(p vec3) sdfl.SceneSample {
+	return f.scene.Distance(p, f.time)
+}
+
+// Frame renders scene at time t in seconds, time() is bound to t
+func Frame(scene *sdfl.SceneEval, width int, height int, t float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	f := &frame{scene: scene, time: t, camera: scene.Camera(t)}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// o_vertex_uv goes up, the rows of the image go down
+			u := (float64(x)+0.5)/float64(width)*2 - 1
+			v := 1 - (float64(y)+0.5)/float64(height)*2
+			img.SetRGBA(x, y, toRGBA(f.color(u, v*float64(height)/float64(width))))
+		}
+	}
+	return img
+}
+
+// color is calc_color of the fragment shader, uv already corrected for the aspect ratio
+func (f *frame) color(u float64, v float64) vec3 {
+	dir := normalize(vec3{u, v, -1})
+	distance, materialId := f.rayMarch(f.camera, dir)
+	var c vec3
+	if distance < sdfl.MAX_DISTANCE {
+		p := add(f.camera, scale(dir, distance))
+		if f.scene.Bounces > 0 {
+			c = f.trace(p, dir, sdfl.MaterialById(materialId))
+		} else {
+			c = f.lighting(p, scale(dir, -1), sdfl.MaterialById(materialId))
+		}
+	} else {
+		// background/sky
+		c = f.sky(v)
+	}
+	return f.post(c, dir, distance, u, v)
+}
+
+// sky is the background at the height h of the screen or of a ray direction
+func (f *frame) sky(h float64) vec3 {
+	bg := f.scene.Background
+	h = h*0.5 + 0.5
+	return vec3{mix(0.5, bg[0], h), mix(0.7, bg[1], h), mix(1.0, bg[2], h)}
+}
+
+func (f *frame) rayMarch(origin vec3, dir vec3) (float64, int) {
+	dfo := 0.0
+	materialId := 0
+	for i := 0; i < MAX_STEPS; i++ {
+		s := f.dist(add(origin, scale(dir, dfo)))
+		dfo += s.Distance
+		materialId = s.MaterialId
+		if dfo > sdfl.MAX_DISTANCE || s.Distance < HIT_DISTANCE {
+			break
+		}
+	}
+	return dfo, materialId
+}
+
+func (f *frame) normal(p vec3) vec3 {
+	d := f.dist(p).Distance
+	return normalize(vec3{
+		d - f.dist(vec3{p[0] - .01, p[1], p[2]}).Distance,
+		d - f.dist(vec3{p[0], p[1] - .01, p[2]}).Distance,
+		d - f.dist(vec3{p[0], p[1], p[2] - .01}).Distance,
+	})
+}
+
+func (f *frame) shadow(p vec3, lightDir vec3, lightDistance float64) float64 {
+	shadow := 1.0
+	start := add(p, scale(f.normal(p), SHADOW_CAST_DISTANCE))
+	t := 0.0
+	for i := 0; i < 32; i++ {
+		d := f.dist(add(start, scale(lightDir, t))).Distance
+		if d < 0 {
+			return 0.1 // hard shadow
+		}
+		// soft shadow, the NaN of 0 / 0 in the first step is ignored
+		if s := 10.0 * d / t; s < shadow {
+			shadow = s
+		}
+		t += d
+		if t >= lightDistance {
+			break
+		}
+	}
+	return math.Min(math.Max(shadow, 0.1), 1)
+}
+
+func (f *frame) lighting(p vec3, viewDir vec3, mat sdfl.Material) vec3 {
+	toLight := sub(lightPos, p)
+	lightDistance := length(toLight)
+	lightDir := normalize(toLight)
+	normal := f.normal(p)
+	halfDir := normalize(add(lightDir, viewDir))
+	lightIntensity := 2.0
+	attenuation := 1.0 / (1.0 + 0.1*lightDistance + 0.01*lightDistance*lightDistance)
+
+	ndotl := math.Max(dot(normal, lightDir), 0)
+	ndoth := math.Max(dot(normal, halfDir), 0)
+	roughness2 := mat.Roughness * mat.Roughness
+	specPower := 2.0/(roughness2*roughness2) - 2.0
+	specular := math.Pow(ndoth, specPower) * lightIntensity * attenuation
+	shadow := f.shadow(p, lightDir, lightDistance)
+
+	color := vec3{}
+	for i := 0; i < 3; i++ {
+		diffuse := mat.Albedo[i] * lightColor[i] * ndotl * lightIntensity * attenuation
+		fresnel := mix(0.04, mat.Albedo[i], mat.Metallic)
+		ambient := mat.Albedo[i] * 0.1
+		color[i] = ambient + (diffuse+fresnel*lightColor[i]*specular)*shadow + mat.Emission[i]
+	}
+	return color
+}
+
+func toRGBA(c vec3) color.RGBA {
+	channel := func(v float64) uint8 {
+		if math.IsNaN(v) {
+			return 0
+		}
+		return uint8(math.Round(math.Min(math.Max(v, 0), 1) * 255))
+	}
+	return color.RGBA{R: channel(c[0]), G: channel(c[1]), B: channel(c[2]), A: 255}
+}
+
+func mix(a, b, t float64) float64 {
+	return a*(1-t) + b*t
+}
+
+func add(a, b vec3) vec3 {
+	return vec3{a[0] + b[0], a[1] + b[1], a[2] + b[2]}
+}
+
+func sub(a, b vec3) vec3 {
+	return vec3{a[0] - b[0], a[1] - b[1], a[2] - b[2]}
+}
+
+func scale(a vec3, s float64) vec3 {
+	return vec3{a[0] * s, a[1] * s, a[2] * s}
+}
+
+func dot(a, b vec3) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+func length(a vec3) float64 {
+	return math.Sqrt(dot(a, a))
+}
+
+func normalize(a vec3) vec3 {
+	l := length(a)
+	if l == 0 {
+		return a
+	}
+	return scale(a, 1/l)
+}
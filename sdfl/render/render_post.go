@@ -0,0 +1,65 @@
+package render
+
+import (
+	"math"
+
+	sdfl "../sdfl"
+)
+
+// post applies the post effects of the scene to the color of a pixel like
+// calc_color, the ray went distance along dir
+func (f *frame) post(c vec3, dir vec3, distance float64, u float64, v float64) vec3 {
+	for _, effect := range f.scene.Post {
+		arg := func(name string) float64 {
+			return effect.Arg(name, f.time)[0]
+		}
+		switch effect.Name {
+		case "fog":
+			fog := 1 - math.Exp(-arg("density")*distance)
+			fogColor := effect.Arg("color", f.time)
+			for i := range c {
+				c[i] = mix(c[i], fogColor[i], fog)
+			}
+		case "ambientOcclusion":
+			if distance < sdfl.MAX_DISTANCE {
+				occlusion := f.occlusion(add(f.camera, scale(dir, distance)), arg("samples"))
+				c = scale(c, mix(1, occlusion, arg("strength")))
+			}
+		case "toneMap":
+			for i, x := range c {
+				if effect.Curve == "reinhard" {
+					c[i] = x / (x + 1)
+				} else {
+					c[i] = math.Min(math.Max(x*(2.51*x+.03)/(x*(2.43*x+.59)+.14), 0), 1)
+				}
+			}
+		case "gamma":
+			for i, x := range c {
+				c[i] = math.Pow(math.Max(x, 0), 1/arg("value"))
+			}
+		case "vignette":
+			d := math.Max(math.Hypot(u, v)-arg("radius"), 0)
+			c = scale(c, math.Max(1-arg("strength")*d*d, 0))
+		case "bloom":
+			threshold, intensity := arg("threshold"), arg("intensity")
+			for i, x := range c {
+				c[i] = x + math.Max(x-threshold, 0)*intensity
+			}
+		}
+	}
+	return c
+}
+
+// occlusion is the ambient light reaching p, sampled along the normal
+func (f *frame) occlusion(p vec3, samples float64) float64 {
+	normal := f.normal(p)
+	occlusion := 0.0
+	falloff := 1.0
+	for i := 0; i < MAX_OCCLUSION_SAMPLES && float64(i) < samples; i++ {
+		h := .01 + .12*float64(i)/math.Max(samples-1, 1)
+		d := f.dist(add(p, scale(normal, h))).Distance
+		occlusion += (h - d) * falloff
+		falloff *= .95
+	}
+	return math.Min(math.Max(1-3*occlusion, 0), 1)
+}
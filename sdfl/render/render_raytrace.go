@@ -0,0 +1,104 @@
+package render
+
+import (
+	"math"
+
+	sdfl "../sdfl"
+)
+
+// trace is sdfl_Trace of the fragment shader, the color of the surface with
+// the material mat the ray along dir hit at p, following the reflected and
+// refracted rays for the bounces of the scene
+func (f *frame) trace(p vec3, dir vec3, mat sdfl.Material) vec3 {
+	c := vec3{}
+	throughput := vec3{1, 1, 1}
+	inside := false
+
+	for bounce := 0; bounce < f.scene.Bounces; bounce++ {
+		normal := f.normal(p)
+		if !inside {
+			lit := scale(f.lighting(p, scale(dir, -1), mat), math.Max(1-mat.Reflectivity-mat.Transparency, 0))
+			c = add(c, mul(throughput, lit))
+		}
+
+		if mat.Transparency > 0 {
+			// the normal facing the ray
+			n, eta := normal, 1/mat.IOR
+			if inside {
+				n, eta = scale(normal, -1), mat.IOR
+			}
+			refracted := refract(dir, n, eta)
+			if dot(refracted, refracted) == 0 {
+				// total internal reflection
+				dir = reflect(dir, n)
+				p = add(p, scale(n, SHADOW_CAST_DISTANCE))
+			} else {
+				if !inside {
+					throughput = mul(throughput, scale(mat.Albedo, mat.Transparency))
+				}
+				dir = refracted
+				p = sub(p, scale(n, SHADOW_CAST_DISTANCE))
+				inside = !inside
+			}
+		} else if mat.Reflectivity > 0 {
+			tint := vec3{}
+			for i := range tint {
+				tint[i] = mix(1, mat.Albedo[i], mat.Metallic) * mat.Reflectivity
+			}
+			throughput = mul(throughput, tint)
+			dir = reflect(dir, normal)
+			p = add(p, scale(normal, SHADOW_CAST_DISTANCE))
+		} else {
+			return c
+		}
+
+		var distance float64
+		var materialId int
+		if inside {
+			distance, materialId = f.rayMarchInside(p, dir)
+		} else {
+			distance, materialId = f.rayMarch(p, dir)
+		}
+		if distance >= sdfl.MAX_DISTANCE {
+			return add(c, mul(throughput, f.sky(dir[1])))
+		}
+		p = add(p, scale(dir, distance))
+		mat = sdfl.MaterialById(materialId)
+	}
+
+	// out of bounces, the last surface is lit like an opaque one
+	return add(c, mul(throughput, f.lighting(p, scale(dir, -1), mat)))
+}
+
+// rayMarchInside marches a ray inside of a shape, where the distance is negative
+func (f *frame) rayMarchInside(origin vec3, dir vec3) (float64, int) {
+	dfo := 0.0
+	materialId := 0
+	for i := 0; i < MAX_STEPS; i++ {
+		s := f.dist(add(origin, scale(dir, dfo)))
+		dfo -= s.Distance
+		materialId = s.MaterialId
+		if dfo > sdfl.MAX_DISTANCE || -s.Distance < HIT_DISTANCE {
+			break
+		}
+	}
+	return dfo, materialId
+}
+
+func mul(a, b vec3) vec3 {
+	return vec3{a[0] * b[0], a[1] * b[1], a[2] * b[2]}
+}
+
+// reflect and refract of GLSL, refract returns the zero vector on total internal reflection
+func reflect(i, n vec3) vec3 {
+	return sub(i, scale(n, 2*dot(n, i)))
+}
+
+func refract(i, n vec3, eta float64) vec3 {
+	ndoti := dot(n, i)
+	k := 1 - eta*eta*(1-ndoti*ndoti)
+	if k < 0 {
+		return vec3{}
+	}
+	return sub(scale(i, eta), scale(n, eta*ndoti+math.Sqrt(k)))
+}
@@ -0,0 +1,315 @@
+package sdfl
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// animation helpers
+//
+// animate interpolates between keys, tuples of a time and a value: (t, v) for
+// floats and (t, x, y, z) for vec3. It is lowered to a chain of GLSL ternaries,
+// one eased mix per pair of neighbouring keys, before the first key it holds
+// the first value and after the last one the last value unless it loops. Keys
+// are sorted by time, two keys at the same time make the value jump.
+// lerp, smoothstep and oscillate work on floats and vec3, a float passed
+// together with a vec3 is widened. All of them read the time from the uniform
+// of the shader (elapsed_time in the fragment shader, time in the compute one).
+
+// GLSL bodies of the easing functions, x goes from 0 to 1
+var easings = map[string]string{
+	"linear":     "x",
+	"step":       "x < 1. ? 0. : 1.",
+	"smooth":     "x * x * (3. - 2. * x)",
+	"quadIn":     "x * x",
+	"quadOut":    "1. - (1. - x) * (1. - x)",
+	"quadInOut":  "x < .5 ? 2. * x * x : 1. - pow(-2. * x + 2., 2.) / 2.",
+	"cubicIn":    "x * x * x",
+	"cubicOut":   "1. - pow(1. - x, 3.)",
+	"cubicInOut": "x < .5 ? 4. * x * x * x : 1. - pow(-2. * x + 2., 3.) / 2.",
+	"sineIn":     "1. - cos(x * 1.57079632679)",
+	"sineOut":    "sin(x * 1.57079632679)",
+	"sineInOut":  "-(cos(3.14159265359 * x) - 1.) / 2.",
+}
+
+// Go counterparts of the easings, for scenes evaluated on the CPU
+var easingEval = map[string]func(x float64) float64{
+	"linear": func(x float64) float64 { return x },
+	"step": func(x float64) float64 {
+		if x < 1 {
+			return 0
+		}
+		return 1
+	},
+	"smooth":  func(x float64) float64 { return x * x * (3 - 2*x) },
+	"quadIn":  func(x float64) float64 { return x * x },
+	"quadOut": func(x float64) float64 { return 1 - (1-x)*(1-x) },
+	"quadInOut": func(x float64) float64 {
+		if x < .5 {
+			return 2 * x * x
+		}
+		return 1 - math.Pow(-2*x+2, 2)/2
+	},
+	"cubicIn":  func(x float64) float64 { return x * x * x },
+	"cubicOut": func(x float64) float64 { return 1 - math.Pow(1-x, 3) },
+	"cubicInOut": func(x float64) float64 {
+		if x < .5 {
+			return 4 * x * x * x
+		}
+		return 1 - math.Pow(-2*x+2, 3)/2
+	},
+	"sineIn":    func(x float64) float64 { return 1 - math.Cos(x*math.Pi/2) },
+	"sineOut":   func(x float64) float64 { return math.Sin(x * math.Pi / 2) },
+	"sineInOut": func(x float64) float64 { return -(math.Cos(math.Pi*x) - 1) / 2 },
+}
+
+func easingNames() []string {
+	names := []string{}
+	for name := range easings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// keyLen is the number of values of the first key of a key list, false when
+// the elements are not keys
+func keyLen(exprs []Expr) (int, bool) {
+	if len(exprs) == 0 {
+		return 0, false
+	}
+	if exprs[0].Type == AST_FOR {
+		return keyLen(exprs[0].For.Body.Exprs)
+	}
+	return VectorLen(&exprs[0])
+}
+
+// animKind is the kind of value a call to an animation helper produces
+func (functions symbols) animKind(funCall *FunCall) ArgKind {
+	if funCall.Id == "animate" {
+		keys, ok := funCall.Arg("keys")
+		if !ok || keys.Expr.Type != AST_ARR_EXPR {
+			return ARG_VALUE
+		}
+		switch n, _ := keyLen(keys.Expr.ArrExpr.Exprs); n {
+		case 2:
+			return ARG_FLOAT
+		case 4:
+			return ARG_VEC3
+		}
+		return ARG_VALUE
+	}
+
+	kind := ARG_FLOAT
+	signature, _ := functions.signature(funCall.Id)
+	for _, arg := range signature {
+		namedArg, ok := funCall.Arg(arg.Name)
+		if !ok || arg.Kind != ARG_VALUE {
+			continue
+		}
+		switch functions.exprKind(&namedArg.Expr) {
+		case ARG_VEC3:
+			return ARG_VEC3
+		case ARG_FLOAT:
+		default:
+			kind = ARG_VALUE
+		}
+	}
+	return kind
+}
+
+// analyzeArgKinds reports the arguments of a builtin that are not of the kind
+// of its signature, and the elements of shape lists that are not shapes
+func (fe *Frontend) analyzeArgKinds(funCall *FunCall) {
+	signature, _ := fe.functions.signature(funCall.Id)
+	for _, arg := range signature {
+		namedArg, ok := funCall.Arg(arg.Name)
+		if !ok || arg.Kind == ARG_STRING || (arg.Kind == ARG_KEY_LIST && namedArg.Expr.Type == AST_ARR_EXPR) {
+			// strings and the elements of the keys are checked by the callers
+			continue
+		}
+		if kind := fe.functions.exprKind(&namedArg.Expr); !KindMatches(arg.Kind, kind) {
+			fe.reportError(namedArg.Span, "%s of %s needs a %s, got a %s", arg.Name, funCall.Id, argKindToString(arg.Kind), argKindToString(kind))
+			continue
+		}
+		if arg.Kind == ARG_SHAPE_LIST && namedArg.Expr.Type == AST_ARR_EXPR {
+			for i := range namedArg.Expr.ArrExpr.Exprs {
+				element := &namedArg.Expr.ArrExpr.Exprs[i]
+				if kind := fe.functions.exprKind(element); !KindMatches(ARG_SHAPE, kind) {
+					fe.reportError(namedArg.Span, "%s of %s needs shapes, element %d is a %s", arg.Name, funCall.Id, i+1, argKindToString(kind))
+				}
+			}
+		}
+	}
+}
+
+// analyzeAnimate checks the keys and the easing of a call to animate, keys
+// that became constant after unrolling are folded into tuples and sorted by time
+func (fe *Frontend) analyzeAnimate(funCall *FunCall) {
+	fe.analyzeArgKinds(funCall)
+	if _, ok := funCall.Arg("loop"); ok {
+		fe.analyzeExpr(&funCall.Args[funCall.argIndex("loop")].Expr)
+	}
+
+	if ease, ok := funCall.Arg("ease"); ok {
+		if ease.Expr.Type != AST_STRING {
+			fe.reportError(ease.Span, "ease of animate has to be a string like \"linear\"")
+		} else if _, ok := easings[ease.Expr.String.Value]; !ok {
+			fe.reportError(ease.Expr.String.Span, "unknown easing %q, expected one of %s", ease.Expr.String.Value, strings.Join(easingNames(), ", "))
+		}
+	}
+
+	keysArg, ok := funCall.Arg("keys")
+	if !ok || keysArg.Expr.Type != AST_ARR_EXPR {
+		return
+	}
+	keys := funCall.Args[funCall.argIndex("keys")].Expr.ArrExpr.Exprs
+	if len(keys) == 0 {
+		fe.reportError(keysArg.Span, "animate needs at least one key")
+		return
+	}
+	n := 0
+	times := map[*Tuple]float64{}
+	for i := range keys {
+		key := &keys[i]
+		span := keysArg.Span
+		if key.Type == AST_VEC {
+			if key.Vec.Span.Row != 0 {
+				span = key.Vec.Span
+			}
+			foldVec(key)
+		}
+		if key.Type == AST_VEC {
+			fe.reportError(span, "keys of animate have to be constant")
+			return
+		} else if key.Type != AST_TUPLE {
+			fe.reportError(span, "a key of animate is a tuple like (time, value), got a %s", argKindToString(fe.functions.exprKind(key)))
+			return
+		}
+		if key.Tuple.Span.Row != 0 {
+			span = key.Tuple.Span
+		}
+
+		values := key.Tuple.Values
+		if len(values) != 2 && len(values) != 4 {
+			fe.reportError(span, "a key of animate needs a time and a float or a vec3, got %d values", len(values))
+			return
+		}
+		if n != 0 && len(values) != n {
+			fe.reportError(span, "keys of animate mix float and vec3 values")
+			return
+		}
+		n = len(values)
+		t, err := ParseNumberLiteral(values[0])
+		if err != nil {
+			fe.reportError(span, "invalid time %s", values[0])
+			return
+		}
+		times[key.Tuple] = t
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return times[keys[i].Tuple] < times[keys[j].Tuple]
+	})
+}
+
+// lowerAnimCall lowers a call to an animation helper to plain calls
+func lowerAnimCall(funCall *FunCall) irExpr {
+	kind := functionSymbols.animKind(funCall)
+	value := func(name string) irExpr {
+		expr := funCall.ArgExpr(name)
+		if kind == ARG_VEC3 && ExprKind(&expr) != ARG_VEC3 {
+			return &irVec3{Args: []irExpr{lowerExpr(&expr)}}
+		}
+		return lowerExpr(&expr)
+	}
+	scalar := func(name string) irExpr {
+		expr := funCall.ArgExpr(name)
+		return lowerExpr(&expr)
+	}
+
+	switch funCall.Id {
+	case "lerp":
+		return &irCall{Function: "mix", Args: []irExpr{value("from"), value("to"), scalar("t")}}
+	case "smoothstep":
+		return &irCall{Function: "smoothstep", Args: []irExpr{value("from"), value("to"), value("x")}}
+	case "oscillate":
+		return &irParen{X: &irBinary{Op: "*", Left: value("amp"), Right: &irCall{Function: "sdfl_Oscillate", Args: []irExpr{scalar("freq")}}}}
+	case "animate":
+		return lowerAnimate(funCall)
+	}
+	return nil
+}
+
+// lowerAnimate lowers animate to one eased mix per pair of neighbouring keys
+func lowerAnimate(funCall *FunCall) irExpr {
+	keys := funCall.ArgExpr("keys").ArrExpr
+	times := []irExpr{}
+	values := []irExpr{}
+	for _, key := range keys.Exprs {
+		if key.Type != AST_TUPLE {
+			reportError(funCall.Span, "keys of animate have to be constant")
+			return nil
+		}
+		numbers := []irExpr{}
+		for _, literal := range key.Tuple.Values {
+			v, _ := ParseNumberLiteral(literal)
+			numbers = append(numbers, &irNumber{Literal: glslFloat(v)})
+		}
+		times = append(times, numbers[0])
+		if len(numbers) == 4 {
+			values = append(values, &irVec3{Args: numbers[1:]})
+		} else {
+			values = append(values, numbers[1])
+		}
+	}
+	if len(values) == 1 {
+		return values[0]
+	}
+
+	ease := funCall.ArgExpr("ease").String.Value
+	loop := funCall.ArgExpr("loop")
+	last := len(times) - 1
+	animTime := func() irExpr {
+		return &irCall{Function: "sdfl_AnimTime", Args: []irExpr{times[0], times[last], lowerExpr(&loop)}}
+	}
+	segment := func(i int) irExpr {
+		t := &irCall{Function: "sdfl_AnimSegment", Args: []irExpr{animTime(), times[i-1], times[i]}}
+		eased := &irCall{Function: "sdfl_ease_" + ease, Args: []irExpr{t}}
+		return &irCall{Function: "mix", Args: []irExpr{values[i-1], values[i], eased}}
+	}
+
+	// the keys are sorted, the first segment that did not end yet is chosen
+	result := segment(last)
+	for i := last - 1; i >= 1; i-- {
+		result = &irSelect{Cond: &irBinary{Op: "<", Left: animTime(), Right: times[i]}, Then: segment(i), Else: result}
+	}
+	return result
+}
+
+// generateGlslAnimFunctions adds the easing functions and the time helpers of animate and oscillate to both shaders
+func generateGlslAnimFunctions() {
+	addGlslLibrary(glslAnimLibrary(), true, true)
+}
+
+func glslAnimLibrary() string {
+	code := `
+float sdfl_AnimTime(float start, float end, bool loop) {
+    float t = sdfl_builtin_time(vec2(0.));
+    return loop && end > start ? start + mod(t - start, end - start) : t;
+}
+
+float sdfl_AnimSegment(float t, float start, float end) {
+    return end > start ? clamp((t - start) / (end - start), 0., 1.) : step(start, t);
+}
+
+float sdfl_Oscillate(float freq) {
+    return sin(6.28318530718 * freq * sdfl_builtin_time(vec2(0.)));
+}
+`
+	for _, name := range easingNames() {
+		code += fmt.Sprintf("\nfloat sdfl_ease_%s(float x) {\n    return %s;\n}\n", name, easings[name])
+	}
+	return code
+}
@@ -2,6 +2,9 @@ package sdfl
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"sort"
 	"strings"
 )
 
@@ -17,6 +20,15 @@ const (
 	AST_BINOP_TERM
 	AST_BINOP_FACTOR
 	AST_ARR_EXPR
+	AST_BINOP_COMPARE
+	AST_BINOP_LOGIC
+	AST_UNOP_NOT
+	AST_COND
+	AST_VEC
+	AST_VAR
+	AST_FOR
+	AST_STRING
+	AST_BOOL
 )
 
 func ruleTypeToString(r RuleType) string {
@@ -37,6 +49,24 @@ func ruleTypeToString(r RuleType) string {
 		return "AST_BINOP_FACTOR"
 	case AST_ARR_EXPR:
 		return "AST_ARR_EXPR"
+	case AST_BINOP_COMPARE:
+		return "AST_BINOP_COMPARE"
+	case AST_BINOP_LOGIC:
+		return "AST_BINOP_LOGIC"
+	case AST_UNOP_NOT:
+		return "AST_UNOP_NOT"
+	case AST_COND:
+		return "AST_COND"
+	case AST_VEC:
+		return "AST_VEC"
+	case AST_VAR:
+		return "AST_VAR"
+	case AST_FOR:
+		return "AST_FOR"
+	case AST_STRING:
+		return "AST_STRING"
+	case AST_BOOL:
+		return "AST_BOOL"
 	default:
 		return fmt.Sprintf("Unknown: RuleType(%d)", int(r))
 	}
@@ -61,27 +91,114 @@ type Expr struct {
 	Number         *Number
 	BinopTerm      *BinopTerm
 	BinopFactor    *BinopFactor
+	BinopCompare   *BinopCompare
+	BinopLogic     *BinopLogic
+	UnopNot        *UnopNot
+	Cond           *Cond
+	Vec            *Vec
+	Var            *Var
+	For            *For
+	String         *String
+	Bool           *Bool
 	HasParentheses bool
 }
 
+// Span is the source position of a node, zero when the node
+// did not come from source (e.g. it was decoded from a sequence)
+type Span struct {
+	Row int
+	Col int
+	Len int
+}
+
 type Number struct {
 	Value string
+	Tweak bool
+	Span  Span
 }
 
 type Tuple struct {
 	Values []string
+	Tweak  bool
+	Span   Span
 }
 
 type BinopTerm struct {
 	Left     Expr
 	Right    Expr
 	Operator string
+	Span     Span // of the operator
 }
 
 type BinopFactor struct {
 	Left     Expr
 	Right    Expr
 	Operator string
+	Span     Span // of the operator
+}
+
+// BinopCompare compares two numbers, Operator is one of < <= == != > >=
+type BinopCompare struct {
+	Left     Expr
+	Right    Expr
+	Operator string
+	Span     Span
+}
+
+// BinopLogic combines two conditions, Operator is and or or
+type BinopLogic struct {
+	Left     Expr
+	Right    Expr
+	Operator string
+	Span     Span
+}
+
+type UnopNot struct {
+	Expr Expr
+	Span Span
+}
+
+// Cond selects Then or Else, numbers as well as whole shapes
+type Cond struct {
+	Cond   Expr
+	Then   Expr
+	Else   Expr
+	IfElse bool // written as `if c { a } else { b }` instead of `c ? a : b`
+	Span   Span
+}
+
+// Vec is a tuple with other elements than number literals, like (i * 2, 0, 0)
+type Vec struct {
+	Exprs []Expr
+	Span  Span
+}
+
+// Var is the variable of an enclosing for loop
+type Var struct {
+	Name string
+	Span Span
+}
+
+// For repeats Body with Var set to From, From + 1, ... as long as it is below
+// To. It is only allowed as an element of an array, Analyze unrolls it.
+type For struct {
+	Var  string
+	From Expr
+	To   Expr
+	Body ArrExpr
+	Span Span
+}
+
+// String is a string literal like "cubicInOut", Value is without the quotes
+type String struct {
+	Value string
+	Span  Span
+}
+
+// Bool is the literal true or false
+type Bool struct {
+	Value bool
+	Span  Span
 }
 
 type SymbolType int
@@ -95,6 +212,8 @@ const (
 	FUN_BUILTIN_SHAPE
 	FUN_BUILTIN_SDFL
 	FUN_BUILTIN_GLSL
+	FUN_BUILTIN_ANIM
+	FUN_BUILTIN_POST
 	FUN_USER_DEFINED
 	VAR_BUILTIN
 	VAR_USER_DEFINED
@@ -105,74 +224,410 @@ type FunDef struct {
 	SymbolType     SymbolType
 	Id             string
 	FunDefArgNames []string
+	FunDefDefaults map[string]Expr // default values of the parameters declared like `b = 2`
 	Expr           *Expr
 }
 
 type FunNamedArg struct {
-	ArgName string
-	Expr    Expr
+	ArgName    string
+	Expr       Expr
+	Span       Span // span of the name, of the value for positional arguments
+	Positional bool // given without a name, ArgName comes from the function definition
+	Implicit   bool // filled in from the signature by Analyze, not written in the source
 }
 
 type FunCall struct {
-	Id           string
-	FunNamedArgs map[string]FunNamedArg
+	Id   string
+	Args []FunNamedArg // in source order, every name at most once
+	Span Span
+}
+
+func (funCall *FunCall) argIndex(name string) int {
+	for i, arg := range funCall.Args {
+		if arg.ArgName == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Arg returns the argument called name
+func (funCall *FunCall) Arg(name string) (FunNamedArg, bool) {
+	if i := funCall.argIndex(name); i >= 0 {
+		return funCall.Args[i], true
+	}
+	return FunNamedArg{}, false
+}
+
+// ArgExpr returns the value of the argument called name, an empty expression when it is missing
+func (funCall *FunCall) ArgExpr(name string) Expr {
+	arg, _ := funCall.Arg(name)
+	return arg.Expr
+}
+
+// explicitArgs are the arguments written in the source, without the ones Analyze filled in
+func (funCall *FunCall) explicitArgs() []FunNamedArg {
+	args := []FunNamedArg{}
+	for _, arg := range funCall.Args {
+		if !arg.Implicit {
+			args = append(args, arg)
+		}
+	}
+	return args
+}
+
+// sortArgs orders the arguments like argNames, the names of the function
+// definition, unknown ones last by name
+func (funCall *FunCall) sortArgs(argNames []string) {
+	order := map[string]int{}
+	for i, name := range argNames {
+		order[name] = i
+	}
+	sort.SliceStable(funCall.Args, func(i, j int) bool {
+		oi, okI := order[funCall.Args[i].ArgName]
+		oj, okJ := order[funCall.Args[j].ArgName]
+		if okI != okJ {
+			return okI
+		}
+		if okI {
+			return oi < oj
+		}
+		return funCall.Args[i].ArgName < funCall.Args[j].ArgName
+	})
+}
+
+// SetArg replaces the value of the argument called name, or adds the argument at the end
+func (funCall *FunCall) SetArg(name string, expr Expr) {
+	if i := funCall.argIndex(name); i >= 0 {
+		funCall.Args[i].Expr = expr
+		return
+	}
+	funCall.Args = append(funCall.Args, FunNamedArg{ArgName: name, Expr: expr})
 }
 
 type ArrExpr struct {
 	Exprs []Expr
 }
 
+/*
+	AST Walk
+*/
+
+// walkExpr calls fn for expr and every expression nested in it in a
+// deterministic order, the children of expr are skipped when fn returns false.
+// Changes fn makes through the pointer are kept.
+func walkExpr(expr *Expr, fn func(*Expr) bool) {
+	if !fn(expr) {
+		return
+	}
+
+	switch expr.Type {
+	case AST_FUN_CALL:
+		for _, argName := range sortedArgNames(expr.FunCall) {
+			walkExpr(&expr.FunCall.Args[expr.FunCall.argIndex(argName)].Expr, fn)
+		}
+	case AST_ARR_EXPR:
+		for i := range expr.ArrExpr.Exprs {
+			walkExpr(&expr.ArrExpr.Exprs[i], fn)
+		}
+	case AST_BINOP_TERM:
+		walkExpr(&expr.BinopTerm.Left, fn)
+		walkExpr(&expr.BinopTerm.Right, fn)
+	case AST_BINOP_FACTOR:
+		walkExpr(&expr.BinopFactor.Left, fn)
+		walkExpr(&expr.BinopFactor.Right, fn)
+	case AST_BINOP_COMPARE:
+		walkExpr(&expr.BinopCompare.Left, fn)
+		walkExpr(&expr.BinopCompare.Right, fn)
+	case AST_BINOP_LOGIC:
+		walkExpr(&expr.BinopLogic.Left, fn)
+		walkExpr(&expr.BinopLogic.Right, fn)
+	case AST_UNOP_NOT:
+		walkExpr(&expr.UnopNot.Expr, fn)
+	case AST_COND:
+		walkExpr(&expr.Cond.Cond, fn)
+		walkExpr(&expr.Cond.Then, fn)
+		walkExpr(&expr.Cond.Else, fn)
+	case AST_VEC:
+		for i := range expr.Vec.Exprs {
+			walkExpr(&expr.Vec.Exprs[i], fn)
+		}
+	case AST_FOR:
+		walkExpr(&expr.For.From, fn)
+		walkExpr(&expr.For.To, fn)
+		for i := range expr.For.Body.Exprs {
+			walkExpr(&expr.For.Body.Exprs[i], fn)
+		}
+	}
+}
+
+func sortedArgNames(funCall *FunCall) []string {
+	argNames := make([]string, 0, len(funCall.Args))
+	for _, arg := range funCall.Args {
+		argNames = append(argNames, arg.ArgName)
+	}
+	sort.Strings(argNames)
+	return argNames
+}
+
+/*
+	AST Equality
+*/
+
+// EqualAST compares two programs structurally, source spans are ignored but
+// the order of the arguments is not
+func EqualAST(a Program, b Program) bool {
+	if len(a.Stmts) != len(b.Stmts) {
+		return false
+	}
+	for i := range a.Stmts {
+		fa, fb := a.Stmts[i].FunDef, b.Stmts[i].FunDef
+		if a.Stmts[i].Type != b.Stmts[i].Type || (fa == nil) != (fb == nil) {
+			return false
+		}
+		if fa == nil {
+			continue
+		}
+		if fa.Id != fb.Id || strings.Join(fa.FunDefArgNames, ",") != strings.Join(fb.FunDefArgNames, ",") || (fa.Expr == nil) != (fb.Expr == nil) {
+			return false
+		}
+		if fa.Expr != nil && !EqualExpr(*fa.Expr, *fb.Expr) {
+			return false
+		}
+		if len(fa.FunDefDefaults) != len(fb.FunDefDefaults) {
+			return false
+		}
+		for name, defaultA := range fa.FunDefDefaults {
+			defaultB, ok := fb.FunDefDefaults[name]
+			if !ok || !EqualExpr(defaultA, defaultB) {
+				return false
+			}
+		}
+	}
+	return EqualExpr(a.Expr, b.Expr)
+}
+
+func EqualExpr(a Expr, b Expr) bool {
+	if a.Type != b.Type || a.HasParentheses != b.HasParentheses {
+		return false
+	}
+
+	switch a.Type {
+	case AST_NUMBER:
+		return a.Number.Value == b.Number.Value && a.Number.Tweak == b.Number.Tweak
+	case AST_TUPLE:
+		return strings.Join(a.Tuple.Values, ",") == strings.Join(b.Tuple.Values, ",") && len(a.Tuple.Values) == len(b.Tuple.Values) && a.Tuple.Tweak == b.Tuple.Tweak
+	case AST_FUN_CALL:
+		// arguments are compared in order, sequences keep the order of the source
+		if a.FunCall.Id != b.FunCall.Id || len(a.FunCall.Args) != len(b.FunCall.Args) {
+			return false
+		}
+		for i, argA := range a.FunCall.Args {
+			argB := b.FunCall.Args[i]
+			if argA.ArgName != argB.ArgName || argA.Positional != argB.Positional || !EqualExpr(argA.Expr, argB.Expr) {
+				return false
+			}
+		}
+		return true
+	case AST_ARR_EXPR:
+		return equalExprs(a.ArrExpr.Exprs, b.ArrExpr.Exprs)
+	case AST_BINOP_TERM:
+		return a.BinopTerm.Operator == b.BinopTerm.Operator && EqualExpr(a.BinopTerm.Left, b.BinopTerm.Left) && EqualExpr(a.BinopTerm.Right, b.BinopTerm.Right)
+	case AST_BINOP_FACTOR:
+		return a.BinopFactor.Operator == b.BinopFactor.Operator && EqualExpr(a.BinopFactor.Left, b.BinopFactor.Left) && EqualExpr(a.BinopFactor.Right, b.BinopFactor.Right)
+	case AST_BINOP_COMPARE:
+		return a.BinopCompare.Operator == b.BinopCompare.Operator && EqualExpr(a.BinopCompare.Left, b.BinopCompare.Left) && EqualExpr(a.BinopCompare.Right, b.BinopCompare.Right)
+	case AST_BINOP_LOGIC:
+		return a.BinopLogic.Operator == b.BinopLogic.Operator && EqualExpr(a.BinopLogic.Left, b.BinopLogic.Left) && EqualExpr(a.BinopLogic.Right, b.BinopLogic.Right)
+	case AST_UNOP_NOT:
+		return EqualExpr(a.UnopNot.Expr, b.UnopNot.Expr)
+	case AST_COND:
+		return a.Cond.IfElse == b.Cond.IfElse && EqualExpr(a.Cond.Cond, b.Cond.Cond) && EqualExpr(a.Cond.Then, b.Cond.Then) && EqualExpr(a.Cond.Else, b.Cond.Else)
+	case AST_VEC:
+		return equalExprs(a.Vec.Exprs, b.Vec.Exprs)
+	case AST_VAR:
+		return a.Var.Name == b.Var.Name
+	case AST_STRING:
+		return a.String.Value == b.String.Value
+	case AST_BOOL:
+		return a.Bool.Value == b.Bool.Value
+	case AST_FOR:
+		return a.For.Var == b.For.Var && EqualExpr(a.For.From, b.For.From) && EqualExpr(a.For.To, b.For.To) && equalExprs(a.For.Body.Exprs, b.For.Body.Exprs)
+	}
+	return true
+}
+
+func equalExprs(a []Expr, b []Expr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !EqualExpr(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+	AST Copy
+*/
+
+// CopyProgram returns a deep copy of prog, changing the copy leaves prog as it is
+func CopyProgram(prog Program) Program {
+	stmts := []Stmt{}
+	for _, stmt := range prog.Stmts {
+		if stmt.FunDef != nil {
+			funDef := *stmt.FunDef
+			funDef.FunDefArgNames = append([]string{}, funDef.FunDefArgNames...)
+			if funDef.FunDefDefaults != nil {
+				defaults := map[string]Expr{}
+				for name, value := range funDef.FunDefDefaults {
+					defaults[name] = CopyExpr(value)
+				}
+				funDef.FunDefDefaults = defaults
+			}
+			if funDef.Expr != nil {
+				expr := CopyExpr(*funDef.Expr)
+				funDef.Expr = &expr
+			}
+			stmt.FunDef = &funDef
+		}
+		stmts = append(stmts, stmt)
+	}
+	prog.Stmts = stmts
+	prog.Expr = CopyExpr(prog.Expr)
+	return prog
+}
+
+func CopyExpr(expr Expr) Expr {
+	switch expr.Type {
+	case AST_NUMBER:
+		number := *expr.Number
+		expr.Number = &number
+	case AST_TUPLE:
+		tuple := *expr.Tuple
+		tuple.Values = append([]string{}, tuple.Values...)
+		expr.Tuple = &tuple
+	case AST_FUN_CALL:
+		funCall := *expr.FunCall
+		funCall.Args = []FunNamedArg{}
+		for _, arg := range expr.FunCall.Args {
+			arg.Expr = CopyExpr(arg.Expr)
+			funCall.Args = append(funCall.Args, arg)
+		}
+		expr.FunCall = &funCall
+	case AST_ARR_EXPR:
+		expr.ArrExpr = &ArrExpr{Exprs: copyExprs(expr.ArrExpr.Exprs)}
+	case AST_BINOP_TERM:
+		binop := *expr.BinopTerm
+		binop.Left, binop.Right = CopyExpr(binop.Left), CopyExpr(binop.Right)
+		expr.BinopTerm = &binop
+	case AST_BINOP_FACTOR:
+		binop := *expr.BinopFactor
+		binop.Left, binop.Right = CopyExpr(binop.Left), CopyExpr(binop.Right)
+		expr.BinopFactor = &binop
+	case AST_BINOP_COMPARE:
+		binop := *expr.BinopCompare
+		binop.Left, binop.Right = CopyExpr(binop.Left), CopyExpr(binop.Right)
+		expr.BinopCompare = &binop
+	case AST_BINOP_LOGIC:
+		binop := *expr.BinopLogic
+		binop.Left, binop.Right = CopyExpr(binop.Left), CopyExpr(binop.Right)
+		expr.BinopLogic = &binop
+	case AST_UNOP_NOT:
+		expr.UnopNot = &UnopNot{Expr: CopyExpr(expr.UnopNot.Expr), Span: expr.UnopNot.Span}
+	case AST_COND:
+		cond := *expr.Cond
+		cond.Cond, cond.Then, cond.Else = CopyExpr(cond.Cond), CopyExpr(cond.Then), CopyExpr(cond.Else)
+		expr.Cond = &cond
+	case AST_VEC:
+		expr.Vec = &Vec{Exprs: copyExprs(expr.Vec.Exprs), Span: expr.Vec.Span}
+	case AST_VAR:
+		v := *expr.Var
+		expr.Var = &v
+	case AST_STRING:
+		str := *expr.String
+		expr.String = &str
+	case AST_BOOL:
+		b := *expr.Bool
+		expr.Bool = &b
+	case AST_FOR:
+		loop := *expr.For
+		loop.From, loop.To = CopyExpr(loop.From), CopyExpr(loop.To)
+		loop.Body = ArrExpr{Exprs: copyExprs(loop.Body.Exprs)}
+		expr.For = &loop
+	}
+	return expr
+}
+
+func copyExprs(exprs []Expr) []Expr {
+	copies := []Expr{}
+	for _, e := range exprs {
+		copies = append(copies, CopyExpr(e))
+	}
+	return copies
+}
+
 /*
 	AST Print
 */
 
 func PrintAST(prog Program) {
-	printProgram(prog, 0)
+	FprintAST(os.Stdout, prog)
+}
+
+func FprintAST(w io.Writer, prog Program) {
+	printProgram(w, prog, 0)
 }
 
 func indent(level int) string {
 	return strings.Repeat("  ", level)
 }
 
-func printProgram(prog Program, level int) {
-	fmt.Printf("%sProgram:\n", indent(level))
+func printProgram(w io.Writer, prog Program, level int) {
+	fmt.Fprintf(w, "%sProgram:\n", indent(level))
 	if len(prog.Stmts) > 0 {
-		fmt.Printf("%sStatements:\n", indent(level+1))
+		fmt.Fprintf(w, "%sStatements:\n", indent(level+1))
 		for i, stmt := range prog.Stmts {
-			fmt.Printf("%s[%d]\n", indent(level+2), i)
-			printStmt(stmt, level+3)
+			fmt.Fprintf(w, "%s[%d]\n", indent(level+2), i)
+			printStmt(w, stmt, level+3)
 		}
 	}
 
 	// print main expression (scene)
-	fmt.Printf("%sExpression:\n", indent(level+1))
-	printExpr(prog.Expr, level+2)
+	fmt.Fprintf(w, "%sExpression:\n", indent(level+1))
+	printExpr(w, prog.Expr, level+2)
 }
 
-func printStmt(stmt Stmt, level int) {
+func printStmt(w io.Writer, stmt Stmt, level int) {
 	switch stmt.Type {
 	case AST_FUN_DEF:
-		printFunDef(stmt.FunDef, level)
+		printFunDef(w, stmt.FunDef, level)
 	default:
-		fmt.Printf("%sUnknown statement type: %v\n", indent(level), stmt.Type)
+		fmt.Fprintf(w, "%sUnknown statement type: %v\n", indent(level), stmt.Type)
 	}
 }
 
-func printFunDef(funDef *FunDef, level int) {
-	fmt.Printf("%sFunDef:\n", indent(level))
-	fmt.Printf("%sId: %s\n", indent(level+1), funDef.Id)
-	fmt.Printf("%sSymbolType: %s\n", indent(level+1), symbolTypeToString(funDef.SymbolType))
+func printFunDef(w io.Writer, funDef *FunDef, level int) {
+	fmt.Fprintf(w, "%sFunDef:\n", indent(level))
+	fmt.Fprintf(w, "%sId: %s\n", indent(level+1), funDef.Id)
+	fmt.Fprintf(w, "%sSymbolType: %s\n", indent(level+1), symbolTypeToString(funDef.SymbolType))
 
 	if len(funDef.FunDefArgNames) > 0 {
-		fmt.Printf("%sArguments:\n", indent(level+1))
+		fmt.Fprintf(w, "%sArguments:\n", indent(level+1))
 		for i, argName := range funDef.FunDefArgNames {
-			fmt.Printf("%s[%d] %s\n", indent(level+2), i, argName)
+			fmt.Fprintf(w, "%s[%d] %s\n", indent(level+2), i, argName)
+			if value, ok := funDef.FunDefDefaults[argName]; ok {
+				fmt.Fprintf(w, "%sDefault:\n", indent(level+3))
+				printExpr(w, value, level+4)
+			}
 		}
 	}
 
 	if funDef.Expr != nil {
-		fmt.Printf("%sBody:\n", indent(level+1))
-		printExpr(*funDef.Expr, level+2)
+		fmt.Fprintf(w, "%sBody:\n", indent(level+1))
+		printExpr(w, *funDef.Expr, level+2)
 	}
 }
 
@@ -192,6 +647,10 @@ func symbolTypeToString(st SymbolType) string {
 		return "FUN_BUILTIN_SDFL"
 	case FUN_BUILTIN_GLSL:
 		return "FUN_BUILTIN_GLSL"
+	case FUN_BUILTIN_ANIM:
+		return "FUN_BUILTIN_ANIM"
+	case FUN_BUILTIN_POST:
+		return "FUN_BUILTIN_POST"
 	case FUN_USER_DEFINED:
 		return "FUN_USER_DEFINED"
 	case VAR_BUILTIN:
@@ -203,67 +662,118 @@ func symbolTypeToString(st SymbolType) string {
 	}
 }
 
-func printExpr(expr Expr, level int) {
+func printExpr(w io.Writer, expr Expr, level int) {
 	switch expr.Type {
 	case AST_FUN_CALL:
-		printFunCall(expr.FunCall, level)
+		printFunCall(w, expr.FunCall, level)
 	case AST_TUPLE:
-		printTuple(expr.Tuple, level)
+		printTuple(w, expr.Tuple, level)
 	case AST_ARR_EXPR:
-		printArr(expr.ArrExpr, level)
+		printArr(w, expr.ArrExpr, level)
 	case AST_NUMBER:
-		printNumber(expr.Number, level)
+		printNumber(w, expr.Number, level)
 	case AST_BINOP_TERM:
-		printBinopTerm(expr.BinopTerm, level)
+		printBinopTerm(w, expr.BinopTerm, level)
 	case AST_BINOP_FACTOR:
-		printBinopFactor(expr.BinopFactor, level)
+		printBinopFactor(w, expr.BinopFactor, level)
+	case AST_BINOP_COMPARE:
+		printOperands(w, "Comparison: "+expr.BinopCompare.Operator, level, expr.BinopCompare.Left, expr.BinopCompare.Right)
+	case AST_BINOP_LOGIC:
+		printOperands(w, "Logic: "+expr.BinopLogic.Operator, level, expr.BinopLogic.Left, expr.BinopLogic.Right)
+	case AST_UNOP_NOT:
+		fmt.Fprintf(w, "%sNot:\n", indent(level))
+		printExpr(w, expr.UnopNot.Expr, level+1)
+	case AST_COND:
+		printCond(w, expr.Cond, level)
+	case AST_VEC:
+		fmt.Fprintf(w, "%sVector:\n", indent(level))
+		for i, e := range expr.Vec.Exprs {
+			fmt.Fprintf(w, "%s[%d]\n", indent(level+1), i)
+			printExpr(w, e, level+2)
+		}
+	case AST_VAR:
+		fmt.Fprintf(w, "%sVariable: %s\n", indent(level), expr.Var.Name)
+	case AST_STRING:
+		fmt.Fprintf(w, "%sString: %q\n", indent(level), expr.String.Value)
+	case AST_BOOL:
+		fmt.Fprintf(w, "%sBool: %t\n", indent(level), expr.Bool.Value)
+	case AST_FOR:
+		printFor(w, expr.For, level)
 	default:
-		fmt.Printf("%sUnknown expr type: %v\n", indent(level), expr.Type)
+		fmt.Fprintf(w, "%sUnknown expr type: %v\n", indent(level), expr.Type)
 	}
 }
 
-func printNumber(num *Number, level int) {
-	fmt.Printf("%sNumber: %s\n", indent(level), num.Value)
+func printNumber(w io.Writer, num *Number, level int) {
+	fmt.Fprintf(w, "%sNumber: %s\n", indent(level), num.Value)
 }
 
-func printTuple(tuple *Tuple, level int) {
-	fmt.Printf("%sTuple:\n", indent(level))
+func printTuple(w io.Writer, tuple *Tuple, level int) {
+	fmt.Fprintf(w, "%sTuple:\n", indent(level))
 	for i, val := range tuple.Values {
-		fmt.Printf("%s[%d] %s\n", indent(level+1), i, val)
+		fmt.Fprintf(w, "%s[%d] %s\n", indent(level+1), i, val)
 	}
 }
 
-func printFunCall(fun *FunCall, level int) {
-	fmt.Printf("%sFunCall: %s\n", indent(level), fun.Id)
-	if len(fun.FunNamedArgs) > 0 {
-		fmt.Printf("%sArguments:\n", indent(level+1))
-		for argName, arg := range fun.FunNamedArgs {
-			fmt.Printf("%s%s:\n", indent(level+2), argName)
-			printExpr(arg.Expr, level+3)
+func printFunCall(w io.Writer, fun *FunCall, level int) {
+	fmt.Fprintf(w, "%sFunCall: %s\n", indent(level), fun.Id)
+	if len(fun.Args) > 0 {
+		fmt.Fprintf(w, "%sArguments:\n", indent(level+1))
+		for _, arg := range fun.Args {
+			fmt.Fprintf(w, "%s%s:\n", indent(level+2), arg.ArgName)
+			printExpr(w, arg.Expr, level+3)
 		}
 	}
 }
 
-func printArr(arr *ArrExpr, level int) {
-	fmt.Printf("%sArray:\n", indent(level))
+func printArr(w io.Writer, arr *ArrExpr, level int) {
+	fmt.Fprintf(w, "%sArray:\n", indent(level))
 	for i, e := range arr.Exprs {
-		fmt.Printf("%s[%d]\n", indent(level+1), i)
-		printExpr(e, level+2)
+		fmt.Fprintf(w, "%s[%d]\n", indent(level+1), i)
+		printExpr(w, e, level+2)
 	}
 }
 
-func printBinopTerm(binop *BinopTerm, level int) {
-	fmt.Printf("%sBinaryOperation (Term): %s\n", indent(level), binop.Operator)
-	fmt.Printf("%sLeft:\n", indent(level+1))
-	printExpr(binop.Left, level+2)
-	fmt.Printf("%sRight:\n", indent(level+1))
-	printExpr(binop.Right, level+2)
+func printBinopTerm(w io.Writer, binop *BinopTerm, level int) {
+	fmt.Fprintf(w, "%sBinaryOperation (Term): %s\n", indent(level), binop.Operator)
+	fmt.Fprintf(w, "%sLeft:\n", indent(level+1))
+	printExpr(w, binop.Left, level+2)
+	fmt.Fprintf(w, "%sRight:\n", indent(level+1))
+	printExpr(w, binop.Right, level+2)
+}
+
+func printBinopFactor(w io.Writer, binop *BinopFactor, level int) {
+	fmt.Fprintf(w, "%sBinaryOperation (Factor): %s\n", indent(level), binop.Operator)
+	fmt.Fprintf(w, "%sLeft:\n", indent(level+1))
+	printExpr(w, binop.Left, level+2)
+	fmt.Fprintf(w, "%sRight:\n", indent(level+1))
+	printExpr(w, binop.Right, level+2)
+}
+
+func printOperands(w io.Writer, title string, level int, left Expr, right Expr) {
+	fmt.Fprintf(w, "%s%s\n", indent(level), title)
+	fmt.Fprintf(w, "%sLeft:\n", indent(level+1))
+	printExpr(w, left, level+2)
+	fmt.Fprintf(w, "%sRight:\n", indent(level+1))
+	printExpr(w, right, level+2)
+}
+
+func printCond(w io.Writer, cond *Cond, level int) {
+	fmt.Fprintf(w, "%sConditional:\n", indent(level))
+	fmt.Fprintf(w, "%sCondition:\n", indent(level+1))
+	printExpr(w, cond.Cond, level+2)
+	fmt.Fprintf(w, "%sThen:\n", indent(level+1))
+	printExpr(w, cond.Then, level+2)
+	fmt.Fprintf(w, "%sElse:\n", indent(level+1))
+	printExpr(w, cond.Else, level+2)
 }
 
-func printBinopFactor(binop *BinopFactor, level int) {
-	fmt.Printf("%sBinaryOperation (Factor): %s\n", indent(level), binop.Operator)
-	fmt.Printf("%sLeft:\n", indent(level+1))
-	printExpr(binop.Left, level+2)
-	fmt.Printf("%sRight:\n", indent(level+1))
-	printExpr(binop.Right, level+2)
+func printFor(w io.Writer, loop *For, level int) {
+	fmt.Fprintf(w, "%sFor: %s\n", indent(level), loop.Var)
+	fmt.Fprintf(w, "%sFrom:\n", indent(level+1))
+	printExpr(w, loop.From, level+2)
+	fmt.Fprintf(w, "%sTo:\n", indent(level+1))
+	printExpr(w, loop.To, level+2)
+	fmt.Fprintf(w, "%sBody:\n", indent(level+1))
+	printArr(w, &loop.Body, level+2)
 }
@@ -7,8 +7,86 @@ import (
 	"strings"
 )
 
+/*
+	AST sequence format, version 3
+
+	A program is written as one node per line, in prefix order. The first line
+	is the header, every other line is a list of fields separated by ':'.
+	Inside a field '\' is written as '\\', ':' as '\:' and a newline as '\n'.
+
+	sequence  = header { fundef } expr
+	header    = "sdfl-seq:3"
+	fundef    = "fundef:" id ":" n { param } expr                (n params)
+	param     = "param:" name | "param:" name ":default" expr  (parameter with a default value)
+	arg       = "arg:" name | "arg:" name ":positional"       (argument given without its name)
+	expr      = [ "paren:open" ] [ annot ] value [ "paren:close" ]
+	annot     = "annot:" name                                 (e.g. annot:tweak)
+	value     = "call:" id ":" n { arg expr }                  (n args in source order)
+	          | "val:number" "literal:" number
+	          | "val:tuple" "literal:(" number { ", " number } ")"
+	          | "val:arr:begin:" n { expr } "val:arr:end"      (n elements)
+	          | "val:binopt:" op "left" expr "right" expr      (op is + or -)
+	          | "val:binopf:" op "left" expr "right" expr      (op is * or /)
+	          | "val:cmp:" op "left" expr "right" expr         (op is < <= == != > >=)
+	          | "val:logic:" op "left" expr "right" expr       (op is and or or)
+	          | "val:not" expr
+	          | "val:cond:" style "cond" expr "then" expr "else" expr  (style is ternary or if)
+	          | "val:vec:" n { expr }                          (tuple of n values that are not all literals)
+	          | "val:var:" name                                (variable of an enclosing loop)
+	          | "val:string:" text                             (string literal without the quotes)
+	          | "val:bool:" ( "true" | "false" )
+	          | "val:for:" name "from" expr "to" expr arr      (arr is a val:arr value, the loop body)
+
+	Sequences without a header are version 1, which is the same grammar
+	without escaping and annotations, decoded leniently. Version 2 wrote the
+	arguments of a call sorted by name and without the positional flag.
+*/
+
+const SEQ_VERSION = 3
+const SEQ_HEADER = "sdfl-seq:3"
+
+// escapeSeqField escapes a value so it can be used as a single sequence field
+func escapeSeqField(value string) string {
+	value = strings.ReplaceAll(value, "\\", "\\\\")
+	value = strings.ReplaceAll(value, ":", "\\:")
+	value = strings.ReplaceAll(value, "\n", "\\n")
+	return value
+}
+
+// SplitSeqLine splits a line into its unescaped fields
+func SplitSeqLine(line string) []string {
+	fields := []string{}
+	field := strings.Builder{}
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if c == '\\' && i+1 < len(line) {
+			i++
+			if line[i] == 'n' {
+				field.WriteByte('\n')
+			} else {
+				field.WriteByte(line[i])
+			}
+		} else if c == ':' {
+			fields = append(fields, field.String())
+			field.Reset()
+		} else {
+			field.WriteByte(c)
+		}
+	}
+	return append(fields, field.String())
+}
+
+// SeqLine joins escaped fields into a sequence line
+func SeqLine(fields ...string) string {
+	escaped := make([]string, len(fields))
+	for i, field := range fields {
+		escaped[i] = escapeSeqField(field)
+	}
+	return strings.Join(escaped, ":")
+}
+
 func AST2Seq(prog Program) string {
-	var lines []string
+	lines := []string{SEQ_HEADER}
 
 	for _, stmt := range prog.Stmts {
 		lines = append(lines, stmtToLines(stmt)...)
@@ -19,6 +97,71 @@ func AST2Seq(prog Program) string {
 	return strings.Join(lines, "\n")
 }
 
+// canonicalize removes the details of expr that do not change the scene
+// (parentheses, annotations, literal spelling, arguments left at their default
+// or given in another order or without their name, if-else written as a ternary)
+func (fe *Frontend) canonicalize(expr *Expr) {
+	walkExpr(expr, func(e *Expr) bool {
+		e.HasParentheses = false
+		switch e.Type {
+		case AST_FUN_CALL:
+			fe.fillDefaults(e.FunCall, false)
+			e.FunCall.sortArgs(fe.functions[e.FunCall.Id].FunDefArgNames)
+			for i := range e.FunCall.Args {
+				e.FunCall.Args[i].Implicit = false
+				e.FunCall.Args[i].Positional = false
+			}
+		case AST_NUMBER:
+			e.Number.Tweak = false
+			if v, err := ParseNumberLiteral(e.Number.Value); err == nil {
+				e.Number.Value = formatNumber(v)
+			}
+		case AST_COND:
+			e.Cond.IfElse = false
+		case AST_TUPLE:
+			e.Tuple.Tweak = false
+			for i, value := range e.Tuple.Values {
+				if v, err := ParseNumberLiteral(value); err == nil {
+					e.Tuple.Values[i] = formatNumber(v)
+				}
+			}
+		}
+		return true
+	})
+}
+
+// CanonicalSeq is the sequence of prog with the details that do not change the
+// scene removed, equal scenes written differently have the same canonical sequence
+func CanonicalSeq(prog Program) string {
+	return defaultFrontend.CanonicalSeq(prog)
+}
+
+func (fe *Frontend) CanonicalSeq(prog Program) string {
+	canonical := CopyProgram(prog)
+	for _, stmt := range canonical.Stmts {
+		if stmt.FunDef != nil && stmt.FunDef.Expr != nil {
+			fe.canonicalize(stmt.FunDef.Expr)
+		}
+	}
+	fe.canonicalize(&canonical.Expr)
+	return AST2Seq(canonical)
+}
+
+// CanonicalExpr is the canonical sequence of a single expression
+func CanonicalExpr(expr Expr) string {
+	canonical := CopyExpr(expr)
+	defaultFrontend.canonicalize(&canonical)
+	return strings.Join(exprToLines(canonical), "\n")
+}
+
+func CanonicalHash(prog Program) string {
+	return defaultFrontend.CanonicalHash(prog)
+}
+
+func (fe *Frontend) CanonicalHash(prog Program) string {
+	return HashContent(fe.CanonicalSeq(prog))
+}
+
 func stmtToLines(stmt Stmt) []string {
 	switch stmt.Type {
 	case AST_FUN_DEF:
@@ -31,11 +174,17 @@ func stmtToLines(stmt Stmt) []string {
 func funDefToLines(funDef *FunDef) []string {
 	var lines []string
 
-	lines = append(lines, "fundef:"+funDef.Id+":"+strconv.Itoa(len(funDef.FunDefArgNames)))
+	lines = append(lines, SeqLine("fundef", funDef.Id, strconv.Itoa(len(funDef.FunDefArgNames))))
 
 	// add argument names
 	for _, argName := range funDef.FunDefArgNames {
-		lines = append(lines, "param:"+argName)
+		value, ok := funDef.FunDefDefaults[argName]
+		if !ok {
+			lines = append(lines, SeqLine("param", argName))
+			continue
+		}
+		lines = append(lines, SeqLine("param", argName, "default"))
+		lines = append(lines, exprToLines(value)...)
 	}
 
 	// add body expression
@@ -53,6 +202,10 @@ func exprToLines(expr Expr) []string {
 		lines = append(lines, "paren:open")
 	}
 
+	if (expr.Type == AST_NUMBER && expr.Number.Tweak) || (expr.Type == AST_TUPLE && expr.Tuple.Tweak) {
+		lines = append(lines, "annot:tweak")
+	}
+
 	switch expr.Type {
 	case AST_FUN_CALL:
 		lines = append(lines, funCallToLines(expr.FunCall)...)
@@ -66,6 +219,28 @@ func exprToLines(expr Expr) []string {
 		lines = append(lines, binopTermToLines(expr.BinopTerm)...)
 	case AST_BINOP_FACTOR:
 		lines = append(lines, binopFactorToLines(expr.BinopFactor)...)
+	case AST_BINOP_COMPARE:
+		lines = append(lines, operandsToLines(SeqLine("val", "cmp", expr.BinopCompare.Operator), expr.BinopCompare.Left, expr.BinopCompare.Right)...)
+	case AST_BINOP_LOGIC:
+		lines = append(lines, operandsToLines(SeqLine("val", "logic", expr.BinopLogic.Operator), expr.BinopLogic.Left, expr.BinopLogic.Right)...)
+	case AST_UNOP_NOT:
+		lines = append(lines, "val:not")
+		lines = append(lines, exprToLines(expr.UnopNot.Expr)...)
+	case AST_COND:
+		lines = append(lines, condToLines(expr.Cond)...)
+	case AST_VEC:
+		lines = append(lines, SeqLine("val", "vec", strconv.Itoa(len(expr.Vec.Exprs))))
+		for _, e := range expr.Vec.Exprs {
+			lines = append(lines, exprToLines(e)...)
+		}
+	case AST_VAR:
+		lines = append(lines, SeqLine("val", "var", expr.Var.Name))
+	case AST_STRING:
+		lines = append(lines, SeqLine("val", "string", expr.String.Value))
+	case AST_BOOL:
+		lines = append(lines, SeqLine("val", "bool", strconv.FormatBool(expr.Bool.Value)))
+	case AST_FOR:
+		lines = append(lines, forToLines(expr.For)...)
 	default:
 		lines = append(lines, "unknown_expr")
 	}
@@ -80,29 +255,17 @@ func exprToLines(expr Expr) []string {
 func funCallToLines(funCall *FunCall) []string {
 	var lines []string
 
-	lines = append(lines, "call:"+funCall.Id+":"+strconv.Itoa(len(funCall.FunNamedArgs)))
-
-	// process each argument in a consistent order (sorted by name for reproducibility)
-	if len(funCall.FunNamedArgs) > 0 {
-		argNames := make([]string, 0, len(funCall.FunNamedArgs))
-		for argName := range funCall.FunNamedArgs {
-			argNames = append(argNames, argName)
-		}
-
-		// sort argument names for consistent ordering
-		for i := 0; i < len(argNames); i++ {
-			for j := i + 1; j < len(argNames); j++ {
-				if argNames[i] > argNames[j] {
-					argNames[i], argNames[j] = argNames[j], argNames[i]
-				}
-			}
-		}
+	// default values filled in by Analyze are not part of the sequence
+	args := funCall.explicitArgs()
+	lines = append(lines, SeqLine("call", funCall.Id, strconv.Itoa(len(args))))
 
-		for _, argName := range argNames {
-			arg := funCall.FunNamedArgs[argName]
-			lines = append(lines, "arg:"+argName)
-			lines = append(lines, exprToLines(arg.Expr)...)
+	for _, arg := range args {
+		if arg.Positional {
+			lines = append(lines, SeqLine("arg", arg.ArgName, "positional"))
+		} else {
+			lines = append(lines, SeqLine("arg", arg.ArgName))
 		}
+		lines = append(lines, exprToLines(arg.Expr)...)
 	}
 
 	return lines
@@ -114,10 +277,8 @@ func tupleToLines(tuple *Tuple) []string {
 	lines = append(lines, "val:tuple")
 
 	// Add the actual tuple values as a formatted line
-	if len(tuple.Values) > 0 {
-		tupleStr := "(" + strings.Join(tuple.Values, ", ") + ")"
-		lines = append(lines, "literal:"+tupleStr)
-	}
+	tupleStr := "(" + strings.Join(tuple.Values, ", ") + ")"
+	lines = append(lines, SeqLine("literal", tupleStr))
 
 	return lines
 }
@@ -140,7 +301,7 @@ func numberToLines(number *Number) []string {
 	var lines []string
 
 	lines = append(lines, "val:number")
-	lines = append(lines, "literal:"+number.Value)
+	lines = append(lines, SeqLine("literal", number.Value))
 
 	return lines
 }
@@ -149,7 +310,7 @@ func numberToLines(number *Number) []string {
 func binopTermToLines(binop *BinopTerm) []string {
 	var lines []string
 
-	lines = append(lines, "val:binopt:"+binop.Operator)
+	lines = append(lines, SeqLine("val", "binopt", binop.Operator))
 	lines = append(lines, "left")
 	lines = append(lines, exprToLines(binop.Left)...)
 	lines = append(lines, "right")
@@ -162,7 +323,7 @@ func binopTermToLines(binop *BinopTerm) []string {
 func binopFactorToLines(binop *BinopFactor) []string {
 	var lines []string
 
-	lines = append(lines, "val:binopf:"+binop.Operator)
+	lines = append(lines, SeqLine("val", "binopf", binop.Operator))
 	lines = append(lines, "left")
 	lines = append(lines, exprToLines(binop.Left)...)
 	lines = append(lines, "right")
@@ -171,6 +332,39 @@ func binopFactorToLines(binop *BinopFactor) []string {
 	return lines
 }
 
+// operandsToLines converts a comparison or a logic operation to lines
+func operandsToLines(head string, left Expr, right Expr) []string {
+	lines := []string{head, "left"}
+	lines = append(lines, exprToLines(left)...)
+	lines = append(lines, "right")
+	lines = append(lines, exprToLines(right)...)
+	return lines
+}
+
+func condToLines(cond *Cond) []string {
+	style := "ternary"
+	if cond.IfElse {
+		style = "if"
+	}
+
+	lines := []string{SeqLine("val", "cond", style), "cond"}
+	lines = append(lines, exprToLines(cond.Cond)...)
+	lines = append(lines, "then")
+	lines = append(lines, exprToLines(cond.Then)...)
+	lines = append(lines, "else")
+	lines = append(lines, exprToLines(cond.Else)...)
+	return lines
+}
+
+func forToLines(loop *For) []string {
+	lines := []string{SeqLine("val", "for", loop.Var), "from"}
+	lines = append(lines, exprToLines(loop.From)...)
+	lines = append(lines, "to")
+	lines = append(lines, exprToLines(loop.To)...)
+	lines = append(lines, arrExprToLines(&loop.Body)...)
+	return lines
+}
+
 // WriteSequenceToFile writes the AST sequence to a file
 func WriteSequenceToFile(prog Program, filename string, sequence string) error {
 	file, err := os.Create(filename)
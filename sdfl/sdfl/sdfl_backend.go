@@ -0,0 +1,89 @@
+package sdfl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// shader backends
+//
+// A backend generates the shaders of an analyzed program in one shading
+// language, it is chosen with SetTarget. glsl430 is the desktop runtime: a
+// fragment shader with every render mode and a compute shader sampling the
+// distance field. The portable backends write a single fragment shader for
+// viewers on the web and in game engines, with the normal render mode only.
+
+type Backend interface {
+	// Name selects the backend, like glsl430
+	Name() string
+	// Generate generates the shaders of prog, errors are reported as diagnostics
+	Generate(prog *Program) []ShaderFile
+	// Uniforms the runtime sets, the hoisted literals of the tweak mode come on top
+	Uniforms() []ShaderUniform
+}
+
+// ShaderFile is a generated shader, Stage is fragment or compute
+type ShaderFile struct {
+	Stage string
+	Name  string
+	Code  string
+}
+
+var backends = []Backend{
+	glsl430Backend{},
+	&portableBackend{name: "glsl-es300", file: "out_frag_es300.glsl", lang: glslESLanguage{}},
+	&portableBackend{name: "wgsl", file: "out_frag.wgsl", lang: wgslLanguage{}},
+	&portableBackend{name: "hlsl", file: "out_frag.hlsl", lang: hlslLanguage{}},
+	&portableBackend{name: "msl", file: "out_frag.metal", lang: mslLanguage{}},
+	&portableBackend{name: "shadertoy", file: "out_shadertoy.glsl", lang: shadertoyLanguage{}, fixedInputs: true},
+}
+
+var target = backends[0]
+var generatedShaders = []ShaderFile{}
+
+func TargetNames() []string {
+	names := []string{}
+	for _, backend := range backends {
+		names = append(names, backend.Name())
+	}
+	return names
+}
+
+func SetTarget(name string) error {
+	for _, backend := range backends {
+		if backend.Name() == name {
+			target = backend
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown target %s, expected one of %s", name, strings.Join(TargetNames(), ", "))
+}
+
+// Generate generates the shaders of prog for the target
+func Generate(prog *Program) {
+	generatedShaders = target.Generate(prog)
+}
+
+// GetShaders returns the shaders of the last Generate call
+func GetShaders() []ShaderFile {
+	return generatedShaders
+}
+
+type glsl430Backend struct{}
+
+func (glsl430Backend) Name() string {
+	return "glsl430"
+}
+
+func (glsl430Backend) Generate(prog *Program) []ShaderFile {
+	prog.generate()
+	return []ShaderFile{
+		{Stage: "fragment", Name: "out_frag.glsl", Code: GetFragmentCode()},
+		{Stage: "compute", Name: "out_compute.glsl", Code: GetComputeCode()},
+	}
+}
+
+func (glsl430Backend) Uniforms() []ShaderUniform {
+	uniforms := append([]ShaderUniform{}, fragmentUniforms...)
+	return append(uniforms, computeUniforms...)
+}
@@ -0,0 +1,122 @@
+package sdfl
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of testdata/golden")
+
+// portableTargets are the targets checked by checkShaderSyntax and the validators
+var portableTargets = []string{"glsl-es300", "wgsl", "hlsl", "msl", "shadertoy"}
+
+// checkGolden compares code with the golden file testdata/golden/name, -update rewrites it
+func checkGolden(t *testing.T, name string, code string) {
+	t.Helper()
+	path := filepath.Join("testdata", "golden", name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(code), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v, run the tests with -update to write it", err)
+	}
+	if string(golden) != code {
+		t.Errorf("%s differs from the generated code, run the tests with -update if the change is intended\n%s", path, firstDifference(string(golden), code))
+	}
+}
+
+// firstDifference describes the first line where want and got differ
+func firstDifference(want, got string) string {
+	wantLines, gotLines := strings.Split(want, "\n"), strings.Split(got, "\n")
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		w, g := "", ""
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			return "line " + formatNumber(float64(i+1)) + ":\n- " + w + "\n+ " + g
+		}
+	}
+	return ""
+}
+
+func TestBackendGoldens(t *testing.T) {
+	for _, scene := range []string{"features.sdfl", "reflections.sdfl"} {
+		prog := parseFile(t, scene)
+		for _, name := range portableTargets {
+			for _, shader := range generateTarget(t, &prog, name) {
+				checkGolden(t, strings.TrimSuffix(scene, ".sdfl")+"/"+shader.Name, shader.Code)
+				if err := checkShaderSyntax(name, shader.Code); err != nil {
+					t.Errorf("%s %s: %v", scene, name, err)
+				}
+			}
+		}
+	}
+}
+
+func TestBackendValidators(t *testing.T) {
+	for _, name := range portableTargets {
+		t.Run(name, func(t *testing.T) {
+			for _, scene := range []string{"features.sdfl", "reflections.sdfl"} {
+				prog := parseFile(t, scene)
+				for _, shader := range generateTarget(t, &prog, name) {
+					validateShader(t, name, shader.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestBackendTweaksSyntax(t *testing.T) {
+	prog := parseFile(t, "features.sdfl")
+	SetTweakMode(TWEAK_ALL)
+	defer SetTweakMode(TWEAK_NONE)
+	for _, name := range portableTargets {
+		if name == "shadertoy" {
+			// shadertoy can not declare the uniforms of tweaked literals
+			continue
+		}
+		for _, shader := range generateTarget(t, &prog, name) {
+			if err := checkShaderSyntax(name, shader.Code); err != nil {
+				t.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+}
+
+func TestSyntaxCheckerRejects(t *testing.T) {
+	for _, tc := range []struct {
+		target string
+		code   string
+		want   string
+	}{
+		{"glsl-es300", "precision highp float;\nvoid main() {}\n", "have to start with"},
+		{"glsl-es300", "#version 300 es\nfloat f() { return (1.0; }\n", "unbalanced }"},
+		{"glsl-es300", "#version 300 es\nfloat f() { return 1.0;\n", "{ is not closed"},
+		{"hlsl", "float3 f(float3 a, float3 b) { return mix(a, b, 0.5); }\n", "undeclared function mix"},
+		{"msl", "float f(float a) { return radians(a); }\n", "undeclared function radians"},
+		{"wgsl", "fn f(a: f32) -> f32 { return a > 0. ? a : -a; }\n", "no conditional operator"},
+		{"wgsl", "fn f(a: f32) -> f32 { return mod(a, 2.); }\n", "undeclared function mod"},
+		{"wgsl", "// mod(a, 2.) is not a call\nfn f(a: f32) -> f32 { return a; }\n", ""},
+	} {
+		err := checkShaderSyntax(tc.target, tc.code)
+		if tc.want == "" && err != nil {
+			t.Errorf("%s %q: got %v, want no error", tc.target, tc.code, err)
+		} else if tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)) {
+			t.Errorf("%s %q: got %v, want an error with %q", tc.target, tc.code, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package sdfl
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// conservative axis aligned bounding boxes of scene subtrees
+
+type AABB struct {
+	Min [3]float64 `json:"min"`
+	Max [3]float64 `json:"max"`
+}
+
+func (b AABB) union(o AABB) AABB {
+	for i := 0; i < 3; i++ {
+		b.Min[i] = math.Min(b.Min[i], o.Min[i])
+		b.Max[i] = math.Max(b.Max[i], o.Max[i])
+	}
+	return b
+}
+
+func (b AABB) intersect(o AABB) AABB {
+	for i := 0; i < 3; i++ {
+		b.Min[i] = math.Max(b.Min[i], o.Min[i])
+		b.Max[i] = math.Min(b.Max[i], o.Max[i])
+	}
+	return b
+}
+
+func (b AABB) pad(amount float64) AABB {
+	for i := 0; i < 3; i++ {
+		b.Min[i] -= amount
+		b.Max[i] += amount
+	}
+	return b
+}
+
+func (b AABB) Center() [3]float64 {
+	return [3]float64{(b.Min[0] + b.Max[0]) * 0.5, (b.Min[1] + b.Max[1]) * 0.5, (b.Min[2] + b.Max[2]) * 0.5}
+}
+
+func (b AABB) HalfSize() [3]float64 {
+	return [3]float64{(b.Max[0] - b.Min[0]) * 0.5, (b.Max[1] - b.Min[1]) * 0.5, (b.Max[2] - b.Min[2]) * 0.5}
+}
+
+func aabbAround(center [3]float64, extent [3]float64) AABB {
+	return AABB{
+		Min: [3]float64{center[0] - extent[0], center[1] - extent[1], center[2] - extent[2]},
+		Max: [3]float64{center[0] + extent[0], center[1] + extent[1], center[2] + extent[2]},
+	}
+}
+
+// rotationColumns returns the columns of sdfl_RotationMatrix for angles in radians
+func rotationColumns(angles [3]float64) [3][3]float64 {
+	cx, sx := math.Cos(angles[0]), math.Sin(angles[0])
+	cy, sy := math.Cos(angles[1]), math.Sin(angles[1])
+	cz, sz := math.Cos(angles[2]), math.Sin(angles[2])
+
+	return [3][3]float64{
+		{cy * cz, cz*sx*sy - cx*sz, sx*sz + cx*cz*sy},
+		{cy * sz, cx*cz + sx*sy*sz, cx*sy*sz - cz*sx},
+		{-sy, cy * sx, cx * cy},
+	}
+}
+
+// rotate computes M * v like GLSL does with the column major matrix
+func rotate(columns [3][3]float64, v [3]float64) [3]float64 {
+	r := [3]float64{}
+	for i := 0; i < 3; i++ {
+		r[i] = columns[0][i]*v[0] + columns[1][i]*v[1] + columns[2][i]*v[2]
+	}
+	return r
+}
+
+// rotateInverse computes transpose(M) * v, the inverse of rotate
+func rotateInverse(columns [3][3]float64, v [3]float64) [3]float64 {
+	r := [3]float64{}
+	for i := 0; i < 3; i++ {
+		r[i] = columns[i][0]*v[0] + columns[i][1]*v[1] + columns[i][2]*v[2]
+	}
+	return r
+}
+
+func funCallArgFloat(funCall *FunCall, name string) (float64, bool) {
+	arg, ok := funCall.Arg(name)
+	if !ok {
+		return 0, false
+	}
+	return evalConstFloat(&arg.Expr)
+}
+
+func funCallArgVec3(funCall *FunCall, name string) ([3]float64, bool) {
+	arg, ok := funCall.Arg(name)
+	if !ok {
+		return [3]float64{}, false
+	}
+	return evalConstVec3(&arg.Expr)
+}
+
+// boundsOf returns the bounds of the shape expr describes, false when it is
+// unbounded (plane) or depends on values only known at runtime (time())
+func boundsOf(expr *Expr) (AABB, bool) {
+	if expr.Type == AST_COND {
+		// a shape chosen at runtime is inside the bounds of both branches
+		if branch, ok := constBranch(expr.Cond); ok {
+			return boundsOf(branch)
+		}
+		b1, ok1 := boundsOf(&expr.Cond.Then)
+		b2, ok2 := boundsOf(&expr.Cond.Else)
+		return b1.union(b2), ok1 && ok2
+	}
+	if expr.Type != AST_FUN_CALL {
+		return AABB{}, false
+	}
+	funCall := expr.FunCall
+	funDef, ok := functionSymbols[funCall.Id]
+	if !ok {
+		return AABB{}, false
+	}
+
+	switch funDef.SymbolType {
+	case FUN_BUILTIN_SHAPE:
+		return shapeBounds(funCall)
+
+	case FUN_BUILTIN_OP:
+		child1, ok1 := funCall.Arg("child1")
+		child2, ok2 := funCall.Arg("child2")
+		if !ok1 || !ok2 {
+			return AABB{}, false
+		}
+		b1, ok1 := boundsOf(&child1.Expr)
+		b2, ok2 := boundsOf(&child2.Expr)
+
+		switch funCall.Id {
+		case "union":
+			return b1.union(b2), ok1 && ok2
+		case "smoothUnion":
+			// the smooth minimum is at most k/4 below the exact one
+			k, ok := funCallArgFloat(funCall, "smooth_transition")
+			return b1.union(b2).pad(math.Abs(k) / 4.0), ok1 && ok2 && ok
+		case "subtraction", "smoothSubtraction":
+			// both never go below the distance of child2
+			return b2, ok2
+		case "intersection", "smoothIntersection":
+			if ok1 && ok2 {
+				return b1.intersect(b2), true
+			} else if ok1 {
+				return b1, true
+			}
+			return b2, ok2
+		}
+
+	case FUN_BUILTIN_ROTATE_AROUND:
+		child, ok := funCall.Arg("child")
+		if !ok {
+			return AABB{}, false
+		}
+		b, ok := boundsOf(&child.Expr)
+		pivot, okPivot := funCallArgVec3(funCall, "position")
+		degrees, okRotation := funCallArgVec3(funCall, "rotation")
+		if !ok || !okPivot || !okRotation {
+			return AABB{}, false
+		}
+
+		return rotatedBounds(b, pivot, degrees), true
+
+	case FUN_USER_DEFINED:
+		if funDef.Expr == nil || funDef.Expr.FunCall == nil {
+			return AABB{}, false
+		}
+		children, ok := funDef.Expr.FunCall.Arg("children")
+		if !ok || children.Expr.ArrExpr == nil {
+			return AABB{}, false
+		}
+		return boundsOfChildren(children.Expr.ArrExpr.Exprs)
+	}
+
+	return AABB{}, false
+}
+
+// rotatedBounds returns the world space bounds of a child of rotateAround
+// with the bounds b, rotation is in degrees
+func rotatedBounds(b AABB, pivot [3]float64, degrees [3]float64) AABB {
+	// the child is evaluated at M * (p - pivot) + pivot, so its
+	// corners are moved to world space with the inverse rotation
+	columns := rotationColumns([3]float64{degrees[0] * math.Pi / 180.0, degrees[1] * math.Pi / 180.0, degrees[2] * math.Pi / 180.0})
+	var world AABB
+	for i := 0; i < 8; i++ {
+		corner := [3]float64{b.Min[0], b.Min[1], b.Min[2]}
+		for axis := 0; axis < 3; axis++ {
+			if i&(1<<axis) != 0 {
+				corner[axis] = b.Max[axis]
+			}
+		}
+		local := [3]float64{corner[0] - pivot[0], corner[1] - pivot[1], corner[2] - pivot[2]}
+		r := rotateInverse(columns, local)
+		p := [3]float64{r[0] + pivot[0], r[1] + pivot[1], r[2] + pivot[2]}
+		if i == 0 {
+			world = AABB{Min: p, Max: p}
+		} else {
+			world = world.union(AABB{Min: p, Max: p})
+		}
+	}
+	return world
+}
+
+func boundsOfChildren(exprs []Expr) (AABB, bool) {
+	var bounds AABB
+	if len(exprs) == 0 {
+		return bounds, false
+	}
+	for i := range exprs {
+		b, ok := boundsOf(&exprs[i])
+		if !ok {
+			return AABB{}, false
+		}
+		if i == 0 {
+			bounds = b
+		} else {
+			bounds = bounds.union(b)
+		}
+	}
+	return bounds, true
+}
+
+func shapeBounds(funCall *FunCall) (AABB, bool) {
+	switch funCall.Id {
+	case "sphere":
+		pos, ok1 := funCallArgVec3(funCall, "position")
+		r, ok2 := funCallArgFloat(funCall, "radius")
+		r = math.Abs(r)
+		return aabbAround(pos, [3]float64{r, r, r}), ok1 && ok2
+	case "ellipsoid":
+		pos, ok1 := funCallArgVec3(funCall, "position")
+		r, ok2 := funCallArgVec3(funCall, "radius")
+		return aabbAround(pos, [3]float64{math.Abs(r[0]), math.Abs(r[1]), math.Abs(r[2])}), ok1 && ok2
+	case "box":
+		pos, ok1 := funCallArgVec3(funCall, "position")
+		size, ok2 := funCallArgVec3(funCall, "size")
+		return aabbAround(pos, [3]float64{math.Abs(size[0]), math.Abs(size[1]), math.Abs(size[2])}), ok1 && ok2
+	case "torus":
+		pos, ok1 := funCallArgVec3(funCall, "position")
+		r, ok2 := funCallArgFloat(funCall, "radius")
+		t, ok3 := funCallArgFloat(funCall, "thickness")
+		outer := math.Abs(r) + math.Abs(t)
+		return aabbAround(pos, [3]float64{outer, math.Abs(t), outer}), ok1 && ok2 && ok3
+	case "cylinder":
+		a, ok1 := funCallArgVec3(funCall, "begin")
+		b, ok2 := funCallArgVec3(funCall, "end")
+		r, ok3 := funCallArgFloat(funCall, "radius")
+		r = math.Abs(r)
+		bounds := AABB{Min: a, Max: a}.union(AABB{Min: b, Max: b})
+		return bounds.pad(r), ok1 && ok2 && ok3
+	}
+	// plane and unknown shapes are unbounded
+	return AABB{}, false
+}
+
+// SceneBounds is the union of the bounded scene children, Unbounded is set
+// when some children (like a plane) could not be included
+type SceneBounds struct {
+	Bounds    *AABB `json:"bounds"`
+	Unbounded bool  `json:"unbounded"`
+}
+
+// MarshalJSON writes missing bounds as an empty object, like the bounds of a
+// scene that did not compile
+func (s SceneBounds) MarshalJSON() ([]byte, error) {
+	type fields SceneBounds
+	if s.Bounds == nil {
+		return json.Marshal(struct {
+			Bounds    struct{} `json:"bounds"`
+			Unbounded bool     `json:"unbounded"`
+		}{Unbounded: s.Unbounded})
+	}
+	return json.Marshal(fields(s))
+}
+
+func GetSceneBounds(prog *Program) SceneBounds {
+	result := SceneBounds{}
+	sceneCall := prog.Expr.FunCall
+	if sceneCall == nil {
+		return result
+	}
+	children, ok := sceneCall.Arg("children")
+	if !ok || children.Expr.ArrExpr == nil {
+		return result
+	}
+
+	for i := range children.Expr.ArrExpr.Exprs {
+		b, ok := boundsOf(&children.Expr.ArrExpr.Exprs[i])
+		if !ok {
+			result.Unbounded = true
+			continue
+		}
+		if result.Bounds == nil {
+			result.Bounds = &b
+		} else {
+			u := result.Bounds.union(b)
+			result.Bounds = &u
+		}
+	}
+	return result
+}
@@ -0,0 +1,189 @@
+package sdfl
+
+import "math"
+
+// compile time evaluation of constant expressions
+
+// Go counterparts of the FUN_BUILTIN_GLSL functions, in FunDefArgNames order
+var glslBuiltinEval = map[string]func(args []float64) float64{
+	"radians":     func(a []float64) float64 { return a[0] * math.Pi / 180.0 },
+	"degrees":     func(a []float64) float64 { return a[0] * 180.0 / math.Pi },
+	"sin":         func(a []float64) float64 { return math.Sin(a[0]) },
+	"cos":         func(a []float64) float64 { return math.Cos(a[0]) },
+	"tan":         func(a []float64) float64 { return math.Tan(a[0]) },
+	"asin":        func(a []float64) float64 { return math.Asin(a[0]) },
+	"acos":        func(a []float64) float64 { return math.Acos(a[0]) },
+	"atan":        func(a []float64) float64 { return math.Atan(a[0]) },
+	"sinh":        func(a []float64) float64 { return math.Sinh(a[0]) },
+	"cosh":        func(a []float64) float64 { return math.Cosh(a[0]) },
+	"tanh":        func(a []float64) float64 { return math.Tanh(a[0]) },
+	"asinh":       func(a []float64) float64 { return math.Asinh(a[0]) },
+	"acosh":       func(a []float64) float64 { return math.Acosh(a[0]) },
+	"atanh":       func(a []float64) float64 { return math.Atanh(a[0]) },
+	"pow":         func(a []float64) float64 { return math.Pow(a[0], a[1]) },
+	"exp":         func(a []float64) float64 { return math.Exp(a[0]) },
+	"log":         func(a []float64) float64 { return math.Log(a[0]) },
+	"exp2":        func(a []float64) float64 { return math.Exp2(a[0]) },
+	"log2":        func(a []float64) float64 { return math.Log2(a[0]) },
+	"sqrt":        func(a []float64) float64 { return math.Sqrt(a[0]) },
+	"inversesqrt": func(a []float64) float64 { return 1.0 / math.Sqrt(a[0]) },
+}
+
+// evalConstFloat evaluates expr if it only depends on literals, a literal
+// marked @tweak may become a uniform and is not constant
+func evalConstFloat(expr *Expr) (float64, bool) {
+	switch expr.Type {
+	case AST_NUMBER:
+		if expr.Number.Tweak {
+			return 0, false
+		}
+		v, err := ParseNumberLiteral(expr.Number.Value)
+		return v, err == nil
+	case AST_BINOP_TERM:
+		return evalConstBinop(&expr.BinopTerm.Left, &expr.BinopTerm.Right, expr.BinopTerm.Operator)
+	case AST_BINOP_FACTOR:
+		return evalConstBinop(&expr.BinopFactor.Left, &expr.BinopFactor.Right, expr.BinopFactor.Operator)
+	case AST_COND:
+		if branch, ok := constBranch(expr.Cond); ok {
+			return evalConstFloat(branch)
+		}
+		return 0, false
+	case AST_FUN_CALL:
+		eval, ok := glslBuiltinEval[expr.FunCall.Id]
+		if !ok {
+			return 0, false
+		}
+		args := []float64{}
+		for _, argName := range functionSymbols[expr.FunCall.Id].FunDefArgNames {
+			arg, ok := expr.FunCall.Arg(argName)
+			if !ok {
+				return 0, false
+			}
+			v, ok := evalConstFloat(&arg.Expr)
+			if !ok {
+				return 0, false
+			}
+			args = append(args, v)
+		}
+		v := eval(args)
+		return v, !math.IsNaN(v) && !math.IsInf(v, 0)
+	}
+	return 0, false
+}
+
+func evalConstBinop(left *Expr, right *Expr, operator string) (float64, bool) {
+	l, ok := evalConstFloat(left)
+	if !ok {
+		return 0, false
+	}
+	r, ok := evalConstFloat(right)
+	if !ok {
+		return 0, false
+	}
+
+	switch operator {
+	case "+":
+		return l + r, true
+	case "-":
+		return l - r, true
+	case "*":
+		return l * r, true
+	case "/":
+		if r == 0 {
+			return 0, false
+		}
+		return l / r, true
+	}
+	return 0, false
+}
+
+// evalConstBool evaluates a condition if it only depends on literals
+func evalConstBool(expr *Expr) (bool, bool) {
+	switch expr.Type {
+	case AST_BINOP_COMPARE:
+		l, okL := evalConstFloat(&expr.BinopCompare.Left)
+		r, okR := evalConstFloat(&expr.BinopCompare.Right)
+		if !okL || !okR {
+			return false, false
+		}
+		switch expr.BinopCompare.Operator {
+		case "<":
+			return l < r, true
+		case "<=":
+			return l <= r, true
+		case "==":
+			return l == r, true
+		case "!=":
+			return l != r, true
+		case ">":
+			return l > r, true
+		case ">=":
+			return l >= r, true
+		}
+	case AST_BINOP_LOGIC:
+		l, okL := evalConstBool(&expr.BinopLogic.Left)
+		r, okR := evalConstBool(&expr.BinopLogic.Right)
+		// one known side can decide the result on its own
+		if expr.BinopLogic.Operator == "and" {
+			if (okL && !l) || (okR && !r) {
+				return false, true
+			}
+			return true, okL && okR
+		}
+		if (okL && l) || (okR && r) {
+			return true, true
+		}
+		return false, okL && okR
+	case AST_UNOP_NOT:
+		v, ok := evalConstBool(&expr.UnopNot.Expr)
+		return !v, ok
+	}
+	return false, false
+}
+
+// constBranch is the branch a conditional takes when its condition is constant
+func constBranch(cond *Cond) (*Expr, bool) {
+	v, ok := evalConstBool(&cond.Cond)
+	if !ok {
+		return nil, false
+	}
+	if v {
+		return &cond.Then, true
+	}
+	return &cond.Else, true
+}
+
+// evalConstVec3 evaluates a tuple of literals, or a vector of constant values
+func evalConstVec3(expr *Expr) ([3]float64, bool) {
+	v := [3]float64{}
+	if expr.Type == AST_COND {
+		if branch, ok := constBranch(expr.Cond); ok {
+			return evalConstVec3(branch)
+		}
+		return v, false
+	}
+	if expr.Type == AST_VEC {
+		if len(expr.Vec.Exprs) < 3 {
+			return v, false
+		}
+		for i := 0; i < 3; i++ {
+			f, ok := evalConstFloat(&expr.Vec.Exprs[i])
+			if !ok {
+				return v, false
+			}
+			v[i] = f
+		}
+		return v, true
+	}
+	if expr.Type != AST_TUPLE || len(expr.Tuple.Values) < 3 {
+		return v, false
+	}
+	for i := 0; i < 3; i++ {
+		f, err := ParseNumberLiteral(expr.Tuple.Values[i])
+		if err != nil {
+			return v, false
+		}
+		v[i] = f
+	}
+	return v, true
+}
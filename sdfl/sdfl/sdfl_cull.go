@@ -0,0 +1,288 @@
+package sdfl
+
+import (
+	"math"
+	"sort"
+)
+
+// bounding volume culling
+//
+// Children of a scene or of a function are pushed to a buffer that only keeps
+// the closest distance so far. A child whose distance can not get below the
+// distance to a box around it is skipped while that box is farther away than
+// the buffer, it would not have been pushed anyway. The bounded children are
+// sorted into a tree of such boxes so most of them are skipped by a few tests.
+//
+// This needs cullBounds to hold the whole distance of a shape, not only its
+// surface like boundsOf: ellipsoids and planes are never culled and neither
+// are calls of user defined functions, their local buffer is shared by all
+// calls. Values that change at runtime (time(), tweaked literals) make a
+// subtree unbounded as well.
+//
+// Culling changes the order the children are pushed in: the unbounded ones
+// come first, the others in the order of the tree. Distances do not depend on
+// it, but of two children at exactly the same distance the one pushed first
+// keeps its material, which is not always the first one of the source.
+
+var cullingEnabled = true
+
+func SetCulling(enabled bool) {
+	cullingEnabled = enabled
+}
+
+// guards are widened by cullMargin against the rounding of 32 bit floats
+const cullMargin = 0.001
+
+// guards are only worth their box when they skip this many shapes
+const cullMinShapes = 2
+
+// cullNode is a node of the bounding volume tree, a leaf holds one child
+type cullNode struct {
+	bounds   AABB
+	center   [3]float64 // the guard box, bounds rounded outwards
+	half     [3]float64
+	shapes   int
+	expr     *Expr
+	children []*cullNode
+}
+
+func (node *cullNode) guarded() bool {
+	return node.shapes >= cullMinShapes
+}
+
+// planCulling returns the children that are always evaluated and the tree of
+// the others, which is nil when there are none or culling is disabled
+func planCulling(exprs []Expr) ([]*Expr, *cullNode) {
+	unbounded := []*Expr{}
+	leaves := []*cullNode{}
+	for i := range exprs {
+		b, ok := cullBounds(&exprs[i])
+		if !cullingEnabled || !ok {
+			unbounded = append(unbounded, &exprs[i])
+			continue
+		}
+		leaves = append(leaves, newCullNode(b.pad(cullMargin), countShapes(&exprs[i]), &exprs[i]))
+	}
+	if len(leaves) == 0 {
+		return unbounded, nil
+	}
+	return unbounded, buildCullTree(leaves)
+}
+
+// newCullNode rounds the guard box of bounds outwards to thousandths, so the
+// generated guards stay readable
+func newCullNode(bounds AABB, shapes int, expr *Expr) *cullNode {
+	node := &cullNode{bounds: bounds, shapes: shapes, expr: expr}
+	for i := 0; i < 3; i++ {
+		node.center[i] = math.Round((bounds.Min[i]+bounds.Max[i])*500) / 1000
+		node.half[i] = math.Ceil(math.Max(bounds.Max[i]-node.center[i], node.center[i]-bounds.Min[i])*1000) / 1000
+	}
+	return node
+}
+
+// buildCullTree splits the leaves in half along the longest axis of their centers
+func buildCullTree(leaves []*cullNode) *cullNode {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+	bounds, shapes := leaves[0].bounds, 0
+	centers := AABB{Min: leaves[0].bounds.Center(), Max: leaves[0].bounds.Center()}
+	for _, leaf := range leaves {
+		bounds = bounds.union(leaf.bounds)
+		shapes += leaf.shapes
+		centers = centers.union(AABB{Min: leaf.bounds.Center(), Max: leaf.bounds.Center()})
+	}
+	node := newCullNode(bounds, shapes, nil)
+	axis := 0
+	extent := centers.HalfSize()
+	for i := 1; i < 3; i++ {
+		if extent[i] > extent[axis] {
+			axis = i
+		}
+	}
+	sort.SliceStable(leaves, func(i, j int) bool {
+		return leaves[i].bounds.Center()[axis] < leaves[j].bounds.Center()[axis]
+	})
+	half := len(leaves) / 2
+	node.children = []*cullNode{buildCullTree(leaves[:half]), buildCullTree(leaves[half:])}
+	return node
+}
+
+// countShapes counts the primitives evaluated for expr
+func countShapes(expr *Expr) int {
+	count := 0
+	walkExpr(expr, func(e *Expr) bool {
+		if e.Type == AST_FUN_CALL && functionSymbols[e.FunCall.Id].SymbolType == FUN_BUILTIN_SHAPE {
+			count++
+		}
+		return true
+	})
+	return count
+}
+
+// cullBounds returns a box b such that the distance of expr is at least
+// sdBox(p, b) everywhere, false when there is none
+func cullBounds(expr *Expr) (AABB, bool) {
+	if expr.Type == AST_COND {
+		if v, ok := foldBool(&expr.Cond.Cond); ok {
+			if v {
+				return cullBounds(&expr.Cond.Then)
+			}
+			return cullBounds(&expr.Cond.Else)
+		}
+		b1, ok1 := cullBounds(&expr.Cond.Then)
+		b2, ok2 := cullBounds(&expr.Cond.Else)
+		return b1.union(b2), ok1 && ok2
+	}
+	if expr.Type != AST_FUN_CALL {
+		return AABB{}, false
+	}
+	funCall := expr.FunCall
+	funDef, ok := functionSymbols[funCall.Id]
+	if !ok {
+		return AABB{}, false
+	}
+
+	switch funDef.SymbolType {
+	case FUN_BUILTIN_SHAPE:
+		return cullShapeBounds(funCall)
+
+	case FUN_BUILTIN_OP:
+		child1, ok1 := funCall.Arg("child1")
+		child2, ok2 := funCall.Arg("child2")
+		if !ok1 || !ok2 {
+			return AABB{}, false
+		}
+		b1, ok1 := cullBounds(&child1.Expr)
+		b2, ok2 := cullBounds(&child2.Expr)
+		k := 0.0
+		if _, ok := funCall.Arg("smooth_transition"); ok {
+			// the smooth operations are only bounded by their children for a positive k
+			v, ok := cullArg(funCall, "smooth_transition")
+			if !ok || v[0] <= 0 {
+				return AABB{}, false
+			}
+			k = v[0]
+		}
+
+		switch funCall.Id {
+		case "union", "smoothUnion":
+			// the smooth minimum is at most k/4 below the minimum
+			return b1.union(b2).pad(k / 4.0), ok1 && ok2
+		case "subtraction", "smoothSubtraction":
+			// at least the distance of child2
+			return b2, ok2
+		case "intersection", "smoothIntersection":
+			// at least the distance of either child, the smaller box culls more
+			if ok1 && (!ok2 || volume(b1) < volume(b2)) {
+				return b1, true
+			}
+			return b2, ok2
+		}
+
+	case FUN_BUILTIN_ROTATE_AROUND:
+		child, ok := funCall.Arg("child")
+		if !ok {
+			return AABB{}, false
+		}
+		b, ok := cullBounds(&child.Expr)
+		pivot, okPivot := cullArg(funCall, "position")
+		degrees, okRotation := cullArg(funCall, "rotation")
+		if !ok || !okPivot || !okRotation {
+			return AABB{}, false
+		}
+		// rotations keep distances
+		return rotatedBounds(b, pivot, degrees), true
+	}
+	return AABB{}, false
+}
+
+func cullShapeBounds(funCall *FunCall) (AABB, bool) {
+	switch funCall.Id {
+	case "sphere":
+		pos, ok1 := cullArg(funCall, "position")
+		r, ok2 := cullArg(funCall, "radius")
+		return aabbAround(pos, splat(math.Abs(r[0]))), ok1 && ok2
+	case "box":
+		pos, ok1 := cullArg(funCall, "position")
+		size, ok2 := cullArg(funCall, "size")
+		return aabbAround(pos, [3]float64{math.Abs(size[0]), math.Abs(size[1]), math.Abs(size[2])}), ok1 && ok2
+	case "torus":
+		pos, ok1 := cullArg(funCall, "position")
+		r, ok2 := cullArg(funCall, "radius")
+		t, ok3 := cullArg(funCall, "thickness")
+		outer := math.Abs(r[0]) + math.Abs(t[0])
+		return aabbAround(pos, [3]float64{outer, math.Abs(t[0]), outer}), ok1 && ok2 && ok3
+	case "cylinder":
+		a, ok1 := cullArg(funCall, "begin")
+		b, ok2 := cullArg(funCall, "end")
+		r, ok3 := cullArg(funCall, "radius")
+		bounds := AABB{Min: a, Max: a}.union(AABB{Min: b, Max: b})
+		return bounds.pad(r[0]), ok1 && ok2 && ok3 && r[0] >= 0
+	}
+	// the distance of an ellipsoid is below the distance to its surface,
+	// far away from it by the ratio of its smallest and largest radius
+	return AABB{}, false
+}
+
+// cullArg evaluates an argument that does not change at runtime, floats are splatted
+func cullArg(funCall *FunCall, name string) ([3]float64, bool) {
+	arg, ok := funCall.Arg(name)
+	if !ok || !constant(&arg.Expr) {
+		return [3]float64{}, false
+	}
+	v := (&evalCompiler{}).value(&arg.Expr)(evalEnv{})
+	for _, f := range v {
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return v, false
+		}
+	}
+	return v, true
+}
+
+func volume(b AABB) float64 {
+	return (b.Max[0] - b.Min[0]) * (b.Max[1] - b.Min[1]) * (b.Max[2] - b.Min[2])
+}
+
+// guardDistance is the distance to the guard box of node, like sdfl_builtin_box
+func (node *cullNode) guardDistance(p [3]float64) float64 {
+	q := [3]float64{}
+	for i := 0; i < 3; i++ {
+		q[i] = math.Abs(p[i]-node.center[i]) - node.half[i]
+	}
+	outside := length3([3]float64{math.Max(q[0], 0), math.Max(q[1], 0), math.Max(q[2], 0)})
+	return outside + math.Min(math.Max(q[0], math.Max(q[1], q[2])), 0)
+}
+
+// generateCulledChildren generates the children of a scene or a function,
+// best is the distance of the buffer they are pushed to. When guards are
+// generated the result is true, the buffer has to be returned instead of the
+// result of the last push as that may have been skipped.
+func generateCulledChildren(exprs []Expr, rayPosition string, best string, generateChild func(expr *Expr)) bool {
+	unbounded, root := planCulling(uniqueChildren(exprs))
+	for _, expr := range unbounded {
+		generateChild(expr)
+	}
+	if root == nil {
+		return false
+	}
+	generateCullNode(root, rayPosition, best, generateChild)
+	return root.guarded()
+}
+
+func generateCullNode(node *cullNode, rayPosition string, best string, generateChild func(expr *Expr)) {
+	if node.guarded() {
+		generateCodeBoth("    if (sdfl_builtin_box(%s, %s, %s) < %s) {\n", rayPosition, glslVec3(node.center), glslVec3(node.half), best)
+		pushGlslScope()
+	}
+	if node.expr != nil {
+		generateChild(node.expr)
+	}
+	for _, child := range node.children {
+		generateCullNode(child, rayPosition, best, generateChild)
+	}
+	if node.guarded() {
+		popGlslScope()
+		generateCodeBoth("    }\n")
+	}
+}
@@ -0,0 +1,227 @@
+package sdfl
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// cullScene returns a scene of many small shapes spread over a grid, most of
+// them bounded, some always evaluated
+func cullScene(seed int64) string {
+	r := rand.New(rand.NewSource(seed))
+	materials := []string{"default", "mirror", "glass"}
+	children := []string{"plane(height: -2)"}
+	for i := 0; i < 40; i++ {
+		x, z := float64(i%8)*1.5-6+r.Float64()*0.4, float64(i/8)*1.5-4+r.Float64()*0.4
+		mat := materials[r.Intn(len(materials))]
+		var child string
+		switch r.Intn(6) {
+		case 0:
+			child = fmt.Sprintf(`sphere(position: (%.2f, 0, %.2f), radius: %.2f, material: "%s")`, x, z, 0.3+r.Float64()*0.3, mat)
+		case 1:
+			child = fmt.Sprintf(`box(position: (%.2f, 0.5, %.2f), size: (0.3, %.2f, 0.4), material: "%s")`, x, z, 0.2+r.Float64(), mat)
+		case 2:
+			child = fmt.Sprintf(`torus(position: (%.2f, 0, %.2f), radius: 0.5, thickness: 0.1, material: "%s")`, x, z, mat)
+		case 3:
+			child = fmt.Sprintf(`rotateAround(position: (%.2f, 0, %.2f), rotation: (%d, %d, 0), child: box(position: (%.2f, 0, %.2f), size: (0.5, 0.2, 0.2)))`, x, z, r.Intn(90), r.Intn(90), x, z)
+		case 4:
+			child = fmt.Sprintf(`smoothUnion(child1: sphere(position: (%.2f, 0, %.2f), radius: 0.3), child2: cylinder(begin: (%.2f, -1, %.2f), end: (%.2f, 1, %.2f), radius: 0.1), smooth_transition: 0.2)`, x, z, x, z, x, z)
+		case 5:
+			child = fmt.Sprintf(`ellipsoid(position: (%.2f, 0, %.2f), radius: (0.4, 0.2, 0.3))`, x, z)
+		}
+		children = append(children, child)
+	}
+	return "scene(camera: camera(position: (0, 2, 10)), children: [\n  " + strings.Join(children, ",\n  ") + "\n])"
+}
+
+// compileCulled compiles prog for the CPU with culling on or off
+func compileCulled(t *testing.T, prog *Program, enabled bool) *SceneEval {
+	t.Helper()
+	SetCulling(enabled)
+	defer SetCulling(true)
+	scene := CompileEval(prog)
+	if scene == nil {
+		t.Fatalf("compile: %v", GetDiagnostics())
+	}
+	return scene
+}
+
+func TestCullingKeepsDistances(t *testing.T) {
+	programs := map[string]Program{
+		"features.sdfl":    parseFile(t, "features.sdfl"),
+		"reflections.sdfl": parseFile(t, "reflections.sdfl"),
+	}
+	for seed := int64(1); seed <= 3; seed++ {
+		programs[fmt.Sprintf("grid %d", seed)] = parseSource(t, cullScene(seed))
+	}
+	r := rand.New(rand.NewSource(1))
+	for name, prog := range programs {
+		culled, unculled := compileCulled(t, &prog, true), compileCulled(t, &prog, false)
+		for i := 0; i < 2000; i++ {
+			p := [3]float64{r.Float64()*16 - 8, r.Float64()*6 - 3, r.Float64()*12 - 6}
+			time := float64(i%4) * 1.5
+			a, b := culled.Distance(p, time), unculled.Distance(p, time)
+			if a.Distance != b.Distance {
+				t.Fatalf("%s: distance at %v, time %g, is %g culled and %g with --no-cull", name, p, time, a.Distance, b.Distance)
+			}
+			if a.MaterialId != b.MaterialId {
+				t.Fatalf("%s: material at %v, time %g, is %d culled and %d with --no-cull", name, p, time, a.MaterialId, b.MaterialId)
+			}
+		}
+	}
+}
+
+func TestCullingGuards(t *testing.T) {
+	prog := parseSource(t, cullScene(1))
+	fragment := generateTarget(t, &prog, "glsl430")[0].Code
+	if !strings.Contains(fragment, "if (sdfl_builtin_box(p, ") {
+		t.Fatalf("the scene is not culled")
+	}
+	SetCulling(false)
+	defer SetCulling(true)
+	fragment = generateTarget(t, &prog, "glsl430")[0].Code
+	if strings.Contains(fragment, "if (sdfl_builtin_box(p, ") {
+		t.Errorf("guards are generated with culling off")
+	}
+}
+
+func TestResetIndented(t *testing.T) {
+	prog := parseSource(t, `def blob() { local(children: [sphere()]) }
+scene(camera: camera(position: (0, 0, 5)), children: [blob()])`)
+	for _, shader := range generateTarget(t, &prog, "glsl430") {
+		for _, line := range strings.Split(shader.Code, "\n") {
+			if strings.HasPrefix(line, "// reset") || strings.HasPrefix(line, "_scene_result") {
+				t.Errorf("%s: the reset block is not indented: %q", shader.Name, line)
+			}
+		}
+		if !strings.Contains(shader.Code, "    // reset\n    _scene_result_blob = SceneResult(SDFL_MAX_DISTANCE, 0);\n") {
+			t.Errorf("%s: the buffer of blob is not reset", shader.Name)
+		}
+	}
+}
+
+// tieScene has two children at exactly the same distance, the last one
+// depends on time() and is always evaluated
+const tieScene = `scene(camera: camera(position: (0, 0, 5)), children: [
+  sphere(radius: 1, material: "mirror"),
+  sphere(position: (3, 0, 0), radius: 1),
+  sphere(radius: 1 + 0 * time(), material: "glass")
+])`
+
+var glslPush = regexp.MustCompile(`SceneResult sd\d+ = SceneResult\(.*, (\d+)\);`)
+
+// sceneFunction returns the scene distance function of the glsl430 fragment
+// shader of prog, with culling on or off
+func sceneFunction(t *testing.T, prog *Program, enabled bool) string {
+	t.Helper()
+	SetCulling(enabled)
+	defer SetCulling(true)
+	for _, function := range parseGlslFunctions(generateTarget(t, prog, "glsl430")[0].Code) {
+		if function.name == "sdfl_GetDistScene" {
+			return function.code
+		}
+	}
+	t.Fatalf("no sdfl_GetDistScene")
+	return ""
+}
+
+// firstPushed returns the name of the first of materials the scene function
+// code pushes, sdfl_PushScene keeps the first of equally close results
+func firstPushed(code string, materials ...string) string {
+	for _, match := range glslPush.FindAllStringSubmatch(code, -1) {
+		id, _ := strconv.Atoi(match[1])
+		if name := MaterialById(id).Name; slices.Contains(materials, name) {
+			return name
+		}
+	}
+	return ""
+}
+
+func TestCullingTies(t *testing.T) {
+	prog := parseSource(t, tieScene)
+	culled, unculled := sceneFunction(t, &prog, true), sceneFunction(t, &prog, false)
+	checkGolden(t, "cull/ties.glsl", "// culled\n"+culled+"\n// --no-cull\n"+unculled)
+
+	// the CPU evaluator breaks the tie like the shader
+	p := [3]float64{0, 0, 2}
+	for _, tc := range []struct {
+		name    string
+		enabled bool
+		code    string
+		want    string
+	}{
+		{"--no-cull", false, unculled, "mirror"},
+		// known deviation, the always evaluated child is pushed first
+		{"culled", true, culled, "glass"},
+	} {
+		if got := firstPushed(tc.code, "mirror", "glass"); got != tc.want {
+			t.Errorf("%s: the shader pushes %s first, want %s", tc.name, got, tc.want)
+		}
+		if got := MaterialById(compileCulled(t, &prog, tc.enabled).Distance(p, 0).MaterialId).Name; got != tc.want {
+			t.Errorf("%s: the CPU evaluator picks %s, the shader %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+// planOutline writes the guards and pushes the plan of exprs generates, one per line
+func planOutline(exprs []Expr) []string {
+	unbounded, root := planCulling(exprs)
+	outline := []string{}
+	for range unbounded {
+		outline = append(outline, "push")
+	}
+	var walk func(node *cullNode)
+	walk = func(node *cullNode) {
+		if node.guarded() {
+			outline = append(outline, fmt.Sprintf("if %s %s", glslVec3(node.center), glslVec3(node.half)))
+		}
+		if node.expr != nil {
+			outline = append(outline, "push")
+		}
+		for _, child := range node.children {
+			walk(child)
+		}
+		if node.guarded() {
+			outline = append(outline, "}")
+		}
+	}
+	if root != nil {
+		walk(root)
+	}
+	return outline
+}
+
+var glslGuard = regexp.MustCompile(`^    if \(sdfl_builtin_box\(p, (vec3\(.*\)), (vec3\(.*\))\) < _scene_result\.distance\) \{$`)
+
+// shaderOutline writes the guards and pushes of a scene function, one per line
+func shaderOutline(code string) []string {
+	outline := []string{}
+	for _, line := range strings.Split(code, "\n") {
+		if match := glslGuard.FindStringSubmatch(line); match != nil {
+			outline = append(outline, "if "+match[1]+" "+match[2])
+		} else if strings.HasPrefix(line, "    d = sdfl_PushScene(sd") {
+			outline = append(outline, "push")
+		} else if line == "    }" {
+			outline = append(outline, "}")
+		}
+	}
+	return outline
+}
+
+func TestCullingPlanOfShader(t *testing.T) {
+	// the CPU evaluator culls with the plan, the shader has to follow it too
+	for seed := int64(1); seed <= 3; seed++ {
+		prog := parseSource(t, cullScene(seed))
+		code := sceneFunction(t, &prog, true)
+		children, _ := prog.Expr.FunCall.Arg("children")
+		want := planOutline(children.Expr.ArrExpr.Exprs)
+		if got := shaderOutline(code); !slices.Equal(got, want) {
+			t.Errorf("grid %d: the shader is culled like\n%s\nthe plan like\n%s", seed, strings.Join(got, "\n"), strings.Join(want, "\n"))
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package sdfl
+
+import "fmt"
+
+// diagnostics collected while compiling, so the
+// caller decides how to present them (text or json)
+
+const (
+	SEVERITY_ERROR   = "error"
+	SEVERITY_WARNING = "warning"
+)
+
+type Diagnostic struct {
+	Severity string `json:"severity"`
+	Row      int    `json:"row"`
+	Col      int    `json:"col"`
+	Message  string `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	if d.Row == 0 {
+		return fmt.Sprintf("%s: %s", d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", d.Severity, d.Row, d.Col, d.Message)
+}
+
+func ResetDiagnostics() {
+	defaultFrontend.ResetDiagnostics()
+}
+
+func GetDiagnostics() []Diagnostic {
+	return defaultFrontend.Diagnostics()
+}
+
+func HasErrors() bool {
+	return defaultFrontend.HasErrors()
+}
+
+// report adds d unless it was already reported at the same source position,
+// the copies of an unrolled loop body share the positions of the source
+func (fe *Frontend) report(d Diagnostic) {
+	for _, previous := range fe.diagnostics {
+		if d.Row != 0 && previous == d {
+			return
+		}
+	}
+	fe.diagnostics = append(fe.diagnostics, d)
+}
+
+func (fe *Frontend) reportError(span Span, format string, args ...any) {
+	fe.report(Diagnostic{Severity: SEVERITY_ERROR, Row: span.Row, Col: span.Col, Message: fmt.Sprintf(format, args...)})
+}
+
+func (fe *Frontend) reportWarning(span Span, format string, args ...any) {
+	fe.report(Diagnostic{Severity: SEVERITY_WARNING, Row: span.Row, Col: span.Col, Message: fmt.Sprintf(format, args...)})
+}
+
+// reportError and reportWarning report to the default front end
+func reportError(span Span, format string, args ...any) {
+	defaultFrontend.reportError(span, format, args...)
+}
+
+func reportWarning(span Span, format string, args ...any) {
+	defaultFrontend.reportWarning(span, format, args...)
+}
+
+func tokenSpan(tok Token) Span {
+	return Span{Row: tok.Row, Col: tok.Col, Len: len(tok.Value)}
+}
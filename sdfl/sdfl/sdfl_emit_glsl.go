@@ -0,0 +1,117 @@
+package sdfl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GLSL emitter
+//
+// Writes the lowered SDF tree to both shaders. Values are returned as GLSL
+// expressions, distances are bound to variables with letVar so repeated ones
+// are shared, and the name of the variable holding a distance is returned.
+
+// glslShape emits the statements computing shape at the position ray and
+// returns the variable holding its SceneResult
+func glslShape(shape irShape, ray string) string {
+	switch s := shape.(type) {
+	case *irPrimitive:
+		args := append([]string{ray}, glslValues(s.Args)...)
+		return letVar("SceneResult", "sd", fmt.Sprintf("SceneResult(sdfl_builtin_%s(%s), %d)", s.Name, strings.Join(args, ", "), s.Material))
+
+	case *irOp:
+		args := []string{glslShape(s.Child1, ray), glslShape(s.Child2, ray)}
+		if s.K != nil {
+			args = append(args, glslValue(s.K))
+		}
+		return letVar("SceneResult", "sd", fmt.Sprintf("sdfl_builtin_%s(%s)", s.Name, strings.Join(args, ", ")))
+
+	case *irTransform:
+		// the child is evaluated at the rotated position, the pivot is only computed once
+		pivot := letVar("vec3", "pivot", glslValue(s.Pivot))
+		rotation := letVar("mat3", "rotation", fmt.Sprintf("sdfl_RotationMatrix(radians(%s))", glslValue(s.Rotation)))
+		q := letVar("vec3", "q", fmt.Sprintf("%s * (%s - %s) + %s", rotation, ray, pivot, pivot))
+		return glslShape(s.Child, q)
+
+	case *irBranch:
+		// only the chosen shape is evaluated
+		sd := freshVar("sd")
+		generateCodeBoth("    SceneResult %s = SceneResult(SDFL_MAX_DISTANCE, 0);\n", sd)
+		generateCodeBoth("    if (%s) {\n", glslValue(s.Cond))
+		pushGlslScope()
+		generateCodeBoth("    %s = %s;\n", sd, glslShape(s.Then, ray))
+		popGlslScope()
+		generateCodeBoth("    } else {\n")
+		pushGlslScope()
+		generateCodeBoth("    %s = %s;\n", sd, glslShape(s.Else, ray))
+		popGlslScope()
+		generateCodeBoth("    }\n")
+		return sd
+
+	case *irFunction:
+		// calls push to the local scene of the function, they are never shared.
+		// The generated functions only take the position, like the bodies
+		// compiled by the evaluator they do not see the arguments.
+		sd := freshVar("sd")
+		generateCodeBoth("    SceneResult %s = %s(%s);\n", sd, s.Name, ray)
+		return sd
+	}
+	reportError(Span{}, "unknown shape node %T", shape)
+	return ""
+}
+
+var glslLogicOperators = map[string]string{"and": "&&", "or": "||"}
+
+// glslFloatNumbers spells every number as a float, like the evaluator
+// computes them. GLSL 430 keeps integer literals as they are written.
+var glslFloatNumbers = false
+
+// glslValue returns value as a GLSL expression
+func glslValue(value irExpr) string {
+	switch v := value.(type) {
+	case *irNumber:
+		if glslFloatNumbers && !strings.ContainsAny(v.Literal, ".eE") {
+			return v.Literal + ".0"
+		}
+		return v.Literal
+	case *irBool:
+		return fmt.Sprintf("%t", v.Value)
+	case *irTweak:
+		return declareTweak(v.Type, v.Values, v.Span)
+	case *irPoint:
+		return "p"
+	case *irSwizzle:
+		return glslValue(v.X) + "." + v.Components
+	case *irVec3:
+		return fmt.Sprintf("vec3(%s)", strings.Join(glslValues(v.Args), ", "))
+	case *irCall:
+		return fmt.Sprintf("%s(%s)", v.Function, strings.Join(glslValues(v.Args), ", "))
+	case *irBinary:
+		switch v.Op {
+		case "+", "-", "*", "/":
+			return glslValue(v.Left) + v.Op + glslValue(v.Right)
+		case "and", "or":
+			return fmt.Sprintf("%s %s %s", glslValue(v.Left), glslLogicOperators[v.Op], glslValue(v.Right))
+		}
+		return fmt.Sprintf("%s %s %s", glslValue(v.Left), v.Op, glslValue(v.Right))
+	case *irNot:
+		return fmt.Sprintf("!(%s)", glslValue(v.X))
+	case *irSelect:
+		return fmt.Sprintf("(%s ? %s : %s)", glslValue(v.Cond), glslValue(v.Then), glslValue(v.Else))
+	case *irParen:
+		return fmt.Sprintf("(%s)", glslValue(v.X))
+	case nil:
+		// the error was reported while lowering
+		return ""
+	}
+	reportError(Span{}, "unknown value node %T", value)
+	return ""
+}
+
+func glslValues(values []irExpr) []string {
+	code := []string{}
+	for _, value := range values {
+		code = append(code, glslValue(value))
+	}
+	return code
+}
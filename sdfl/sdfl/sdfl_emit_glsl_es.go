@@ -0,0 +1,80 @@
+package sdfl
+
+// GLSL ES 3.00 emitter, for WebGL 2
+//
+// The tree is already GLSL, ES only lacks the implicit conversions of the
+// desktop versions and wants precisions.
+
+type glslESLanguage struct{}
+
+var glslESKeywords = keywordSet(cKeywords, []string{
+	"attribute", "varying", "precision", "highp", "mediump", "lowp", "in", "out", "inout",
+	"uniform", "layout", "flat", "smooth", "centroid", "invariant", "common", "partition", "active",
+})
+
+func (glslESLanguage) typeName(t string) string {
+	return t
+}
+
+func (glslESLanguage) keywords() map[string]bool {
+	return glslESKeywords
+}
+
+func (lang glslESLanguage) program(p *shPrinter, prog *shProgram) {
+	p.line("#version 300 es")
+	p.line("")
+	p.line("// sdfl generated code")
+	p.line("")
+	p.line("precision highp float;")
+	p.line("precision highp int;")
+	p.line("")
+	p.line("in vec2 o_vertex_uv;")
+	p.line("out vec4 frag_color;")
+	p.line("")
+	for _, uniform := range prog.Uniforms() {
+		p.line("uniform %s %s;", uniform.Type, p.name(uniform.Name))
+	}
+	p.line("")
+	lang.declarations(p, prog)
+	p.line("void main() {")
+	p.line("    frag_color = sdfl_Render(o_vertex_uv);")
+	p.line("}")
+}
+
+// declarations prints the structs, constants and functions of prog
+func (lang glslESLanguage) declarations(p *shPrinter, prog *shProgram) {
+	for _, s := range prog.Structs {
+		cStruct(p, s)
+	}
+	for _, constant := range prog.Constants() {
+		p.line("const %s;", cDecl(p, constant.Type, p.name(constant.Name), constant.Init))
+	}
+	p.line("")
+	for _, function := range prog.Functions {
+		lang.function(p, function)
+	}
+}
+
+func (glslESLanguage) function(p *shPrinter, function *shFunction) {
+	cFunction(p, function)
+}
+
+func (glslESLanguage) decl(p *shPrinter, t string, name string, init shExpr) string {
+	return cDecl(p, t, name, init)
+}
+
+func (glslESLanguage) ident(p *shPrinter, ident *shIdent) string {
+	return p.name(ident.Name)
+}
+
+func (glslESLanguage) call(p *shPrinter, call *shCall) string {
+	return cCall(p, call, map[string]string{"mod": "mod"})
+}
+
+func (glslESLanguage) binary(p *shPrinter, binary *shBinary) string {
+	return cBinary(p, binary)
+}
+
+func (glslESLanguage) selectValue(p *shPrinter, s *shSelect) string {
+	return cSelect(p, s)
+}
@@ -0,0 +1,135 @@
+package sdfl
+
+import "fmt"
+
+// HLSL emitter, for Direct3D and game engines
+//
+// Uniforms are in one constant buffer. HLSL has no constructors for structs
+// or vectors from one float, structs are built by sdfl_make_ functions and
+// floats are cast to vectors. Matrices are filled by rows where GLSL fills
+// them by columns, so mul(v, m) of the same values is GLSL's m * v.
+
+type hlslLanguage struct{}
+
+var hlslTypes = map[string]string{
+	"vec2": "float2", "vec3": "float3", "vec4": "float4",
+	"ivec2": "int2", "ivec3": "int3", "ivec4": "int4", "mat3": "float3x3",
+}
+
+var hlslBuiltins = map[string]string{
+	"mix": "lerp", "fract": "frac", "inversesqrt": "rsqrt",
+	"asinh": "sdfl_asinh", "acosh": "sdfl_acosh", "atanh": "sdfl_atanh",
+}
+
+// the inverse hyperbolic functions HLSL does not have, for floats and vectors
+var hlslHelpers = map[string]string{
+	"asinh": "log(x + sqrt(x * x + 1.0))",
+	"acosh": "log(x + sqrt(x * x - 1.0))",
+	"atanh": "0.5 * log((1.0 + x) / (1.0 - x))",
+}
+
+var hlslKeywords = keywordSet(cKeywords, []string{
+	"in", "out", "inout", "uniform", "point", "line", "lineadj", "triangle", "triangleadj",
+	"matrix", "vector", "string", "texture", "sampler", "linear", "centroid", "nointerpolation",
+	"noperspective", "precise", "shared", "groupshared", "row_major", "column_major", "packoffset",
+	"dword", "technique", "pass", "compile", "discard", "cbuffer", "tbuffer", "snorm", "unorm",
+	"export", "noise", "main",
+})
+
+func (hlslLanguage) typeName(t string) string {
+	if name, ok := hlslTypes[t]; ok {
+		return name
+	}
+	return t
+}
+
+func (hlslLanguage) keywords() map[string]bool {
+	return hlslKeywords
+}
+
+func (lang hlslLanguage) program(p *shPrinter, prog *shProgram) {
+	p.line("// sdfl generated code")
+	p.line("")
+	p.line("cbuffer SdflUniforms : register(b0) {")
+	p.indent++
+	for _, uniform := range prog.Uniforms() {
+		p.line("%s %s;", lang.typeName(uniform.Type), p.name(uniform.Name))
+	}
+	p.indent--
+	p.line("};")
+	p.line("")
+	for _, s := range prog.Structs {
+		cStruct(p, s)
+		args := []string{}
+		for _, field := range s.Fields {
+			args = append(args, p.name(field.Name))
+		}
+		p.line("%s sdfl_make_%s(%s) {", s.Name, s.Name, cParams(p, s.Fields))
+		p.line("    %s result;", s.Name)
+		for _, arg := range args {
+			p.line("    result.%s = %s;", arg, arg)
+		}
+		p.line("    return result;")
+		p.line("}")
+		p.line("")
+	}
+	for _, constant := range prog.Constants() {
+		p.line("static const %s;", cDecl(p, constant.Type, p.name(constant.Name), constant.Init))
+	}
+	p.line("")
+
+	builtins := prog.Builtins()
+	for _, name := range []string{"asinh", "acosh", "atanh"} {
+		if !builtins[name] {
+			continue
+		}
+		for _, t := range []string{"float", "float2", "float3"} {
+			p.line("%s %s(%s x) {", t, hlslBuiltins[name], t)
+			p.line("    return %s;", hlslHelpers[name])
+			p.line("}")
+			p.line("")
+		}
+	}
+
+	for _, function := range prog.Functions {
+		lang.function(p, function)
+	}
+	p.line("float4 main(float2 o_vertex_uv : TEXCOORD0) : SV_Target {")
+	p.line("    return sdfl_Render(o_vertex_uv);")
+	p.line("}")
+}
+
+func (hlslLanguage) function(p *shPrinter, function *shFunction) {
+	cFunction(p, function)
+}
+
+func (hlslLanguage) decl(p *shPrinter, t string, name string, init shExpr) string {
+	return cDecl(p, t, name, init)
+}
+
+func (hlslLanguage) ident(p *shPrinter, ident *shIdent) string {
+	return p.name(ident.Name)
+}
+
+func (lang hlslLanguage) call(p *shPrinter, call *shCall) string {
+	switch call.Kind {
+	case SH_CALL_STRUCT:
+		return fmt.Sprintf("sdfl_make_%s(%s)", call.Function, p.args(call.Args))
+	case SH_CALL_CONSTRUCTOR:
+		if len(call.Args) == 1 && shVectorLen(call.Type) > 1 {
+			return fmt.Sprintf("((%s)%s)", lang.typeName(call.Type), p.atom(call.Args[0]))
+		}
+	}
+	return cCall(p, call, hlslBuiltins)
+}
+
+func (hlslLanguage) binary(p *shPrinter, binary *shBinary) string {
+	if binary.Op == "*" && binary.Left.shType() == "mat3" {
+		return fmt.Sprintf("mul(%s, %s)", p.expr(binary.Right), p.expr(binary.Left))
+	}
+	return cBinary(p, binary)
+}
+
+func (hlslLanguage) selectValue(p *shPrinter, s *shSelect) string {
+	return cSelect(p, s)
+}
@@ -0,0 +1,115 @@
+package sdfl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Metal emitter
+//
+// Metal has no mutable globals and passes the uniforms as an argument of the
+// fragment function. The functions are members of SdflShader, which holds a
+// copy of the uniforms, and the fragment function calls sdfl_Render on it.
+
+type mslLanguage struct{}
+
+var mslBuiltins = map[string]string{"inversesqrt": "rsqrt"}
+
+var mslKeywords = keywordSet(cKeywords, []string{
+	"kernel", "vertex", "fragment", "constant", "device", "thread", "threadgroup", "texture",
+	"sampler", "metal", "uniforms", "bool2", "bool3", "bool4",
+})
+
+func (mslLanguage) typeName(t string) string {
+	if name, ok := hlslTypes[t]; ok {
+		return name
+	}
+	return t
+}
+
+func (mslLanguage) keywords() map[string]bool {
+	return mslKeywords
+}
+
+func (lang mslLanguage) program(p *shPrinter, prog *shProgram) {
+	p.line("// sdfl generated code")
+	p.line("")
+	p.line("#include <metal_stdlib>")
+	p.line("using namespace metal;")
+	p.line("")
+	p.line("struct SdflUniforms {")
+	p.indent++
+	for _, uniform := range prog.Uniforms() {
+		p.line("%s %s;", lang.typeName(uniform.Type), uniform.Name)
+	}
+	p.indent--
+	p.line("};")
+	p.line("")
+	for _, s := range prog.Structs {
+		cStruct(p, s)
+	}
+	for _, constant := range prog.Constants() {
+		p.line("constant %s;", cDecl(p, constant.Type, p.name(constant.Name), constant.Init))
+	}
+	p.line("")
+	p.line("struct SdflShader {")
+	p.indent++
+	p.line("SdflUniforms uniforms;")
+	p.line("")
+	for _, function := range prog.Functions {
+		lang.function(p, function)
+	}
+	p.indent--
+	p.line("};")
+	p.line("")
+	p.line("struct SdflFragmentIn {")
+	p.line("    float2 o_vertex_uv;")
+	p.line("};")
+	p.line("")
+	p.line("fragment float4 sdfl_fragment(SdflFragmentIn fragment_in [[stage_in]], constant SdflUniforms& uniforms [[buffer(0)]]) {")
+	p.line("    SdflShader shader = {uniforms};")
+	p.line("    return shader.sdfl_Render(fragment_in.o_vertex_uv);")
+	p.line("}")
+}
+
+func (mslLanguage) function(p *shPrinter, function *shFunction) {
+	cFunction(p, function)
+}
+
+func (mslLanguage) decl(p *shPrinter, t string, name string, init shExpr) string {
+	return cDecl(p, t, name, init)
+}
+
+func (mslLanguage) ident(p *shPrinter, ident *shIdent) string {
+	if ident.Uniform {
+		return "uniforms." + ident.Name
+	}
+	return p.name(ident.Name)
+}
+
+func (lang mslLanguage) call(p *shPrinter, call *shCall) string {
+	switch {
+	case call.Kind == SH_CALL_STRUCT:
+		return fmt.Sprintf("%s{%s}", call.Function, p.args(call.Args))
+	case call.Kind == SH_CALL_CONSTRUCTOR && call.Type == "mat3" && len(call.Args) == 9:
+		// filled by columns like in GLSL
+		columns := []string{}
+		for i := 0; i < 9; i += 3 {
+			columns = append(columns, fmt.Sprintf("float3(%s)", p.args(call.Args[i:i+3])))
+		}
+		return fmt.Sprintf("float3x3(%s)", strings.Join(columns, ", "))
+	case call.Kind == SH_CALL_BUILTIN && call.Function == "radians":
+		return fmt.Sprintf("(%s * 0.017453292519943295)", p.atom(call.Args[0]))
+	case call.Kind == SH_CALL_BUILTIN && call.Function == "degrees":
+		return fmt.Sprintf("(%s * 57.29577951308232)", p.atom(call.Args[0]))
+	}
+	return cCall(p, call, mslBuiltins)
+}
+
+func (mslLanguage) binary(p *shPrinter, binary *shBinary) string {
+	return cBinary(p, binary)
+}
+
+func (mslLanguage) selectValue(p *shPrinter, s *shSelect) string {
+	return cSelect(p, s)
+}
@@ -0,0 +1,46 @@
+package sdfl
+
+// Shadertoy emitter
+//
+// Shadertoy wraps the code of the Image tab in its own GLSL ES 3.00 header,
+// with the inputs iTime and iResolution, and calls mainImage for every pixel.
+// The shader has no uniforms of its own, so tweaked literals are not
+// supported.
+
+type shadertoyLanguage struct {
+	glslESLanguage
+}
+
+var shadertoyKeywords = keywordSet(cKeywords, []string{
+	"attribute", "varying", "precision", "highp", "mediump", "lowp", "in", "out", "inout",
+	"uniform", "layout", "flat", "smooth", "centroid", "invariant", "common", "partition", "active",
+	"mainImage", "iResolution", "iTime", "iTimeDelta", "iFrameRate", "iFrame", "iChannelTime",
+	"iChannelResolution", "iMouse", "iChannel0", "iChannel1", "iChannel2", "iChannel3", "iDate",
+	"iSampleRate",
+})
+
+// the runtime uniforms as Shadertoy inputs
+var shadertoyInputs = map[string]string{
+	"elapsed_time": "iTime",
+	"window_size":  "ivec2(iResolution.xy)",
+}
+
+func (shadertoyLanguage) keywords() map[string]bool {
+	return shadertoyKeywords
+}
+
+func (lang shadertoyLanguage) program(p *shPrinter, prog *shProgram) {
+	p.line("// sdfl generated code, paste it into the Image tab of Shadertoy")
+	p.line("")
+	lang.declarations(p, prog)
+	p.line("void mainImage(out vec4 fragColor, in vec2 fragCoord) {")
+	p.line("    fragColor = sdfl_Render(fragCoord / iResolution.xy);")
+	p.line("}")
+}
+
+func (shadertoyLanguage) ident(p *shPrinter, ident *shIdent) string {
+	if input, ok := shadertoyInputs[ident.Name]; ok && ident.Uniform {
+		return input
+	}
+	return p.name(ident.Name)
+}
@@ -0,0 +1,180 @@
+package sdfl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WGSL emitter, for WebGPU
+//
+// The uniforms are fields of one uniform buffer. Conditional values become
+// select, both of its values are computed but they have no side effects.
+// Parameters are constant in WGSL, the ones a function assigns are copied to
+// variables of the same name first.
+
+type wgslLanguage struct{}
+
+var wgslTypes = map[string]string{
+	"float": "f32", "int": "i32", "uint": "u32",
+	"vec2": "vec2f", "vec3": "vec3f", "vec4": "vec4f",
+	"ivec2": "vec2i", "ivec3": "vec3i", "ivec4": "vec4i", "mat3": "mat3x3f",
+}
+
+var wgslBuiltins = map[string]string{"inversesqrt": "inverseSqrt"}
+
+var wgslKeywords = keywordSet([]string{
+	"alias", "break", "case", "const", "const_assert", "continue", "continuing", "default",
+	"diagnostic", "discard", "else", "enable", "false", "fn", "for", "if", "let", "loop",
+	"override", "requires", "return", "struct", "switch", "true", "var", "while",
+	// reserved words
+	"NULL", "Self", "abstract", "active", "alignas", "alignof", "as", "asm", "async", "attribute",
+	"auto", "await", "become", "cast", "catch", "class", "common", "concept", "crate", "delete",
+	"demote", "do", "dynamic_cast", "enum", "explicit", "export", "extends", "extern", "external",
+	"fallthrough", "filter", "final", "finally", "friend", "from", "get", "goto", "handle", "highp",
+	"impl", "implements", "import", "inline", "instanceof", "interface", "layout", "lowp", "macro",
+	"match", "mediump", "meta", "mod", "module", "move", "mut", "mutable", "namespace", "new", "nil",
+	"noexcept", "noinline", "null", "nullptr", "of", "operator", "package", "packoffset", "partition",
+	"pass", "patch", "precise", "precision", "premerge", "priv", "protected", "pub", "public",
+	"readonly", "ref", "regardless", "register", "require", "resource", "restrict", "self", "set",
+	"shared", "sizeof", "smooth", "snorm", "static", "std", "subroutine", "super", "target",
+	"template", "this", "throw", "trait", "try", "type", "typedef", "typeid", "typename", "typeof",
+	"union", "unless", "unorm", "unsafe", "unsized", "use", "using", "varying", "virtual",
+	"volatile", "wgsl", "where", "with", "writeonly", "yield", "sdfl_uniforms",
+})
+
+func (wgslLanguage) typeName(t string) string {
+	if name, ok := wgslTypes[t]; ok {
+		return name
+	}
+	return t
+}
+
+func (wgslLanguage) keywords() map[string]bool {
+	return wgslKeywords
+}
+
+func (lang wgslLanguage) program(p *shPrinter, prog *shProgram) {
+	p.line("// sdfl generated code")
+	p.line("")
+	p.line("struct SdflUniforms {")
+	p.indent++
+	for _, uniform := range prog.Uniforms() {
+		p.line("%s: %s,", uniform.Name, lang.typeName(uniform.Type))
+	}
+	p.indent--
+	p.line("}")
+	p.line("")
+	p.line("@group(0) @binding(0) var<uniform> sdfl_uniforms: SdflUniforms;")
+	p.line("")
+	for _, s := range prog.Structs {
+		p.line("struct %s {", s.Name)
+		p.indent++
+		for _, field := range s.Fields {
+			p.line("%s: %s,", p.name(field.Name), lang.typeName(field.Type))
+		}
+		p.indent--
+		p.line("}")
+		p.line("")
+	}
+	for _, constant := range prog.Constants() {
+		p.line("const %s: %s = %s;", p.name(constant.Name), lang.typeName(constant.Type), p.expr(constant.Init))
+	}
+	p.line("")
+	for _, function := range prog.Functions {
+		lang.function(p, function)
+	}
+	p.line("@fragment")
+	p.line("fn main(@location(0) o_vertex_uv: vec2f) -> @location(0) vec4f {")
+	p.line("    return sdfl_Render(o_vertex_uv);")
+	p.line("}")
+}
+
+func (lang wgslLanguage) function(p *shPrinter, function *shFunction) {
+	assigned := map[string]bool{}
+	walkShAssignments(function.Body, func(target string) {
+		assigned[target] = true
+	})
+
+	params := []string{}
+	copies := []shVar{}
+	for _, param := range function.Params {
+		name := p.name(param.Name)
+		if assigned[param.Name] {
+			copies = append(copies, param)
+			name += "_in"
+		}
+		params = append(params, fmt.Sprintf("%s: %s", name, lang.typeName(param.Type)))
+	}
+	result := ""
+	if function.Type != "void" {
+		result = " -> " + lang.typeName(function.Type)
+	}
+
+	p.line("fn %s(%s)%s {", p.name(function.Name), strings.Join(params, ", "), result)
+	for _, param := range copies {
+		name := p.name(param.Name)
+		p.line("    var %s: %s = %s_in;", name, lang.typeName(param.Type), name)
+	}
+	p.block(function.Body)
+	p.line("}")
+	p.line("")
+}
+
+// walkShAssignments calls assign with the variables stmts assign to
+func walkShAssignments(stmts []shStmt, assign func(name string)) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *shAssign:
+			target := s.Target
+			for {
+				field, ok := target.(*shField)
+				if !ok {
+					break
+				}
+				target = field.X
+			}
+			if ident, ok := target.(*shIdent); ok {
+				assign(ident.Name)
+			}
+		case *shIf:
+			walkShAssignments(s.Then, assign)
+			walkShAssignments(s.Else, assign)
+		case *shFor:
+			walkShAssignments([]shStmt{s.Init, s.Post}, assign)
+			walkShAssignments(s.Body, assign)
+		}
+	}
+}
+
+func (lang wgslLanguage) decl(p *shPrinter, t string, name string, init shExpr) string {
+	if init == nil {
+		return fmt.Sprintf("var %s: %s", name, lang.typeName(t))
+	}
+	return fmt.Sprintf("var %s: %s = %s", name, lang.typeName(t), p.expr(init))
+}
+
+func (wgslLanguage) ident(p *shPrinter, ident *shIdent) string {
+	if ident.Uniform {
+		return "sdfl_uniforms." + ident.Name
+	}
+	return p.name(ident.Name)
+}
+
+func (wgslLanguage) call(p *shPrinter, call *shCall) string {
+	return cCall(p, call, wgslBuiltins)
+}
+
+// binary puts logic operators of the other kind in parentheses, WGSL does not order && and ||
+func (wgslLanguage) binary(p *shPrinter, binary *shBinary) string {
+	operand := func(e shExpr) string {
+		if other, ok := e.(*shBinary); ok && (binary.Op == "&&" || binary.Op == "||") && (other.Op == "&&" || other.Op == "||") && other.Op != binary.Op {
+			return "(" + p.expr(e) + ")"
+		}
+		return p.expr(e)
+	}
+	return fmt.Sprintf("%s %s %s", operand(binary.Left), binary.Op, operand(binary.Right))
+}
+
+func (wgslLanguage) selectValue(p *shPrinter, s *shSelect) string {
+	return fmt.Sprintf("select(%s, %s, %s)", p.expr(s.Else), p.expr(s.Then), p.expr(s.Cond))
+}
@@ -0,0 +1,678 @@
+package sdfl
+
+import "math"
+
+// evaluation of scenes on the CPU
+//
+// CompileEval turns an analyzed program into Go closures computing the same
+// distances as the generated sdfl_GetDistScene, for rendering without a GPU.
+// Floats are kept as vectors with three equal components, so the arithmetic
+// of floats and vec3 broadcasts like in GLSL. The closures do not touch
+// package state, a compiled scene can be evaluated by many goroutines at once.
+
+// MAX_DISTANCE is the distance of an empty scene, SDFL_MAX_DISTANCE of the shaders
+const MAX_DISTANCE = 100.0
+
+// SceneSample is the distance to the closest shape and its material, SceneResult of the shaders
+type SceneSample struct {
+	Distance   float64
+	MaterialId int
+}
+
+// SceneEval is a scene compiled for the CPU
+type SceneEval struct {
+	Background [3]float64
+	Post       []PostEffect // the effects of the post list, in order
+	Bounces    int          // reflected and refracted rays a pixel follows at most
+	camera     valueEval
+	dist       shapeEval
+}
+
+// evalEnv is what values depend on: the time and the position p of the
+// enclosing scene or function, which noise() and hash() read
+type evalEnv struct {
+	time float64
+	p    [3]float64
+}
+
+type valueEval func(env evalEnv) [3]float64
+type boolEval func(env evalEnv) bool
+
+// shapeEval computes the distance of a shape at ray, the position the
+// shape is evaluated at after the rotations of its parents
+type shapeEval func(env evalEnv, ray [3]float64) SceneSample
+
+// Distance evaluates the scene at p at the given time in seconds
+func (scene *SceneEval) Distance(p [3]float64, time float64) SceneSample {
+	return scene.dist(evalEnv{time: time, p: p}, p)
+}
+
+// Camera is the position of the camera at the given time in seconds
+func (scene *SceneEval) Camera(time float64) [3]float64 {
+	return scene.camera(evalEnv{time: time})
+}
+
+type evalCompiler struct {
+	functions map[string]*shapeEval // user defined functions compiled so far
+	compiling map[string]bool
+}
+
+// CompileEval compiles an analyzed program for the CPU, errors are
+// reported like in Generate and the result is nil when there are any
+func CompileEval(prog *Program) *SceneEval {
+	sceneCall := prog.Expr.FunCall
+	if sceneCall == nil || sceneCall.Id != "scene" {
+		reportError(Span{}, "scene function must be called")
+		return nil
+	}
+	cameraCall := sceneCall.ArgExpr("camera").FunCall
+	if cameraCall == nil {
+		reportError(sceneCall.Span, "scene, camera argument is empty")
+		return nil
+	}
+	childrenArr := sceneCall.ArgExpr("children").ArrExpr
+	if childrenArr == nil {
+		reportError(sceneCall.Span, "scene, children argument is empty")
+		return nil
+	}
+
+	c := &evalCompiler{functions: map[string]*shapeEval{}, compiling: map[string]bool{}}
+	scene := &SceneEval{}
+	if background, ok := sceneCall.Arg("background"); ok {
+		v, ok := evalConstVec3(&background.Expr)
+		if !ok {
+			reportError(background.Span, "scene function had argument background as tuple")
+		}
+		scene.Background = v
+	}
+	cameraPos := cameraCall.ArgExpr("position")
+	scene.camera = c.value(&cameraPos)
+	scene.dist = c.children(childrenArr.Exprs)
+	scene.Post = c.post(sceneCall)
+	scene.Bounces = sceneBounces(sceneCall)
+	if HasErrors() {
+		return nil
+	}
+	return scene
+}
+
+// children combines shapes like pushing them to the scene, the closest one
+// wins. They are culled like in the generated code.
+func (c *evalCompiler) children(exprs []Expr) shapeEval {
+	unbounded, root := planCulling(exprs)
+	shapes := []shapeEval{}
+	for _, expr := range unbounded {
+		shapes = append(shapes, c.shape(expr))
+	}
+	var tree func(env evalEnv, ray [3]float64, result *SceneSample)
+	if root != nil {
+		tree = c.cullNode(root)
+	}
+	return func(env evalEnv, ray [3]float64) SceneSample {
+		result := SceneSample{Distance: MAX_DISTANCE}
+		for _, shape := range shapes {
+			if s := shape(env, ray); s.Distance < result.Distance {
+				result = s
+			}
+		}
+		if tree != nil {
+			tree(env, ray, &result)
+		}
+		return result
+	}
+}
+
+func (c *evalCompiler) cullNode(node *cullNode) func(env evalEnv, ray [3]float64, result *SceneSample) {
+	var shape shapeEval
+	if node.expr != nil {
+		shape = c.shape(node.expr)
+	}
+	children := []func(env evalEnv, ray [3]float64, result *SceneSample){}
+	for _, child := range node.children {
+		children = append(children, c.cullNode(child))
+	}
+	guarded := node.guarded()
+	return func(env evalEnv, ray [3]float64, result *SceneSample) {
+		if guarded && !(node.guardDistance(ray) < result.Distance) {
+			return
+		}
+		if shape != nil {
+			if s := shape(env, ray); s.Distance < result.Distance {
+				*result = s
+			}
+		}
+		for _, child := range children {
+			child(env, ray, result)
+		}
+	}
+}
+
+func (c *evalCompiler) shape(expr *Expr) shapeEval {
+	if expr.Type == AST_COND {
+		cond := c.bool(&expr.Cond.Cond)
+		then, els := c.shape(&expr.Cond.Then), c.shape(&expr.Cond.Else)
+		return func(env evalEnv, ray [3]float64) SceneSample {
+			if cond(env) {
+				return then(env, ray)
+			}
+			return els(env, ray)
+		}
+	}
+	if expr.Type != AST_FUN_CALL {
+		reportError(Span{}, "expected a shape, got a %s", argKindToString(ExprKind(expr)))
+		return nil
+	}
+
+	funCall := expr.FunCall
+	funDef, ok := functionSymbols[funCall.Id]
+	if !ok {
+		reportError(funCall.Span, "function call %s is not defined", funCall.Id)
+		return nil
+	}
+	switch funDef.SymbolType {
+	case FUN_BUILTIN_SHAPE:
+		return c.builtinShape(funCall)
+
+	case FUN_BUILTIN_OP:
+		child1, child2 := c.argShape(funCall, "child1"), c.argShape(funCall, "child2")
+		k := func(evalEnv) [3]float64 { return [3]float64{} }
+		if _, ok := funCall.Arg("smooth_transition"); ok {
+			k = c.arg(funCall, "smooth_transition")
+		}
+		op := evalOps[funCall.Id]
+		return func(env evalEnv, ray [3]float64) SceneSample {
+			return op(child1(env, ray), child2(env, ray), k(env)[0])
+		}
+
+	case FUN_BUILTIN_ROTATE_AROUND:
+		pivot, rotation := c.arg(funCall, "position"), c.arg(funCall, "rotation")
+		child := c.argShape(funCall, "child")
+		return func(env evalEnv, ray [3]float64) SceneSample {
+			pos, degrees := pivot(env), rotation(env)
+			columns := rotationColumns([3]float64{degrees[0] * math.Pi / 180.0, degrees[1] * math.Pi / 180.0, degrees[2] * math.Pi / 180.0})
+			q := rotate(columns, [3]float64{ray[0] - pos[0], ray[1] - pos[1], ray[2] - pos[2]})
+			return child(env, [3]float64{q[0] + pos[0], q[1] + pos[1], q[2] + pos[2]})
+		}
+
+	case FUN_USER_DEFINED:
+		function := c.function(funCall, &funDef)
+		return func(env evalEnv, ray [3]float64) SceneSample {
+			// the body sees the position the function is called at as p
+			return (*function)(evalEnv{time: env.time, p: ray}, ray)
+		}
+	}
+	reportError(funCall.Span, "function %s (%s) is not a shape", funCall.Id, symbolTypeToString(funDef.SymbolType))
+	return nil
+}
+
+// function compiles the body of a user defined function once, calls refer
+// to it by pointer as it is only complete after the body is compiled
+func (c *evalCompiler) function(funCall *FunCall, funDef *FunDef) *shapeEval {
+	if c.compiling[funDef.Id] {
+		reportError(funCall.Span, "function %s calls itself", funDef.Id)
+	}
+	if function, ok := c.functions[funDef.Id]; ok {
+		return function
+	}
+	function := new(shapeEval)
+	c.functions[funDef.Id] = function
+	c.compiling[funDef.Id] = true
+	defer delete(c.compiling, funDef.Id)
+
+	localCall := funDef.Expr
+	if localCall == nil || localCall.FunCall == nil || localCall.FunCall.Id != "local" || localCall.FunCall.ArgExpr("children").ArrExpr == nil {
+		reportError(Span{}, "local function must be called in a function definition %s", funDef.Id)
+		return function
+	}
+	*function = c.children(localCall.FunCall.ArgExpr("children").ArrExpr.Exprs)
+	return function
+}
+
+func (c *evalCompiler) builtinShape(funCall *FunCall) shapeEval {
+	materialId := shapeMaterial(funCall)
+	sample := func(d float64) SceneSample { return SceneSample{Distance: d, MaterialId: materialId} }
+	switch funCall.Id {
+	case "plane":
+		height := c.arg(funCall, "height")
+		return func(env evalEnv, ray [3]float64) SceneSample {
+			return sample(ray[1] - height(env)[0])
+		}
+	case "sphere":
+		pos, radius := c.arg(funCall, "position"), c.arg(funCall, "radius")
+		return func(env evalEnv, ray [3]float64) SceneSample {
+			return sample(length3(sub3(ray, pos(env))) - radius(env)[0])
+		}
+	case "cylinder":
+		begin, end, radius := c.arg(funCall, "begin"), c.arg(funCall, "end"), c.arg(funCall, "radius")
+		return func(env evalEnv, ray [3]float64) SceneSample {
+			return sample(sdCylinder(ray, begin(env), end(env), radius(env)[0]))
+		}
+	case "ellipsoid":
+		pos, radius := c.arg(funCall, "position"), c.arg(funCall, "radius")
+		return func(env evalEnv, ray [3]float64) SceneSample {
+			r := radius(env)
+			q := sub3(ray, pos(env))
+			q = [3]float64{q[0] / r[0], q[1] / r[1], q[2] / r[2]}
+			return sample((length3(q) - 1.0) * math.Min(math.Min(r[0], r[1]), r[2]))
+		}
+	case "box":
+		pos, size := c.arg(funCall, "position"), c.arg(funCall, "size")
+		return func(env evalEnv, ray [3]float64) SceneSample {
+			b, s := pos(env), size(env)
+			q := [3]float64{}
+			for i := 0; i < 3; i++ {
+				q[i] = math.Abs(ray[i]-b[i]) - s[i]
+			}
+			outside := length3([3]float64{math.Max(q[0], 0), math.Max(q[1], 0), math.Max(q[2], 0)})
+			return sample(outside + math.Min(math.Max(q[0], math.Max(q[1], q[2])), 0))
+		}
+	case "torus":
+		pos, radius, thickness := c.arg(funCall, "position"), c.arg(funCall, "radius"), c.arg(funCall, "thickness")
+		return func(env evalEnv, ray [3]float64) SceneSample {
+			wp := sub3(ray, pos(env))
+			qx := math.Hypot(wp[0], wp[2]) - radius(env)[0]
+			return sample(math.Hypot(qx, wp[1]) - thickness(env)[0])
+		}
+	}
+	reportError(funCall.Span, "shape %s can not be evaluated", funCall.Id)
+	return nil
+}
+
+// https://iquilezles.org/
+// https://www.shadertoy.com/view/wdXGDr
+func sdCylinder(p, a, b [3]float64, r float64) float64 {
+	ba := sub3(b, a)
+	pa := sub3(p, a)
+	baba := dot3(ba, ba)
+	paba := dot3(pa, ba)
+	x := length3([3]float64{pa[0]*baba - ba[0]*paba, pa[1]*baba - ba[1]*paba, pa[2]*baba - ba[2]*paba}) - r*baba
+	y := math.Abs(paba-baba*0.5) - baba*0.5
+	x2 := x * x
+	y2 := y * y * baba
+	d := 0.0
+	if math.Max(x, y) < 0 {
+		d = -math.Min(x2, y2)
+	} else {
+		if x > 0 {
+			d += x2
+		}
+		if y > 0 {
+			d += y2
+		}
+	}
+	sign := 0.0
+	if d > 0 {
+		sign = 1
+	} else if d < 0 {
+		sign = -1
+	}
+	return sign * math.Sqrt(math.Abs(d)) / baba
+}
+
+// Go counterparts of the sdfl_builtin operations, k is the smooth transition
+var evalOps = map[string]func(d1, d2 SceneSample, k float64) SceneSample{
+	"union": func(d1, d2 SceneSample, k float64) SceneSample {
+		if d1.Distance < d2.Distance {
+			return d1
+		}
+		return d2
+	},
+	"subtraction": func(d1, d2 SceneSample, k float64) SceneSample {
+		return SceneSample{Distance: math.Max(d2.Distance, -d1.Distance), MaterialId: d2.MaterialId}
+	},
+	"intersection": func(d1, d2 SceneSample, k float64) SceneSample {
+		if d1.Distance > d2.Distance {
+			return d1
+		}
+		return d2
+	},
+	"smoothUnion": func(d1, d2 SceneSample, k float64) SceneSample {
+		h := clamp(0.5+0.5*(d2.Distance-d1.Distance)/k, 0, 1)
+		return smoothResult(mix(d2.Distance, d1.Distance, h)-k*h*(1-h), h, d1, d2)
+	},
+	"smoothSubtraction": func(d1, d2 SceneSample, k float64) SceneSample {
+		h := clamp(0.5-0.5*(d2.Distance+d1.Distance)/k, 0, 1)
+		// the material of the shape that is subtracted from
+		return SceneSample{Distance: mix(d2.Distance, -d1.Distance, h) + k*h*(1-h), MaterialId: d2.MaterialId}
+	},
+	"smoothIntersection": func(d1, d2 SceneSample, k float64) SceneSample {
+		h := clamp(0.5-0.5*(d2.Distance-d1.Distance)/k, 0, 1)
+		return smoothResult(mix(d2.Distance, d1.Distance, h)+k*h*(1-h), h, d1, d2)
+	},
+}
+
+func smoothResult(distance float64, h float64, d1, d2 SceneSample) SceneSample {
+	if h > 0.5 {
+		return SceneSample{Distance: distance, MaterialId: d1.MaterialId}
+	}
+	return SceneSample{Distance: distance, MaterialId: d2.MaterialId}
+}
+
+func (c *evalCompiler) argShape(funCall *FunCall, name string) shapeEval {
+	arg, ok := funCall.Arg(name)
+	if !ok {
+		reportError(funCall.Span, "function call %s, missing argument %s", funCall.Id, name)
+		return nil
+	}
+	return c.shape(&arg.Expr)
+}
+
+func (c *evalCompiler) arg(funCall *FunCall, name string) valueEval {
+	arg, ok := funCall.Arg(name)
+	if !ok {
+		reportError(funCall.Span, "function call %s, missing argument %s", funCall.Id, name)
+		return nil
+	}
+	return c.value(&arg.Expr)
+}
+
+func splat(v float64) [3]float64 {
+	return [3]float64{v, v, v}
+}
+
+func constValue(v [3]float64) valueEval {
+	return func(evalEnv) [3]float64 { return v }
+}
+
+// value compiles a float or a vec3
+func (c *evalCompiler) value(expr *Expr) valueEval {
+	switch expr.Type {
+	case AST_NUMBER:
+		v, err := ParseNumberLiteral(expr.Number.Value)
+		if err != nil {
+			reportError(expr.Number.Span, "invalid number %s", expr.Number.Value)
+		}
+		return constValue(splat(v))
+	case AST_TUPLE:
+		v, ok := evalConstVec3(expr)
+		if !ok || len(expr.Tuple.Values) != 3 {
+			reportError(expr.Tuple.Span, "a vector needs 3 values, got %d", len(expr.Tuple.Values))
+		}
+		return constValue(v)
+	case AST_VEC:
+		if len(expr.Vec.Exprs) != 3 {
+			reportError(expr.Vec.Span, "a vector needs 3 values, got %d", len(expr.Vec.Exprs))
+			return nil
+		}
+		x, y, z := c.value(&expr.Vec.Exprs[0]), c.value(&expr.Vec.Exprs[1]), c.value(&expr.Vec.Exprs[2])
+		return func(env evalEnv) [3]float64 {
+			return [3]float64{x(env)[0], y(env)[0], z(env)[0]}
+		}
+	case AST_BINOP_TERM:
+		return c.binop(&expr.BinopTerm.Left, &expr.BinopTerm.Right, expr.BinopTerm.Operator)
+	case AST_BINOP_FACTOR:
+		return c.binop(&expr.BinopFactor.Left, &expr.BinopFactor.Right, expr.BinopFactor.Operator)
+	case AST_COND:
+		cond := c.bool(&expr.Cond.Cond)
+		then, els := c.value(&expr.Cond.Then), c.value(&expr.Cond.Else)
+		return func(env evalEnv) [3]float64 {
+			if cond(env) {
+				return then(env)
+			}
+			return els(env)
+		}
+	case AST_FUN_CALL:
+		return c.call(expr.FunCall)
+	}
+	reportError(Span{}, "expected a float or a vec3, got a %s", argKindToString(ExprKind(expr)))
+	return nil
+}
+
+func (c *evalCompiler) binop(left *Expr, right *Expr, operator string) valueEval {
+	l, r := c.value(left), c.value(right)
+	var op func(a, b float64) float64
+	switch operator {
+	case "+":
+		op = func(a, b float64) float64 { return a + b }
+	case "-":
+		op = func(a, b float64) float64 { return a - b }
+	case "*":
+		op = func(a, b float64) float64 { return a * b }
+	case "/":
+		op = func(a, b float64) float64 { return a / b }
+	default:
+		reportError(Span{}, "unknown operator %s", operator)
+		return nil
+	}
+	return func(env evalEnv) [3]float64 {
+		a, b := l(env), r(env)
+		return [3]float64{op(a[0], b[0]), op(a[1], b[1]), op(a[2], b[2])}
+	}
+}
+
+func (c *evalCompiler) bool(expr *Expr) boolEval {
+	switch expr.Type {
+	case AST_BOOL:
+		v := expr.Bool.Value
+		return func(evalEnv) bool { return v }
+	case AST_BINOP_COMPARE:
+		l, r := c.value(&expr.BinopCompare.Left), c.value(&expr.BinopCompare.Right)
+		compare := map[string]func(a, b float64) bool{
+			"<":  func(a, b float64) bool { return a < b },
+			"<=": func(a, b float64) bool { return a <= b },
+			"==": func(a, b float64) bool { return a == b },
+			"!=": func(a, b float64) bool { return a != b },
+			">":  func(a, b float64) bool { return a > b },
+			">=": func(a, b float64) bool { return a >= b },
+		}[expr.BinopCompare.Operator]
+		if compare == nil {
+			reportError(expr.BinopCompare.Span, "unknown operator %s", expr.BinopCompare.Operator)
+			return nil
+		}
+		return func(env evalEnv) bool { return compare(l(env)[0], r(env)[0]) }
+	case AST_BINOP_LOGIC:
+		l, r := c.bool(&expr.BinopLogic.Left), c.bool(&expr.BinopLogic.Right)
+		if expr.BinopLogic.Operator == "and" {
+			return func(env evalEnv) bool { return l(env) && r(env) }
+		}
+		return func(env evalEnv) bool { return l(env) || r(env) }
+	case AST_UNOP_NOT:
+		v := c.bool(&expr.UnopNot.Expr)
+		return func(env evalEnv) bool { return !v(env) }
+	case AST_COND:
+		cond := c.bool(&expr.Cond.Cond)
+		then, els := c.bool(&expr.Cond.Then), c.bool(&expr.Cond.Else)
+		return func(env evalEnv) bool {
+			if cond(env) {
+				return then(env)
+			}
+			return els(env)
+		}
+	}
+	reportError(Span{}, "expected a condition, got a %s", argKindToString(ExprKind(expr)))
+	return nil
+}
+
+// call compiles a call producing a float or a vec3
+func (c *evalCompiler) call(funCall *FunCall) valueEval {
+	funDef, ok := functionSymbols[funCall.Id]
+	if !ok {
+		reportError(funCall.Span, "function call %s is not defined", funCall.Id)
+		return nil
+	}
+	switch funDef.SymbolType {
+	case FUN_BUILTIN_GLSL:
+		// GLSL applies them to every component
+		eval := glslBuiltinEval[funCall.Id]
+		args := []valueEval{}
+		for _, name := range funDef.FunDefArgNames {
+			args = append(args, c.arg(funCall, name))
+		}
+		return func(env evalEnv) [3]float64 {
+			values := make([][3]float64, len(args))
+			for i, arg := range args {
+				values[i] = arg(env)
+			}
+			result := [3]float64{}
+			component := make([]float64, len(args))
+			for i := 0; i < 3; i++ {
+				for j := range values {
+					component[j] = values[j][i]
+				}
+				result[i] = eval(component)
+			}
+			return result
+		}
+	case FUN_BUILTIN_SDFL:
+		switch funCall.Id {
+		case "time":
+			return func(env evalEnv) [3]float64 { return splat(env.time) }
+		case "hash":
+			return func(env evalEnv) [3]float64 { return splat(evalHash(env.p[0], env.p[1])) }
+		case "noise":
+			return func(env evalEnv) [3]float64 { return splat(evalNoise(env.p[0], env.p[1])) }
+		}
+	case FUN_BUILTIN_ANIM:
+		return c.anim(funCall)
+	}
+	reportError(funCall.Span, "function %s (%s) is not a float or a vec3", funCall.Id, symbolTypeToString(funDef.SymbolType))
+	return nil
+}
+
+// anim compiles the animation helpers like lowerAnimCall lowers them
+func (c *evalCompiler) anim(funCall *FunCall) valueEval {
+	switch funCall.Id {
+	case "lerp":
+		from, to, t := c.arg(funCall, "from"), c.arg(funCall, "to"), c.arg(funCall, "t")
+		return func(env evalEnv) [3]float64 {
+			a, b, x := from(env), to(env), t(env)[0]
+			return [3]float64{mix(a[0], b[0], x), mix(a[1], b[1], x), mix(a[2], b[2], x)}
+		}
+	case "smoothstep":
+		from, to, x := c.arg(funCall, "from"), c.arg(funCall, "to"), c.arg(funCall, "x")
+		return func(env evalEnv) [3]float64 {
+			a, b, v := from(env), to(env), x(env)
+			result := [3]float64{}
+			for i := 0; i < 3; i++ {
+				t := clamp((v[i]-a[i])/(b[i]-a[i]), 0, 1)
+				result[i] = t * t * (3 - 2*t)
+			}
+			return result
+		}
+	case "oscillate":
+		freq, amp := c.arg(funCall, "freq"), c.arg(funCall, "amp")
+		return func(env evalEnv) [3]float64 {
+			s := math.Sin(2 * math.Pi * freq(env)[0] * env.time)
+			a := amp(env)
+			return [3]float64{a[0] * s, a[1] * s, a[2] * s}
+		}
+	case "animate":
+		return c.animate(funCall)
+	}
+	reportError(funCall.Span, "function %s can not be evaluated", funCall.Id)
+	return nil
+}
+
+func (c *evalCompiler) animate(funCall *FunCall) valueEval {
+	keys := funCall.ArgExpr("keys").ArrExpr
+	if keys == nil || len(keys.Exprs) == 0 {
+		reportError(funCall.Span, "animate needs at least one key")
+		return nil
+	}
+	times := []float64{}
+	values := [][3]float64{}
+	for _, key := range keys.Exprs {
+		if key.Type != AST_TUPLE {
+			reportError(funCall.Span, "keys of animate have to be constant")
+			return nil
+		}
+		numbers := []float64{}
+		for _, literal := range key.Tuple.Values {
+			v, _ := ParseNumberLiteral(literal)
+			numbers = append(numbers, v)
+		}
+		times = append(times, numbers[0])
+		if len(numbers) == 4 {
+			values = append(values, [3]float64{numbers[1], numbers[2], numbers[3]})
+		} else {
+			values = append(values, splat(numbers[1]))
+		}
+	}
+	if len(values) == 1 {
+		return constValue(values[0])
+	}
+
+	ease := easingEval[funCall.ArgExpr("ease").String.Value]
+	loopExpr := funCall.ArgExpr("loop")
+	loop := c.bool(&loopExpr)
+	if ease == nil {
+		reportError(funCall.Span, "unknown easing %q", funCall.ArgExpr("ease").String.Value)
+		return nil
+	}
+	last := len(times) - 1
+	return func(env evalEnv) [3]float64 {
+		// sdfl_AnimTime
+		t, start, end := env.time, times[0], times[last]
+		if loop(env) && end > start {
+			t = start + glslMod(t-start, end-start)
+		}
+		i := 1
+		for i < last && t >= times[i] {
+			i++
+		}
+		// sdfl_AnimSegment
+		x := 0.0
+		if times[i] > times[i-1] {
+			x = clamp((t-times[i-1])/(times[i]-times[i-1]), 0, 1)
+		} else if t >= times[i-1] {
+			x = 1
+		}
+		e := ease(x)
+		a, b := values[i-1], values[i]
+		return [3]float64{mix(a[0], b[0], e), mix(a[1], b[1], e), mix(a[2], b[2], e)}
+	}
+}
+
+func fract(x float64) float64 {
+	return x - math.Floor(x)
+}
+
+// glslMod is mod of GLSL, the result has the sign of y
+func glslMod(x, y float64) float64 {
+	return x - y*math.Floor(x/y)
+}
+
+func evalHash(x, y float64) float64 {
+	return fract(math.Sin(x*12.9898+y*78.233) * 43758.5453)
+}
+
+func evalNoiseSimple(x, y float64) float64 {
+	px, py := fract(x), fract(y)
+	px, py = px*px*(3-2*px), py*py*(3-2*py)
+	idx, idy := math.Floor(x), math.Floor(y)
+
+	b := mix(evalHash(idx, idy), evalHash(idx+1, idy), px)
+	t := mix(evalHash(idx, idy+1), evalHash(idx+1, idy+1), px)
+	return mix(b, t, py)
+}
+
+// evalNoise matches sdfl_builtin_noise, where the first octave scales the sum of the others
+func evalNoise(x, y float64) float64 {
+	octaves := 0.0
+	amplitude := 0.5
+	for scale := 4.0; scale <= 64; scale *= 2 {
+		octaves += evalNoiseSimple(x*scale, y*scale) * amplitude
+		amplitude *= 0.5
+	}
+	return evalNoiseSimple(x, y) * octaves
+}
+
+func mix(a, b, t float64) float64 {
+	return a*(1-t) + b*t
+}
+
+func clamp(x, lo, hi float64) float64 {
+	return math.Min(math.Max(x, lo), hi)
+}
+
+func sub3(a, b [3]float64) [3]float64 {
+	return [3]float64{a[0] - b[0], a[1] - b[1], a[2] - b[2]}
+}
+
+func dot3(a, b [3]float64) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+func length3(a [3]float64) float64 {
+	return math.Sqrt(dot3(a, a))
+}
@@ -8,6 +8,7 @@ import (
 type FileWatcher struct {
 	path          string
 	lastWriteTime time.Time
+	lastHash      string
 }
 
 func NewFileWatcher(path string) (*FileWatcher, error) {
@@ -16,9 +17,15 @@ func NewFileWatcher(path string) (*FileWatcher, error) {
 		return nil, err
 	}
 
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
 	return &FileWatcher{
 		path:          path,
 		lastWriteTime: info.ModTime(),
+		lastHash:      HashContent(string(content)),
 	}, nil
 }
 
@@ -29,9 +36,20 @@ func (fw *FileWatcher) HasChanged() (bool, error) {
 	}
 
 	current := info.ModTime()
-	if !current.Equal(fw.lastWriteTime) {
-		fw.lastWriteTime = current
-		return true, nil
+	if current.Equal(fw.lastWriteTime) {
+		return false, nil
+	}
+	fw.lastWriteTime = current
+
+	// editors often touch the file without changing it, only report real edits
+	content, err := os.ReadFile(fw.path)
+	if err != nil {
+		return false, err
+	}
+	hash := HashContent(string(content))
+	if hash == fw.lastHash {
+		return false, nil
 	}
-	return false, nil
+	fw.lastHash = hash
+	return true, nil
 }
@@ -0,0 +1,252 @@
+package sdfl
+
+import (
+	"strconv"
+	"strings"
+)
+
+// source formatter
+//
+// Prints an AST back as SDFL source in the layout of the examples in the
+// README, so decoded or generated programs can be read and edited again.
+
+// FormatProgram returns the source of prog, parsing it gives back the same AST
+func FormatProgram(prog Program) string {
+	var sb strings.Builder
+	for _, stmt := range prog.Stmts {
+		if stmt.Type != AST_FUN_DEF || stmt.FunDef == nil {
+			continue
+		}
+		sb.WriteString("def " + stmt.FunDef.Id + "(" + FormatParams(stmt.FunDef) + ") {\n")
+		if stmt.FunDef.Expr != nil {
+			sb.WriteString(indent(1))
+			formatExpr(&sb, *stmt.FunDef.Expr, 1, 0, false)
+			sb.WriteString("\n")
+		}
+		sb.WriteString("}\n")
+	}
+	formatExpr(&sb, prog.Expr, 0, 0, false)
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// FormatParams returns the parameter list of a function definition, with the default values
+func FormatParams(funDef *FunDef) string {
+	params := []string{}
+	for _, name := range funDef.FunDefArgNames {
+		if value, ok := funDef.FunDefDefaults[name]; ok {
+			name += " = " + FormatExpr(value)
+		}
+		params = append(params, name)
+	}
+	return strings.Join(params, ", ")
+}
+
+// FormatExpr returns the source of a single expression
+func FormatExpr(expr Expr) string {
+	var sb strings.Builder
+	formatExpr(&sb, expr, 0, 0, false)
+	return sb.String()
+}
+
+// binopPrecedence is how tightly expr binds, if-else expressions are closed
+// by their braces and bind like a primary
+func binopPrecedence(expr Expr) int {
+	switch expr.Type {
+	case AST_COND:
+		if expr.Cond.IfElse {
+			return 8
+		}
+		return 1
+	case AST_BINOP_LOGIC:
+		if expr.BinopLogic.Operator == "or" {
+			return 2
+		}
+		return 3
+	case AST_UNOP_NOT:
+		return 4
+	case AST_BINOP_COMPARE:
+		return 5
+	case AST_BINOP_TERM:
+		return 6
+	case AST_BINOP_FACTOR:
+		return 7
+	}
+	return 8
+}
+
+// formatExpr writes expr at the given indentation level, parentheses are added where
+// the source had them or where the precedence of the parent operator needs them
+func formatExpr(sb *strings.Builder, expr Expr, level int, parentPrecedence int, isRight bool) {
+	precedence := binopPrecedence(expr)
+	parentheses := expr.HasParentheses || precedence < parentPrecedence || (isRight && precedence == parentPrecedence)
+	if parentheses {
+		sb.WriteString("(")
+	}
+
+	switch expr.Type {
+	case AST_NUMBER:
+		if expr.Number.Tweak {
+			sb.WriteString("@tweak ")
+		}
+		sb.WriteString(expr.Number.Value)
+	case AST_TUPLE:
+		if expr.Tuple.Tweak {
+			sb.WriteString("@tweak ")
+		}
+		sb.WriteString("(" + strings.Join(expr.Tuple.Values, ", ") + ")")
+	case AST_BINOP_TERM:
+		formatExpr(sb, expr.BinopTerm.Left, level, precedence, false)
+		sb.WriteString(" " + expr.BinopTerm.Operator + " ")
+		formatExpr(sb, expr.BinopTerm.Right, level, precedence, true)
+	case AST_BINOP_FACTOR:
+		formatExpr(sb, expr.BinopFactor.Left, level, precedence, false)
+		sb.WriteString(" " + expr.BinopFactor.Operator + " ")
+		formatExpr(sb, expr.BinopFactor.Right, level, precedence, true)
+	case AST_BINOP_COMPARE:
+		// comparisons do not chain, both sides need parentheses for anything looser than a term
+		formatExpr(sb, expr.BinopCompare.Left, level, precedence+1, false)
+		sb.WriteString(" " + expr.BinopCompare.Operator + " ")
+		formatExpr(sb, expr.BinopCompare.Right, level, precedence+1, false)
+	case AST_BINOP_LOGIC:
+		formatExpr(sb, expr.BinopLogic.Left, level, precedence, false)
+		sb.WriteString(" " + expr.BinopLogic.Operator + " ")
+		formatExpr(sb, expr.BinopLogic.Right, level, precedence, true)
+	case AST_UNOP_NOT:
+		sb.WriteString("not ")
+		formatExpr(sb, expr.UnopNot.Expr, level, precedence, false)
+	case AST_COND:
+		formatCond(sb, expr.Cond, level)
+	case AST_VEC:
+		sb.WriteString("(")
+		for i, e := range expr.Vec.Exprs {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			formatExpr(sb, e, level, 0, false)
+		}
+		sb.WriteString(")")
+	case AST_VAR:
+		sb.WriteString(expr.Var.Name)
+	case AST_STRING:
+		sb.WriteString(`"` + expr.String.Value + `"`)
+	case AST_BOOL:
+		sb.WriteString(strconv.FormatBool(expr.Bool.Value))
+	case AST_FOR:
+		formatFor(sb, expr.For, level)
+	case AST_ARR_EXPR:
+		if len(expr.ArrExpr.Exprs) == 0 {
+			sb.WriteString("[]")
+			break
+		}
+		sb.WriteString("[\n")
+		formatElements(sb, expr.ArrExpr.Exprs, level)
+		sb.WriteString(indent(level) + "]")
+	case AST_FUN_CALL:
+		formatFunCall(sb, expr.FunCall, level)
+	}
+
+	if parentheses {
+		sb.WriteString(")")
+	}
+}
+
+// formatElements writes the elements of an array or a loop body one per line
+func formatElements(sb *strings.Builder, exprs []Expr, level int) {
+	for i, e := range exprs {
+		sb.WriteString(indent(level + 1))
+		formatExpr(sb, e, level+1, 0, false)
+		if i < len(exprs)-1 {
+			sb.WriteString(",")
+		}
+		sb.WriteString("\n")
+	}
+}
+
+// formatFor writes a loop, its range binds like a term
+func formatFor(sb *strings.Builder, loop *For, level int) {
+	sb.WriteString("for " + loop.Var + " in ")
+	formatExpr(sb, loop.From, level, 6, false)
+	if strings.HasSuffix(sb.String(), ".") {
+		// 1...3 would read as 1 .. .3
+		sb.WriteString(" ")
+	}
+	sb.WriteString("..")
+	formatExpr(sb, loop.To, level, 6, false)
+	if len(loop.Body.Exprs) == 0 {
+		sb.WriteString(" {}")
+		return
+	}
+	sb.WriteString(" {\n")
+	formatElements(sb, loop.Body.Exprs, level)
+	sb.WriteString(indent(level) + "}")
+}
+
+// formatCond writes a conditional the way it was written, else-if chains stay chains
+func formatCond(sb *strings.Builder, cond *Cond, level int) {
+	if !cond.IfElse {
+		formatExpr(sb, cond.Cond, level, 2, false)
+		sb.WriteString(" ? ")
+		formatExpr(sb, cond.Then, level, 0, false)
+		sb.WriteString(" : ")
+		formatExpr(sb, cond.Else, level, 1, false)
+		return
+	}
+
+	sb.WriteString("if ")
+	formatExpr(sb, cond.Cond, level, 0, false)
+	sb.WriteString(" { ")
+	formatExpr(sb, cond.Then, level, 0, false)
+	sb.WriteString(" } else ")
+	if cond.Else.Type == AST_COND && cond.Else.Cond.IfElse && !cond.Else.HasParentheses {
+		formatCond(sb, cond.Else.Cond, level)
+		return
+	}
+	sb.WriteString("{ ")
+	formatExpr(sb, cond.Else, level, 0, false)
+	sb.WriteString(" }")
+}
+
+func formatArg(sb *strings.Builder, arg FunNamedArg, named bool, level int) {
+	if named {
+		sb.WriteString(arg.ArgName + ": ")
+	}
+	formatExpr(sb, arg.Expr, level, 0, false)
+}
+
+// formatFunCall keeps the order of the arguments, positional ones stay positional.
+// Default values filled in by Analyze are left out.
+func formatFunCall(sb *strings.Builder, funCall *FunCall, level int) {
+	sb.WriteString(funCall.Id + "(")
+	args := funCall.explicitArgs()
+	if len(args) == 0 {
+		sb.WriteString(")")
+		return
+	}
+
+	named := false
+	// calls producing values stay on one line, shapes get one argument per line
+	if ReturnKind(funCall.Id) == ARG_FLOAT {
+		for i, arg := range args {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			named = named || !arg.Positional
+			formatArg(sb, arg, named, level)
+		}
+		sb.WriteString(")")
+		return
+	}
+
+	sb.WriteString("\n")
+	for i, arg := range args {
+		sb.WriteString(indent(level + 1))
+		named = named || !arg.Positional
+		formatArg(sb, arg, named, level+1)
+		if i < len(args)-1 {
+			sb.WriteString(",")
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString(indent(level) + ")")
+}
@@ -0,0 +1,48 @@
+package sdfl
+
+// front end state
+//
+// Tokenizing, parsing and analyzing a source report diagnostics and define the
+// functions of the source. A Frontend keeps both, so several sources can be
+// parsed and analyzed at the same time, each by its own Frontend. Tokenize,
+// NewParser, Analyze and the other functions of the package that take none
+// share the default front end, whose functions are functionSymbols; the code
+// generators read those and report to it as well.
+
+// symbols are the functions by name
+type symbols map[string]FunDef
+
+type Frontend struct {
+	diagnostics []Diagnostic
+	functions   symbols // the builtins and the functions the sources define
+}
+
+// NewFrontend returns a front end that knows the builtin functions
+func NewFrontend() *Frontend {
+	functions := symbols{}
+	for id, funDef := range functionSymbols {
+		if funDef.SymbolType != FUN_USER_DEFINED {
+			functions[id] = funDef
+		}
+	}
+	return &Frontend{diagnostics: []Diagnostic{}, functions: functions}
+}
+
+var defaultFrontend = &Frontend{diagnostics: []Diagnostic{}, functions: functionSymbols}
+
+func (fe *Frontend) ResetDiagnostics() {
+	fe.diagnostics = []Diagnostic{}
+}
+
+func (fe *Frontend) Diagnostics() []Diagnostic {
+	return fe.diagnostics
+}
+
+func (fe *Frontend) HasErrors() bool {
+	for _, d := range fe.diagnostics {
+		if d.Severity == SEVERITY_ERROR {
+			return true
+		}
+	}
+	return false
+}
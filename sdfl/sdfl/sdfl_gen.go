@@ -2,20 +2,21 @@ package sdfl
 
 import (
 	"fmt"
-	"os"
-	"reflect"
+	"slices"
+	"sort"
+	"strings"
 )
 
-var functionSymbols = map[string]FunDef{
-	"scene":              {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_SCENE, Id: "scene", FunDefArgNames: []string{"background", "camera", "children"}},
+var functionSymbols = symbols{
+	"scene":              {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_SCENE, Id: "scene", FunDefArgNames: []string{"background", "camera", "children", "render", "post", "bounces"}},
 	"local":              {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_LOCAL, Id: "local", FunDefArgNames: []string{"children"}},
 	"camera":             {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_CAMERA, Id: "camera", FunDefArgNames: []string{"position"}},
-	"plane":              {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_SHAPE, Id: "plane", FunDefArgNames: []string{"height"}},
-	"sphere":             {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_SHAPE, Id: "sphere", FunDefArgNames: []string{"position", "radius"}},
-	"cylinder":           {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_SHAPE, Id: "cylinder", FunDefArgNames: []string{"begin", "end", "radius"}},
-	"ellipsoid":          {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_SHAPE, Id: "ellipsoid", FunDefArgNames: []string{"position", "radius"}},
-	"box":                {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_SHAPE, Id: "box", FunDefArgNames: []string{"position", "size"}},
-	"torus":              {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_SHAPE, Id: "torus", FunDefArgNames: []string{"position", "radius", "thickness"}},
+	"plane":              {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_SHAPE, Id: "plane", FunDefArgNames: []string{"height", "material"}},
+	"sphere":             {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_SHAPE, Id: "sphere", FunDefArgNames: []string{"position", "radius", "material"}},
+	"cylinder":           {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_SHAPE, Id: "cylinder", FunDefArgNames: []string{"begin", "end", "radius", "material"}},
+	"ellipsoid":          {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_SHAPE, Id: "ellipsoid", FunDefArgNames: []string{"position", "radius", "material"}},
+	"box":                {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_SHAPE, Id: "box", FunDefArgNames: []string{"position", "size", "material"}},
+	"torus":              {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_SHAPE, Id: "torus", FunDefArgNames: []string{"position", "radius", "thickness", "material"}},
 	"rotateAround":       {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_ROTATE_AROUND, Id: "rotateAround", FunDefArgNames: []string{"position", "rotation", "child"}},
 	"smoothUnion":        {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_OP, Id: "smoothUnion", FunDefArgNames: []string{"child1", "child2", "smooth_transition"}},
 	"smoothSubtraction":  {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_OP, Id: "smoothSubtraction", FunDefArgNames: []string{"child1", "child2", "smooth_transition"}},
@@ -47,15 +48,26 @@ var functionSymbols = map[string]FunDef{
 	"log2":               {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_GLSL, Id: "log2", FunDefArgNames: []string{"val"}},
 	"sqrt":               {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_GLSL, Id: "sqrt", FunDefArgNames: []string{"val"}},
 	"inversesqrt":        {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_GLSL, Id: "inversesqrt", FunDefArgNames: []string{"val"}},
-}
-
-var resetCode = "// reset\n"
+	"animate":            {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_ANIM, Id: "animate", FunDefArgNames: []string{"keys", "ease", "loop"}},
+	"lerp":               {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_ANIM, Id: "lerp", FunDefArgNames: []string{"from", "to", "t"}},
+	"smoothstep":         {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_ANIM, Id: "smoothstep", FunDefArgNames: []string{"from", "to", "x"}},
+	"oscillate":          {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_ANIM, Id: "oscillate", FunDefArgNames: []string{"freq", "amp"}},
+	"fog":                {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_POST, Id: "fog", FunDefArgNames: []string{"density", "color"}},
+	"ambientOcclusion":   {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_POST, Id: "ambientOcclusion", FunDefArgNames: []string{"samples", "strength"}},
+	"toneMap":            {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_POST, Id: "toneMap", FunDefArgNames: []string{"curve"}},
+	"gamma":              {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_POST, Id: "gamma", FunDefArgNames: []string{"value"}},
+	"vignette":           {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_POST, Id: "vignette", FunDefArgNames: []string{"strength", "radius"}},
+	"bloom":              {Type: AST_FUN_DEF, SymbolType: FUN_BUILTIN_POST, Id: "bloom", FunDefArgNames: []string{"threshold", "intensity"}},
+}
+
+var resetCode = "    // reset\n"
 var generatedCodeFragmentShader = ""
 var generatedCodeComputeShader = ""
 
 func Reset() {
 	generatedCodeFragmentShader = ""
 	generatedCodeComputeShader = ""
+	resetCode = "    // reset\n"
 }
 
 func GetFragmentCode() string {
@@ -66,10 +78,6 @@ func GetComputeCode() string {
 	return generatedCodeComputeShader
 }
 
-type generator interface {
-	generate(args ...any)
-}
-
 func generateFragmentCode(code string, args ...any) {
 	generatedCodeFragmentShader += fmt.Sprintf(code, args...)
 }
@@ -83,77 +91,126 @@ func generateCodeBoth(code string, args ...any) {
 	generateComputeCode(code, args...)
 }
 
-func Generate(prog *Program) {
-	prog.generate()
-}
-
 func (prog *Program) generate(args ...any) {
+	resetTweaks()
+	resetGlslLibrary()
 	generateGlslFragmentHeader()
+	tweakInsertFragment = len(generatedCodeFragmentShader)
 	generateGlslFragmentGetMaterial()
 	generateGlslComputeHeader()
+	tweakInsertCompute = len(generatedCodeComputeShader)
 	generateGlslBuiltinSDFFunctions()
+	generateGlslAnimFunctions()
+
+	cameraCall, childrenArr, backgroundStr, ok := sceneParts(prog)
+	if !ok {
+		return
+	}
+	generatedRenderModes = sceneRenderModes(prog.Expr.FunCall)
+
+	beginGenCache()
+	funDefs := map[string]*FunDef{}
+	for _, stmt := range prog.Stmts {
+		if stmt.Type == AST_FUN_DEF {
+			funDefs[stmt.FunDef.Id] = stmt.FunDef
+		}
+	}
+
+	generateGlslPushScene()
+	for _, stmt := range prog.Stmts {
+		stmt := stmt
+		generateCached("stmt", strings.Join(stmtToLines(stmt), "\n")+tweakFingerprint(stmt.FunDef.Expr), func() {
+			stmt.generate()
+		})
+	}
+
+	generateGlslDistSceneBegin()
+	guarded := generateCulledChildren(childrenArr.Exprs, "p", "_scene_result.distance", func(expr *Expr) {
+		generateCached("child", calledSignatures(expr, funDefs)+strings.Join(exprToLines(*expr), "\n")+tweakFingerprint(expr), func() {
+			generateChild(expr, "")
+		})
+	})
+	generateGlslDistSceneEnd(guarded)
+	endGenCache()
+
+	generateGlslRaymarchEngine()
 
+	generateGlslFragmentMain(cameraCall, backgroundStr, scenePost(prog.Expr.FunCall), sceneBounces(prog.Expr.FunCall))
+	generateGlslComputeMain()
+	generateGlslLibrary()
+	generateGlslTweakUniforms()
+}
+
+// calledSignatures returns the signatures of the user defined functions expr
+// calls. The code of a call depends on them, so a cached scene child is keyed
+// by them as well, but not by the functions it does not call: another call of
+// a function with parameters adds a copy the other children do not see.
+func calledSignatures(expr *Expr, funDefs map[string]*FunDef) string {
+	ids := []string{}
+	walkExpr(expr, func(e *Expr) bool {
+		if e.Type == AST_FUN_CALL && funDefs[e.FunCall.Id] != nil && !slices.Contains(ids, e.FunCall.Id) {
+			ids = append(ids, e.FunCall.Id)
+		}
+		return true
+	})
+	sort.Strings(ids)
+	signatures := ""
+	for _, id := range ids {
+		signatures += strings.Join(funDefToLines(&FunDef{Id: id, FunDefArgNames: funDefs[id].FunDefArgNames}), "\n") + "\n"
+	}
+	return signatures
+}
+
+// sceneParts checks the call of scene and returns the call of its camera,
+// its children and its background as a GLSL vec3
+func sceneParts(prog *Program) (*FunCall, *ArrExpr, string, bool) {
 	sceneCall := prog.Expr.FunCall
 	if sceneCall == nil || sceneCall.Id != "scene" {
-		fmt.Println("ERROR: scene function must be called")
-		return
+		reportError(Span{}, "scene function must be called")
+		return nil, nil, "", false
 	}
-	if _, ok := sceneCall.FunNamedArgs["camera"]; !ok {
-		fmt.Println("ERROR: scene function had argument camera")
-		return
+	if _, ok := sceneCall.Arg("camera"); !ok {
+		reportError(sceneCall.Span, "scene function had argument camera")
+		return nil, nil, "", false
 	}
-	cameraCall := sceneCall.FunNamedArgs["camera"].Expr.FunCall
+	cameraCall := sceneCall.ArgExpr("camera").FunCall
 	if cameraCall == nil {
-		fmt.Println("ERROR: scene, camera argument is empty")
-		return
+		reportError(sceneCall.Span, "scene, camera argument is empty")
+		return nil, nil, "", false
 	}
-	if _, ok := cameraCall.FunNamedArgs["position"]; !ok {
-		fmt.Println("ERROR: camera function had argument position")
-		return
+	if _, ok := cameraCall.Arg("position"); !ok {
+		reportError(cameraCall.Span, "camera function had argument position")
+		return nil, nil, "", false
 	}
-	cameraPos := cameraCall.FunNamedArgs["position"].Expr.Tuple
+	cameraPos := cameraCall.ArgExpr("position").Tuple
 	if cameraPos == nil {
-		fmt.Println("ERROR: camera, position argument is empty")
-		return
+		reportError(cameraCall.Span, "camera, position argument is empty")
+		return nil, nil, "", false
 	}
-	if _, ok := sceneCall.FunNamedArgs["children"]; !ok {
-		fmt.Println("ERROR: scene function had argument children")
-		return
+	if _, ok := sceneCall.Arg("children"); !ok {
+		reportError(sceneCall.Span, "scene function had argument children")
+		return nil, nil, "", false
 	}
-	childrenArr := sceneCall.FunNamedArgs["children"].Expr.ArrExpr
+	childrenArr := sceneCall.ArgExpr("children").ArrExpr
 	if childrenArr == nil {
-		fmt.Println("ERROR: scene, children argument is empty")
-		return
+		reportError(sceneCall.Span, "scene, children argument is empty")
+		return nil, nil, "", false
 	}
 
 	backgroundStr := "vec3(0, 0, 0)"
-	if _, ok := sceneCall.FunNamedArgs["background"]; ok {
-		if sceneCall.FunNamedArgs["background"].Expr.Tuple != nil {
-			r := sceneCall.FunNamedArgs["background"].Expr.Tuple.Values[0]
-			g := sceneCall.FunNamedArgs["background"].Expr.Tuple.Values[1]
-			b := sceneCall.FunNamedArgs["background"].Expr.Tuple.Values[2]
+	if background, ok := sceneCall.Arg("background"); ok {
+		if background.Expr.Tuple != nil {
+			color := background.Expr.Tuple
+			r := irLiteral(color.Values[0], color.Span)
+			g := irLiteral(color.Values[1], color.Span)
+			b := irLiteral(color.Values[2], color.Span)
 			backgroundStr = fmt.Sprintf("vec3(%s, %s, %s)", r, g, b)
 		} else {
-			fmt.Println("ERROR: scene function had argument background as tuple")
-			return
+			reportError(sceneCall.Span, "scene function had argument background as tuple")
+			return nil, nil, "", false
 		}
 	}
-
-	generateGlslPushScene()
-	for _, stmt := range prog.Stmts {
-		stmt.generate()
-	}
-
-	generateGlslDistSceneBegin()
-	for _, expr := range childrenArr.Exprs {
-		expr.generate()
-	}
-	generateGlslDistSceneEnd()
-
-	generateGlslRaymarchEngine()
-
-	generateGlslFragmentMain(cameraCall, backgroundStr)
-	generateGlslComputeMain()
+	return cameraCall, childrenArr, backgroundStr, true
 }
 
 func (stmt *Stmt) generate(args ...any) {
@@ -161,11 +218,12 @@ func (stmt *Stmt) generate(args ...any) {
 	case AST_FUN_DEF:
 		stmt.FunDef.generate()
 	default:
-		fmt.Printf("gen error: unknown stmt type: %v\n", stmt.Type)
+		reportError(Span{}, "unknown stmt type: %v", stmt.Type)
 	}
 }
 
 func (funDef *FunDef) generate(args ...any) {
+	Tracef(TRACE_GEN, "fundef %s", funDef.Id)
 	// local distance buffers
 	generateCodeBoth(`
 SceneResult _scene_result_%s = SceneResult(SDFL_MAX_DISTANCE, 0);
@@ -183,56 +241,42 @@ SceneResult sdfl_PushScene_%s(SceneResult sr) {
 	resetCode += fmt.Sprintf("    _scene_result_%s = SceneResult(SDFL_MAX_DISTANCE, 0);\n", funDef.Id)
 
 	// TODO: get arguments
-	generateCodeBoth("\nfloat %s(%s) {\n", funDef.Id, "vec3 p")
+	generateCodeBoth("\nSceneResult %s(%s) {\n", funDef.Id, "vec3 p")
 	generateCodeBoth("    SceneResult d = SceneResult(SDFL_MAX_DISTANCE, 0);\n")
-	localCall := funDef.Expr.FunCall
-	if localCall == nil || localCall.Id != "local" {
-		fmt.Println("ERROR: local function must be called in a function definition")
-		return
-	}
-	if _, ok := localCall.FunNamedArgs["children"]; !ok {
-		fmt.Println("ERROR: local function had argument children")
-		return
-	}
-	childrenArr := localCall.FunNamedArgs["children"].Expr.ArrExpr
-	if childrenArr == nil {
-		fmt.Println("ERROR: local, children argument is empty")
+	childrenArr, ok := funDef.localChildren()
+	if !ok {
 		return
 	}
 
-	for _, expr := range childrenArr.Exprs {
-		expr.generate("p", false, funDef.Id)
-	}
+	guarded := generateCulledChildren(childrenArr.Exprs, "p", "_scene_result_"+funDef.Id+".distance", func(expr *Expr) {
+		generateChild(expr, funDef.Id)
+	})
 
-	generateCodeBoth("    return d.distance;\n")
+	if guarded {
+		generateCodeBoth("    return _scene_result_%s;\n", funDef.Id)
+	} else {
+		generateCodeBoth("    return d;\n")
+	}
 	generateCodeBoth("}\n")
 }
 
-func (expr *Expr) generate(args ...any) {
-	if expr.HasParentheses {
-		generateCodeBoth("(")
+// localChildren checks the call of local in the body of funDef and returns its children
+func (funDef *FunDef) localChildren() (*ArrExpr, bool) {
+	localCall := funDef.Expr.FunCall
+	if localCall == nil || localCall.Id != "local" {
+		reportError(Span{}, "local function must be called in a function definition %s", funDef.Id)
+		return nil, false
 	}
-
-	switch expr.Type {
-	case AST_FUN_CALL:
-		expr.FunCall.generate(args...)
-	case AST_TUPLE:
-		expr.Tuple.generate()
-	case AST_ARR_EXPR:
-		expr.ArrExpr.generate()
-	case AST_NUMBER:
-		expr.Number.generate()
-	case AST_BINOP_TERM:
-		expr.BinopTerm.generate(args...)
-	case AST_BINOP_FACTOR:
-		expr.BinopFactor.generate(args...)
-	default:
-		fmt.Printf("gen error: unknown expr type: %v\n", expr.Type)
+	if _, ok := localCall.Arg("children"); !ok {
+		reportError(localCall.Span, "local function had argument children")
+		return nil, false
 	}
-
-	if expr.HasParentheses {
-		generateCodeBoth(")")
+	childrenArr := localCall.ArgExpr("children").ArrExpr
+	if childrenArr == nil {
+		reportError(localCall.Span, "local, children argument is empty")
+		return nil, false
 	}
+	return childrenArr, true
 }
 
 var varCounters = make(map[string]int)
@@ -244,216 +288,32 @@ func freshVar(base string) string {
 	return name
 }
 
-func (funCall *FunCall) generate(args ...any) string {
-	println("HERE:")
-	println(len(args))
-	rayPosition := "p"
-	parentIsOp := false
-	localFunDefId := ""
-	if len(args) > 0 {
-		if reflect.TypeOf(args[0]).String() == "string" {
-			rayPosition = args[0].(string)
-		}
-		if len(args) > 1 {
-			parentIsOp = args[1].(bool)
-			if len(args) > 2 {
-				localFunDefId = args[2].(string)
-			}
-		}
-	}
-
-	funDef, ok := functionSymbols[funCall.Id]
-	println(funCall.Id, funDef.SymbolType, rayPosition)
-
-	if !ok {
-		fmt.Printf("ERROR: function call %s is not defined!\n", funCall.Id)
-		os.Exit(-1)
-	}
-
-	orderedArgs := func() []*Expr {
-		exprs := []*Expr{}
-		// figure out named parameter order
-		for j := 0; j < len(funDef.FunDefArgNames); j++ {
-			funNamedArg, ok := funCall.FunNamedArgs[funDef.FunDefArgNames[j]]
-			if !ok {
-				fmt.Printf("ERROR: function call %s, did you mean %s?", funDef.Id, funDef.FunDefArgNames[j])
-				// TODO: find a better way than exit
-				os.Exit(-1)
-			}
-			if funDef.FunDefArgNames[j] == funNamedArg.ArgName {
-				exprs = append(exprs, &funNamedArg.Expr)
-			}
-		}
-		return exprs
-	}
-
-	genFunCall := func(funId string) string {
-		return "sdfl_builtin_" + funId
-	}
-
-	switch funDef.SymbolType {
-	case FUN_BUILTIN_ROTATE_AROUND:
-		posExpr, okPos := funCall.FunNamedArgs["position"]
-		rotExpr, okRot := funCall.FunNamedArgs["rotation"]
-		childExpr, okChild := funCall.FunNamedArgs["child"]
-
-		if !okPos || !okRot || !okChild {
-			fmt.Println("ERROR: rotateAround missing args (needs position, rotation, child)")
-			return ""
-		}
-
-		qVar := freshVar("q")
-
-		// Generate the rotation transformation code
-		generateCodeBoth(fmt.Sprintf("    vec3 %s = %s - ", qVar, rayPosition))
-		posExpr.Expr.generate(args...)
-		generateCodeBoth(";\n")
-
-		generateCodeBoth(fmt.Sprintf("    %s = sdfl_RotationMatrix(radians(", qVar))
-		rotExpr.Expr.generate(args...)
-		generateCodeBoth(fmt.Sprintf(")) * %s;\n", qVar))
-
-		generateCodeBoth(fmt.Sprintf("    %s += ", qVar))
-		posExpr.Expr.generate(args...)
-		generateCodeBoth(";\n")
-
-		// CRITICAL: Pass the new coordinate system (qVar) to the child
-		// This ensures all nested shapes use the rotated coordinates
-		return childExpr.Expr.FunCall.generate(qVar, parentIsOp, localFunDefId)
-
-	case FUN_BUILTIN_OP:
-		exprs := orderedArgs()
-
-		// Both children should use the SAME rayPosition (which might be "p" or "q16" etc)
-		// and both should be marked as parentIsOp=true so they don't call sdfl_PushScene
-		child1Var := exprs[0].FunCall.generate(rayPosition, true, localFunDefId)
-		child2Var := exprs[1].FunCall.generate(rayPosition, true, localFunDefId)
-
-		sd := freshVar("sd")
-		// Use child1, child2 order to match the expected output
-		// smoothUnion(child1: sphere, child2: rotateAround) -> smoothUnion(child1_var, child2_var)
-		generateCodeBoth(fmt.Sprintf("    SceneResult %s = %s(%s, %s", sd, genFunCall(funDef.Id), child1Var, child2Var))
-
-		// smooth_transition parameter
-		if len(exprs) > 2 {
-			generateCodeBoth(", ")
-			exprs[2].generate()
-		}
-		generateCodeBoth(");\n")
-
-		// Only push to scene if this isn't part of a larger operation
-		if !parentIsOp {
-			if localFunDefId != "" {
-				generateCodeBoth(fmt.Sprintf("    d = sdfl_PushScene_%s(%s);\n", localFunDefId, sd))
-			} else {
-				generateCodeBoth(fmt.Sprintf("    d = sdfl_PushScene(%s);\n", sd))
-			}
-		}
-		return sd
-
-	case FUN_BUILTIN_SHAPE:
-		exprs := orderedArgs()
-
-		sd := freshVar("sd")
-		generateCodeBoth(fmt.Sprintf("    SceneResult %s = SceneResult(%s(%s, ", sd, genFunCall(funDef.Id), rayPosition))
-		for i, e := range exprs {
-			e.generate()
-			if i < len(exprs)-1 {
-				generateCodeBoth(", ")
-			}
-		}
-		generateCodeBoth("), 0);\n")
-
-		if !parentIsOp {
-			if localFunDefId != "" {
-				generateCodeBoth(fmt.Sprintf("    d = sdfl_PushScene_%s(%s);\n", localFunDefId, sd))
-			} else {
-				generateCodeBoth(fmt.Sprintf("    d = sdfl_PushScene(%s);\n", sd))
-			}
-		}
-		return sd
-
-	case FUN_USER_DEFINED:
-		exprs := orderedArgs()
-
-		sd := freshVar("sd")
-		generateCodeBoth(fmt.Sprintf("    SceneResult %s = SceneResult(%s(%s", sd, funDef.Id, rayPosition))
-		for i, e := range exprs {
-			if i < len(exprs)-1 {
-				generateCodeBoth(", ")
-			}
-			e.generate()
-		}
-		generateCodeBoth("), 0);\n")
-
-		if !parentIsOp {
-			generateCodeBoth(fmt.Sprintf("    d = sdfl_PushScene(%s);\n", sd))
-		}
-		return sd
-
-	case FUN_BUILTIN_SDFL:
-		exprs := orderedArgs()
-
-		generateCodeBoth(fmt.Sprintf("%s(%s.xy", genFunCall(funDef.Id), rayPosition))
-		for i, e := range exprs {
-			if i < len(exprs)-1 {
-				generateCodeBoth(", ")
-			}
-			e.generate()
-		}
-		generateCodeBoth(")")
-		return ""
-
-	default:
-		fmt.Println("NOT IMPLEMENTED YET!")
-		return ""
-	}
-}
-
-func (tuple *Tuple) generate(args ...any) {
-	var isCamera = false
-	if len(args) > 0 {
-		isCamera = args[0].(bool)
-	}
-	if isCamera {
-		generateFragmentCode("vec3(%s, %s, %s)", tuple.Values[0], tuple.Values[1], tuple.Values[2])
+// pushShape adds the result of a shape to the scene, or to the local scene of a function definition
+func pushShape(sd string, localFunDefId string) {
+	if localFunDefId != "" {
+		generateCodeBoth("    d = sdfl_PushScene_%s(%s);\n", localFunDefId, sd)
 	} else {
-		generateCodeBoth("vec3(%s, %s, %s)", tuple.Values[0], tuple.Values[1], tuple.Values[2])
+		generateCodeBoth("    d = sdfl_PushScene(%s);\n", sd)
 	}
 }
 
-func (number *Number) generate(args ...any) {
-	generateCodeBoth(number.Value)
-}
-
-func (binopFactor *BinopFactor) generate(args ...any) {
-	binopFactor.Left.generate(args)
-	generateCodeBoth(binopFactor.Operator)
-	println("HERE1:")
-	println(len(args))
-	binopFactor.Right.generate(args)
-}
-
-func (binopTerm *BinopTerm) generate(args ...any) {
-	binopTerm.Left.generate(args)
-	generateCodeBoth(binopTerm.Operator)
-	binopTerm.Right.generate(args)
-}
-
-func (arrExpr *ArrExpr) generate(args ...any) {
-	for _, expr := range arrExpr.Exprs {
-		expr.generate(args...)
+// generateChild lowers a child of the scene, or of the local scene of the
+// function localFunDefId, and pushes its distance
+func generateChild(expr *Expr, localFunDefId string) {
+	shape := lowerShape(expr)
+	if shape == nil {
+		return
 	}
+	pushShape(glslShape(shape, "p"), localFunDefId)
 }
 
 func generateGlslCamera(cameraFunCall *FunCall) {
 	generateFragmentCode("    // generated camera position\n")
-	generateFragmentCode("    vec3 cam_pos = ")
-	cameraFunCall.FunNamedArgs["position"].Expr.Tuple.generate(true)
-	generateFragmentCode(";\n")
+	position := cameraFunCall.ArgExpr("position")
+	generateFragmentCode("    vec3 cam_pos = %s;\n", glslValue(lowerExpr(&position)))
 }
 
-func generateCalculateMainScene(bg string) {
+func generateCalculateMainScene(bg string, post []*FunCall, bounces int) {
 	generateFragmentCode(`
 vec3 calc_color(vec3 cam_pos, vec2 uv) {
     uv.y *= float(window_size.y) / float(window_size.x);
@@ -487,16 +347,16 @@ vec3 calc_color(vec3 cam_pos, vec2 uv) {
         vec3 view_dir = -ray_dir;
         
         Material mat = sdfl_GetMaterial(result.materialId);
-        color = sdfl_CalculateLighting(p, view_dir, mat);
+        color = %s;
     } else {
         // Background/sky
         color = mix(vec3(0.5, 0.7, 1.0), %s, uv.y * 0.5 + 0.5);
     }
-
+%s
     return color;
 }
 
-`, bg)
+`, glslShading(bounces, "view_dir", "mat", bg), bg, glslPostEffects(post, "ray_origin"))
 }
 
 func generateGlslFragmentAnaglyphRender(cameraFunCall *FunCall) {
@@ -535,23 +395,20 @@ func generateGlslFragmentNormalRender(cameraFunCall *FunCall) {
 }
 
 func generateLensValues() {
-	generateFragmentCode(
-		`
-float u_ipd = 0.064;
-float u_lens_separation = 0.064;
-float u_screen_width = 0.2; // in meters
-// float u_distortion_k1 = 0.22;
-// float u_distortion_k2 = 0.24;
-
-// For Google Cardboard-style viewers:
-float u_distortion_k1 = 0.441;
-float u_distortion_k2 = 0.156;
+	generateFragmentCode(`
+// lens profile %s
+const float u_ipd = %s;
+const float u_lens_separation = %s;
+const float u_screen_width = %s; // in meters
+const float u_distortion_k1 = %s;
+const float u_distortion_k2 = %s;
 
-`)
+`, lensProfile.Name, glslFloat(lensProfile.IPD), glslFloat(lensProfile.LensSeparation), glslFloat(lensProfile.ScreenWidth),
+		glslFloat(lensProfile.K1), glslFloat(lensProfile.K2))
 }
 
 func generateDistortionFunctions() {
-	generateFragmentCode(
+	addGlslLibrary(
 		`
 // Barrel distortion for VR lenses
 vec2 barrel_distortion(vec2 coord, float k1, float k2) {
@@ -570,7 +427,7 @@ vec2 chromatic_distortion(vec2 coord, float k1, float k2, float scale) {
     return 0.5 + cc * distortion;
 }
 
-`)
+`, true, false)
 }
 
 func generateGlslFragmentVRRender(cameraFunCall *FunCall) {
@@ -623,33 +480,51 @@ vec4 VR_RENDER() {
 `)
 }
 
-func generateGlslFragmentMain(cameraFunCall *FunCall, bg string) {
-	generateCalculateMainScene(bg)
+func generateGlslFragmentMain(cameraFunCall *FunCall, bg string, post []*FunCall, bounces int) {
+	generateFragmentCode("%s", glslTraceEngine(bounces))
+	generateFragmentCode("%s", glslPostLibrary(post))
+	generateCalculateMainScene(bg, post, bounces)
 
-	generateGlslFragmentAnaglyphRender(cameraFunCall)
-	generateGlslFragmentNormalRender(cameraFunCall)
-	generateLensValues()
-	generateDistortionFunctions()
-	generateGlslFragmentVRRender(cameraFunCall)
+	if generatedRenderModes["anaglyph"] {
+		generateGlslFragmentAnaglyphRender(cameraFunCall)
+	}
+	if generatedRenderModes["normal"] {
+		generateGlslFragmentNormalRender(cameraFunCall)
+	}
+	if generatedRenderModes["vr"] {
+		generateLensValues()
+		generateDistortionFunctions()
+		generateGlslFragmentVRRender(cameraFunCall)
+	}
 
-	generateFragmentCode(`
+	// the switch falls back to the last mode, normal when it is there
+	functions := map[string]string{"normal": "NORMAL_RENDER", "anaglyph": "ANAGLYPH_RENDER", "vr": "VR_RENDER"}
+	modes := []string{}
+	for _, mode := range []string{"anaglyph", "vr", "normal"} {
+		if generatedRenderModes[mode] {
+			modes = append(modes, mode)
+		}
+	}
+	if len(modes) == 1 {
+		generateFragmentCode(`
 
 void main() {
-	switch (render_mode) {
-		case RENDER_MODE_ANAGLYPH:
-			frag_color = ANAGLYPH_RENDER();
-			break;
-		case RENDER_MODE_VR:
-			frag_color = VR_RENDER();
-			break;
-		case RENDER_MODE_NORMAL:
-		default:
-			frag_color = NORMAL_RENDER();
-			break;
-	}
+	frag_color = %s();
 }
 
-`)
+`, functions[modes[0]])
+		return
+	}
+
+	generateFragmentCode("\n\nvoid main() {\n\tswitch (render_mode) {\n")
+	for i, mode := range modes {
+		generateFragmentCode("\t\tcase RENDER_MODE_%s:\n", strings.ToUpper(mode))
+		if i == len(modes)-1 {
+			generateFragmentCode("\t\tdefault:\n")
+		}
+		generateFragmentCode("\t\t\tfrag_color = %s();\n\t\t\tbreak;\n", functions[mode])
+	}
+	generateFragmentCode("\t}\n}\n\n")
 }
 
 func generateGlslComputeMain() {
@@ -684,14 +559,9 @@ out vec4 frag_color;
 
 
 // uniforms
-uniform sampler2D editor_texture;
-uniform ivec2 window_size;
-uniform float elapsed_time;
-uniform bool ht_tracking_enabled;
-uniform vec3 ht_head_center;
-uniform uint render_mode;
-uniform vec2 anaglyph_offset;
-
+`)
+	generateFragmentCode("%s", glslUniforms(fragmentUniforms))
+	generateFragmentCode(`
 #define RENDER_MODE_NORMAL   0
 #define RENDER_MODE_ANAGLYPH 1
 #define RENDER_MODE_VR       2
@@ -700,65 +570,28 @@ uniform vec2 anaglyph_offset;
 #define SDFL_MAX_DISTANCE 100.
 #define SDFL_HIT_DISTANCE .01
 #define SDFL_SHADOW_CAST_DISTANCE .05
+`)
+	generateFragmentCode("%s", glslSceneStructs)
+}
 
+// the structs of the fragment shader, shared with the portable shaders
+var glslSceneStructs = `
 // material system
 struct Material {
     vec3 albedo;
     float roughness;
     float metallic;
     vec3 emission;
+    float reflectivity;
+    float ior;
+    float transparency;
 };
 
 struct SceneResult {
     float distance;
     int materialId;
 };
-`)
-}
-
-func generateGlslFragmentGetMaterial() {
-	generateFragmentCode(`
-
-vec2 editor_uv = vec2(0.);
-
-Material sdfl_GetMaterial(int id) {
-    Material mat;
-    
-    if (id == 0) { // Default/Ground
-        mat.albedo = vec3(0.8, 0.8, 0.8);
-        mat.roughness = 0.9;
-        mat.metallic = 0.0;
-        mat.emission = vec3(0.0);
-    }
-    else if (id == 1) { // Main object (torus-subtracted sphere)
-        mat.albedo = vec3(0.2, 0.6, 1.0);
-        mat.roughness = 0.3;
-        mat.metallic = 0.1;
-        mat.emission = vec3(0.0);
-    }
-    else if (id == 2) { // Eyes/spheres
-        mat.albedo = vec3(1.0, 0.3, 0.2);
-        mat.roughness = 0.1;
-        mat.metallic = 0.0;
-        mat.emission = vec3(0.1, 0.0, 0.0); // slight red glow
-    }
-	else if (id == 3) { // TEXTURE
-        mat.albedo = texture(editor_texture, editor_uv).xyz;
-        mat.roughness = 1;
-        mat.metallic = 10;
-        mat.emission = vec3(0.2); // slight red glow
-    }
-    else { // Fallback
-        mat.albedo = vec3(0.5, 0.5, 0.5);
-        mat.roughness = 0.5;
-        mat.metallic = 0.0;
-        mat.emission = vec3(0.0);
-    }
-    
-    return mat;
-}
-`)
-}
+`
 
 func generateGlslComputeHeader() {
 	generateComputeCode(`
@@ -773,10 +606,9 @@ layout(std430, binding = 0) buffer SDFBuffer {
     float sdfData[];
 };
 
-uniform vec3 minBound;
-uniform vec3 maxBound;
-uniform int resolution;
-
+`)
+	generateComputeCode("%s", glslUniforms(computeUniforms))
+	generateComputeCode(`
 #define SDFL_MAX_DISTANCE 100.
 
 struct SceneResult {
@@ -786,8 +618,9 @@ struct SceneResult {
 `)
 }
 
-func generateGlslBuiltinSDFFunctions() {
-	code := `
+// glslBuiltinLibrary are the builtin shapes, operations and noise of every
+// backend, the portable ones translate the GLSL
+var glslBuiltinLibrary = `
 float editor_sdfl_builtin_plane(vec3 p, vec3 pos, vec3 n, vec2 size) {    
     vec3 rel = p - pos;
     float d = dot(rel, n);
@@ -940,22 +773,31 @@ float sdfl_builtin_noise(vec2 point) {
 	return noise;
 }
 `
-	generateFragmentCode(code)
-	generateFragmentCode(`
+
+var glslFragmentTime = `
 float sdfl_builtin_time(vec2 p){
     return elapsed_time;
 }
-	`)
-	generateComputeCode(code)
-	generateComputeCode(`
+	`
+
+var glslComputeTime = `
 float sdfl_builtin_time(vec2 p){
-    return 1.0;
+    return time;
 }
-	`)
+	`
+
+func generateGlslBuiltinSDFFunctions() {
+	addGlslLibrary(glslBuiltinLibrary, true, true)
+	addGlslLibrary(glslFragmentTime, true, false)
+	addGlslLibrary(glslComputeTime, false, true)
 }
 
 func generateGlslRaymarchEngine() {
-	generateFragmentCode(`
+	generateFragmentCode("%s", glslRaymarchEngine)
+}
+
+// glslRaymarchEngine marches rays and lights the surfaces they hit, shared with the portable shaders
+var glslRaymarchEngine = `
 SceneResult sdfl_RayMarch(vec3 ray_origin, vec3 ray_dir) {
     float dfo = 0.;
     SceneResult result = SceneResult(SDFL_MAX_DISTANCE, 0);
@@ -1048,8 +890,7 @@ vec3 sdfl_CalculateLighting(vec3 p, vec3 view_dir, Material mat) {
     
     return ambient + (diffuse + specular) * shadow + mat.emission;
 }
-`)
-}
+`
 
 func generateGlslPushScene() {
 	code := `
@@ -1063,7 +904,7 @@ SceneResult sdfl_PushScene(SceneResult sr) {
     return _scene_result;
 }	
 `
-	generateCodeBoth(code)
+	generateCodeBoth("%s", code)
 }
 
 func generateGlslDistSceneBegin() {
@@ -1075,7 +916,10 @@ SceneResult sdfl_GetDistScene(vec3 p) {
 	SceneResult d;
 
 `
-	generateCodeBoth(code)
+	generateCodeBoth("%s", code)
+	if !generatedRenderModes["vr"] {
+		return
+	}
 	generateFragmentCode(`
 	if (render_mode == RENDER_MODE_VR) {
 		SceneResult editor = SceneResult(
@@ -1091,11 +935,20 @@ SceneResult sdfl_GetDistScene(vec3 p) {
 `)
 }
 
-func generateGlslDistSceneEnd() {
+// generateGlslDistSceneEnd returns the scene buffer when pushes were guarded,
+// d is not assigned when all of them are skipped
+func generateGlslDistSceneEnd(guarded bool) {
 	code := resetCode
-	code += `
+	if guarded {
+		code += `
+    return _scene_result;
+}
+`
+	} else {
+		code += `
     return d;
 }
 `
-	generateCodeBoth(code)
+	}
+	generateCodeBoth("%s", code)
 }
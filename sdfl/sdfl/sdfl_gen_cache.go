@@ -0,0 +1,95 @@
+package sdfl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// generation cache
+//
+// Code generated for a function definition or a scene child only depends on
+// its own subtree, so in watch mode we keep it around between compiles and
+// reuse it when the subtree did not change. This works because varCounters
+// are never reset: freshly generated chunks can not collide with variable
+// names of the cached ones.
+
+type genCacheEntry struct {
+	fragment string
+	compute  string
+	reset    string
+	tweaks   []TweakUniform
+}
+
+var genCache = map[string]genCacheEntry{}
+var genCacheTouched = map[string]bool{}
+var genCacheHits = 0
+var genCacheMisses = 0
+
+func HashContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func beginGenCache() {
+	genCacheTouched = map[string]bool{}
+	genCacheHits = 0
+	genCacheMisses = 0
+}
+
+// endGenCache drops the entries that were not used by the last compile,
+// otherwise every edit would leave its old subtree in memory.
+func endGenCache() {
+	for key := range genCache {
+		if !genCacheTouched[key] {
+			delete(genCache, key)
+		}
+	}
+}
+
+func generateCached(kind string, seq string, gen func()) {
+	key := fmt.Sprintf("%s:%d:%t:%t:%s", kind, tweakMode, cullingEnabled, shaderOptimization, HashContent(seq))
+	genCacheTouched[key] = true
+
+	if entry, ok := genCache[key]; ok {
+		generatedCodeFragmentShader += entry.fragment
+		generatedCodeComputeShader += entry.compute
+		resetCode += entry.reset
+		for _, uniform := range entry.tweaks {
+			if !tweakDeclared[uniform.Name] {
+				tweakDeclared[uniform.Name] = true
+				tweakUniforms = append(tweakUniforms, uniform)
+			}
+		}
+		genCacheHits++
+		Tracef(TRACE_GEN, "cache hit %s", key)
+		return
+	}
+
+	fragmentStart := len(generatedCodeFragmentShader)
+	computeStart := len(generatedCodeComputeShader)
+	resetStart := len(resetCode)
+	tweaksStart := len(tweakUniforms)
+	// cached code can not refer to variables bound outside of it
+	scopes := glslScopes
+	glslScopes = []map[string]string{{}}
+	gen()
+	glslScopes = scopes
+	genCache[key] = genCacheEntry{
+		fragment: generatedCodeFragmentShader[fragmentStart:],
+		compute:  generatedCodeComputeShader[computeStart:],
+		reset:    resetCode[resetStart:],
+		tweaks:   append([]TweakUniform{}, tweakUniforms[tweaksStart:]...),
+	}
+	genCacheMisses++
+	Tracef(TRACE_GEN, "cache miss %s", key)
+}
+
+// GetCacheStats returns how many subtrees were reused and regenerated by the last Generate call.
+func GetCacheStats() (int, int) {
+	return genCacheHits, genCacheMisses
+}
+
+func ClearCache() {
+	genCache = map[string]genCacheEntry{}
+}
@@ -0,0 +1,34 @@
+package sdfl
+
+import "testing"
+
+// cacheStats generates src without clearing the cache of the compiles before
+func cacheStats(t *testing.T, src string) (int, int) {
+	t.Helper()
+	prog := parseSource(t, src)
+	Reset()
+	Generate(&prog)
+	if HasErrors() {
+		t.Fatalf("generate: %v", GetDiagnostics())
+	}
+	return GetCacheStats()
+}
+
+func TestCacheKeepsChildrenOfOtherCalls(t *testing.T) {
+	ClearCache()
+	defer ClearCache()
+	blob := "def blob(r) { local(children: [sphere(radius: r)]) }\n"
+	children := "box(size: (1, 1, 1)), blob(r: 1), torus(radius: 1, thickness: 0.2)"
+	if hits, _ := cacheStats(t, blob+sceneWith(children)); hits != 0 {
+		t.Fatalf("%d hits in a cleared cache", hits)
+	}
+	if hits, misses := cacheStats(t, blob+sceneWith(children)); misses != 0 {
+		t.Errorf("the same scene again: %d hits, %d misses, want no miss", hits, misses)
+	}
+
+	// another call makes another copy of blob, the children before do not call it
+	hits, misses := cacheStats(t, blob+sceneWith(children+", blob(r: 2)"))
+	if hits != 4 || misses != 2 {
+		t.Errorf("one more call: %d hits, %d misses, want 4 (the copy blob_1 and three children) and 2 (blob_2 and its call)", hits, misses)
+	}
+}
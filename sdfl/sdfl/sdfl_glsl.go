@@ -0,0 +1,214 @@
+package sdfl
+
+import (
+	"regexp"
+	"strings"
+)
+
+// GLSL level optimization
+//
+// Besides the code appended to the shaders the generator keeps two small
+// representations of it. Pure values are bound with letVar: a value that is
+// bound again in the same or an enclosing block reuses the variable instead of
+// being computed twice. Blocks are opened and closed with pushGlslScope and
+// popGlslScope, and every cached chunk starts with its own table as it has to
+// stand on its own when it is reused. Helper functions like the builtin SDFs
+// are added to a library with addGlslLibrary, at the end only the functions
+// that are called, directly or by other called functions, are inserted where
+// the library was declared.
+
+var shaderOptimization = true
+
+func SetShaderOptimization(enabled bool) {
+	shaderOptimization = enabled
+}
+
+// the variables bound in the open blocks by their value, the innermost is last
+var glslScopes = []map[string]string{{}}
+
+func pushGlslScope() {
+	glslScopes = append(glslScopes, map[string]string{})
+}
+
+func popGlslScope() {
+	glslScopes = glslScopes[:len(glslScopes)-1]
+}
+
+// letVar binds the pure value of glslType to a fresh variable and returns
+// its name, or the name of the variable value is already bound to
+func letVar(glslType string, base string, value string) string {
+	key := glslType + " " + value
+	if shaderOptimization {
+		for i := len(glslScopes) - 1; i >= 0; i-- {
+			if name, ok := glslScopes[i][key]; ok {
+				return name
+			}
+		}
+	}
+	name := freshVar(base)
+	glslScopes[len(glslScopes)-1][key] = name
+	generateCodeBoth("    %s %s = %s;\n", glslType, name, value)
+	return name
+}
+
+// uniqueChildren drops children equal to an earlier one, pushing the same
+// distance twice does not change the scene. Calls of user defined functions
+// are kept, they push to the local scene of the function.
+func uniqueChildren(exprs []Expr) []Expr {
+	if !shaderOptimization {
+		return exprs
+	}
+	unique := []Expr{}
+	seen := map[string]bool{}
+	for _, expr := range exprs {
+		key := strings.Join(exprToLines(expr), "\n") + tweakFingerprint(&expr)
+		if seen[key] && !callsUserFunction(&expr) {
+			Tracef(TRACE_GEN, "dropping a repeated child")
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, expr)
+	}
+	return unique
+}
+
+func callsUserFunction(expr *Expr) bool {
+	calls := false
+	walkExpr(expr, func(e *Expr) bool {
+		if e.Type == AST_FUN_CALL && functionSymbols[e.FunCall.Id].SymbolType == FUN_USER_DEFINED {
+			calls = true
+		}
+		return !calls
+	})
+	return calls
+}
+
+// glslFunction is a function definition of the library, with the comments above it
+type glslFunction struct {
+	name  string
+	code  string
+	calls map[string]bool
+}
+
+var fragmentLibrary = []glslFunction{}
+var computeLibrary = []glslFunction{}
+
+// the library is inserted where it was first declared
+var libraryInsertFragment = -1
+var libraryInsertCompute = -1
+
+func resetGlslLibrary() {
+	fragmentLibrary = []glslFunction{}
+	computeLibrary = []glslFunction{}
+	libraryInsertFragment = -1
+	libraryInsertCompute = -1
+}
+
+// addGlslLibrary adds the function definitions of code to the libraries of
+// the given shaders, without optimization they are generated right away
+func addGlslLibrary(code string, fragment bool, compute bool) {
+	if !shaderOptimization {
+		if fragment {
+			generateFragmentCode("%s", code)
+		}
+		if compute {
+			generateComputeCode("%s", code)
+		}
+		return
+	}
+
+	functions := parseGlslFunctions(code)
+	if fragment {
+		if libraryInsertFragment < 0 {
+			libraryInsertFragment = len(generatedCodeFragmentShader)
+		}
+		fragmentLibrary = append(fragmentLibrary, functions...)
+	}
+	if compute {
+		if libraryInsertCompute < 0 {
+			libraryInsertCompute = len(generatedCodeComputeShader)
+		}
+		computeLibrary = append(computeLibrary, functions...)
+	}
+}
+
+var glslFunctionHead = regexp.MustCompile(`^\w+\s+(\w+)\s*\(`)
+var glslCall = regexp.MustCompile(`(\w+)\s*\(`)
+var glslComment = regexp.MustCompile(`//.*`)
+
+// parseGlslFunctions splits code into its top level function definitions,
+// every definition starts at the beginning of a line
+func parseGlslFunctions(code string) []glslFunction {
+	functions := []glslFunction{}
+	pending := ""
+	var current *glslFunction
+	depth := 0
+	for _, line := range strings.SplitAfter(code, "\n") {
+		if current == nil {
+			match := glslFunctionHead.FindStringSubmatch(line)
+			if match == nil {
+				// comments and blank lines go with the next function
+				pending += line
+				continue
+			}
+			current = &glslFunction{name: match[1], code: pending}
+			pending = ""
+		}
+		current.code += line
+		depth += strings.Count(line, "{") - strings.Count(line, "}")
+		if depth == 0 && strings.Contains(current.code, "{") {
+			current.calls = glslCalls(current.code)
+			functions = append(functions, *current)
+			current = nil
+		}
+	}
+	return functions
+}
+
+// glslCalls returns the names of the functions code calls
+func glslCalls(code string) map[string]bool {
+	calls := map[string]bool{}
+	for _, match := range glslCall.FindAllStringSubmatch(glslComment.ReplaceAllString(code, ""), -1) {
+		calls[match[1]] = true
+	}
+	return calls
+}
+
+// usedGlslFunctions returns the functions of library called by code or by other used functions
+func usedGlslFunctions(library []glslFunction, code string) string {
+	used := map[string]bool{}
+	queue := []map[string]bool{glslCalls(code)}
+	for len(queue) > 0 {
+		calls := queue[0]
+		queue = queue[1:]
+		for _, function := range library {
+			if calls[function.name] && !used[function.name] {
+				used[function.name] = true
+				queue = append(queue, function.calls)
+			}
+		}
+	}
+
+	result := ""
+	for _, function := range library {
+		if used[function.name] {
+			result += function.code
+		} else {
+			Tracef(TRACE_GEN, "dropping unused function %s", function.name)
+		}
+	}
+	return result
+}
+
+// generateGlslLibrary inserts the used functions of the libraries, before the
+// tweak uniforms are inserted above them
+func generateGlslLibrary() {
+	if libraryInsertFragment >= 0 {
+		code := usedGlslFunctions(fragmentLibrary, generatedCodeFragmentShader)
+		generatedCodeFragmentShader = generatedCodeFragmentShader[:libraryInsertFragment] + code + generatedCodeFragmentShader[libraryInsertFragment:]
+	}
+	if libraryInsertCompute >= 0 {
+		code := usedGlslFunctions(computeLibrary, generatedCodeComputeShader)
+		generatedCodeComputeShader = generatedCodeComputeShader[:libraryInsertCompute] + code + generatedCodeComputeShader[libraryInsertCompute:]
+	}
+}
@@ -0,0 +1,277 @@
+package sdfl
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// builtinScenes uses every builtin in a small scene, the post effects in the
+// post list of scene and the other builtins as its child
+var builtinScenes = map[string]string{
+	"plane":              "plane(height: -1)",
+	"sphere":             "sphere(radius: 1)",
+	"cylinder":           "cylinder(begin: (0, -1, 0), end: (0, 1, 0), radius: 0.5)",
+	"ellipsoid":          "ellipsoid(radius: (1, 0.5, 0.5))",
+	"box":                "box(size: (1, 1, 1))",
+	"torus":              "torus(radius: 1, thickness: 0.25)",
+	"rotateAround":       "rotateAround(rotation: (0, 45, 0), child: box())",
+	"smoothUnion":        "smoothUnion(child1: sphere(), child2: box(position: (1, 0, 0)), smooth_transition: 0.2)",
+	"smoothSubtraction":  "smoothSubtraction(child1: sphere(), child2: box(position: (1, 0, 0)), smooth_transition: 0.2)",
+	"smoothIntersection": "smoothIntersection(child1: sphere(), child2: box(position: (1, 0, 0)), smooth_transition: 0.2)",
+	"union":              "union(child1: sphere(), child2: box(position: (1, 0, 0)))",
+	"subtraction":        "subtraction(child1: sphere(), child2: box(position: (1, 0, 0)))",
+	"intersection":       "intersection(child1: sphere(), child2: box(position: (1, 0, 0)))",
+	"noise":              "sphere(radius: 1 + 0.1 * noise())",
+	"hash":               "sphere(radius: 1 + 0.1 * hash())",
+	"time":               "sphere(radius: 1 + 0.1 * time())",
+	"pow":                "sphere(radius: pow(0.5, 2))",
+	"animate":            `sphere(radius: animate(keys: [(0, 0.5), (2, 1)], ease: "cubicInOut", loop: true))`,
+	"lerp":               "sphere(radius: lerp(from: 0.5, to: 1, t: 0.5))",
+	"smoothstep":         "sphere(radius: smoothstep(from: 0.5, to: 1, x: 0.7))",
+	"oscillate":          "sphere(radius: 1 + oscillate(freq: 0.5, amp: 0.25))",
+	"fog":                "post: [fog(density: 0.04)]",
+	"ambientOcclusion":   "post: [ambientOcclusion(samples: 5)]",
+	"toneMap":            `post: [toneMap("reinhard")]`,
+	"gamma":              "post: [gamma(2.2)]",
+	"vignette":           "post: [vignette(strength: 0.5)]",
+	"bloom":              "post: [bloom(threshold: 0.8)]",
+}
+
+// builtinScene returns the scene using the builtin name
+func builtinScene(name string) string {
+	use, ok := builtinScenes[name]
+	if !ok {
+		// the math functions of GLSL
+		use = "sphere(radius: " + name + "(0.5))"
+	}
+	if strings.HasPrefix(use, "post: ") {
+		return "scene(camera: camera(position: (0, 0, 5)), children: [sphere()], " + use + ")"
+	}
+	return "scene(camera: camera(position: (0, 0, 5)), children: [" + use + "])"
+}
+
+// builtinNames returns the builtins with a golden, the structure of a scene has none
+func builtinNames() []string {
+	names := []string{}
+	for name, symbol := range functionSymbols {
+		switch symbol.SymbolType {
+		case FUN_BUILTIN_SCENE, FUN_BUILTIN_CAMERA, FUN_BUILTIN_LOCAL, FUN_USER_DEFINED:
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sceneSpecific returns the function definitions of code that are not in base,
+// the code a builtin adds to the shader of an empty scene
+func sceneSpecific(base string, code string) string {
+	known := map[string]bool{}
+	for _, function := range parseGlslFunctions(base) {
+		known[function.code] = true
+	}
+	result := ""
+	for _, function := range parseGlslFunctions(code) {
+		if !known[function.code] {
+			result += function.code
+		}
+	}
+	return result
+}
+
+func TestBuiltinGoldens(t *testing.T) {
+	empty := parseSource(t, "scene(camera: camera(position: (0, 0, 5)), children: [])")
+	base := generateTarget(t, &empty, "glsl430")
+	for _, name := range builtinNames() {
+		prog := parseSource(t, builtinScene(name))
+		golden := ""
+		for i, shader := range generateTarget(t, &prog, "glsl430") {
+			golden += "// " + shader.Name + "\n" + sceneSpecific(base[i].Code, shader.Code)
+		}
+		checkGolden(t, "builtins/"+name+".glsl", golden)
+	}
+}
+
+var glslDefinition = regexp.MustCompile(`(?m)^\w+\s+(\w+)\s*\(`)
+var glslStruct = regexp.MustCompile(`struct\s+(\w+)`)
+
+var glslTypes = []string{
+	"void", "bool", "int", "uint", "float", "vec2", "vec3", "vec4", "ivec2", "ivec3", "ivec4",
+	"uvec2", "uvec3", "uvec4", "bvec2", "bvec3", "bvec4", "mat2", "mat3", "mat4",
+}
+
+// glslBuiltins are the builtin functions of GLSL ES
+var glslBuiltins = []string{
+	"abs", "acos", "asin", "atan", "ceil", "clamp", "cos", "cosh", "cross", "distance", "dot", "exp", "exp2",
+	"floor", "length", "log", "log2", "max", "min", "normalize", "pow", "reflect", "refract", "round", "sign",
+	"sin", "sinh", "smoothstep", "sqrt", "step", "tan", "tanh", "trunc",
+	"mix", "mod", "fract", "inversesqrt", "radians", "degrees", "asinh", "acosh", "atanh",
+}
+
+// glslKnownCalls are the keywords followed by a parenthesis and the builtins
+// of GLSL 4.30 the generated shaders call besides those of GLSL ES
+var glslKnownCalls = []string{"if", "for", "while", "switch", "return", "layout", "any", "greaterThanEqual", "texture"}
+
+// undefinedGlslCalls returns the functions code calls above their definition
+// or without defining them
+func undefinedGlslCalls(code string) []string {
+	code = glslComment.ReplaceAllString(code, "")
+	known := map[string]bool{}
+	for _, names := range [][]string{glslBuiltins, glslTypes, glslKnownCalls} {
+		for _, name := range names {
+			known[name] = true
+		}
+	}
+	for _, match := range glslStruct.FindAllStringSubmatch(code, -1) {
+		known[match[1]] = true
+	}
+	defined := map[string]int{}
+	for _, match := range glslDefinition.FindAllStringSubmatchIndex(code, -1) {
+		name := code[match[2]:match[3]]
+		if _, ok := defined[name]; !ok {
+			defined[name] = match[0]
+		}
+	}
+	undefined := []string{}
+	for _, match := range glslCall.FindAllStringSubmatchIndex(code, -1) {
+		name := code[match[2]:match[3]]
+		if known[name] {
+			continue
+		}
+		if at, ok := defined[name]; !ok || at > match[0] {
+			undefined = append(undefined, name)
+		}
+	}
+	return undefined
+}
+
+func TestTreeShakingKeepsCalledHelpers(t *testing.T) {
+	for _, scene := range []string{"features.sdfl", "reflections.sdfl"} {
+		prog := parseFile(t, scene)
+		for _, shader := range generateTarget(t, &prog, "glsl430") {
+			if undefined := undefinedGlslCalls(shader.Code); len(undefined) > 0 {
+				t.Errorf("%s %s calls undefined functions %v", scene, shader.Name, undefined)
+			}
+		}
+	}
+	for _, name := range builtinNames() {
+		prog := parseSource(t, builtinScene(name))
+		for _, shader := range generateTarget(t, &prog, "glsl430") {
+			if undefined := undefinedGlslCalls(shader.Code); len(undefined) > 0 {
+				t.Errorf("%s: %s calls undefined functions %v", name, shader.Name, undefined)
+			}
+		}
+	}
+}
+
+func TestTreeShakingDropsUnusedHelpers(t *testing.T) {
+	prog := parseSource(t, builtinScene("sphere"))
+	fragment := generateTarget(t, &prog, "glsl430")[0].Code
+	if !strings.Contains(fragment, "float sdfl_builtin_sphere(") {
+		t.Errorf("the sphere of the scene is dropped")
+	}
+	for _, unused := range []string{"sdfl_builtin_box", "sdfl_builtin_torus", "sdfl_builtin_noise", "sdfl_builtin_smoothUnion", "sdfl_RotationMatrix"} {
+		if strings.Contains(fragment, unused) {
+			t.Errorf("unused helper %s is kept", unused)
+		}
+	}
+
+	SetShaderOptimization(false)
+	defer SetShaderOptimization(true)
+	fragment = generateTarget(t, &prog, "glsl430")[0].Code
+	if !strings.Contains(fragment, "float sdfl_builtin_box(") {
+		t.Errorf("without optimization the whole library is generated")
+	}
+}
+
+func TestParseGlslFunctions(t *testing.T) {
+	functions := parseGlslFunctions(`// first
+float a(float x) {
+    if (x > 0.) {
+        return b(x);
+    }
+    return 0.;
+}
+
+vec3 b(vec3 p) { return p; }
+`)
+	if len(functions) != 2 || functions[0].name != "a" || functions[1].name != "b" {
+		t.Fatalf("functions = %+v", functions)
+	}
+	if !strings.HasPrefix(functions[0].code, "// first\n") {
+		t.Errorf("the comment above a is not kept with it: %q", functions[0].code)
+	}
+	if !functions[0].calls["b"] || functions[1].calls["a"] {
+		t.Errorf("calls of a = %v, calls of b = %v", functions[0].calls, functions[1].calls)
+	}
+}
+
+func TestLetVarReusesValues(t *testing.T) {
+	for _, tc := range []struct {
+		child   string
+		want    []string
+		notWant []string
+	}{
+		{
+			// the same shape twice in one expression is computed once
+			child: "union(child1: sphere(radius: 1), child2: sphere(radius: 1))",
+			want:  []string{"sdfl_builtin_union(sd0, sd0)"},
+		},
+		{
+			// so is the rotation of two rotateAround with the same angles
+			child:   "smoothUnion(child1: rotateAround(rotation: (0, 45, 0), child: box()), child2: rotateAround(rotation: (0, 45, 0), child: torus()))",
+			want:    []string{"sdfl_builtin_box(q0,", "sdfl_builtin_torus(q0,"},
+			notWant: []string{"rotation1", "q1"},
+		},
+		{
+			// a value bound in a branch is not visible after it
+			child: "union(child1: if time() > 1 { box() } else { torus() }, child2: box())",
+			want:  []string{"SceneResult sd1 = SceneResult(sdfl_builtin_box(", "SceneResult sd3 = SceneResult(sdfl_builtin_box(", "sdfl_builtin_union(sd0, sd3)"},
+		},
+	} {
+		prog := parseSource(t, "scene(camera: camera(position: (0, 0, 5)), children: ["+tc.child+"])")
+		fragment := generateTarget(t, &prog, "glsl430")[0].Code
+		for _, want := range tc.want {
+			if !strings.Contains(fragment, want) {
+				t.Errorf("%s: the shader lacks %q", tc.child, want)
+			}
+		}
+		for _, notWant := range tc.notWant {
+			if strings.Contains(fragment, notWant) {
+				t.Errorf("%s: the shader has %q", tc.child, notWant)
+			}
+		}
+	}
+
+	SetShaderOptimization(false)
+	defer SetShaderOptimization(true)
+	prog := parseSource(t, "scene(camera: camera(position: (0, 0, 5)), children: [union(child1: sphere(radius: 1), child2: sphere(radius: 1))])")
+	if fragment := generateTarget(t, &prog, "glsl430")[0].Code; !strings.Contains(fragment, "sdfl_builtin_union(sd0, sd1)") {
+		t.Errorf("without optimization every value has its own variable")
+	}
+}
+
+func TestLensProfileConstants(t *testing.T) {
+	if err := SetRenderModes("vr"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetRenderModes("")
+	if err := SetLensProfile("dk1"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetLensProfile(lensProfiles[0].Name)
+
+	prog := parseSource(t, builtinScene("sphere"))
+	fragment := generateTarget(t, &prog, "glsl430")[0].Code
+	for _, want := range []string{"const float u_ipd = ", "const float u_distortion_k1 = 0.22;", "const float u_distortion_k2 = 0.24;"} {
+		if !strings.Contains(fragment, want) {
+			t.Errorf("the fragment shader lacks %q", want)
+		}
+	}
+	if regexp.MustCompile(`(?m)^float u_`).MatchString(fragment) {
+		t.Errorf("the lens profile is a mutable global")
+	}
+}
@@ -0,0 +1,339 @@
+package sdfl
+
+import (
+	"regexp"
+)
+
+// SDF intermediate representation
+//
+// Scene children and function bodies are lowered from the AST to a small tree
+// of distance nodes before any code is written: primitives, operations
+// combining two children, transforms of the position a child is evaluated
+// at, branches and calls of user defined functions. The values they take are
+// expression nodes. Everything the AST leaves open is settled here (argument
+// order, literal syntax, helpers like animate lowered to plain calls), so an
+// emitter only has to spell the tree in its shading language.
+
+// irShape is a node computing a distance
+type irShape interface {
+	irShape()
+}
+
+// irPrimitive is a builtin shape like sphere, its arguments in the order of
+// its definition and the id of its material
+type irPrimitive struct {
+	Name     string
+	Args     []irExpr
+	Material int
+}
+
+// irOp combines two distances, K is the smooth transition or nil
+type irOp struct {
+	Name   string
+	Child1 irShape
+	Child2 irShape
+	K      irExpr
+}
+
+// irTransform evaluates its child at the position rotated around Pivot by
+// Rotation, in degrees
+type irTransform struct {
+	Pivot    irExpr
+	Rotation irExpr
+	Child    irShape
+}
+
+// irBranch only evaluates the shape Cond chooses
+type irBranch struct {
+	Cond irExpr
+	Then irShape
+	Else irShape
+}
+
+// irFunction calls a user defined function, which pushes to its own local
+// scene and returns the closest result of it
+type irFunction struct {
+	Name string
+	Args []irExpr
+}
+
+func (*irPrimitive) irShape() {}
+func (*irOp) irShape()        {}
+func (*irTransform) irShape() {}
+func (*irBranch) irShape()    {}
+func (*irFunction) irShape()  {}
+
+// irExpr is a float, vec3 or bool value
+type irExpr interface {
+	irExpr()
+}
+
+// irNumber is a float literal in the syntax shared by the shading languages
+type irNumber struct {
+	Literal string
+}
+
+type irBool struct {
+	Value bool
+}
+
+// irTweak is a literal hoisted to a uniform by the tweak mode
+type irTweak struct {
+	Type   string
+	Values []string
+	Span   Span
+}
+
+// irPoint is the position of the enclosing scene or function
+type irPoint struct{}
+
+// irSwizzle selects components of a vector, like p.xy
+type irSwizzle struct {
+	X          irExpr
+	Components string
+}
+
+// irVec3 builds a vec3 from three floats, or splats one
+type irVec3 struct {
+	Args []irExpr
+}
+
+// irCall calls a function of the shading language or of the library
+type irCall struct {
+	Function string
+	Args     []irExpr
+}
+
+// irBinary is arithmetic (+ - * /), a comparison or a logic operator (and, or)
+type irBinary struct {
+	Op    string
+	Left  irExpr
+	Right irExpr
+}
+
+type irNot struct {
+	X irExpr
+}
+
+// irSelect is a conditional value, both branches are values
+type irSelect struct {
+	Cond irExpr
+	Then irExpr
+	Else irExpr
+}
+
+// irParen keeps the parentheses written in the source
+type irParen struct {
+	X irExpr
+}
+
+func (*irNumber) irExpr()  {}
+func (*irBool) irExpr()    {}
+func (*irTweak) irExpr()   {}
+func (*irPoint) irExpr()   {}
+func (*irSwizzle) irExpr() {}
+func (*irVec3) irExpr()    {}
+func (*irCall) irExpr()    {}
+func (*irBinary) irExpr()  {}
+func (*irNot) irExpr()     {}
+func (*irSelect) irExpr()  {}
+func (*irParen) irExpr()   {}
+
+var plainLiteral = regexp.MustCompile(`^[+-]?(?:\d+\.?\d*|\.\d+)(?:[eE][+-]?\d+)?$`)
+
+// irLiteral normalizes a number literal of the lexer: suffixes like 1f and
+// 2u and hex literals like 0x10 are not floats in every shading language
+func irLiteral(value string, span Span) string {
+	if plainLiteral.MatchString(value) {
+		return value
+	}
+	v, err := ParseNumberLiteral(value)
+	if err != nil {
+		reportError(span, "invalid number literal %s", value)
+		return value
+	}
+	return glslFloat(v)
+}
+
+// orderedArgs returns the arguments of funCall in the order of the definition of the function
+func orderedArgs(funCall *FunCall, funDef *FunDef) ([]*Expr, bool) {
+	exprs := []*Expr{}
+	for _, name := range funDef.FunDefArgNames {
+		arg, ok := funCall.Arg(name)
+		if !ok {
+			reportError(funCall.Span, "function call %s, missing argument %s", funDef.Id, name)
+			return nil, false
+		}
+		exprs = append(exprs, &arg.Expr)
+	}
+	return exprs, true
+}
+
+func lowerExprs(exprs []*Expr) []irExpr {
+	values := []irExpr{}
+	for _, expr := range exprs {
+		values = append(values, lowerExpr(expr))
+	}
+	return values
+}
+
+// lowerShape lowers a shape expression, nil after an error
+func lowerShape(expr *Expr) irShape {
+	switch expr.Type {
+	case AST_FUN_CALL:
+		return lowerShapeCall(expr.FunCall)
+	case AST_COND:
+		then := lowerShape(&expr.Cond.Then)
+		els := lowerShape(&expr.Cond.Else)
+		if then == nil || els == nil {
+			return nil
+		}
+		return &irBranch{Cond: lowerExpr(&expr.Cond.Cond), Then: then, Else: els}
+	}
+	reportError(Span{}, "expected a shape, got a %s", argKindToString(ExprKind(expr)))
+	return nil
+}
+
+func lowerShapeCall(funCall *FunCall) irShape {
+	funDef, ok := functionSymbols[funCall.Id]
+	Tracef(TRACE_GEN, "lower %s symbol=%s", funCall.Id, symbolTypeToString(funDef.SymbolType))
+	if !ok {
+		reportError(funCall.Span, "function call %s is not defined", funCall.Id)
+		return nil
+	}
+
+	switch funDef.SymbolType {
+	case FUN_BUILTIN_ROTATE_AROUND:
+		posExpr, okPos := funCall.Arg("position")
+		rotExpr, okRot := funCall.Arg("rotation")
+		childExpr, okChild := funCall.Arg("child")
+		if !okPos || !okRot || !okChild {
+			reportError(funCall.Span, "rotateAround missing args (needs position, rotation, child)")
+			return nil
+		}
+		child := lowerShape(&childExpr.Expr)
+		if child == nil {
+			return nil
+		}
+		return &irTransform{Pivot: lowerExpr(&posExpr.Expr), Rotation: lowerExpr(&rotExpr.Expr), Child: child}
+
+	case FUN_BUILTIN_OP:
+		exprs, ok := orderedArgs(funCall, &funDef)
+		if !ok {
+			return nil
+		}
+		child1 := lowerShape(exprs[0])
+		child2 := lowerShape(exprs[1])
+		if child1 == nil || child2 == nil {
+			return nil
+		}
+		op := &irOp{Name: funDef.Id, Child1: child1, Child2: child2}
+		if len(exprs) > 2 {
+			op.K = lowerExpr(exprs[2])
+		}
+		return op
+
+	case FUN_BUILTIN_SHAPE:
+		exprs, ok := orderedArgs(funCall, &funDef)
+		if !ok {
+			return nil
+		}
+		// the material is the last argument, it is not passed to the distance function
+		return &irPrimitive{Name: funDef.Id, Args: lowerExprs(exprs[:len(exprs)-1]), Material: shapeMaterial(funCall)}
+
+	case FUN_USER_DEFINED:
+		exprs, ok := orderedArgs(funCall, &funDef)
+		if !ok {
+			return nil
+		}
+		return &irFunction{Name: funDef.Id, Args: lowerExprs(exprs)}
+	}
+	reportError(funCall.Span, "function %s (%s) can not be generated here", funCall.Id, symbolTypeToString(funDef.SymbolType))
+	return nil
+}
+
+// lowerExpr lowers a float, vec3 or bool expression, nil after an error
+func lowerExpr(expr *Expr) irExpr {
+	value := lowerValue(expr)
+	if expr.HasParentheses && value != nil {
+		return &irParen{X: value}
+	}
+	return value
+}
+
+func lowerValue(expr *Expr) irExpr {
+	switch expr.Type {
+	case AST_NUMBER:
+		if shouldTweak(expr.Number.Tweak) {
+			return &irTweak{Type: "float", Values: []string{expr.Number.Value}, Span: expr.Number.Span}
+		}
+		return &irNumber{Literal: irLiteral(expr.Number.Value, expr.Number.Span)}
+	case AST_TUPLE:
+		if shouldTweak(expr.Tuple.Tweak) {
+			return &irTweak{Type: "vec3", Values: expr.Tuple.Values[:3], Span: expr.Tuple.Span}
+		}
+		vec := &irVec3{}
+		for _, value := range expr.Tuple.Values[:3] {
+			vec.Args = append(vec.Args, &irNumber{Literal: irLiteral(value, expr.Tuple.Span)})
+		}
+		return vec
+	case AST_VEC:
+		vec := &irVec3{}
+		for i := range expr.Vec.Exprs {
+			vec.Args = append(vec.Args, lowerExpr(&expr.Vec.Exprs[i]))
+		}
+		return vec
+	case AST_BOOL:
+		return &irBool{Value: expr.Bool.Value}
+	case AST_BINOP_TERM:
+		return &irBinary{Op: expr.BinopTerm.Operator, Left: lowerExpr(&expr.BinopTerm.Left), Right: lowerExpr(&expr.BinopTerm.Right)}
+	case AST_BINOP_FACTOR:
+		return &irBinary{Op: expr.BinopFactor.Operator, Left: lowerExpr(&expr.BinopFactor.Left), Right: lowerExpr(&expr.BinopFactor.Right)}
+	case AST_BINOP_COMPARE:
+		return &irBinary{Op: expr.BinopCompare.Operator, Left: lowerExpr(&expr.BinopCompare.Left), Right: lowerExpr(&expr.BinopCompare.Right)}
+	case AST_BINOP_LOGIC:
+		return &irBinary{Op: expr.BinopLogic.Operator, Left: lowerExpr(&expr.BinopLogic.Left), Right: lowerExpr(&expr.BinopLogic.Right)}
+	case AST_UNOP_NOT:
+		return &irNot{X: lowerExpr(&expr.UnopNot.Expr)}
+	case AST_COND:
+		return &irSelect{Cond: lowerExpr(&expr.Cond.Cond), Then: lowerExpr(&expr.Cond.Then), Else: lowerExpr(&expr.Cond.Else)}
+	case AST_STRING:
+		reportError(expr.String.Span, "a string can only be passed to the ease of animate")
+		return nil
+	case AST_FUN_CALL:
+		return lowerValueCall(expr.FunCall)
+	}
+	reportError(Span{}, "unknown expr type: %v", expr.Type)
+	return nil
+}
+
+func lowerValueCall(funCall *FunCall) irExpr {
+	funDef, ok := functionSymbols[funCall.Id]
+	if !ok {
+		reportError(funCall.Span, "function call %s is not defined", funCall.Id)
+		return nil
+	}
+
+	switch funDef.SymbolType {
+	case FUN_BUILTIN_GLSL:
+		exprs, ok := orderedArgs(funCall, &funDef)
+		if !ok {
+			return nil
+		}
+		return &irCall{Function: funDef.Id, Args: lowerExprs(exprs)}
+
+	case FUN_BUILTIN_SDFL:
+		// noise and hash read the position of the enclosing scene or function
+		exprs, ok := orderedArgs(funCall, &funDef)
+		if !ok {
+			return nil
+		}
+		args := append([]irExpr{&irSwizzle{X: &irPoint{}, Components: "xy"}}, lowerExprs(exprs)...)
+		return &irCall{Function: "sdfl_builtin_" + funDef.Id, Args: args}
+
+	case FUN_BUILTIN_ANIM:
+		return lowerAnimCall(funCall)
+	}
+	reportError(funCall.Span, "function %s (%s) can not be generated here", funCall.Id, symbolTypeToString(funDef.SymbolType))
+	return nil
+}
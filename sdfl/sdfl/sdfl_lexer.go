@@ -1,8 +1,8 @@
 package sdfl
 
 import (
-	"fmt"
 	"regexp"
+	"strings"
 )
 
 type TokenType int
@@ -27,30 +27,58 @@ const (
 	PUNC_RCURLY
 	PUNC_COLON
 	PUNC_COMMA
+	PUNC_COMPARE
+	PUNC_QUESTION
+	KW_IF
+	KW_ELSE
+	KW_AND
+	KW_OR
+	KW_NOT
+	KW_FOR
+	KW_IN
+	PUNC_RANGE
+	KW_TRUE
+	KW_FALSE
+	STRING
+	ANNOTATION
 	WS
 )
 
 var TokenName = map[TokenType]string{
-	EOF:          "EOF",
-	KW_LET:       "KW_LET",
-	KW_DEF:       "KW_DEF",
-	KW_ID:        "KW_ID",
-	NUMBER_FLOAT: "NUMBER_FLOAT",
-	NUMBER_INT:   "NUMBER_INT",
-	PUNC_MULT:    "PUNC_MULT",
-	PUNC_DIV:     "PUNC_DIV",
-	PUNC_PLUS:    "PUNC_PLUS",
-	PUNC_SUB:     "PUNC_SUB",
-	PUNC_EQUAL:   "PUNC_EQUAL",
-	PUNC_LPAREN:  "PUNC_LPAREN",
-	PUNC_RPAREN:  "PUNC_RPAREN",
-	PUNC_LSQUARE: "PUNC_LSQUARE",
-	PUNC_RSQUARE: "PUNC_RSQUARE",
-	PUNC_LCURLY:  "PUNC_LCURLY",
-	PUNC_RCURLY:  "PUNC_RCURLY",
-	PUNC_COLON:   "PUNC_COLON",
-	PUNC_COMMA:   "PUNC_COMMA",
-	WS:           "WS",
+	EOF:           "EOF",
+	KW_LET:        "KW_LET",
+	KW_DEF:        "KW_DEF",
+	KW_ID:         "KW_ID",
+	NUMBER_FLOAT:  "NUMBER_FLOAT",
+	NUMBER_INT:    "NUMBER_INT",
+	PUNC_MULT:     "PUNC_MULT",
+	PUNC_DIV:      "PUNC_DIV",
+	PUNC_PLUS:     "PUNC_PLUS",
+	PUNC_SUB:      "PUNC_SUB",
+	PUNC_EQUAL:    "PUNC_EQUAL",
+	PUNC_LPAREN:   "PUNC_LPAREN",
+	PUNC_RPAREN:   "PUNC_RPAREN",
+	PUNC_LSQUARE:  "PUNC_LSQUARE",
+	PUNC_RSQUARE:  "PUNC_RSQUARE",
+	PUNC_LCURLY:   "PUNC_LCURLY",
+	PUNC_RCURLY:   "PUNC_RCURLY",
+	PUNC_COLON:    "PUNC_COLON",
+	PUNC_COMMA:    "PUNC_COMMA",
+	PUNC_COMPARE:  "PUNC_COMPARE",
+	PUNC_QUESTION: "PUNC_QUESTION",
+	KW_IF:         "KW_IF",
+	KW_ELSE:       "KW_ELSE",
+	KW_AND:        "KW_AND",
+	KW_OR:         "KW_OR",
+	KW_NOT:        "KW_NOT",
+	KW_FOR:        "KW_FOR",
+	KW_IN:         "KW_IN",
+	PUNC_RANGE:    "PUNC_RANGE",
+	KW_TRUE:       "KW_TRUE",
+	KW_FALSE:      "KW_FALSE",
+	STRING:        "STRING",
+	ANNOTATION:    "ANNOTATION",
+	WS:            "WS",
 }
 
 type Token struct {
@@ -68,7 +96,25 @@ type Rule struct {
 
 var rules = []Rule{}
 
+// identifiers that are keywords, they are matched as whole words so names
+// like `order` or `notch` stay identifiers
+var keywords = map[string]TokenType{
+	"if":    KW_IF,
+	"else":  KW_ELSE,
+	"and":   KW_AND,
+	"or":    KW_OR,
+	"not":   KW_NOT,
+	"for":   KW_FOR,
+	"in":    KW_IN,
+	"true":  KW_TRUE,
+	"false": KW_FALSE,
+}
+
 func InitRules() {
+	// watch mode calls this on every compile
+	if len(rules) > 0 {
+		return
+	}
 	reg_KW_LET := regexp.MustCompile(`let`)
 	if reg_KW_LET != nil {
 		rules = append(rules, Rule{kind: KW_LET, regex: *reg_KW_LET, skipable: false})
@@ -81,14 +127,19 @@ func InitRules() {
 	if reg_KW_ID != nil {
 		rules = append(rules, Rule{kind: KW_ID, regex: *reg_KW_ID, skipable: false})
 	}
-	reg_NUMBER_FLOAT := regexp.MustCompile(`[+-]?(?:\d+\.\d*|\.\d+|\d+)(?:[eE][+-]?\d+)?[fF]?`)
-	if reg_NUMBER_FLOAT != nil {
-		rules = append(rules, Rule{kind: NUMBER_FLOAT, regex: *reg_NUMBER_FLOAT, skipable: false})
+	reg_PUNC_RANGE := regexp.MustCompile(`\.\.`)
+	if reg_PUNC_RANGE != nil {
+		rules = append(rules, Rule{kind: PUNC_RANGE, regex: *reg_PUNC_RANGE, skipable: false})
 	}
-	reg_NUMBER_INT := regexp.MustCompile(`[+-]?(?:0[xX][0-9A-Fa-f]+|\d+)[uU]?`)
+	// hex and unsigned literals, before floats which would take their leading digits
+	reg_NUMBER_INT := regexp.MustCompile(`[+-]?(?:0[xX][0-9A-Fa-f]+[uU]?|\d+[uU])`)
 	if reg_NUMBER_INT != nil {
 		rules = append(rules, Rule{kind: NUMBER_INT, regex: *reg_NUMBER_INT, skipable: false})
 	}
+	reg_NUMBER_FLOAT := regexp.MustCompile(`[+-]?(?:\d+\.\d*|\.\d+|\d+)(?:[eE][+-]?\d+)?[fF]?`)
+	if reg_NUMBER_FLOAT != nil {
+		rules = append(rules, Rule{kind: NUMBER_FLOAT, regex: *reg_NUMBER_FLOAT, skipable: false})
+	}
 	reg_PUNC_MULT := regexp.MustCompile(`[*]`)
 	if reg_PUNC_MULT != nil {
 		rules = append(rules, Rule{kind: PUNC_MULT, regex: *reg_PUNC_MULT, skipable: false})
@@ -105,6 +156,10 @@ func InitRules() {
 	if reg_PUNC_SUB != nil {
 		rules = append(rules, Rule{kind: PUNC_SUB, regex: *reg_PUNC_SUB, skipable: false})
 	}
+	reg_PUNC_COMPARE := regexp.MustCompile(`<=|>=|==|!=|<|>`)
+	if reg_PUNC_COMPARE != nil {
+		rules = append(rules, Rule{kind: PUNC_COMPARE, regex: *reg_PUNC_COMPARE, skipable: false})
+	}
 	reg_PUNC_EQUAL := regexp.MustCompile(`=`)
 	if reg_PUNC_EQUAL != nil {
 		rules = append(rules, Rule{kind: PUNC_EQUAL, regex: *reg_PUNC_EQUAL, skipable: false})
@@ -141,6 +196,18 @@ func InitRules() {
 	if reg_PUNC_COMMA != nil {
 		rules = append(rules, Rule{kind: PUNC_COMMA, regex: *reg_PUNC_COMMA, skipable: false})
 	}
+	reg_PUNC_QUESTION := regexp.MustCompile(`[?]`)
+	if reg_PUNC_QUESTION != nil {
+		rules = append(rules, Rule{kind: PUNC_QUESTION, regex: *reg_PUNC_QUESTION, skipable: false})
+	}
+	reg_STRING := regexp.MustCompile(`"[^"\n]*"`)
+	if reg_STRING != nil {
+		rules = append(rules, Rule{kind: STRING, regex: *reg_STRING, skipable: false})
+	}
+	reg_ANNOTATION := regexp.MustCompile(`@[a-zA-Z_][a-zA-Z_0-9]*`)
+	if reg_ANNOTATION != nil {
+		rules = append(rules, Rule{kind: ANNOTATION, regex: *reg_ANNOTATION, skipable: false})
+	}
 	reg_WS := regexp.MustCompile(`[ \t\r\n]`)
 	if reg_WS != nil {
 		rules = append(rules, Rule{kind: WS, regex: *reg_WS, skipable: true})
@@ -148,6 +215,11 @@ func InitRules() {
 }
 
 func Tokenize(input string) []Token {
+	return defaultFrontend.Tokenize(input)
+}
+
+// Tokenize splits input into tokens, InitRules has to be called before
+func (fe *Frontend) Tokenize(input string) []Token {
 	pos := 0
 	inputLen := len(input)
 	tokens := []Token{}
@@ -166,9 +238,17 @@ func Tokenize(input string) []Token {
 				// determine token type based on index in regexes
 				skip = rule.skipable
 				tokenType := rule.kind
+				if tokenType == NUMBER_FLOAT && strings.HasSuffix(input[pos:pos+loc[1]], ".") && strings.HasPrefix(input[pos+loc[1]:], ".") {
+					// the dot of 0..20 belongs to the range
+					loc[1]--
+				}
 				value := input[pos : pos+loc[1]]
+				if keyword, ok := keywords[value]; ok && tokenType == KW_ID {
+					tokenType = keyword
+				}
 				if !skip {
 					tokens = append(tokens, Token{Kind: tokenType, Value: value, Row: row, Col: col})
+					Tracef(TRACE_LEXER, "%d:%d %-12s %q", row, col, TokenName[tokenType], value)
 				}
 				col += loc[1]
 				pos += loc[1]
@@ -177,12 +257,18 @@ func Tokenize(input string) []Token {
 			}
 		}
 		if !matched {
-			fmt.Println("ERROR: unrecognized token occured!")
+			fe.reportError(Span{Row: row, Col: col, Len: 1}, "unrecognized token %q", input[pos])
 			pos++
 			col++
 		}
 	}
 
-	tokens = append(tokens, Token{Kind: EOF, Value: "EOF"})
+	// EOF sits right after the last token, errors about a missing end point there
+	eof := Token{Kind: EOF, Value: "EOF", Row: row, Col: col}
+	if len(tokens) > 0 {
+		last := tokens[len(tokens)-1]
+		eof.Row, eof.Col = last.Row, last.Col+len(last.Value)
+	}
+	tokens = append(tokens, eof)
 	return tokens
 }
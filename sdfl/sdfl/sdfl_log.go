@@ -0,0 +1,138 @@
+package sdfl
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// leveled logging and tracing
+//
+// Everything the compiler prints goes through here, so the embedding app
+// decides how much it wants to see and where it ends up. Trace lines have a
+// stable format (no timestamps, deterministic order) to be attached to bug reports.
+
+type LogLevel int
+
+const (
+	LOG_ERROR LogLevel = iota
+	LOG_WARN
+	LOG_INFO
+	LOG_DEBUG
+)
+
+var logLevelNames = map[LogLevel]string{
+	LOG_ERROR: "error",
+	LOG_WARN:  "warn",
+	LOG_INFO:  "info",
+	LOG_DEBUG: "debug",
+}
+
+// trace categories
+const (
+	TRACE_LEXER  = "lexer"
+	TRACE_PARSER = "parser"
+	TRACE_AST    = "ast"
+	TRACE_GEN    = "gen"
+	TRACE_SEQ    = "seq"
+)
+
+var traceCategories = []string{TRACE_LEXER, TRACE_PARSER, TRACE_AST, TRACE_GEN, TRACE_SEQ}
+
+var logLevel = LOG_WARN
+var logOutput io.Writer = os.Stderr
+var traceEnabled = map[string]bool{}
+
+func SetLogLevel(level LogLevel) {
+	logLevel = level
+}
+
+func SetLogOutput(w io.Writer) {
+	logOutput = w
+}
+
+// EnableTrace turns on tracing for the given categories, "all" enables every category
+func EnableTrace(categories ...string) error {
+	for _, category := range categories {
+		category = strings.TrimSpace(category)
+		if category == "all" {
+			for _, c := range traceCategories {
+				traceEnabled[c] = true
+			}
+			continue
+		}
+
+		known := false
+		for _, c := range traceCategories {
+			known = known || c == category
+		}
+		if !known {
+			return fmt.Errorf("unknown trace category %q (expected one of %s or all)", category, strings.Join(traceCategories, ", "))
+		}
+		traceEnabled[category] = true
+	}
+	return nil
+}
+
+func TraceEnabled(category string) bool {
+	return traceEnabled[category]
+}
+
+func EnabledTraces() []string {
+	categories := []string{}
+	for category, enabled := range traceEnabled {
+		if enabled {
+			categories = append(categories, category)
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+func Logf(level LogLevel, format string, args ...any) {
+	if level > logLevel {
+		return
+	}
+	fmt.Fprintf(logOutput, "[%s] %s\n", logLevelNames[level], fmt.Sprintf(format, args...))
+}
+
+func Errorf(format string, args ...any) { Logf(LOG_ERROR, format, args...) }
+func Warnf(format string, args ...any)  { Logf(LOG_WARN, format, args...) }
+func Infof(format string, args ...any)  { Logf(LOG_INFO, format, args...) }
+func Debugf(format string, args ...any) { Logf(LOG_DEBUG, format, args...) }
+
+func Tracef(category string, format string, args ...any) {
+	if !traceEnabled[category] {
+		return
+	}
+	fmt.Fprintf(logOutput, "trace[%s] %s\n", category, fmt.Sprintf(format, args...))
+}
+
+// traceWriter prefixes every line written to it like Tracef does
+type traceWriter struct {
+	category string
+	pending  string
+}
+
+func (tw *traceWriter) Write(b []byte) (int, error) {
+	tw.pending += string(b)
+	for {
+		i := strings.IndexByte(tw.pending, '\n')
+		if i < 0 {
+			break
+		}
+		Tracef(tw.category, "%s", tw.pending[:i])
+		tw.pending = tw.pending[i+1:]
+	}
+	return len(b), nil
+}
+
+// TraceWriter returns a writer for multi-line trace output (like the AST), or io.Discard if the category is off
+func TraceWriter(category string) io.Writer {
+	if !traceEnabled[category] {
+		return io.Discard
+	}
+	return &traceWriter{category: category}
+}
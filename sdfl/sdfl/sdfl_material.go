@@ -0,0 +1,196 @@
+package sdfl
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// material system
+
+type Material struct {
+	Id        int        `json:"id"`
+	Name      string     `json:"name"`
+	Albedo    [3]float64 `json:"albedo"`
+	Texture   string     `json:"texture,omitempty"` // albedo is sampled from this texture when set
+	Roughness float64    `json:"roughness"`
+	Metallic  float64    `json:"metallic"`
+	Emission  [3]float64 `json:"emission"`
+	// share of the light reflected and let through, with the index of
+	// refraction of the latter, scene(bounces:) follows them
+	Reflectivity float64 `json:"reflectivity"`
+	IOR          float64 `json:"ior"`
+	Transparency float64 `json:"transparency"`
+}
+
+var materials = []Material{
+	{Id: 0, Name: "default", Albedo: [3]float64{0.8, 0.8, 0.8}, Roughness: 0.9, Metallic: 0.0, IOR: 1},
+	{Id: 1, Name: "main", Albedo: [3]float64{0.2, 0.6, 1.0}, Roughness: 0.3, Metallic: 0.1, IOR: 1},
+	{Id: 2, Name: "glow", Albedo: [3]float64{1.0, 0.3, 0.2}, Roughness: 0.1, Metallic: 0.0, Emission: [3]float64{0.1, 0.0, 0.0}, IOR: 1},
+	{Id: 3, Name: "editor", Texture: "editor_texture", Roughness: 1.0, Metallic: 10.0, Emission: [3]float64{0.2, 0.2, 0.2}, IOR: 1},
+	{Id: 4, Name: "mirror", Albedo: [3]float64{0.9, 0.9, 0.9}, Roughness: 0.1, Metallic: 1.0, Reflectivity: 0.8, IOR: 1},
+	{Id: 5, Name: "glass", Albedo: [3]float64{0.95, 0.97, 1.0}, Roughness: 0.05, Metallic: 0.0, Reflectivity: 0.1, IOR: 1.5, Transparency: 0.9},
+}
+
+// fallback for ids which are not in the materials table
+var fallbackMaterial = Material{Id: -1, Name: "fallback", Albedo: [3]float64{0.5, 0.5, 0.5}, Roughness: 0.5, Metallic: 0.0, IOR: 1}
+
+func GetMaterials() []Material {
+	return materials
+}
+
+// MaterialById returns the material sdfl_GetMaterial picks for id
+func MaterialById(id int) Material {
+	for _, mat := range materials {
+		if mat.Id == id {
+			return mat
+		}
+	}
+	return fallbackMaterial
+}
+
+// materialNames lists the names of the materials table
+func materialNames() []string {
+	names := []string{}
+	for _, mat := range materials {
+		names = append(names, mat.Name)
+	}
+	return names
+}
+
+// shapeMaterial returns the id of the material argument of a shape, checked by analyzeMaterial
+func shapeMaterial(funCall *FunCall) int {
+	arg, ok := funCall.Arg("material")
+	if !ok || arg.Expr.Type != AST_STRING {
+		return 0
+	}
+	for _, mat := range materials {
+		if mat.Name == arg.Expr.String.Value {
+			return mat.Id
+		}
+	}
+	return 0
+}
+
+// analyzeMaterial checks that the material of a shape names a material of the table
+func (fe *Frontend) analyzeMaterial(funCall *FunCall) {
+	arg, ok := funCall.Arg("material")
+	if !ok {
+		return
+	}
+	if arg.Expr.Type != AST_STRING {
+		fe.reportError(arg.Span, "material of %s has to be a string like \"glass\"", funCall.Id)
+	} else if !slices.Contains(materialNames(), arg.Expr.String.Value) {
+		fe.reportError(arg.Expr.String.Span, "unknown material %q, expected one of %s", arg.Expr.String.Value, strings.Join(materialNames(), ", "))
+	}
+}
+
+// uniforms the generated shaders declare, the runtime is expected to set them
+
+type ShaderUniform struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Shader string `json:"shader"`
+}
+
+var fragmentUniforms = []ShaderUniform{
+	{Name: "editor_texture", Type: "sampler2D", Shader: "fragment"},
+	{Name: "window_size", Type: "ivec2", Shader: "fragment"},
+	{Name: "elapsed_time", Type: "float", Shader: "fragment"},
+	{Name: "ht_tracking_enabled", Type: "bool", Shader: "fragment"},
+	{Name: "ht_head_center", Type: "vec3", Shader: "fragment"},
+	{Name: "render_mode", Type: "uint", Shader: "fragment"},
+	{Name: "anaglyph_offset", Type: "vec2", Shader: "fragment"},
+}
+
+// the portable shaders only have the fragment shader and the normal render mode
+var portableUniforms = []ShaderUniform{
+	{Name: "window_size", Type: "ivec2", Shader: "fragment"},
+	{Name: "elapsed_time", Type: "float", Shader: "fragment"},
+}
+
+var computeUniforms = []ShaderUniform{
+	{Name: "minBound", Type: "vec3", Shader: "compute"},
+	{Name: "maxBound", Type: "vec3", Shader: "compute"},
+	{Name: "resolution", Type: "int", Shader: "compute"},
+	{Name: "time", Type: "float", Shader: "compute"},
+}
+
+// GetDeclaredUniforms returns every uniform of the last generated shaders, including hoisted literals
+func GetDeclaredUniforms() []ShaderUniform {
+	uniforms := target.Uniforms()
+	for _, tweak := range tweakUniforms {
+		uniforms = append(uniforms, ShaderUniform{Name: tweak.Name, Type: tweak.Type, Shader: "both"})
+	}
+	return uniforms
+}
+
+func glslUniforms(uniforms []ShaderUniform) string {
+	code := ""
+	for _, uniform := range uniforms {
+		code += fmt.Sprintf("uniform %s %s;\n", uniform.Type, uniform.Name)
+	}
+	return code
+}
+
+// glslFloat formats f as a float literal, always with a decimal point
+func glslFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.ContainsAny(s, ".eEn") {
+		s += ".0"
+	}
+	return s
+}
+
+func glslVec3(v [3]float64) string {
+	return fmt.Sprintf("vec3(%s, %s, %s)", glslFloat(v[0]), glslFloat(v[1]), glslFloat(v[2]))
+}
+
+// glslMaterialFields sets the fields of mat, textures are only sampled when
+// the shader binds them, otherwise the albedo is used
+func glslMaterialFields(mat Material, textures bool) string {
+	albedo := glslVec3(mat.Albedo)
+	if mat.Texture != "" && textures {
+		albedo = fmt.Sprintf("texture(%s, editor_uv).xyz", mat.Texture)
+	}
+
+	code := fmt.Sprintf("        mat.albedo = %s;\n", albedo)
+	code += fmt.Sprintf("        mat.roughness = %s;\n", glslFloat(mat.Roughness))
+	code += fmt.Sprintf("        mat.metallic = %s;\n", glslFloat(mat.Metallic))
+	code += fmt.Sprintf("        mat.emission = %s;\n", glslVec3(mat.Emission))
+	code += fmt.Sprintf("        mat.reflectivity = %s;\n", glslFloat(mat.Reflectivity))
+	code += fmt.Sprintf("        mat.ior = %s;\n", glslFloat(mat.IOR))
+	code += fmt.Sprintf("        mat.transparency = %s;\n", glslFloat(mat.Transparency))
+	return code
+}
+
+func generateGlslFragmentGetMaterial() {
+	generateFragmentCode("%s", glslGetMaterial(true))
+}
+
+// glslGetMaterial returns sdfl_GetMaterial, with the textures of the materials or without
+func glslGetMaterial(textures bool) string {
+	code := "\n"
+	if textures {
+		code += "\nvec2 editor_uv = vec2(0.);\n\n"
+	}
+	code += "Material sdfl_GetMaterial(int id) {\n    Material mat;\n\n"
+	for i, mat := range materials {
+		keyword := "if"
+		if i > 0 {
+			keyword = "else if"
+		}
+		code += fmt.Sprintf("    %s (id == %d) { // %s\n", keyword, mat.Id, mat.Name)
+		code += glslMaterialFields(mat, textures)
+		code += "    }\n"
+	}
+	code += fmt.Sprintf("    else { // %s\n", fallbackMaterial.Name)
+	code += glslMaterialFields(fallbackMaterial, textures)
+	code += `    }
+
+    return mat;
+}
+`
+	return code
+}
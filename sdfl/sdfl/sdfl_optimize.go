@@ -0,0 +1,251 @@
+package sdfl
+
+import (
+	"math"
+	"strings"
+)
+
+// optimization
+//
+// Optimize runs between Analyze and Generate. Arithmetic on constants,
+// calls to GLSL builtins and to lerp or smoothstep with constant arguments
+// and conditions on constants are evaluated like the CPU evaluator does,
+// conditionals with a constant condition are replaced by their branch, shapes
+// included. x * 1, 1 * x, x / 1, x + 0, 0 + x and x - 0 become x. Literals
+// hoisted into uniforms by tweak mode change at runtime, they are never folded.
+// Afterwards the parentheses of the source are dropped and only put back where
+// the precedence of GLSL needs them.
+
+// Optimize folds the constant expressions of an analyzed program and removes
+// redundant parentheses, only the generated code changes
+func Optimize(prog *Program) {
+	for _, stmt := range prog.Stmts {
+		if stmt.FunDef != nil && stmt.FunDef.Expr != nil {
+			optimizeExpr(stmt.FunDef.Expr)
+			stmt.FunDef.Expr.HasParentheses = false
+		}
+	}
+	optimizeExpr(&prog.Expr)
+	prog.Expr.HasParentheses = false
+}
+
+func optimizeExpr(expr *Expr) {
+	// children first, a parent is constant when its children folded
+	switch expr.Type {
+	case AST_FUN_CALL:
+		for i := range expr.FunCall.Args {
+			optimizeExpr(&expr.FunCall.Args[i].Expr)
+			expr.FunCall.Args[i].Expr.HasParentheses = false
+		}
+	case AST_ARR_EXPR:
+		for i := range expr.ArrExpr.Exprs {
+			optimizeExpr(&expr.ArrExpr.Exprs[i])
+			expr.ArrExpr.Exprs[i].HasParentheses = false
+		}
+	case AST_VEC:
+		for i := range expr.Vec.Exprs {
+			optimizeExpr(&expr.Vec.Exprs[i])
+			expr.Vec.Exprs[i].HasParentheses = false
+		}
+	case AST_COND:
+		for _, e := range []*Expr{&expr.Cond.Cond, &expr.Cond.Then, &expr.Cond.Else} {
+			optimizeExpr(e)
+			e.HasParentheses = false
+		}
+		if v, ok := foldBool(&expr.Cond.Cond); ok {
+			branch := expr.Cond.Else
+			if v {
+				branch = expr.Cond.Then
+			}
+			*expr = branch
+			return
+		}
+	case AST_UNOP_NOT:
+		optimizeExpr(&expr.UnopNot.Expr)
+		// generated as !(x)
+		expr.UnopNot.Expr.HasParentheses = false
+	case AST_BINOP_TERM:
+		optimizeExpr(&expr.BinopTerm.Left)
+		optimizeExpr(&expr.BinopTerm.Right)
+	case AST_BINOP_FACTOR:
+		optimizeExpr(&expr.BinopFactor.Left)
+		optimizeExpr(&expr.BinopFactor.Right)
+	case AST_BINOP_COMPARE:
+		optimizeExpr(&expr.BinopCompare.Left)
+		optimizeExpr(&expr.BinopCompare.Right)
+	case AST_BINOP_LOGIC:
+		optimizeExpr(&expr.BinopLogic.Left)
+		optimizeExpr(&expr.BinopLogic.Right)
+	default:
+		// literals stay as they are written
+		return
+	}
+
+	if foldExpr(expr) {
+		return
+	}
+	simplifyIdentity(expr)
+
+	left, right, operator, ok := binopOperands(expr)
+	if !ok {
+		return
+	}
+	level := precedence(expr)
+	left.HasParentheses = precedence(left) < level
+	// operators of the same level group to the left, a negative literal after
+	// a minus would read as the decrement operator --
+	right.HasParentheses = precedence(right) <= level ||
+		(right.Type == AST_NUMBER && !shouldTweak(right.Number.Tweak) && strings.HasPrefix(right.Number.Value, operator[:1]))
+}
+
+// binopOperands returns the operands and the operator of a binary operation
+func binopOperands(expr *Expr) (*Expr, *Expr, string, bool) {
+	switch expr.Type {
+	case AST_BINOP_TERM:
+		return &expr.BinopTerm.Left, &expr.BinopTerm.Right, expr.BinopTerm.Operator, true
+	case AST_BINOP_FACTOR:
+		return &expr.BinopFactor.Left, &expr.BinopFactor.Right, expr.BinopFactor.Operator, true
+	case AST_BINOP_COMPARE:
+		return &expr.BinopCompare.Left, &expr.BinopCompare.Right, expr.BinopCompare.Operator, true
+	case AST_BINOP_LOGIC:
+		return &expr.BinopLogic.Left, &expr.BinopLogic.Right, glslLogicOperators[expr.BinopLogic.Operator], true
+	}
+	return nil, nil, "", false
+}
+
+// precedence of the GLSL operator expr is generated as, higher binds tighter
+func precedence(expr *Expr) int {
+	switch expr.Type {
+	case AST_BINOP_FACTOR:
+		return 7
+	case AST_BINOP_TERM:
+		return 6
+	case AST_BINOP_COMPARE:
+		if expr.BinopCompare.Operator == "==" || expr.BinopCompare.Operator == "!=" {
+			return 4
+		}
+		return 5
+	case AST_BINOP_LOGIC:
+		if expr.BinopLogic.Operator == "and" {
+			return 3
+		}
+		return 2
+	}
+	// literals, calls, vectors and the conditionals and negations, which
+	// are generated in parentheses of their own
+	return 10
+}
+
+// constant reports if expr only depends on literals that are not tweaked
+func constant(expr *Expr) bool {
+	ok := true
+	walkExpr(expr, func(e *Expr) bool {
+		switch e.Type {
+		case AST_NUMBER:
+			ok = ok && !shouldTweak(e.Number.Tweak)
+		case AST_TUPLE:
+			ok = ok && !shouldTweak(e.Tuple.Tweak) && len(e.Tuple.Values) == 3
+		case AST_VEC:
+			ok = ok && len(e.Vec.Exprs) == 3
+		case AST_FUN_CALL:
+			ok = ok && (functionSymbols[e.FunCall.Id].SymbolType == FUN_BUILTIN_GLSL || e.FunCall.Id == "lerp" || e.FunCall.Id == "smoothstep")
+		case AST_BINOP_TERM, AST_BINOP_FACTOR, AST_BINOP_COMPARE, AST_BINOP_LOGIC, AST_UNOP_NOT, AST_COND, AST_BOOL:
+		default:
+			ok = false
+		}
+		return ok
+	})
+	return ok
+}
+
+// valueKind is ExprKind, except that arithmetic with a vec3 operand is a vec3
+func valueKind(expr *Expr) ArgKind {
+	left, right, _, ok := binopOperands(expr)
+	if !ok || expr.Type == AST_BINOP_COMPARE || expr.Type == AST_BINOP_LOGIC {
+		if expr.Type == AST_COND {
+			if then := valueKind(&expr.Cond.Then); then != ARG_ANY {
+				return then
+			}
+			return valueKind(&expr.Cond.Else)
+		}
+		return ExprKind(expr)
+	}
+	if valueKind(left) == ARG_VEC3 || valueKind(right) == ARG_VEC3 {
+		return ARG_VEC3
+	}
+	return ARG_FLOAT
+}
+
+// foldExpr replaces a constant float or vec3 by a literal
+func foldExpr(expr *Expr) bool {
+	kind := valueKind(expr)
+	if kind == ARG_BOOL {
+		if v, ok := foldBool(expr); ok {
+			*expr = Expr{Type: AST_BOOL, Bool: &Bool{Value: v}}
+			return true
+		}
+		return false
+	}
+	if (kind != ARG_FLOAT && kind != ARG_VEC3) || !constant(expr) {
+		return false
+	}
+	v := (&evalCompiler{}).value(expr)(evalEnv{})
+	for _, f := range v {
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			// left to the GPU, like 1 / 0
+			return false
+		}
+	}
+
+	if kind == ARG_FLOAT {
+		*expr = Expr{Type: AST_NUMBER, Number: &Number{Value: glslFloat(v[0])}}
+	} else {
+		*expr = Expr{Type: AST_TUPLE, Tuple: &Tuple{Values: []string{glslFloat(v[0]), glslFloat(v[1]), glslFloat(v[2])}}}
+	}
+	return true
+}
+
+func foldBool(expr *Expr) (bool, bool) {
+	if ExprKind(expr) != ARG_BOOL || !constant(expr) {
+		return false, false
+	}
+	return (&evalCompiler{}).bool(expr)(evalEnv{}), true
+}
+
+// identityOperand reports if expr is the literal identity, or a tuple of it
+// when the other operand is a vec3 so the kind of the operation is kept
+func identityOperand(expr *Expr, identity float64, other *Expr) bool {
+	switch expr.Type {
+	case AST_NUMBER:
+		v, err := ParseNumberLiteral(expr.Number.Value)
+		return err == nil && v == identity && !shouldTweak(expr.Number.Tweak)
+	case AST_TUPLE:
+		v, ok := evalConstVec3(expr)
+		return ok && v == splat(identity) && !shouldTweak(expr.Tuple.Tweak) && valueKind(other) == ARG_VEC3
+	}
+	return false
+}
+
+// simplifyIdentity replaces x * 1, 1 * x, x / 1, x + 0, 0 + x and x - 0 by x
+func simplifyIdentity(expr *Expr) {
+	var left, right *Expr
+	leftIdentity, rightIdentity := false, false
+	switch expr.Type {
+	case AST_BINOP_TERM:
+		left, right = &expr.BinopTerm.Left, &expr.BinopTerm.Right
+		leftIdentity = expr.BinopTerm.Operator == "+" && identityOperand(left, 0, right)
+		rightIdentity = identityOperand(right, 0, left)
+	case AST_BINOP_FACTOR:
+		left, right = &expr.BinopFactor.Left, &expr.BinopFactor.Right
+		leftIdentity = expr.BinopFactor.Operator == "*" && identityOperand(left, 1, right)
+		rightIdentity = identityOperand(right, 1, left)
+	default:
+		return
+	}
+
+	if rightIdentity {
+		*expr = *left
+	} else if leftIdentity {
+		*expr = *right
+	}
+}
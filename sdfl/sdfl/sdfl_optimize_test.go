@@ -0,0 +1,129 @@
+package sdfl
+
+import (
+	"strings"
+	"testing"
+)
+
+// optimizedArg optimizes the scene with the children and returns the
+// argument name of its first child as GLSL would see it
+func optimizedArg(t *testing.T, children string, name string) string {
+	t.Helper()
+	prog := parseSource(t, sceneWith(children))
+	Optimize(&prog)
+	child := prog.Expr.FunCall.ArgExpr("children").ArrExpr.Exprs[0]
+	if name == "" {
+		return FormatExpr(child)
+	}
+	arg, ok := child.FunCall.Arg(name)
+	if !ok {
+		t.Fatalf("%s has no argument %s", children, name)
+	}
+	return FormatExpr(arg.Expr)
+}
+
+func TestOptimizeFolds(t *testing.T) {
+	for _, tc := range []struct {
+		rule     string
+		children string
+		want     string // the radius of a sphere or the size of a box
+	}{
+		{"arithmetic", "sphere(radius: 2 * 3.14159 / 4)", "1.570795"},
+		{"arithmetic groups to the left", "sphere(radius: 8 - 4 - 2)", "2.0"},
+		{"vector arithmetic", "box(size: (1, 2, 3) * 2 + 1)", "(3.0, 5.0, 7.0)"},
+		{"vectors of constants", "box(size: (1 + 1, 2, 3))", "(2, 2, 3)"},
+		{"glsl builtins", "sphere(radius: pow(2, 3) + sqrt(4))", "10.0"},
+		{"degrees", "sphere(radius: degrees(radians(90)))", "90.0"},
+		{"lerp", "sphere(radius: lerp(from: 1, to: 3, t: 0.5))", "2.0"},
+		{"smoothstep", "sphere(radius: smoothstep(from: 0, to: 1, x: 2))", "1.0"},
+		{"constant condition", "sphere(radius: 1 < 2 ? 4 : 5)", "4"},
+		{"logic", "sphere(radius: (1 > 2 or not (3 < 2)) and 1 == 1 ? 4 : 5)", "4"},
+		{"x * 1", "sphere(radius: time() * 1)", "time()"},
+		{"1 * x", "sphere(radius: 1 * time())", "time()"},
+		{"x / 1", "sphere(radius: time() / 1)", "time()"},
+		{"x + 0", "sphere(radius: time() + 0)", "time()"},
+		{"0 + x", "sphere(radius: 0 + time())", "time()"},
+		{"x - 0", "sphere(radius: time() - 0)", "time()"},
+		{"vector identity", "box(size: (time(), 1, 1) * (1, 1, 1))", "(time(), 1, 1)"},
+		{"parentheses dropped", "sphere(radius: ((time())) + (2 * time()))", "time() + 2 * time()"},
+		{"parentheses kept", "sphere(radius: (time() + 1) * 2)", "(time() + 1) * 2"},
+		{"right operand of a minus", "sphere(radius: time() - (time() - 1))", "time() - (time() - 1)"},
+
+		// not folded
+		{"time", "sphere(radius: time() * 2 + 1)", "time() * 2 + 1"},
+		{"noise", "sphere(radius: noise() + 1)", "noise() + 1"},
+		{"0 - x", "sphere(radius: 0 - time())", "0 - time()"},
+		{"x / 0.5", "sphere(radius: time() / 0.5)", "time() / 0.5"},
+		{"float identity of a vector", "box(size: (time(), 1, 1) * 1)", "(time(), 1, 1)"},
+		{"vector identity of a float", "box(size: time() * (1, 1, 1))", "time() * (1, 1, 1)"},
+		{"not a number", "sphere(radius: sqrt(0 - 1) + 1)", "sqrt(-1.0) + 1"},
+		{"time dependent side", "sphere(radius: 1 > 2 and time() > 1 ? 4 : 5)", "false and time() > 1 ? 4 : 5"},
+		{"time dependent condition", "sphere(radius: time() > 1 ? 1 + 1 : 3)", "time() > 1 ? 2.0 : 3"},
+	} {
+		name := "radius"
+		if strings.HasPrefix(tc.children, "box") {
+			name = "size"
+		}
+		if got := optimizedArg(t, tc.children, name); got != tc.want {
+			t.Errorf("%s: %s is %s, want %s", tc.rule, tc.children, got, tc.want)
+		}
+	}
+}
+
+func TestOptimizeKeepsTweaks(t *testing.T) {
+	SetTweakMode(TWEAK_MARKED)
+	defer SetTweakMode(TWEAK_NONE)
+	for _, tc := range []struct {
+		children string
+		want     string
+	}{
+		{"sphere(radius: @tweak 1 + 1)", "@tweak 1 + 1"},
+		{"sphere(radius: time() * @tweak 1)", "time() * @tweak 1"},
+		{"sphere(radius: @tweak 0 + time())", "@tweak 0 + time()"},
+		{"box(size: @tweak (1, 1, 1) * 2)", "@tweak (1, 1, 1) * 2"},
+		{"box(size: (1, @tweak 2, 3) * 2)", "(1, @tweak 2, 3) * 2"},
+		{"sphere(radius: 1 < @tweak 2 ? 4 : 5)", "1 < @tweak 2 ? 4 : 5"},
+		// unmarked literals still fold
+		{"sphere(radius: @tweak 1 + 2 * 3)", "@tweak 1 + 6.0"},
+	} {
+		name := "radius"
+		if strings.HasPrefix(tc.children, "box") {
+			name = "size"
+		}
+		if got := optimizedArg(t, tc.children, name); got != tc.want {
+			t.Errorf("%s: %s, want %s", tc.children, got, tc.want)
+		}
+	}
+}
+
+func TestOptimizeConstantBranchShapes(t *testing.T) {
+	if got := optimizedArg(t, "1 > 2 ? sphere() : box(size: (1, 2, 3) * 2)", ""); !strings.HasPrefix(got, "box(") || !strings.Contains(got, "size: (2.0, 4.0, 6.0)") {
+		t.Errorf("the constant conditional is %s, want the box", got)
+	}
+}
+
+func TestDivisionByZero(t *testing.T) {
+	for _, tc := range []struct {
+		children string
+		zero     bool
+	}{
+		{"sphere(radius: 1 / 0)", true},
+		{"sphere(radius: 1 / (2 - 2))", true},
+		{"box(size: (1, 1, 1) / (1, 0, 1))", true},
+		{"sphere(radius: 1 / (0 < 1 ? 0 : 1))", true},
+		{"sphere(radius: 1 / @tweak 0)", false},
+		{"sphere(radius: 1 / time())", false},
+		{"sphere(radius: 0 / 1)", false},
+	} {
+		src := sceneWith(tc.children)
+		diagnostics := diagnosticsOf(src)
+		// reported at the operator
+		col := strings.Index(src, " / ") + 2
+		switch {
+		case !tc.zero && len(diagnostics) > 0:
+			t.Errorf("%s: diagnostics %v", tc.children, diagnostics)
+		case tc.zero && (len(diagnostics) != 1 || diagnostics[0].Message != "division by zero" || diagnostics[0].Col != col):
+			t.Errorf("%s: diagnostics %v, want division by zero at column %d", tc.children, diagnostics, col)
+		}
+	}
+}
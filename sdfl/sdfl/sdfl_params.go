@@ -0,0 +1,263 @@
+package sdfl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parameters of user defined functions
+//
+// The generated functions only take the position, so the parameters of a
+// function are bound at analysis time: every call with a different list of
+// arguments gets its own copy of the function, f_1, f_2 and so on, with the
+// parameters replaced by the arguments. Calls with the same arguments share
+// a copy. The copies take the place of the function in the program, a
+// function with parameters that is never called is not generated.
+
+// specializer makes the copies of the functions with parameters of a program
+type specializer struct {
+	fe        *Frontend
+	funDefs   map[string]*FunDef // the functions of the program by name
+	names     map[string]bool    // the names in use
+	copies    map[string][]Stmt  // the copies of every function
+	keys      map[string]string  // the name of the copy for the key of a call
+	counts    map[string]int     // the copies made of every function
+	expanding map[string]bool    // the functions whose copies are being analyzed
+	analyze   func(expr *Expr)   // unrolls and analyzes a body
+}
+
+func newSpecializer(fe *Frontend, prog *Program, analyze func(expr *Expr)) *specializer {
+	s := &specializer{
+		fe:        fe,
+		funDefs:   map[string]*FunDef{},
+		names:     map[string]bool{},
+		copies:    map[string][]Stmt{},
+		keys:      map[string]string{},
+		counts:    map[string]int{},
+		expanding: map[string]bool{},
+		analyze:   analyze,
+	}
+	for _, stmt := range prog.Stmts {
+		if stmt.FunDef != nil {
+			s.funDefs[stmt.FunDef.Id] = stmt.FunDef
+			s.names[stmt.FunDef.Id] = true
+		}
+	}
+	return s
+}
+
+// hasParams tells whether the function id of the program takes parameters
+func (s *specializer) hasParams(id string) bool {
+	funDef, ok := s.funDefs[id]
+	return ok && len(funDef.FunDefArgNames) > 0
+}
+
+// calls replaces the calls of functions with parameters in expr by calls of
+// their copies, expr is analyzed already
+func (s *specializer) calls(expr *Expr) {
+	walkExpr(expr, func(e *Expr) bool {
+		if e.Type == AST_FUN_CALL && s.hasParams(e.FunCall.Id) {
+			if name, ok := s.copy(e.FunCall); ok {
+				e.FunCall.Id = name
+				e.FunCall.Args = []FunNamedArg{}
+			}
+			return false
+		}
+		return true
+	})
+}
+
+// copy returns the name of the copy of the function funCall calls with its
+// arguments, making it on the first call
+func (s *specializer) copy(funCall *FunCall) (string, bool) {
+	funDef := s.funDefs[funCall.Id]
+	if s.expanding[funDef.Id] {
+		s.fe.reportError(funCall.Span, "function %s calls itself", funDef.Id)
+		return "", false
+	}
+
+	uses := s.fe.paramUses(funDef)
+	args := map[string]Expr{}
+	key := funDef.Id
+	wrong := false
+	for _, name := range funDef.FunDefArgNames {
+		arg, ok := funCall.Arg(name)
+		if !ok {
+			// Analyze reported the missing argument
+			return "", false
+		}
+		kind := s.fe.functions.exprKind(&arg.Expr)
+		for _, use := range uses[name] {
+			if !KindMatches(use, kind) {
+				s.fe.reportError(arg.Span, "argument %s of %s is used as a %s, got a %s", name, funDef.Id, argKindToString(use), argKindToString(kind))
+				wrong = true
+				break
+			}
+		}
+		args[name] = arg.Expr
+		key += "\n" + name + "\n" + strings.Join(exprToLines(arg.Expr), "\n") + tweakFingerprint(&arg.Expr)
+	}
+	if wrong {
+		return "", false
+	}
+	if name, ok := s.keys[key]; ok {
+		return name, true
+	}
+
+	name := s.newName(funDef.Id)
+	s.keys[key] = name
+	body := CopyExpr(*funDef.Expr)
+	bindParams(&body, args)
+
+	s.expanding[funDef.Id] = true
+	s.analyze(&body)
+	s.calls(&body)
+	s.expanding[funDef.Id] = false
+
+	specialized := &FunDef{Type: AST_FUN_DEF, SymbolType: FUN_USER_DEFINED, Id: name, FunDefArgNames: []string{}, Expr: &body}
+	s.fe.functions[name] = *specialized
+	s.copies[funDef.Id] = append(s.copies[funDef.Id], Stmt{Type: AST_FUN_DEF, FunDef: specialized})
+	return name, true
+}
+
+// newName returns the name of the next copy of the function id, one that is
+// not used by the program
+func (s *specializer) newName(id string) string {
+	for {
+		s.counts[id]++
+		name := fmt.Sprintf("%s_%d", id, s.counts[id])
+		if !s.names[name] {
+			s.names[name] = true
+			return name
+		}
+	}
+}
+
+// stmts returns the statements of the program with every function with
+// parameters replaced by its copies, a function is defined before its callers
+// so its copies are as well
+func (s *specializer) stmts(stmts []Stmt) []Stmt {
+	result := []Stmt{}
+	for _, stmt := range stmts {
+		if stmt.FunDef != nil && s.hasParams(stmt.FunDef.Id) {
+			result = append(result, s.copies[stmt.FunDef.Id]...)
+			continue
+		}
+		result = append(result, stmt)
+	}
+	return result
+}
+
+// paramUses returns the kinds the body of funDef uses each of its parameters
+// as, a parameter passed on to a user defined function can be anything there
+func (fe *Frontend) paramUses(funDef *FunDef) map[string][]ArgKind {
+	uses := map[string][]ArgKind{}
+	params := map[string]bool{}
+	for _, name := range funDef.FunDefArgNames {
+		params[name] = true
+	}
+	fe.collectUses(funDef.Expr, params, uses)
+	return uses
+}
+
+func (fe *Frontend) collectUses(body *Expr, params map[string]bool, uses map[string][]ArgKind) {
+	use := func(e *Expr, kind ArgKind) {
+		if e.Type == AST_VAR && params[e.Var.Name] {
+			uses[e.Var.Name] = append(uses[e.Var.Name], kind)
+		}
+	}
+	walkExpr(body, func(e *Expr) bool {
+		switch e.Type {
+		case AST_FUN_CALL:
+			signature, _ := fe.functions.signature(e.FunCall.Id)
+			for _, arg := range signature {
+				namedArg, ok := e.FunCall.Arg(arg.Name)
+				if !ok {
+					continue
+				}
+				use(&namedArg.Expr, arg.Kind)
+				if arg.Kind == ARG_SHAPE_LIST && namedArg.Expr.Type == AST_ARR_EXPR {
+					for i := range namedArg.Expr.ArrExpr.Exprs {
+						use(&namedArg.Expr.ArrExpr.Exprs[i], ARG_SHAPE)
+					}
+				}
+			}
+		case AST_BINOP_TERM:
+			use(&e.BinopTerm.Left, ARG_VALUE)
+			use(&e.BinopTerm.Right, ARG_VALUE)
+		case AST_BINOP_FACTOR:
+			use(&e.BinopFactor.Left, ARG_VALUE)
+			use(&e.BinopFactor.Right, ARG_VALUE)
+		case AST_BINOP_COMPARE:
+			use(&e.BinopCompare.Left, ARG_FLOAT)
+			use(&e.BinopCompare.Right, ARG_FLOAT)
+		case AST_BINOP_LOGIC:
+			use(&e.BinopLogic.Left, ARG_BOOL)
+			use(&e.BinopLogic.Right, ARG_BOOL)
+		case AST_UNOP_NOT:
+			use(&e.UnopNot.Expr, ARG_BOOL)
+		case AST_VEC:
+			for i := range e.Vec.Exprs {
+				use(&e.Vec.Exprs[i], ARG_FLOAT)
+			}
+		case AST_COND:
+			use(&e.Cond.Cond, ARG_BOOL)
+		case AST_FOR:
+			if params[e.For.Var] {
+				// the loop variable hides the parameter in the body
+				fe.collectUses(&e.For.From, params, uses)
+				fe.collectUses(&e.For.To, params, uses)
+				inner := map[string]bool{}
+				for name := range params {
+					inner[name] = name != e.For.Var
+				}
+				for i := range e.For.Body.Exprs {
+					fe.collectUses(&e.For.Body.Exprs[i], inner, uses)
+				}
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// bindParams replaces the variables of body that are parameters by their
+// arguments, the variables of loops hide the parameters of the same name
+func bindParams(body *Expr, args map[string]Expr) {
+	walkExpr(body, func(e *Expr) bool {
+		switch e.Type {
+		case AST_VAR:
+			if arg, ok := args[e.Var.Name]; ok {
+				value := CopyExpr(arg)
+				// the argument is one operand, whatever operator it is used with
+				value.HasParentheses = value.HasParentheses || isBinop(&value)
+				*e = value
+			}
+			return false
+		case AST_FOR:
+			if _, ok := args[e.For.Var]; ok {
+				bindParams(&e.For.From, args)
+				bindParams(&e.For.To, args)
+				inner := map[string]Expr{}
+				for name, arg := range args {
+					if name != e.For.Var {
+						inner[name] = arg
+					}
+				}
+				for i := range e.For.Body.Exprs {
+					bindParams(&e.For.Body.Exprs[i], inner)
+				}
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func isBinop(expr *Expr) bool {
+	switch expr.Type {
+	case AST_BINOP_TERM, AST_BINOP_FACTOR, AST_BINOP_COMPARE, AST_BINOP_LOGIC:
+		return true
+	}
+	return false
+}
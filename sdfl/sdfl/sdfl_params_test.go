@@ -0,0 +1,141 @@
+package sdfl
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// sameDistances compares the distances of two scenes at random points
+func sameDistances(t *testing.T, src string, want string) {
+	t.Helper()
+	a, b := parseSource(t, src), parseSource(t, want)
+	sceneA, sceneB := CompileEval(&a), CompileEval(&b)
+	if sceneA == nil || sceneB == nil {
+		t.Fatalf("compile: %v", GetDiagnostics())
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		p := [3]float64{r.Float64()*8 - 4, r.Float64()*8 - 4, r.Float64()*8 - 4}
+		if got, want := sceneA.Distance(p, 1.5).Distance, sceneB.Distance(p, 1.5).Distance; got != want {
+			t.Fatalf("distance at %v is %g, want %g", p, got, want)
+		}
+	}
+}
+
+func TestFunctionParams(t *testing.T) {
+	const camera = "camera: camera(position: (0, 0, 5))"
+	for _, tc := range []struct {
+		src  string
+		want string
+	}{
+		{
+			// positional, named and default arguments
+			"def f(a, b = 2) { local(children: [sphere(radius: b, position: (a, 0, 0))]) }\nscene(" + camera + ", children: [f(1), f(a: 3, b: 0.5)])",
+			"scene(" + camera + ", children: [sphere(position: (1, 0, 0), radius: 2), sphere(position: (3, 0, 0), radius: 0.5)])",
+		},
+		{
+			// an argument keeps its precedence
+			"def f(a) { local(children: [sphere(radius: a * 2)]) }\nscene(" + camera + ", children: [f(0.5 + 0.25)])",
+			"scene(" + camera + ", children: [sphere(radius: 1.5)])",
+		},
+		{
+			// shapes, loop variables and time() as arguments
+			"def f(s, h) { local(children: [union(child1: s, child2: sphere(position: (0, h, 0), radius: 0.5))]) }\nscene(" + camera + ", children: [for i in 0..2 { f(box(position: (i, 0, 0)), h: i + time()) }])",
+			"scene(" + camera + ", children: [union(child1: box(position: (0, 0, 0)), child2: sphere(position: (0, 0 + time(), 0), radius: 0.5)), union(child1: box(position: (1, 0, 0)), child2: sphere(position: (0, 1 + time(), 0), radius: 0.5))])",
+		},
+		{
+			// a loop variable hides a parameter of the same name
+			"def f(i) { local(children: [for i in 0..2 { sphere(position: (i, 0, 0), radius: 0.5) }]) }\nscene(" + camera + ", children: [f(5)])",
+			"scene(" + camera + ", children: [sphere(position: (0, 0, 0), radius: 0.5), sphere(position: (1, 0, 0), radius: 0.5)])",
+		},
+		{
+			// functions passing their parameters on
+			"def f(r) { local(children: [sphere(radius: r)]) }\ndef g(r) { local(children: [f(r + 1)]) }\nscene(" + camera + ", children: [g(1), f(2)])",
+			"scene(" + camera + ", children: [sphere(radius: 2)])",
+		},
+	} {
+		sameDistances(t, tc.src, tc.want)
+	}
+}
+
+func TestFunctionParamCopies(t *testing.T) {
+	prog := parseSource(t, `def f(a, b = 2) { local(children: [sphere(radius: b, position: (a, 0, 0))]) }
+def unused(a) { local(children: [sphere(radius: a)]) }
+def f_1() { local(children: [box()]) }
+scene(camera: camera(position: (0, 0, 5)), children: [f(1), f(a: 1, b: 2), f(2), f_1()])`)
+	names := []string{}
+	for _, stmt := range prog.Stmts {
+		names = append(names, stmt.FunDef.Id)
+	}
+	if got := strings.Join(names, ", "); got != "f_2, f_3, f_1" {
+		t.Errorf("functions = %s, want a copy of f for each list of arguments", got)
+	}
+
+	for _, name := range portableTargets {
+		for _, shader := range generateTarget(t, &prog, name) {
+			if err := checkShaderSyntax(name, shader.Code); err != nil {
+				t.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+	fragment := generateTarget(t, &prog, "glsl430")[0].Code
+	if !strings.Contains(fragment, "sdfl_builtin_sphere(p, vec3(2, 0, 0), 2)") {
+		t.Errorf("the arguments of f(2) are not passed to its copy")
+	}
+	if strings.Contains(fragment, "unused") {
+		t.Errorf("a function with parameters that is never called is generated")
+	}
+}
+
+func TestFunctionParamErrors(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		want string
+	}{
+		{"def f(a) { local(children: [sphere(radius: a)]) }\nscene(camera: camera(position: (0, 0, 5)), children: [f()])", "missing argument a"},
+		{"def f(a) { local(children: [sphere(radius: b)]) }\nscene(camera: camera(position: (0, 0, 5)), children: [f(1)])", "unknown variable b"},
+		{"def f(a) { local(children: [sphere(radius: a)]) }\nscene(camera: camera(position: (0, 0, 5)), children: [f((1, 2, 3))])", "argument a of f is used as a float, got a vec3"},
+		{"def f(s) { local(children: [union(child1: s, child2: box())]) }\nscene(camera: camera(position: (0, 0, 5)), children: [f(2)])", "argument s of f is used as a shape, got a float"},
+		{"def f(s) { local(children: [s]) }\nscene(camera: camera(position: (0, 0, 5)), children: [f(s: 2)])", "argument s of f is used as a shape, got a float"},
+		{"def f(a) { local(children: [sphere(position: (a, 0, 0))]) }\nscene(camera: camera(position: (0, 0, 5)), children: [f(box())])", "argument a of f is used as a float, got a shape"},
+		{"def f(a) { local(children: [box(size: a * 2)]) }\nscene(camera: camera(position: (0, 0, 5)), children: [f(0.5)])", "size of box needs a vec3, got a float"},
+	} {
+		found := []string{}
+		for _, d := range diagnosticsOf(tc.src) {
+			found = append(found, d.Message)
+		}
+		if !strings.Contains(strings.Join(found, "\n"), tc.want) {
+			t.Errorf("%s: diagnostics %v, want %q", tc.src, found, tc.want)
+		}
+	}
+}
+
+func TestTweakedVectorElements(t *testing.T) {
+	SetTweakMode(TWEAK_MARKED)
+	defer SetTweakMode(TWEAK_NONE)
+	const camera = "camera: camera(position: (0, 0, 5))"
+	for _, src := range []string{
+		"scene(" + camera + ", children: [sphere(position: (0, @tweak 1, @tweak 2), radius: @tweak 0.5)])",
+		// an argument keeps its mark in the copy of the function
+		"def f(y) { local(children: [sphere(position: (0, y, @tweak 2), radius: @tweak 0.5)]) }\nscene(" + camera + ", children: [f(@tweak 1)])",
+	} {
+		for _, optimize := range []bool{false, true} {
+			prog := parseSource(t, src)
+			if optimize {
+				Optimize(&prog)
+			}
+			fragment := generateTarget(t, &prog, "glsl430")[0].Code
+			uniforms := GetTweakUniforms()
+			if len(uniforms) != 3 {
+				t.Errorf("%s, optimized %v: %d uniforms, want one per tweaked literal: %+v", src, optimize, len(uniforms), uniforms)
+				continue
+			}
+			for _, uniform := range uniforms {
+				if uniform.Type != "float" || !strings.Contains(fragment, "uniform float "+uniform.Name+";") {
+					t.Errorf("%s: uniform %+v is not a declared float", src, uniform)
+				}
+			}
+		}
+	}
+}
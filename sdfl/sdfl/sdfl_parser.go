@@ -1,24 +1,31 @@
 package sdfl
 
-// parser
-
 import (
-	"fmt"
+	"slices"
+	"strings"
 )
 
+// parser
+
 type Parser struct {
 	Tokens    []Token
 	token_idx int
 	err       bool
+	eof       bool      // an error at EOF was reported, the rest would repeat it
+	fe        *Frontend // gets the diagnostics and the functions defined
 }
 
 func NewParser(tokens []Token) Parser {
-	return Parser{token_idx: 0, Tokens: tokens, err: false}
+	return defaultFrontend.NewParser(tokens)
+}
+
+func (fe *Frontend) NewParser(tokens []Token) Parser {
+	return Parser{token_idx: 0, Tokens: tokens, err: false, fe: fe}
 }
 
 func (p *Parser) current() Token {
 	if p.token_idx >= len(p.Tokens) {
-		return Token{Kind: EOF}
+		return p.end()
 	}
 	return p.Tokens[p.token_idx]
 }
@@ -26,18 +33,38 @@ func (p *Parser) current() Token {
 func (p *Parser) lookAhead(num int) Token {
 	idx := p.token_idx + num
 	if idx >= len(p.Tokens) {
-		return Token{Kind: EOF}
+		return p.end()
 	} else if idx <= 0 {
 		panic("PANIC: You go too back far there is no token!\n")
 	}
 	return p.Tokens[idx]
 }
 
+// end is the EOF token of the tokens, at the position of the end of the input
+func (p *Parser) end() Token {
+	if len(p.Tokens) > 0 && p.Tokens[len(p.Tokens)-1].Kind == EOF {
+		return p.Tokens[len(p.Tokens)-1]
+	}
+	return Token{Kind: EOF, Value: "EOF"}
+}
+
+// syntaxError reports an error at tok, once for EOF since every enclosing
+// construct misses its end as well
+func (p *Parser) syntaxError(tok Token, format string, args ...any) {
+	p.err = true
+	if tok.Kind == EOF {
+		if p.eof {
+			return
+		}
+		p.eof = true
+	}
+	p.fe.reportError(tokenSpan(tok), format, args...)
+}
+
 func (p *Parser) eat(token_kind TokenType) (bool, Token) {
 	tok := p.current()
 	if token_kind != tok.Kind {
-		fmt.Printf("ERROR:%d:%d expected %s but got %s\n", tok.Row, tok.Col, TokenName[token_kind], TokenName[tok.Kind])
-		p.err = true
+		p.syntaxError(tok, "expected %s but got %s", TokenName[token_kind], TokenName[tok.Kind])
 		return false, tok
 	}
 	p.token_idx++
@@ -60,11 +87,18 @@ func (p *Parser) eatOneOf(kinds ...TokenType) (bool, Token) {
 		}
 		expected += TokenName[k]
 	}
-	fmt.Printf("ERROR:%d:%d expected %s but got %s\n", tok.Row, tok.Col, expected, TokenName[tok.Kind])
-	p.err = true
+	p.syntaxError(tok, "expected %s but got %s", expected, TokenName[tok.Kind])
 	return false, tok
 }
 
+// skipIfStuck drops the current token when a loop iteration could not consume
+// anything, so a syntax error does not turn into an endless loop
+func (p *Parser) skipIfStuck(start int) {
+	if p.token_idx == start && p.current().Kind != EOF {
+		p.token_idx++
+	}
+}
+
 func (p *Parser) IsThereError() bool {
 	return p.err
 }
@@ -73,22 +107,39 @@ func (p *Parser) ParseFunDef() FunDef {
 	p.eat(KW_DEF)
 	_, tok := p.eat(KW_ID)
 	funName := tok.Value
+	Tracef(TRACE_PARSER, "%d:%d fundef %s", tok.Row, tok.Col, funName)
 	p.eat(PUNC_LPAREN)
 	funDefArgNames := []string{}
-	for p.current().Kind != PUNC_RPAREN {
+	var funDefDefaults map[string]Expr
+	for p.current().Kind != PUNC_RPAREN && p.current().Kind != EOF {
+		start := p.token_idx
 		_, tok := p.eat(KW_ID)
-		funDefArgNames = append(funDefArgNames, tok.Value)
+		if slices.Contains(funDefArgNames, tok.Value) {
+			p.fe.reportError(tokenSpan(tok), "duplicate parameter %s in definition of %s", tok.Value, funName)
+		} else {
+			funDefArgNames = append(funDefArgNames, tok.Value)
+		}
+		// a default value makes the parameter optional, `def f(a, b = 2)`
+		if p.current().Kind == PUNC_EQUAL {
+			p.eat(PUNC_EQUAL)
+			value := p.ParseExpr()
+			if funDefDefaults == nil {
+				funDefDefaults = map[string]Expr{}
+			}
+			funDefDefaults[tok.Value] = value
+		}
 		if p.current().Kind != PUNC_RPAREN {
 			p.eat(PUNC_COMMA)
 		}
+		p.skipIfStuck(start)
 	}
 	p.eat(PUNC_RPAREN)
 	p.eat(PUNC_LCURLY)
 	expr := p.ParseExpr()
 	p.eat(PUNC_RCURLY)
 
-	funDef := FunDef{Type: AST_FUN_DEF, SymbolType: FUN_USER_DEFINED, Id: funName, FunDefArgNames: funDefArgNames, Expr: &expr}
-	functionSymbols[funName] = funDef
+	funDef := FunDef{Type: AST_FUN_DEF, SymbolType: FUN_USER_DEFINED, Id: funName, FunDefArgNames: funDefArgNames, FunDefDefaults: funDefDefaults, Expr: &expr}
+	p.fe.functions[funName] = funDef
 	return funDef
 }
 
@@ -99,31 +150,69 @@ func (p *Parser) ParseFunNamedArg() FunNamedArg {
 	p.eat(PUNC_COLON)
 	expr := p.ParseExpr()
 
-	funNamedArg := FunNamedArg{ArgName: argName, Expr: expr}
+	funNamedArg := FunNamedArg{ArgName: argName, Expr: expr, Span: tokenSpan(tok)}
 	return funNamedArg
 }
 
+// isNamedArg tells a named argument `radius: 1` from a positional one
+func (p *Parser) isNamedArg() bool {
+	return p.current().Kind == KW_ID && p.lookAhead(1).Kind == PUNC_COLON
+}
+
+// ParseFunCall parses a call with named arguments, or positional ones which
+// take the names of the function definition in order. Positional arguments
+// come first, duplicate names are reported and dropped. Names the function
+// does not have are kept, Analyze reports them.
 func (p *Parser) ParseFunCall() FunCall {
 	_, tok := p.eat(KW_ID)
+	Tracef(TRACE_PARSER, "%d:%d call %s", tok.Row, tok.Col, tok.Value)
 	p.eat(PUNC_LPAREN)
 
-	funNamedArgs := map[string]FunNamedArg{}
-	for p.current().Kind != PUNC_RPAREN {
-		funNamedArg := p.ParseFunNamedArg()
-		funNamedArgs[funNamedArg.ArgName] = funNamedArg
+	funCall := FunCall{Id: tok.Value, Args: []FunNamedArg{}, Span: tokenSpan(tok)}
+	funDef, known := p.fe.functions[tok.Value]
+	named := false
+	for p.current().Kind != PUNC_RPAREN && p.current().Kind != EOF {
+		start := p.token_idx
+
+		var arg FunNamedArg
+		if p.isNamedArg() {
+			arg = p.ParseFunNamedArg()
+			named = true
+		} else {
+			valueTok := p.current()
+			arg = FunNamedArg{Expr: p.ParseExpr(), Span: tokenSpan(valueTok), Positional: true}
+			if named {
+				p.fe.reportError(arg.Span, "positional argument after named arguments in call to %s", tok.Value)
+			} else if !known {
+				p.fe.reportError(arg.Span, "positional arguments need a known function, %s is not defined", tok.Value)
+			} else if len(funCall.Args) >= len(funDef.FunDefArgNames) {
+				p.fe.reportError(arg.Span, "too many arguments in call to %s, it takes %d", tok.Value, len(funDef.FunDefArgNames))
+			} else {
+				arg.ArgName = funDef.FunDefArgNames[len(funCall.Args)]
+			}
+		}
+
+		if arg.ArgName != "" {
+			if previous, ok := funCall.Arg(arg.ArgName); ok {
+				p.fe.reportError(arg.Span, "duplicate argument %s in call to %s, first given at %d:%d", arg.ArgName, tok.Value, previous.Span.Row, previous.Span.Col)
+			} else {
+				funCall.Args = append(funCall.Args, arg)
+			}
+		}
+
 		if p.current().Kind != PUNC_RPAREN {
 			p.eat(PUNC_COMMA)
 		}
+		p.skipIfStuck(start)
 	}
 
 	p.eat(PUNC_RPAREN)
-	funcCall := FunCall{Id: tok.Value, FunNamedArgs: funNamedArgs}
-	return funcCall
+	return funCall
 }
 
 func (p *Parser) ParseNumber() Number {
-	_, tok := p.eat(NUMBER_FLOAT)
-	number := Number{Value: tok.Value}
+	_, tok := p.eatOneOf(NUMBER_FLOAT, NUMBER_INT)
+	number := Number{Value: tok.Value, Span: Span{Row: tok.Row, Col: tok.Col, Len: len(tok.Value)}}
 	return number
 }
 
@@ -164,62 +253,211 @@ func (p *Parser) isTuple() bool {
 	return foundComma
 }
 
-func (p *Parser) ParseTuple() Tuple {
-	p.eat(PUNC_LPAREN)
+// ParseTuple parses `(1, 2, 3)`, a tuple with other elements than number
+// literals like `(i * 2, 0, 0)` becomes a Vec
+func (p *Parser) ParseTuple() Expr {
+	_, lparen := p.eat(PUNC_LPAREN)
+	exprs := p.parseElements(PUNC_RPAREN)
+	_, rparen := p.eat(PUNC_RPAREN)
 
-	values := []string{}
-	for p.current().Kind != PUNC_RPAREN {
-		if p.current().Kind == NUMBER_FLOAT {
-			_, tok := p.eat(NUMBER_FLOAT)
-			values = append(values, tok.Value)
-		} else {
-			// for now, still only handle NUMBER_FLOAT in tuples
-			// TODO: extend this to handle expressions later
-			panic("Only number literals supported in tuples currently")
-		}
+	span := Span{Row: lparen.Row, Col: lparen.Col, Len: 1}
+	if rparen.Row == lparen.Row {
+		span.Len = rparen.Col - lparen.Col + 1
+	}
 
-		if p.current().Kind != PUNC_RPAREN {
-			p.eat(PUNC_COMMA)
+	values := []string{}
+	for _, expr := range exprs {
+		if expr.Type != AST_NUMBER || expr.HasParentheses || expr.Number.Tweak {
+			return Expr{Type: AST_VEC, Vec: &Vec{Exprs: exprs, Span: span}}
 		}
+		values = append(values, expr.Number.Value)
 	}
-
-	p.eat(PUNC_RPAREN)
-
-	tuple := Tuple{Values: values}
-	return tuple
+	return Expr{Type: AST_TUPLE, Tuple: &Tuple{Values: values, Span: span}}
 }
 
-func (p *Parser) ParseArrExpr() ArrExpr {
-	p.eat(PUNC_LSQUARE)
+// parseElements parses a comma separated list of expressions up to end
+func (p *Parser) parseElements(end TokenType) []Expr {
 	exprs := []Expr{}
-	for p.current().Kind != PUNC_RSQUARE {
+	for p.current().Kind != end && p.current().Kind != EOF {
+		start := p.token_idx
 		expr := p.ParseExpr()
 		exprs = append(exprs, expr)
-		if p.current().Kind != PUNC_RSQUARE {
+		if p.current().Kind != end {
 			p.eat(PUNC_COMMA)
 		}
+		p.skipIfStuck(start)
 	}
+	return exprs
+}
+
+func (p *Parser) ParseArrExpr() ArrExpr {
+	p.eat(PUNC_LSQUARE)
+	exprs := p.parseElements(PUNC_RSQUARE)
 	p.eat(PUNC_RSQUARE)
 
 	arrExpr := ArrExpr{Exprs: exprs}
 	return arrExpr
 }
 
+// ParseFor parses `for i in 0..n { a, b }`, the body is a list of elements
+// like the ones of an array
+func (p *Parser) ParseFor() Expr {
+	_, tok := p.eat(KW_FOR)
+	_, varTok := p.eat(KW_ID)
+	p.eat(KW_IN)
+	from := p.ParseTerm()
+	p.eat(PUNC_RANGE)
+	to := p.ParseTerm()
+	p.eat(PUNC_LCURLY)
+	body := p.parseElements(PUNC_RCURLY)
+	p.eat(PUNC_RCURLY)
+
+	return Expr{
+		Type: AST_FOR,
+		For:  &For{Var: varTok.Value, From: from, To: to, Body: ArrExpr{Exprs: body}, Span: tokenSpan(tok)},
+	}
+}
+
+// ParseExpr parses a full expression. From the loosest to the tightest
+// binding: c ? a : b, or, and, not, comparisons, + -, * /
 func (p *Parser) ParseExpr() Expr {
-	return p.ParseTerm()
+	return p.ParseTernary()
+}
+
+func (p *Parser) ParseTernary() Expr {
+	cond := p.ParseOr()
+	if p.current().Kind != PUNC_QUESTION {
+		return cond
+	}
+	_, tok := p.eat(PUNC_QUESTION)
+	then := p.ParseExpr()
+	p.eat(PUNC_COLON)
+	els := p.ParseTernary()
+
+	return Expr{
+		Type: AST_COND,
+		Cond: &Cond{Cond: cond, Then: then, Else: els, Span: tokenSpan(tok)},
+	}
+}
+
+func (p *Parser) ParseOr() Expr {
+	left := p.ParseAnd()
+
+	for p.current().Kind == KW_OR {
+		_, opTok := p.eat(KW_OR)
+		right := p.ParseAnd()
+		left = Expr{
+			Type:       AST_BINOP_LOGIC,
+			BinopLogic: &BinopLogic{Left: left, Right: right, Operator: opTok.Value, Span: tokenSpan(opTok)},
+		}
+	}
+
+	return left
+}
+
+func (p *Parser) ParseAnd() Expr {
+	left := p.ParseNot()
+
+	for p.current().Kind == KW_AND {
+		_, opTok := p.eat(KW_AND)
+		right := p.ParseNot()
+		left = Expr{
+			Type:       AST_BINOP_LOGIC,
+			BinopLogic: &BinopLogic{Left: left, Right: right, Operator: opTok.Value, Span: tokenSpan(opTok)},
+		}
+	}
+
+	return left
+}
+
+func (p *Parser) ParseNot() Expr {
+	if p.current().Kind != KW_NOT {
+		return p.ParseComparison()
+	}
+	_, tok := p.eat(KW_NOT)
+	operand := p.ParseNot()
+	return Expr{
+		Type:    AST_UNOP_NOT,
+		UnopNot: &UnopNot{Expr: operand, Span: tokenSpan(tok)},
+	}
+}
+
+// ParseComparison parses a single comparison, `a < b < c` has to be written
+// as `a < b and b < c`
+func (p *Parser) ParseComparison() Expr {
+	left := p.ParseTerm()
+	if p.current().Kind != PUNC_COMPARE {
+		return left
+	}
+	_, opTok := p.eat(PUNC_COMPARE)
+	right := p.ParseTerm()
+	if tok := p.current(); tok.Kind == PUNC_COMPARE {
+		p.fe.reportError(tokenSpan(tok), "comparisons can not be chained, use and")
+		p.err = true
+		for p.current().Kind == PUNC_COMPARE {
+			p.eat(PUNC_COMPARE)
+			p.ParseTerm()
+		}
+	}
+
+	return Expr{
+		Type:         AST_BINOP_COMPARE,
+		BinopCompare: &BinopCompare{Left: left, Right: right, Operator: opTok.Value, Span: tokenSpan(opTok)},
+	}
+}
+
+// ParseIf parses `if c { a } else { b }`, the else branch can be another if
+func (p *Parser) ParseIf() Expr {
+	_, tok := p.eat(KW_IF)
+	cond := p.ParseExpr()
+	p.eat(PUNC_LCURLY)
+	then := p.ParseExpr()
+	p.eat(PUNC_RCURLY)
+	p.eat(KW_ELSE)
+
+	var els Expr
+	if p.current().Kind == KW_IF {
+		els = p.ParseIf()
+	} else {
+		p.eat(PUNC_LCURLY)
+		els = p.ParseExpr()
+		p.eat(PUNC_RCURLY)
+	}
+
+	return Expr{
+		Type: AST_COND,
+		Cond: &Cond{Cond: cond, Then: then, Else: els, IfElse: true, Span: tokenSpan(tok)},
+	}
+}
+
+// isSignedNumber reports if the current token is a number with a sign, the
+// lexer reads `i-1` as i and -1
+func (p *Parser) isSignedNumber() bool {
+	tok := p.current()
+	return (tok.Kind == NUMBER_FLOAT || tok.Kind == NUMBER_INT) && (strings.HasPrefix(tok.Value, "-") || strings.HasPrefix(tok.Value, "+"))
 }
 
 func (p *Parser) ParseTerm() Expr {
 	left := p.ParseFactor()
 
-	for p.current().Kind == PUNC_PLUS || p.current().Kind == PUNC_SUB {
-		_, opTok := p.eat(p.current().Kind)
+	for p.current().Kind == PUNC_PLUS || p.current().Kind == PUNC_SUB || p.isSignedNumber() {
+		var opTok Token
+		if p.isSignedNumber() {
+			// split the sign off as the operator
+			tok := p.current()
+			opTok = Token{Kind: PUNC_SUB, Value: tok.Value[:1], Row: tok.Row, Col: tok.Col}
+			p.Tokens[p.token_idx].Value = tok.Value[1:]
+			p.Tokens[p.token_idx].Col++
+		} else {
+			_, opTok = p.eat(p.current().Kind)
+		}
 		right := p.ParseFactor()
 
 		binopTerm := BinopTerm{
 			Left:     left,
 			Right:    right,
 			Operator: opTok.Value,
+			Span:     tokenSpan(opTok),
 		}
 
 		left = Expr{
@@ -242,6 +480,7 @@ func (p *Parser) ParseFactor() Expr {
 			Left:     left,
 			Right:    right,
 			Operator: opTok.Value,
+			Span:     tokenSpan(opTok),
 		}
 
 		left = Expr{
@@ -253,10 +492,33 @@ func (p *Parser) ParseFactor() Expr {
 	return left
 }
 
+// ParseAnnotated parses an annotated literal like `@tweak 1.5` or `@tweak (0, 1, 0)`
+func (p *Parser) ParseAnnotated() Expr {
+	_, tok := p.eat(ANNOTATION)
+	if tok.Value != "@tweak" {
+		p.fe.reportError(tokenSpan(tok), "unknown annotation %s", tok.Value)
+		p.err = true
+	}
+
+	expr := p.ParsePrimary()
+	switch expr.Type {
+	case AST_NUMBER:
+		expr.Number.Tweak = true
+	case AST_TUPLE:
+		expr.Tuple.Tweak = true
+	default:
+		p.fe.reportError(tokenSpan(tok), "%s can only be applied to a number or a tuple", tok.Value)
+		p.err = true
+	}
+	return expr
+}
+
 func (p *Parser) ParsePrimary() Expr {
 	expr := Expr{}
 
-	if p.current().Kind == NUMBER_FLOAT {
+	if p.current().Kind == ANNOTATION {
+		return p.ParseAnnotated()
+	} else if p.current().Kind == NUMBER_FLOAT || p.current().Kind == NUMBER_INT {
 		number := p.ParseNumber()
 		expr.Number = &number
 		expr.Type = AST_NUMBER
@@ -266,13 +528,14 @@ func (p *Parser) ParsePrimary() Expr {
 			expr.Type = AST_FUN_CALL
 			expr.FunCall = &funcCall
 		} else {
-			// TODO: check a symbol table if a variable created
+			// loop variables are resolved by Analyze
+			_, tok := p.eat(KW_ID)
+			expr.Type = AST_VAR
+			expr.Var = &Var{Name: tok.Value, Span: tokenSpan(tok)}
 		}
 	} else if p.current().Kind == PUNC_LPAREN {
 		if p.isTuple() {
-			tuple := p.ParseTuple()
-			expr.Type = AST_TUPLE // RuleType(int(AST_TUPLE) + len(tuple.Values))
-			expr.Tuple = &tuple
+			expr = p.ParseTuple()
 		} else {
 			// Handle parenthesized expressions
 			p.eat(PUNC_LPAREN)
@@ -284,10 +547,33 @@ func (p *Parser) ParsePrimary() Expr {
 				expr.HasParentheses = true
 			}
 		}
+	} else if p.current().Kind == STRING {
+		_, tok := p.eat(STRING)
+		expr.Type = AST_STRING
+		expr.String = &String{Value: strings.Trim(tok.Value, `"`), Span: tokenSpan(tok)}
+	} else if p.current().Kind == KW_TRUE || p.current().Kind == KW_FALSE {
+		_, tok := p.eatOneOf(KW_TRUE, KW_FALSE)
+		expr.Type = AST_BOOL
+		expr.Bool = &Bool{Value: tok.Kind == KW_TRUE, Span: tokenSpan(tok)}
+	} else if p.current().Kind == KW_IF {
+		expr = p.ParseIf()
+	} else if p.current().Kind == KW_FOR {
+		expr = p.ParseFor()
 	} else if p.current().Kind == PUNC_LSQUARE {
 		arrExpr := p.ParseArrExpr()
 		expr.ArrExpr = &arrExpr
 		expr.Type = AST_ARR_EXPR
+	} else if p.current().Kind == PUNC_SUB {
+		// only number literals carry a sign
+		p.syntaxError(p.current(), "unary minus needs a number, write -1 * x instead of -x")
+	} else if tok := p.current(); tok.Kind == EOF {
+		p.syntaxError(tok, "unexpected end of input")
+	} else {
+		p.syntaxError(tok, "unexpected token %s", tok.Value)
+		// a closing token still ends the enclosing construct
+		if !slices.Contains([]TokenType{PUNC_RPAREN, PUNC_RSQUARE, PUNC_RCURLY, PUNC_COMMA}, tok.Kind) {
+			p.token_idx++
+		}
 	}
 
 	return expr
@@ -313,9 +599,7 @@ func (p *Parser) Parse() Program {
 
 	expr := p.ParseExpr()
 
-	if !p.err {
-		println("DONE!")
-	}
+	Tracef(TRACE_PARSER, "done statements=%d error=%t", len(stmts), p.err)
 
 	program := Program{Type: AST_PROGRAM, Expr: expr, Stmts: stmts}
 	return program
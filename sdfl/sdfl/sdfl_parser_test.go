@@ -0,0 +1,31 @@
+package sdfl
+
+import "testing"
+
+func TestSyntaxErrors(t *testing.T) {
+	for _, tc := range []struct {
+		src      string
+		want     string // the only diagnostic
+		row, col int
+	}{
+		{sceneWith("sphere(radius: -time())"), "unary minus needs a number, write -1 * x instead of -x", 1, 70},
+		{sceneWith("sphere(radius: *)"), "unexpected token *", 1, 70},
+		{sceneWith("sphere(radius: )"), "unexpected token )", 1, 70},
+		// every open call and list misses its end, the first one is reported
+		{"scene(camera: camera(position: (0, 0, 5)), children: [sphere(radius: 1\n\n", "expected PUNC_COMMA but got EOF", 1, 71},
+		{"scene(camera: camera(position: (0, 0, 5)), children: [sphere(radius: \n", "unexpected end of input", 1, 69},
+	} {
+		diagnostics := diagnosticsOf(tc.src)
+		if len(diagnostics) != 1 || diagnostics[0].Message != tc.want {
+			t.Errorf("%q: diagnostics %v, want %q", tc.src, diagnostics, tc.want)
+			continue
+		}
+		if d := diagnostics[0]; d.Row != tc.row || d.Col != tc.col {
+			t.Errorf("%q: reported at %d:%d, want %d:%d", tc.src, d.Row, d.Col, tc.row, tc.col)
+		}
+	}
+
+	if diagnostics := diagnosticsOf(sceneWith("sphere(radius: -1 * time())")); len(diagnostics) != 0 {
+		t.Errorf("negative literal: diagnostics %v", diagnostics)
+	}
+}
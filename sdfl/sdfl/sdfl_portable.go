@@ -0,0 +1,135 @@
+package sdfl
+
+// portable shaders
+//
+// The GLSL ES, WGSL, HLSL, Metal and Shadertoy backends share one GLSL
+// shader, which is parsed and printed in their language (see the shader
+// trees). It has the builtin library and the raymarcher of the desktop
+// shaders, but only a plain camera and no render modes, editor plane or
+// textures. Scene and function children push to a local buffer instead of a
+// global one: a call of a user defined function only sees its own children,
+// like in the evaluator.
+
+type portableBackend struct {
+	name string
+	file string
+	lang shaderLanguage
+	// the shader can not declare uniforms, only read the inputs of its host
+	fixedInputs bool
+}
+
+func (backend *portableBackend) Name() string {
+	return backend.name
+}
+
+func (backend *portableBackend) Uniforms() []ShaderUniform {
+	return portableUniforms
+}
+
+func (backend *portableBackend) Generate(prog *Program) []ShaderFile {
+	prog.generatePortable()
+	source := GetFragmentCode()
+	Reset()
+	if HasErrors() {
+		return nil
+	}
+	if backend.fixedInputs && len(tweakUniforms) > 0 {
+		literal := tweakUniforms[0]
+		reportError(Span{Row: literal.Row, Col: literal.Col, Len: literal.Len}, "%s: tweaked literals need uniforms, which %s shaders can not declare", backend.name, backend.name)
+		return nil
+	}
+
+	shader, err := parseShader(source)
+	if err != nil {
+		reportError(Span{}, "%s: the generated shader does not parse: %v", backend.name, err)
+		return nil
+	}
+	if shaderOptimization {
+		shader.Reachable("sdfl_Render")
+	}
+	return []ShaderFile{{Stage: "fragment", Name: backend.file, Code: printShader(backend.lang, shader)}}
+}
+
+// generatePortable generates the GLSL of the portable shaders to the fragment shader
+func (prog *Program) generatePortable() {
+	Reset()
+	resetTweaks()
+	glslFloatNumbers = true
+	defer func() { glslFloatNumbers = false }()
+	generatedRenderModes = map[string]bool{"normal": true}
+
+	generateFragmentCode("%s", glslSceneStructs)
+	generateFragmentCode(`
+const int SDFL_MAX_STEPS = 100;
+const float SDFL_MAX_DISTANCE = 100.;
+const float SDFL_HIT_DISTANCE = .01;
+const float SDFL_SHADOW_CAST_DISTANCE = .05;
+
+`)
+	generateFragmentCode("%s", glslUniforms(portableUniforms))
+	tweakInsertFragment = len(generatedCodeFragmentShader)
+	tweakInsertCompute = len(generatedCodeComputeShader)
+	generateFragmentCode("%s", glslBuiltinLibrary)
+	generateFragmentCode("%s", glslFragmentTime)
+	generateFragmentCode("%s", glslAnimLibrary())
+	generateFragmentCode("%s", glslGetMaterial(false))
+
+	cameraCall, childrenArr, background, ok := sceneParts(prog)
+	if !ok {
+		return
+	}
+	for _, stmt := range prog.Stmts {
+		if stmt.Type != AST_FUN_DEF {
+			reportError(Span{}, "unknown stmt type: %v", stmt.Type)
+			continue
+		}
+		childrenArr, ok := stmt.FunDef.localChildren()
+		if !ok {
+			continue
+		}
+		generateFragmentCode("\nSceneResult %s(vec3 p) {\n", stmt.FunDef.Id)
+		generatePortableChildren(childrenArr.Exprs)
+		generateFragmentCode("    return best;\n}\n")
+	}
+
+	generateFragmentCode("\nSceneResult sdfl_GetDistScene(vec3 p) {\n")
+	generatePortableChildren(childrenArr.Exprs)
+	generateFragmentCode("    return best;\n}\n")
+
+	generateFragmentCode("%s", glslRaymarchEngine)
+	bounces := sceneBounces(prog.Expr.FunCall)
+	generateFragmentCode("%s", glslTraceEngine(bounces))
+	post := scenePost(prog.Expr.FunCall)
+	generateFragmentCode("%s", glslPostLibrary(post))
+	position := cameraCall.ArgExpr("position")
+	generateFragmentCode(`
+vec4 sdfl_Render(vec2 vertex_uv) {
+    vec3 cam_pos = %s;
+    vec2 uv = vertex_uv * 2. - 1.;
+    uv.y *= float(window_size.y) / float(window_size.x);
+    vec3 ray_dir = normalize(vec3(uv, -1));
+
+    SceneResult result = sdfl_RayMarch(cam_pos, ray_dir);
+    vec3 color = mix(vec3(0.5, 0.7, 1.0), %s, uv.y * 0.5 + 0.5);
+    if (result.distance < SDFL_MAX_DISTANCE) {
+        vec3 p = cam_pos + ray_dir * result.distance;
+        color = %s;
+    }
+%s    return vec4(color, 1.0);
+}
+`, glslValue(lowerExpr(&position)), background, glslShading(bounces, "-ray_dir", "sdfl_GetMaterial(result.materialId)", background), glslPostEffects(post, "cam_pos"))
+	generateGlslTweakUniforms()
+}
+
+// generatePortableChildren pushes the children to the local buffer best,
+// keeping the closer of two results like sdfl_builtin_union
+func generatePortableChildren(exprs []Expr) {
+	// bindings of other functions are not visible
+	glslScopes = []map[string]string{{}}
+	generateFragmentCode("    SceneResult best = SceneResult(SDFL_MAX_DISTANCE, 0);\n")
+	generateCulledChildren(exprs, "p", "best.distance", func(expr *Expr) {
+		if shape := lowerShape(expr); shape != nil {
+			generateCodeBoth("    best = sdfl_builtin_union(%s, best);\n", glslShape(shape, "p"))
+		}
+	})
+}
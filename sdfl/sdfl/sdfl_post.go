@@ -0,0 +1,212 @@
+package sdfl
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// post processing
+//
+// The post argument of scene is a list of effects, calc_color applies them in
+// order to the lit color of a pixel: fog, ambientOcclusion, toneMap, gamma,
+// vignette and bloom. Effects see the sky as well, except ambient occlusion,
+// which samples the distance of the scene along the normal of the surface a
+// ray hit, five times by default like the classic one of Inigo Quilez. A
+// single pass has no neighbouring pixels, so bloom only lets the part of a
+// color above its threshold glow on the pixel itself.
+
+var toneMapCurves = []string{"aces", "reinhard"}
+
+// ambient occlusion takes at most this many samples
+const maxOcclusionSamples = 16
+
+// GLSL of the effects, keyed by the name postFunction returns
+var glslPostFunctions = map[string]string{
+	"sdfl_post_fog": `
+vec3 sdfl_post_fog(vec3 color, float dist, float density, vec3 fog_color) {
+    return mix(color, fog_color, 1. - exp(-density * dist));
+}
+`,
+	"sdfl_post_ambientOcclusion": fmt.Sprintf(`
+vec3 sdfl_post_ambientOcclusion(vec3 color, vec3 p, float samples, float strength) {
+    vec3 normal = sdfl_GetNormal(p);
+    float occlusion = 0.;
+    float falloff = 1.;
+    for (int i = 0; i < %d; i++) {
+        if (float(i) >= samples) {
+            break;
+        }
+        float h = .01 + .12 * float(i) / max(samples - 1., 1.);
+        float d = sdfl_GetDistScene(p + normal * h).distance;
+        occlusion += (h - d) * falloff;
+        falloff *= .95;
+    }
+    return color * mix(1., clamp(1. - 3. * occlusion, 0., 1.), strength);
+}
+`, maxOcclusionSamples),
+	"sdfl_post_toneMap_aces": `
+// fit of the ACES filmic curve by Krzysztof Narkowicz
+vec3 sdfl_post_toneMap_aces(vec3 color) {
+    return clamp(color * (2.51 * color + .03) / (color * (2.43 * color + .59) + .14), 0., 1.);
+}
+`,
+	"sdfl_post_toneMap_reinhard": `
+vec3 sdfl_post_toneMap_reinhard(vec3 color) {
+    return color / (color + 1.);
+}
+`,
+	"sdfl_post_gamma": `
+vec3 sdfl_post_gamma(vec3 color, float value) {
+    return pow(max(color, 0.), vec3(1. / value));
+}
+`,
+	"sdfl_post_vignette": `
+vec3 sdfl_post_vignette(vec3 color, vec2 uv, float strength, float radius) {
+    float v = max(length(uv) - radius, 0.);
+    return color * max(1. - strength * v * v, 0.);
+}
+`,
+	"sdfl_post_bloom": `
+vec3 sdfl_post_bloom(vec3 color, float threshold, float intensity) {
+    return color + max(color - threshold, 0.) * intensity;
+}
+`,
+}
+
+// scenePost returns the effects of the post list of a scene, the list is checked by analyzeScenePost
+func scenePost(sceneCall *FunCall) []*FunCall {
+	post, ok := sceneCall.Arg("post")
+	if !ok || post.Expr.Type != AST_ARR_EXPR {
+		return nil
+	}
+	effects := []*FunCall{}
+	for _, effect := range post.Expr.ArrExpr.Exprs {
+		if effect.Type == AST_FUN_CALL && ReturnKind(effect.FunCall.Id) == ARG_EFFECT {
+			effects = append(effects, effect.FunCall)
+		}
+	}
+	return effects
+}
+
+// analyzeScenePost checks that the post list of a call to scene only holds effects
+func (fe *Frontend) analyzeScenePost(sceneCall *FunCall) {
+	post, ok := sceneCall.Arg("post")
+	if !ok {
+		return
+	}
+	if post.Expr.Type != AST_ARR_EXPR {
+		fe.reportError(post.Span, "post of scene has to be a list of effects like [fog(), gamma()]")
+		return
+	}
+	for i := range post.Expr.ArrExpr.Exprs {
+		effect := &post.Expr.ArrExpr.Exprs[i]
+		if effect.Type != AST_FUN_CALL || fe.functions.returnKind(effect.FunCall.Id) != ARG_EFFECT {
+			fe.reportError(post.Span, "an effect of post is a call like fog(), got a %s", argKindToString(fe.functions.exprKind(effect)))
+		}
+	}
+}
+
+// analyzePost checks the arguments of a post effect
+func (fe *Frontend) analyzePost(funCall *FunCall) {
+	fe.analyzeArgKinds(funCall)
+	curve, ok := funCall.Arg("curve")
+	if !ok {
+		return
+	}
+	if curve.Expr.Type != AST_STRING {
+		fe.reportError(curve.Span, "curve of toneMap has to be a string like \"aces\"")
+	} else if !slices.Contains(toneMapCurves, curve.Expr.String.Value) {
+		fe.reportError(curve.Expr.String.Span, "unknown tone map curve %q, expected one of %s", curve.Expr.String.Value, strings.Join(toneMapCurves, ", "))
+	}
+}
+
+// postFunction is the GLSL function applying effect
+func postFunction(effect *FunCall) string {
+	if effect.Id == "toneMap" {
+		return "sdfl_post_toneMap_" + effect.ArgExpr("curve").String.Value
+	}
+	return "sdfl_post_" + effect.Id
+}
+
+// glslPostLibrary returns the functions of the effects, after the raymarcher
+// as ambient occlusion samples the scene
+func glslPostLibrary(effects []*FunCall) string {
+	code := ""
+	generated := map[string]bool{}
+	for _, effect := range effects {
+		name := postFunction(effect)
+		if !generated[name] {
+			generated[name] = true
+			code += glslPostFunctions[name]
+		}
+	}
+	return code
+}
+
+// glslPostEffects applies the effects to color in calc_color, result is the
+// marched ray starting at origin and uv the position on the screen
+func glslPostEffects(effects []*FunCall, origin string) string {
+	code := ""
+	for _, effect := range effects {
+		funDef := functionSymbols[effect.Id]
+		args := []string{"color"}
+		switch effect.Id {
+		case "toneMap":
+			code += fmt.Sprintf("    color = %s(color);\n", postFunction(effect))
+			continue
+		case "fog":
+			args = append(args, "result.distance")
+		case "ambientOcclusion":
+			args = append(args, fmt.Sprintf("%s + ray_dir * result.distance", origin))
+		case "vignette":
+			args = append(args, "uv")
+		}
+		exprs, ok := orderedArgs(effect, &funDef)
+		if !ok {
+			continue
+		}
+		for _, expr := range exprs {
+			args = append(args, glslValue(lowerExpr(expr)))
+		}
+		call := fmt.Sprintf("color = %s(%s);", postFunction(effect), strings.Join(args, ", "))
+		if effect.Id == "ambientOcclusion" {
+			// the sky has no surface to occlude
+			code += fmt.Sprintf("    if (result.distance < SDFL_MAX_DISTANCE) {\n        %s\n    }\n", call)
+		} else {
+			code += fmt.Sprintf("    %s\n", call)
+		}
+	}
+	if code != "" {
+		code = "\n    // post processing\n" + code
+	}
+	return code
+}
+
+// PostEffect is an effect of the post list of a scene compiled for the CPU
+type PostEffect struct {
+	Name  string // fog, ambientOcclusion, toneMap, gamma, vignette or bloom
+	Curve string // curve of toneMap
+	args  map[string]valueEval
+}
+
+// Arg is the value of an argument of the effect at the given time in seconds
+func (effect *PostEffect) Arg(name string, time float64) [3]float64 {
+	return effect.args[name](evalEnv{time: time})
+}
+
+func (c *evalCompiler) post(sceneCall *FunCall) []PostEffect {
+	effects := []PostEffect{}
+	for _, funCall := range scenePost(sceneCall) {
+		effect := PostEffect{Name: funCall.Id, args: map[string]valueEval{}}
+		for _, name := range functionSymbols[funCall.Id].FunDefArgNames {
+			if name == "curve" {
+				effect.Curve = funCall.ArgExpr(name).String.Value
+			} else {
+				effect.args[name] = c.arg(funCall, name)
+			}
+		}
+		effects = append(effects, effect)
+	}
+	return effects
+}
@@ -0,0 +1,132 @@
+package sdfl
+
+import "fmt"
+
+// reflections and refraction
+//
+// With the bounces argument of scene, calc_color follows the rays that
+// surfaces reflect or let through for up to that many bounces. Shapes pick
+// their material with the material argument, see analyzeMaterial. Reflective
+// materials bounce the ray off their surface, metallic ones tint the
+// reflection with their albedo. Transparent materials refract it into the
+// shape, where the ray is marched with the negated distance until it leaves
+// through the other side, bent again by the index of refraction ior. A
+// transparent surface is not reflective as well, a ray only follows one path.
+// The part of a surface that is neither is lit as before. Without bounces,
+// the default, every pixel is one ray and its shadow ray like before.
+
+// scene(bounces:) is at most
+const maxBounces = 8
+
+// sceneBounces returns the bounces of the scene call, checked by analyzeBounces
+func sceneBounces(sceneCall *FunCall) int {
+	bounces, ok := sceneCall.Arg("bounces")
+	if !ok {
+		return 0
+	}
+	v, ok := evalConstFloat(&bounces.Expr)
+	if !ok {
+		return 0
+	}
+	return int(v)
+}
+
+// analyzeBounces checks that the bounces of a call to scene are a constant whole number
+func (fe *Frontend) analyzeBounces(sceneCall *FunCall) {
+	bounces, ok := sceneCall.Arg("bounces")
+	if !ok {
+		return
+	}
+	if v, ok := evalConstFloat(&bounces.Expr); !ok || v != float64(int(v)) || v < 0 || v > maxBounces {
+		fe.reportError(bounces.Span, "bounces of scene has to be a constant whole number from 0 to %d", maxBounces)
+	}
+}
+
+// glslShading returns the color of the surface ray_dir hit at p, lit or traced
+func glslShading(bounces int, viewDir string, mat string, background string) string {
+	if bounces == 0 {
+		return fmt.Sprintf("sdfl_CalculateLighting(p, %s, %s)", viewDir, mat)
+	}
+	return fmt.Sprintf("sdfl_Trace(p, ray_dir, %s, %s)", mat, background)
+}
+
+// glslTraceEngine follows the reflected and refracted rays, after the raymarcher
+func glslTraceEngine(bounces int) string {
+	if bounces == 0 {
+		return ""
+	}
+	return fmt.Sprintf(`
+SceneResult sdfl_RayMarchInside(vec3 ray_origin, vec3 ray_dir) {
+    // the distance is negative inside of a shape
+    float dfo = 0.;
+    SceneResult result = SceneResult(SDFL_MAX_DISTANCE, 0);
+
+    for (int i = 0; i < SDFL_MAX_STEPS; i++) {
+        vec3 p = ray_origin + ray_dir * dfo;
+
+        SceneResult scene = sdfl_GetDistScene(p);
+        dfo -= scene.distance;
+        result.materialId = scene.materialId;
+
+        if (dfo > SDFL_MAX_DISTANCE || -scene.distance < SDFL_HIT_DISTANCE) {
+            break;
+        }
+    }
+
+    result.distance = dfo;
+    return result;
+}
+
+vec3 sdfl_Trace(vec3 p, vec3 ray_dir, Material mat, vec3 background) {
+    vec3 color = vec3(0.);
+    vec3 throughput = vec3(1.);
+    bool inside = false;
+
+    for (int bounce = 0; bounce < %d; bounce++) {
+        vec3 normal = sdfl_GetNormal(p);
+        if (!inside) {
+            color += throughput * sdfl_CalculateLighting(p, -ray_dir, mat) * max(1. - mat.reflectivity - mat.transparency, 0.);
+        }
+
+        if (mat.transparency > 0.) {
+            // the normal facing the ray
+            vec3 n = inside ? -normal : normal;
+            vec3 refracted = refract(ray_dir, n, inside ? mat.ior : 1. / mat.ior);
+            if (dot(refracted, refracted) == 0.) {
+                // total internal reflection
+                ray_dir = reflect(ray_dir, n);
+                p += n * SDFL_SHADOW_CAST_DISTANCE;
+            } else {
+                if (!inside) {
+                    throughput *= mat.transparency * mat.albedo;
+                }
+                ray_dir = refracted;
+                p -= n * SDFL_SHADOW_CAST_DISTANCE;
+                inside = !inside;
+            }
+        } else if (mat.reflectivity > 0.) {
+            throughput *= mat.reflectivity * mix(vec3(1.), mat.albedo, mat.metallic);
+            ray_dir = reflect(ray_dir, normal);
+            p += normal * SDFL_SHADOW_CAST_DISTANCE;
+        } else {
+            return color;
+        }
+
+        SceneResult result;
+        if (inside) {
+            result = sdfl_RayMarchInside(p, ray_dir);
+        } else {
+            result = sdfl_RayMarch(p, ray_dir);
+        }
+        if (result.distance >= SDFL_MAX_DISTANCE) {
+            return color + throughput * mix(vec3(0.5, 0.7, 1.0), background, ray_dir.y * 0.5 + 0.5);
+        }
+        p += ray_dir * result.distance;
+        mat = sdfl_GetMaterial(result.materialId);
+    }
+
+    // out of bounces, the last surface is lit like an opaque one
+    return color + throughput * sdfl_CalculateLighting(p, -ray_dir, mat);
+}
+`, bounces)
+}
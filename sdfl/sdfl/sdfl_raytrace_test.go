@@ -0,0 +1,78 @@
+package sdfl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShapeMaterials(t *testing.T) {
+	prog := parseFile(t, "reflections.sdfl")
+	scene := CompileEval(&prog)
+	if scene == nil {
+		t.Fatalf("compile: %v", GetDiagnostics())
+	}
+	if scene.Bounces != 4 {
+		t.Errorf("bounces = %d, want 4", scene.Bounces)
+	}
+	for _, tc := range []struct {
+		p    [3]float64
+		want string
+	}{
+		{[3]float64{0, -1, 3}, "default"},
+		{[3]float64{-1.2, 0, 1}, "mirror"},
+		{[3]float64{1.2, 0, 1}, "glass"},
+	} {
+		s := scene.Distance(tc.p, 0)
+		if got := MaterialById(s.MaterialId).Name; got != tc.want {
+			t.Errorf("material at %v = %s, want %s", tc.p, got, tc.want)
+		}
+	}
+}
+
+func TestFunctionMaterials(t *testing.T) {
+	prog := parseSource(t, `def gem() {
+  local(children: [sphere(radius: 1, material: "glass")])
+}
+scene(camera: camera(position: (0, 0, 5)), children: [gem()], bounces: 2)`)
+	scene := CompileEval(&prog)
+	if scene == nil {
+		t.Fatalf("compile: %v", GetDiagnostics())
+	}
+	if got := MaterialById(scene.Distance([3]float64{0, 0, 1}, 0).MaterialId).Name; got != "glass" {
+		t.Errorf("material in a function = %s, want glass", got)
+	}
+	fragment := generateTarget(t, &prog, "glsl430")[0].Code
+	for _, want := range []string{"SceneResult gem(vec3 p)", "SceneResult(sdfl_builtin_sphere(p, vec3(0, 0, 0), 1), 5)"} {
+		if !strings.Contains(fragment, want) {
+			t.Errorf("fragment shader lacks %q", want)
+		}
+	}
+}
+
+func TestTraceGenerated(t *testing.T) {
+	prog := parseFile(t, "reflections.sdfl")
+	for _, name := range TargetNames() {
+		code := generateTarget(t, &prog, name)[0].Code
+		if !strings.Contains(code, "sdfl_Trace") || !strings.Contains(code, "sdfl_RayMarchInside") {
+			t.Errorf("%s: the bounces of the scene are not traced", name)
+		}
+	}
+
+	prog = parseSource(t, `scene(camera: camera(position: (0, 0, 5)), children: [sphere(material: "mirror")])`)
+	if code := generateTarget(t, &prog, "glsl430")[0].Code; strings.Contains(code, "sdfl_Trace") {
+		t.Error("a scene without bounces is traced")
+	}
+}
+
+func TestMaterialErrors(t *testing.T) {
+	for src, want := range map[string]string{
+		`scene(camera: camera(), children: [sphere(material: "gold")])`:             `unknown material "gold"`,
+		`scene(camera: camera(), children: [sphere(material: 1)])`:                  "material of sphere has to be a string",
+		`scene(camera: camera(), children: [sphere()], bounces: 2.5)`:               "bounces of scene has to be a constant whole number",
+		`scene(camera: camera(), children: [union(sphere(), box(), material: "")])`: "function union has no argument material",
+	} {
+		if diagnostics := diagnosticsOf(src); len(diagnostics) == 0 || !strings.Contains(diagnostics[0].Message, want) {
+			t.Errorf("%s: got %v, want %q", src, diagnostics, want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package sdfl
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// render modes
+//
+// The fragment shader of the desktop runtime draws a scene in the modes
+// normal, anaglyph (red and cyan glasses) and vr (one view per eye, with the
+// lens distortion of a headset), the runtime picks one with render_mode.
+// Only the modes a scene asks for are generated, with the render argument of
+// scene like render: "normal,vr", or with SetRenderModes, which takes
+// precedence. A shader with a single mode does not switch, the lens
+// distortion and the editor plane come with vr.
+
+// the modes in the order of RENDER_MODE_*
+var renderModeNames = []string{"normal", "anaglyph", "vr"}
+
+// modes of SetRenderModes, nil when the scene decides
+var renderModesOverride map[string]bool
+
+// modes of the last generated fragment shader
+var generatedRenderModes = map[string]bool{}
+
+// parseRenderModes parses a comma separated list of render modes
+func parseRenderModes(list string) (map[string]bool, error) {
+	modes := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if !slices.Contains(renderModeNames, name) {
+			return nil, fmt.Errorf("unknown render mode %q, expected one of %s", name, strings.Join(renderModeNames, ", "))
+		}
+		modes[name] = true
+	}
+	return modes, nil
+}
+
+// SetRenderModes generates the comma separated modes for every scene, an
+// empty list lets the scenes decide again
+func SetRenderModes(list string) error {
+	if list == "" {
+		renderModesOverride = nil
+		return nil
+	}
+	modes, err := parseRenderModes(list)
+	if err != nil {
+		return err
+	}
+	renderModesOverride = modes
+	return nil
+}
+
+// GetRenderModes returns the modes of the last generated fragment shader
+func GetRenderModes() []string {
+	names := []string{}
+	for _, name := range renderModeNames {
+		if generatedRenderModes[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// sceneRenderModes returns the modes to generate for the scene call, the
+// argument is checked by analyzeScene
+func sceneRenderModes(sceneCall *FunCall) map[string]bool {
+	if renderModesOverride != nil {
+		return renderModesOverride
+	}
+	if render, ok := sceneCall.Arg("render"); ok && render.Expr.Type == AST_STRING {
+		if modes, err := parseRenderModes(render.Expr.String.Value); err == nil {
+			return modes
+		}
+	}
+	modes := map[string]bool{}
+	for _, name := range renderModeNames {
+		modes[name] = true
+	}
+	return modes
+}
+
+// analyzeScene checks the render modes of a call to scene
+func (fe *Frontend) analyzeScene(funCall *FunCall) {
+	render, ok := funCall.Arg("render")
+	if !ok {
+		return
+	}
+	if render.Expr.Type != AST_STRING {
+		fe.reportError(render.Span, "render of scene has to be a string like \"normal,vr\"")
+	} else if _, err := parseRenderModes(render.Expr.String.Value); err != nil {
+		fe.reportError(render.Expr.String.Span, "%v", err)
+	}
+}
+
+// LensProfile describes the optics of a headset for the vr render mode,
+// lengths are in meters
+type LensProfile struct {
+	Name           string
+	IPD            float64 // distance between the eyes, the cameras are this far apart
+	LensSeparation float64
+	ScreenWidth    float64
+	K1, K2         float64 // barrel distortion coefficients
+}
+
+var lensProfiles = []LensProfile{
+	// Google Cardboard style viewers
+	{Name: "cardboard", IPD: 0.064, LensSeparation: 0.064, ScreenWidth: 0.2, K1: 0.441, K2: 0.156},
+	// Oculus Rift DK1
+	{Name: "dk1", IPD: 0.064, LensSeparation: 0.0635, ScreenWidth: 0.14976, K1: 0.22, K2: 0.24},
+	// side by side without lenses, for 3D displays
+	{Name: "flat", IPD: 0.064, LensSeparation: 0.064, ScreenWidth: 0.2, K1: 0, K2: 0},
+}
+
+var lensProfile = lensProfiles[0]
+
+func LensProfileNames() []string {
+	names := []string{}
+	for _, profile := range lensProfiles {
+		names = append(names, profile.Name)
+	}
+	return names
+}
+
+func SetLensProfile(name string) error {
+	for _, profile := range lensProfiles {
+		if profile.Name == name {
+			lensProfile = profile
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown lens profile %s, expected one of %s", name, strings.Join(LensProfileNames(), ", "))
+}
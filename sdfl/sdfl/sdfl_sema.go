@@ -0,0 +1,266 @@
+package sdfl
+
+// semantic analysis
+//
+// Runs between parsing and code generation. Calls may leave out the optional
+// arguments of a signature, Analyze fills in their default values so the
+// generator always sees complete calls. The filled in arguments are marked
+// Implicit, the formatter and AST2Seq leave them out so sources and sequences
+// stay as they were written. Conditions have to be comparisons or logic
+// operations, numbers are not used as conditions.
+//
+// For loops are unrolled first: every loop in an array is replaced by copies
+// of its body with the loop variable substituted, vectors that became constant
+// are folded into tuples.
+
+import (
+	"math"
+	"slices"
+	"strings"
+)
+
+// UNROLL_LIMIT is the number of elements the loops of a program may produce
+const UNROLL_LIMIT = 10000
+
+// unroller replaces the loops of a program by copies of their bodies
+type unroller struct {
+	fe       *Frontend
+	count    int // elements produced by loops so far
+	exceeded bool
+}
+
+// expr substitutes the loop variables in scope and unrolls the loops in the arrays of expr
+func (u *unroller) expr(expr *Expr, scope map[string]float64) {
+	walkExpr(expr, func(e *Expr) bool {
+		switch e.Type {
+		case AST_VAR:
+			value, ok := scope[e.Var.Name]
+			if !ok {
+				u.fe.reportError(e.Var.Span, "unknown variable %s", e.Var.Name)
+				return false
+			}
+			// no span, the value is not a literal of the source
+			*e = Expr{Type: AST_NUMBER, Number: &Number{Value: formatNumber(value)}, HasParentheses: e.HasParentheses}
+		case AST_ARR_EXPR:
+			e.ArrExpr.Exprs = u.elements(e.ArrExpr.Exprs, scope)
+			return false
+		case AST_FOR:
+			u.fe.reportError(e.For.Span, "for loops are only allowed in arrays")
+			return false
+		}
+		return true
+	})
+}
+
+// elements unrolls the loops among the elements of an array
+func (u *unroller) elements(exprs []Expr, scope map[string]float64) []Expr {
+	unrolled := []Expr{}
+	for i := range exprs {
+		if exprs[i].Type == AST_FOR {
+			unrolled = append(unrolled, u.loop(exprs[i].For, scope)...)
+			continue
+		}
+		u.expr(&exprs[i], scope)
+		unrolled = append(unrolled, exprs[i])
+		if len(scope) > 0 {
+			u.count++
+		}
+	}
+	return unrolled
+}
+
+// loop returns a copy of the body of loop for every value of its variable
+func (u *unroller) loop(loop *For, scope map[string]float64) []Expr {
+	if _, ok := scope[loop.Var]; ok {
+		u.fe.reportError(loop.Span, "variable %s is already used by an enclosing loop", loop.Var)
+		return nil
+	}
+	u.expr(&loop.From, scope)
+	u.expr(&loop.To, scope)
+	from, okFrom := evalConstFloat(&loop.From)
+	to, okTo := evalConstFloat(&loop.To)
+	if !okFrom || !okTo {
+		u.fe.reportError(loop.Span, "the range of a for loop has to be constant")
+		return nil
+	}
+
+	unrolled := []Expr{}
+	for i := from; i < to; i++ {
+		if u.exceeded {
+			return nil
+		}
+		if math.Ceil(to-from) > UNROLL_LIMIT || u.count+len(loop.Body.Exprs) > UNROLL_LIMIT {
+			u.fe.reportError(loop.Span, "for loops produce more than %d elements", UNROLL_LIMIT)
+			u.exceeded = true
+			return nil
+		}
+		inner := map[string]float64{loop.Var: i}
+		for name, value := range scope {
+			inner[name] = value
+		}
+		unrolled = append(unrolled, u.elements(copyExprs(loop.Body.Exprs), inner)...)
+	}
+	return unrolled
+}
+
+// foldVec turns a vector whose values are all constant into a tuple, the
+// elements marked @tweak are not constant so their vector stays
+func foldVec(expr *Expr) {
+	values := []string{}
+	for i := range expr.Vec.Exprs {
+		v, ok := evalConstFloat(&expr.Vec.Exprs[i])
+		if !ok {
+			return
+		}
+		values = append(values, formatNumber(v))
+	}
+	*expr = Expr{Type: AST_TUPLE, Tuple: &Tuple{Values: values, Span: expr.Vec.Span}, HasParentheses: expr.HasParentheses}
+}
+
+// constantZero reports if expr is a constant zero or a constant vector with a
+// zero, tweaked literals are not constant
+func constantZero(expr *Expr) bool {
+	if v, ok := evalConstFloat(expr); ok {
+		return v == 0
+	}
+	if expr.Type == AST_TUPLE && expr.Tuple.Tweak {
+		return false
+	}
+	v, ok := evalConstVec3(expr)
+	return ok && (v[0] == 0 || v[1] == 0 || v[2] == 0)
+}
+
+// fillDefaults adds the default value of every optional argument funCall leaves
+// out and returns the names of the missing required ones
+func (fe *Frontend) fillDefaults(funCall *FunCall, implicit bool) []string {
+	signature, ok := fe.functions.signature(funCall.Id)
+	if !ok {
+		return nil
+	}
+	missing := []string{}
+	for _, arg := range signature {
+		if _, ok := funCall.Arg(arg.Name); ok {
+			continue
+		}
+		if !arg.Optional {
+			missing = append(missing, arg.Name)
+			continue
+		}
+		funCall.Args = append(funCall.Args, FunNamedArg{ArgName: arg.Name, Expr: DefaultArgExpr(arg), Span: funCall.Span, Implicit: implicit})
+	}
+	return missing
+}
+
+// checkOperand reports an operand of an operator that is not of the expected kind
+func (fe *Frontend) checkOperand(span Span, operator string, operand *Expr, expected ArgKind) {
+	if kind := fe.functions.exprKind(operand); !KindMatches(expected, kind) {
+		fe.reportError(span, "%s needs a %s, got a %s", operator, argKindToString(expected), argKindToString(kind))
+	}
+}
+
+// checkArgNames reports the arguments of funCall its function does not have
+func (fe *Frontend) checkArgNames(funCall *FunCall) {
+	funDef, ok := fe.functions[funCall.Id]
+	if !ok {
+		return
+	}
+	for _, arg := range funCall.Args {
+		if !slices.Contains(funDef.FunDefArgNames, arg.ArgName) {
+			fe.reportError(arg.Span, "function %s has no argument %s (expected %s)", funCall.Id, arg.ArgName, strings.Join(funDef.FunDefArgNames, ", "))
+		}
+	}
+}
+
+func (fe *Frontend) analyzeExpr(expr *Expr) {
+	walkExpr(expr, func(e *Expr) bool {
+		switch e.Type {
+		case AST_FUN_CALL:
+			if _, ok := fe.functions[e.FunCall.Id]; !ok {
+				fe.reportError(e.FunCall.Span, "function call %s is not defined", e.FunCall.Id)
+				return true
+			}
+			fe.checkArgNames(e.FunCall)
+			for _, name := range fe.fillDefaults(e.FunCall, true) {
+				fe.reportError(e.FunCall.Span, "function call %s, missing argument %s", e.FunCall.Id, name)
+			}
+			if e.FunCall.Id == "animate" {
+				// the keys are not vectors, analyzeAnimate checks them
+				fe.analyzeAnimate(e.FunCall)
+				return false
+			}
+			switch fe.functions[e.FunCall.Id].SymbolType {
+			case FUN_BUILTIN_ANIM, FUN_BUILTIN_OP, FUN_BUILTIN_ROTATE_AROUND, FUN_BUILTIN_LOCAL, FUN_BUILTIN_CAMERA:
+				fe.analyzeArgKinds(e.FunCall)
+			case FUN_BUILTIN_POST:
+				fe.analyzePost(e.FunCall)
+			case FUN_BUILTIN_SHAPE:
+				fe.analyzeArgKinds(e.FunCall)
+				fe.analyzeMaterial(e.FunCall)
+			case FUN_BUILTIN_SCENE:
+				fe.analyzeArgKinds(e.FunCall)
+				fe.analyzeScene(e.FunCall)
+				fe.analyzeScenePost(e.FunCall)
+				fe.analyzeBounces(e.FunCall)
+			}
+		case AST_BINOP_TERM:
+			fe.checkOperand(e.BinopTerm.Span, e.BinopTerm.Operator, &e.BinopTerm.Left, ARG_VALUE)
+			fe.checkOperand(e.BinopTerm.Span, e.BinopTerm.Operator, &e.BinopTerm.Right, ARG_VALUE)
+		case AST_BINOP_FACTOR:
+			fe.checkOperand(e.BinopFactor.Span, e.BinopFactor.Operator, &e.BinopFactor.Left, ARG_VALUE)
+			fe.checkOperand(e.BinopFactor.Span, e.BinopFactor.Operator, &e.BinopFactor.Right, ARG_VALUE)
+			if e.BinopFactor.Operator == "/" && constantZero(&e.BinopFactor.Right) {
+				fe.reportError(e.BinopFactor.Span, "division by zero")
+			}
+		case AST_BINOP_COMPARE:
+			fe.checkOperand(e.BinopCompare.Span, e.BinopCompare.Operator, &e.BinopCompare.Left, ARG_FLOAT)
+			fe.checkOperand(e.BinopCompare.Span, e.BinopCompare.Operator, &e.BinopCompare.Right, ARG_FLOAT)
+		case AST_BINOP_LOGIC:
+			fe.checkOperand(e.BinopLogic.Span, e.BinopLogic.Operator, &e.BinopLogic.Left, ARG_BOOL)
+			fe.checkOperand(e.BinopLogic.Span, e.BinopLogic.Operator, &e.BinopLogic.Right, ARG_BOOL)
+		case AST_UNOP_NOT:
+			fe.checkOperand(e.UnopNot.Span, "not", &e.UnopNot.Expr, ARG_BOOL)
+		case AST_VEC:
+			if len(e.Vec.Exprs) != 3 {
+				fe.reportError(e.Vec.Span, "a vector needs 3 values, got %d", len(e.Vec.Exprs))
+			}
+			for i := range e.Vec.Exprs {
+				fe.checkOperand(e.Vec.Span, "vector", &e.Vec.Exprs[i], ARG_FLOAT)
+			}
+			foldVec(e)
+		case AST_COND:
+			fe.checkOperand(e.Cond.Span, "conditional", &e.Cond.Cond, ARG_BOOL)
+			then, els := fe.functions.exprKind(&e.Cond.Then), fe.functions.exprKind(&e.Cond.Else)
+			if !KindMatches(then, els) {
+				fe.reportError(e.Cond.Span, "branches of the conditional differ, %s and %s", argKindToString(then), argKindToString(els))
+			}
+		}
+		return true
+	})
+}
+
+// Analyze unrolls the loops of prog, completes its calls with default
+// arguments, binds the parameters of user defined functions and reports the
+// calls of undefined functions, the required arguments that are missing and
+// operands of the wrong kind
+func Analyze(prog *Program) {
+	defaultFrontend.Analyze(prog)
+}
+
+func (fe *Frontend) Analyze(prog *Program) {
+	u := unroller{fe: fe}
+	analyze := func(expr *Expr) {
+		u.expr(expr, map[string]float64{})
+		fe.analyzeExpr(expr)
+	}
+	s := newSpecializer(fe, prog, analyze)
+	for _, stmt := range prog.Stmts {
+		// the bodies of functions with parameters are analyzed in their copies
+		if stmt.FunDef != nil && stmt.FunDef.Expr != nil && !s.hasParams(stmt.FunDef.Id) {
+			analyze(stmt.FunDef.Expr)
+			s.calls(stmt.FunDef.Expr)
+		}
+	}
+	analyze(&prog.Expr)
+	s.calls(&prog.Expr)
+	prog.Stmts = s.stmts(prog.Stmts)
+}
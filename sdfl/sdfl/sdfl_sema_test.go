@@ -0,0 +1,51 @@
+package sdfl
+
+import (
+	"strings"
+	"testing"
+)
+
+// sceneWith returns a scene with the children
+func sceneWith(children string) string {
+	return "scene(camera: camera(position: (0, 0, 5)), children: [" + children + "])"
+}
+
+func TestArgumentKinds(t *testing.T) {
+	for _, tc := range []struct {
+		children string
+		want     string // the only diagnostic, empty when the scene is fine
+	}{
+		{"box(size: 2)", "size of box needs a vec3, got a float"},
+		{"sphere(radius: (1, 2, 3))", "radius of sphere needs a float, got a vec3"},
+		{"torus(thickness: box())", "thickness of torus needs a float, got a shape"},
+		{"union(child1: 1, child2: box())", "child1 of union needs a shape, got a float"},
+		{"rotateAround(rotation: 45, child: box())", "rotation of rotateAround needs a vec3, got a float"},
+		{"local(children: [sphere()])", "children of scene needs shapes, element 1 is a local"},
+		{"1", "children of scene needs shapes, element 1 is a float"},
+		{"sphere(radius: box() * 2)", "* needs a float or vec3, got a shape"},
+		{"sphere(radius: 1 + (0, 1, 0))", "radius of sphere needs a float, got a vec3"},
+		{"box(size: (1, 1, 1) * 2)", ""},
+		{"box(size: 2 * (1, 1, 1) + 0.5)", ""},
+		{"sphere(radius: 1 + oscillate(amp: 0.5))", ""},
+		{"box(size: lerp(from: (1, 1, 1), to: (2, 2, 2), t: 0.5))", ""},
+	} {
+		src := sceneWith(tc.children)
+		found := []string{}
+		for _, d := range diagnosticsOf(src) {
+			found = append(found, d.Message)
+		}
+		if got := strings.Join(found, "\n"); got != tc.want {
+			t.Errorf("%s: diagnostics %q, want %q", tc.children, got, tc.want)
+		}
+	}
+
+	diagnostics := diagnosticsOf("def f() { local(children: [sphere(), 2]) }\n" + sceneWith("f()"))
+	if len(diagnostics) != 1 || diagnostics[0].Message != "children of local needs shapes, element 2 is a float" {
+		t.Errorf("function body: diagnostics %v", diagnostics)
+	}
+
+	diagnostics = diagnosticsOf("scene(camera: camera(position: 1), children: [box(size: 2)])")
+	if len(diagnostics) != 2 || diagnostics[0].Col != 22 || diagnostics[1].Col != 51 {
+		t.Errorf("diagnostics %v, want position of camera at 1:22 and size of box at 1:51", diagnostics)
+	}
+}
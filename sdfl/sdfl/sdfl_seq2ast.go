@@ -3,7 +3,9 @@ package sdfl
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -18,6 +20,16 @@ const (
 	SEQ_TYPE_LIT
 	SEQ_TYPE_LEFT
 	SEQ_TYPE_RIGHT
+	SEQ_TYPE_PARAM
+	SEQ_TYPE_PAREN_OPEN
+	SEQ_TYPE_PAREN_CLOSE
+	SEQ_TYPE_ANNOT
+	SEQ_TYPE_ARR_END
+	SEQ_TYPE_COND
+	SEQ_TYPE_THEN
+	SEQ_TYPE_ELSE
+	SEQ_TYPE_FROM
+	SEQ_TYPE_TO
 )
 
 func seqTypeToString(s SeqType) string {
@@ -36,18 +48,40 @@ func seqTypeToString(s SeqType) string {
 		return "SEQ_TYPE_LEFT"
 	case SEQ_TYPE_RIGHT:
 		return "SEQ_TYPE_RIGHT"
+	case SEQ_TYPE_PARAM:
+		return "SEQ_TYPE_PARAM"
+	case SEQ_TYPE_PAREN_OPEN:
+		return "SEQ_TYPE_PAREN_OPEN"
+	case SEQ_TYPE_PAREN_CLOSE:
+		return "SEQ_TYPE_PAREN_CLOSE"
+	case SEQ_TYPE_ANNOT:
+		return "SEQ_TYPE_ANNOT"
+	case SEQ_TYPE_ARR_END:
+		return "SEQ_TYPE_ARR_END"
+	case SEQ_TYPE_COND:
+		return "SEQ_TYPE_COND"
+	case SEQ_TYPE_THEN:
+		return "SEQ_TYPE_THEN"
+	case SEQ_TYPE_ELSE:
+		return "SEQ_TYPE_ELSE"
+	case SEQ_TYPE_FROM:
+		return "SEQ_TYPE_FROM"
+	case SEQ_TYPE_TO:
+		return "SEQ_TYPE_TO"
 	default:
 		return fmt.Sprintf("Unknown: SeqType(%d)", int(s))
 	}
 }
 
 type StackSeqObject struct {
-	SeqType  SeqType
-	RuleType *RuleType
-	Id       *string
-	BinopOp  *string
-	LitValue *string
-	Arity    int
+	SeqType    SeqType
+	RuleType   *RuleType
+	Id         *string
+	BinopOp    *string
+	LitValue   *string
+	Arity      int
+	Positional bool // arg line of an argument given without its name
+	Line       int  // line in the sequence, for error messages
 }
 
 func (s StackSeqObject) String() string {
@@ -80,8 +114,30 @@ func (s StackSeqObject) String() string {
 	return str
 }
 
+// Compact is the single line form of String used for tracing
+func (s StackSeqObject) Compact() string {
+	str := seqTypeToString(s.SeqType)
+	if s.RuleType != nil {
+		str += " rule=" + ruleTypeToString(*s.RuleType)
+	}
+	if s.Id != nil {
+		str += " id=" + *s.Id
+	}
+	if s.BinopOp != nil {
+		str += " op=" + *s.BinopOp
+	}
+	if s.LitValue != nil {
+		str += " lit=" + strconv.Quote(*s.LitValue)
+	}
+	if s.Arity != -1 {
+		str += " arity=" + strconv.Itoa(s.Arity)
+	}
+	return str
+}
+
 type Stack struct {
 	Objects []StackSeqObject
+	Version int
 }
 
 var _stack Stack
@@ -97,157 +153,472 @@ func (s *Stack) Push(obj StackSeqObject) {
 	s.Objects = append(s.Objects, obj)
 }
 
-func parseObject(objStrArr []string) StackSeqObject {
+func parseArity(field string) (int, error) {
+	a, err := strconv.Atoi(field)
+	if err != nil || a < 0 {
+		return 0, fmt.Errorf("invalid arity %q", field)
+	}
+	return a, nil
+}
+
+func parseObject(objStrArr []string) (StackSeqObject, error) {
 	var seqType SeqType
 	var ruleType *RuleType = nil
 	var id *string = nil
 	var binopOp *string = nil
 	var lit *string = nil
 	var arity int = -1
+	var positional bool
+	var err error
+
+	// expects checks the number of fields of the line
+	expects := func(n int) error {
+		if len(objStrArr) != n {
+			return fmt.Errorf("%q expects %d fields, got %d", strings.Join(objStrArr, ":"), n, len(objStrArr))
+		}
+		return nil
+	}
 
 	switch objStrArr[0] {
-	case "call":
+	case "call", "fundef":
+		if err := expects(3); err != nil {
+			return StackSeqObject{}, err
+		}
 		seqType = SEQ_TYPE_CALL
 		r := AST_FUN_CALL
+		if objStrArr[0] == "fundef" {
+			seqType = SEQ_TYPE_FUNDEF
+			r = AST_FUN_DEF
+		}
 		ruleType = &r
-		i := objStrArr[1]
-		id = &i
-		a, _ := strconv.ParseInt(objStrArr[2], 10, 64)
-		arity = int(a)
-	case "fundef":
-		seqType = SEQ_TYPE_FUNDEF
-		r := AST_FUN_DEF
-		ruleType = &r
-		i := objStrArr[1]
-		id = &i
-		a, _ := strconv.ParseInt(objStrArr[2], 10, 64)
-		arity = int(a)
+		id = &objStrArr[1]
+		arity, err = parseArity(objStrArr[2])
 	case "arg":
+		// arg:name, or arg:name:positional
 		seqType = SEQ_TYPE_ARG
-		i := objStrArr[1]
-		id = &i
+		if len(objStrArr) == 3 && objStrArr[2] == "positional" {
+			positional = true
+		} else {
+			err = expects(2)
+		}
+		if err == nil {
+			id = &objStrArr[1]
+		}
 		arity = 1
+	case "param":
+		// param:name, or param:name:default followed by the default value
+		seqType = SEQ_TYPE_PARAM
+		arity = 0
+		if len(objStrArr) == 3 && objStrArr[2] == "default" {
+			arity = 1
+		} else {
+			err = expects(2)
+		}
+		if err == nil {
+			id = &objStrArr[1]
+		}
+	case "annot":
+		err = expects(2)
+		seqType = SEQ_TYPE_ANNOT
+		if err == nil {
+			id = &objStrArr[1]
+		}
+	case "paren":
+		if err := expects(2); err != nil {
+			return StackSeqObject{}, err
+		}
+		switch objStrArr[1] {
+		case "open":
+			seqType = SEQ_TYPE_PAREN_OPEN
+		case "close":
+			seqType = SEQ_TYPE_PAREN_CLOSE
+		default:
+			err = fmt.Errorf("unknown paren %q", objStrArr[1])
+		}
 	case "val":
+		if len(objStrArr) < 2 {
+			return StackSeqObject{}, expects(2)
+		}
 		seqType = SEQ_TYPE_VAL
 		switch objStrArr[1] {
 		case "number":
+			err = expects(2)
 			r := AST_NUMBER
 			ruleType = &r
 			arity = 1
 		case "tuple":
+			err = expects(2)
 			r := AST_TUPLE
 			ruleType = &r
 			arity = 1
 		case "arr":
 			r := AST_ARR_EXPR
 			ruleType = &r
-			if objStrArr[2] == "begin" {
-				a, _ := strconv.ParseInt(objStrArr[3], 10, 64)
-				arity = int(a)
+			if len(objStrArr) == 4 && objStrArr[2] == "begin" {
+				arity, err = parseArity(objStrArr[3])
+			} else if len(objStrArr) == 3 && objStrArr[2] == "end" {
+				seqType = SEQ_TYPE_ARR_END
+			} else {
+				err = fmt.Errorf("invalid array line %q", strings.Join(objStrArr, ":"))
+			}
+		case "binopf", "binopt":
+			if err := expects(3); err != nil {
+				return StackSeqObject{}, err
+			}
+			r := AST_BINOP_TERM
+			if objStrArr[1] == "binopf" {
+				r = AST_BINOP_FACTOR
 			}
-		case "binopf":
-			r := AST_BINOP_FACTOR
 			ruleType = &r
 			binopOp = &objStrArr[2]
 			arity = 2
-		case "binopt":
-			r := AST_BINOP_TERM
+		case "cmp", "logic":
+			if err := expects(3); err != nil {
+				return StackSeqObject{}, err
+			}
+			r := AST_BINOP_COMPARE
+			ops := []string{"<", "<=", "==", "!=", ">", ">="}
+			if objStrArr[1] == "logic" {
+				r = AST_BINOP_LOGIC
+				ops = []string{"and", "or"}
+			}
+			if !slices.Contains(ops, objStrArr[2]) {
+				err = fmt.Errorf("unknown %s operator %q", objStrArr[1], objStrArr[2])
+			}
 			ruleType = &r
 			binopOp = &objStrArr[2]
 			arity = 2
+		case "not":
+			err = expects(2)
+			r := AST_UNOP_NOT
+			ruleType = &r
+			arity = 1
+		case "cond":
+			if err := expects(3); err != nil {
+				return StackSeqObject{}, err
+			}
+			if objStrArr[2] != "ternary" && objStrArr[2] != "if" {
+				err = fmt.Errorf("unknown conditional style %q", objStrArr[2])
+			}
+			r := AST_COND
+			ruleType = &r
+			id = &objStrArr[2]
+			arity = 3
+		case "vec":
+			if err := expects(3); err != nil {
+				return StackSeqObject{}, err
+			}
+			r := AST_VEC
+			ruleType = &r
+			arity, err = parseArity(objStrArr[2])
+		case "var", "for":
+			if err := expects(3); err != nil {
+				return StackSeqObject{}, err
+			}
+			r := AST_VAR
+			arity = 0
+			if objStrArr[1] == "for" {
+				r = AST_FOR
+				arity = 3
+			}
+			ruleType = &r
+			id = &objStrArr[2]
+		case "string", "bool":
+			if err := expects(3); err != nil {
+				return StackSeqObject{}, err
+			}
+			r := AST_STRING
+			if objStrArr[1] == "bool" {
+				r = AST_BOOL
+				if objStrArr[2] != "true" && objStrArr[2] != "false" {
+					err = fmt.Errorf("invalid bool %q", objStrArr[2])
+				}
+			}
+			ruleType = &r
+			id = &objStrArr[2]
+		default:
+			err = fmt.Errorf("unknown value type %q", objStrArr[1])
 		}
 
 	case "literal":
+		err = expects(2)
 		seqType = SEQ_TYPE_LIT
-		lit = &objStrArr[1]
+		if err == nil {
+			lit = &objStrArr[1]
+		}
 	case "left":
+		err = expects(1)
 		seqType = SEQ_TYPE_LEFT
 		arity = 1
 	case "right":
+		err = expects(1)
 		seqType = SEQ_TYPE_RIGHT
 		arity = 1
+	case "cond", "then", "else", "from", "to":
+		err = expects(1)
+		seqType = map[string]SeqType{"cond": SEQ_TYPE_COND, "then": SEQ_TYPE_THEN, "else": SEQ_TYPE_ELSE, "from": SEQ_TYPE_FROM, "to": SEQ_TYPE_TO}[objStrArr[0]]
+		arity = 1
 	default:
-		panic("unknown sequence type!")
+		err = fmt.Errorf("unknown sequence type %q", objStrArr[0])
+	}
+
+	obj := StackSeqObject{SeqType: seqType, RuleType: ruleType, Id: id, BinopOp: binopOp, LitValue: lit, Arity: arity, Positional: positional}
+
+	return obj, err
+}
+
+// seqDecoder turns the objects of a sequence back into an AST, it is the exact inverse of AST2Seq.
+// In repair mode it completes malformed sequences instead of failing, see sdfl_seq_repair.go
+type seqDecoder struct {
+	objects []StackSeqObject
+	pos     int
+	version int
+	repair  bool
+}
+
+func (d *seqDecoder) errorf(format string, args ...any) error {
+	if d.pos < len(d.objects) {
+		return fmt.Errorf("sequence line %d: %s", d.objects[d.pos].Line, fmt.Sprintf(format, args...))
+	}
+	return fmt.Errorf("sequence end: %s", fmt.Sprintf(format, args...))
+}
+
+// line is the sequence line of the next object, or the last line at the end
+func (d *seqDecoder) line() int {
+	if d.pos < len(d.objects) {
+		return d.objects[d.pos].Line
+	}
+	if len(d.objects) > 0 {
+		return d.objects[len(d.objects)-1].Line
+	}
+	return 0
+}
+
+// peek returns the next object, false at the end of the sequence
+func (d *seqDecoder) peek() (StackSeqObject, bool) {
+	if d.pos >= len(d.objects) {
+		return StackSeqObject{}, false
 	}
+	return d.objects[d.pos], true
+}
 
-	obj := StackSeqObject{SeqType: seqType, RuleType: ruleType, Id: id, BinopOp: binopOp, LitValue: lit, Arity: arity}
+// peekIs reports if the next object has the given type
+func (d *seqDecoder) peekIs(seqType SeqType) bool {
+	seq, ok := d.peek()
+	return ok && seq.SeqType == seqType
+}
 
-	return obj
+// peekExpression reports if an expression starts at the next object
+func (d *seqDecoder) peekExpression() bool {
+	seq, ok := d.peek()
+	if !ok {
+		return false
+	}
+	switch seq.SeqType {
+	case SEQ_TYPE_CALL, SEQ_TYPE_PAREN_OPEN, SEQ_TYPE_ANNOT:
+		return true
+	case SEQ_TYPE_VAL:
+		return true
+	}
+	return false
 }
 
-func Seq2AST() Program {
-	// process the stack from beginning to end (index 0 to len-1)
+// expect consumes the next object if it has the given type
+func (d *seqDecoder) expect(seqType SeqType, what string) (StackSeqObject, error) {
+	seq, ok := d.peek()
+	if !ok {
+		return seq, d.errorf("unexpected end of sequence, expected %s", what)
+	}
+	if seq.SeqType != seqType {
+		return seq, d.errorf("expected %s, got %s", what, seqTypeToString(seq.SeqType))
+	}
+	d.pos++
+	return seq, nil
+}
 
-	pos := 0
+func Seq2AST() (Program, error) {
+	d := seqDecoder{objects: _stack.Objects, version: _stack.Version, repair: seqRepair}
 	var stmts []Stmt
-	var mainExpr Expr
 
 	// Parse all top-level items (function definitions and main expression)
-	for pos < len(_stack.Objects) {
-		seq := _stack.Objects[pos]
-
-		if seq.SeqType == SEQ_TYPE_FUNDEF {
-			// Parse function definition
-			pos++
-			stmt := parseFunctionDefinition(seq, &pos)
-			stmts = append(stmts, stmt)
-		} else {
-			// Parse main expression (should be the scene call)
-			mainExpr = parseExpression(&pos)
-			break // Main expression should be the last thing
+	for d.peekIs(SEQ_TYPE_FUNDEF) {
+		seq, _ := d.peek()
+		d.pos++
+		stmt, err := d.parseFunctionDefinition(seq)
+		if err != nil {
+			if !d.repair {
+				return Program{}, err
+			}
+			repairf(seq.Line, "dropped function %s: %v", *seq.Id, err)
+			d.skipTo(SEQ_TYPE_FUNDEF)
+			continue
 		}
+		stmts = append(stmts, stmt)
 	}
 
-	return Program{
+	// Parse main expression (should be the scene call), it is the last thing
+	line, start := d.line(), d.pos
+	mainExpr, err := d.parseExpression()
+	if err != nil {
+		if !d.repair {
+			return Program{}, err
+		}
+		repairf(line, "replaced the missing scene expression: %v", err)
+		mainExpr = Expr{Type: AST_FUN_CALL, FunCall: &FunCall{Id: "scene"}}
+	}
+	if d.repair && d.pos < len(d.objects) && ExprKind(&mainExpr) != ARG_SCENE {
+		// the scene might follow the remains of a broken function definition
+		for i := d.pos; i < len(d.objects); i++ {
+			if d.objects[i].SeqType == SEQ_TYPE_CALL && *d.objects[i].Id == "scene" {
+				repairf(line, "dropped %d lines before the scene expression", i-start)
+				d.pos = i
+				mainExpr, _ = d.parseExpression()
+				break
+			}
+		}
+	}
+	if d.pos < len(d.objects) {
+		if !d.repair {
+			return Program{}, d.errorf("unexpected %s after the scene expression", seqTypeToString(d.objects[d.pos].SeqType))
+		}
+		repairf(d.line(), "ignored %d lines after the scene expression", len(d.objects)-d.pos)
+		d.pos = len(d.objects)
+	}
+
+	prog := Program{
 		Type:  AST_PROGRAM,
 		Stmts: stmts,
 		Expr:  mainExpr,
 	}
+	if d.repair {
+		repairProgram(&prog)
+	}
+	return prog, nil
 }
 
-func parseExpression(pos *int) Expr {
-	if *pos >= len(_stack.Objects) {
-		panic("Unexpected end of sequence")
+// skipTo moves to the next object of the given type or to the end
+func (d *seqDecoder) skipTo(seqType SeqType) {
+	for d.pos < len(d.objects) && d.objects[d.pos].SeqType != seqType {
+		d.pos++
 	}
+}
 
-	seq := _stack.Objects[*pos]
-	*pos++
+func (d *seqDecoder) parseExpression() (Expr, error) {
+	parentheses := false
+	if d.peekIs(SEQ_TYPE_PAREN_OPEN) {
+		parentheses = true
+		d.pos++
+	}
 
+	tweak := false
+	annotLine := 0
+	if seq, ok := d.peek(); ok && seq.SeqType == SEQ_TYPE_ANNOT {
+		d.pos++
+		if *seq.Id != "tweak" {
+			if !d.repair {
+				d.pos--
+				return Expr{}, d.errorf("unknown annotation %q", *seq.Id)
+			}
+			repairf(seq.Line, "dropped unknown annotation %q", *seq.Id)
+		} else {
+			tweak = true
+			annotLine = seq.Line
+		}
+	}
+
+	seq, ok := d.peek()
+	if !ok {
+		return Expr{}, d.errorf("unexpected end of sequence, expected call or val")
+	}
+	d.pos++
+
+	var expr Expr
+	var err error
 	switch seq.SeqType {
 	case SEQ_TYPE_CALL:
-		return parseFunctionCall(seq, pos)
+		expr, err = d.parseFunctionCall(seq)
 	case SEQ_TYPE_VAL:
-		return parseValue(seq, pos)
+		expr, err = d.parseValue(seq)
 	default:
-		panic(fmt.Sprintf("Expected call or val, got: %v", seq.SeqType))
+		d.pos--
+		return Expr{}, d.errorf("expected call or val, got %s", seqTypeToString(seq.SeqType))
+	}
+	if err != nil {
+		return Expr{}, err
 	}
-}
 
-func parseFunctionDefinition(fundefSeq StackSeqObject, pos *int) Stmt {
-	// Parse function arguments (if any)
-	argNames := make([]string, fundefSeq.Arity)
-	for i := 0; i < fundefSeq.Arity; i++ {
-		if *pos >= len(_stack.Objects) {
-			panic("Expected function argument")
+	if tweak {
+		switch expr.Type {
+		case AST_NUMBER:
+			expr.Number.Tweak = true
+		case AST_TUPLE:
+			expr.Tuple.Tweak = true
+		default:
+			if !d.repair {
+				return Expr{}, fmt.Errorf("sequence line %d: @tweak can only be applied to a number or a tuple", annotLine)
+			}
+			repairf(annotLine, "dropped @tweak of a %s", ruleTypeToString(expr.Type))
 		}
+	}
 
-		argSeq := _stack.Objects[*pos]
-		if argSeq.SeqType != SEQ_TYPE_ARG {
-			panic(fmt.Sprintf("Expected ARG for function parameter, got: %v", argSeq.SeqType))
+	if parentheses {
+		if d.peekIs(SEQ_TYPE_PAREN_CLOSE) {
+			d.pos++
+		} else if d.repair {
+			repairf(d.line(), "added missing paren:close")
+		} else {
+			_, err := d.expect(SEQ_TYPE_PAREN_CLOSE, "paren:close")
+			return Expr{}, err
 		}
+		expr.HasParentheses = true
+	}
+	return expr, nil
+}
 
-		argNames[i] = *argSeq.Id
-		*pos++
+func (d *seqDecoder) parseFunctionDefinition(fundefSeq StackSeqObject) (Stmt, error) {
+	// Parse function parameters (if any), version 1 writers used arg lines for them too
+	argNames := []string{}
+	var defaults map[string]Expr
+	for i := 0; i < fundefSeq.Arity; i++ {
+		seq, ok := d.peek()
+		if ok && d.version < 2 && seq.SeqType == SEQ_TYPE_ARG {
+			seq.SeqType = SEQ_TYPE_PARAM
+			seq.Arity = 0
+			d.objects[d.pos] = seq
+		}
+		if d.repair && !d.peekIs(SEQ_TYPE_PARAM) {
+			repairf(fundefSeq.Line, "function %s has %d of %d params", *fundefSeq.Id, i, fundefSeq.Arity)
+			break
+		}
+		argSeq, err := d.expect(SEQ_TYPE_PARAM, "param for function "+*fundefSeq.Id)
+		if err != nil {
+			return Stmt{}, err
+		}
+		argNames = append(argNames, *argSeq.Id)
+		if argSeq.Arity > 0 {
+			value, err := d.parseExpression()
+			if err != nil {
+				return Stmt{}, err
+			}
+			if defaults == nil {
+				defaults = map[string]Expr{}
+			}
+			defaults[*argSeq.Id] = value
+		}
 	}
 
 	// Parse function body expression
-	bodyExpr := parseExpression(pos)
+	bodyExpr, err := d.parseExpression()
+	if err != nil {
+		return Stmt{}, err
+	}
 
 	funDef := &FunDef{
 		Type:           AST_FUN_DEF,
 		Id:             *fundefSeq.Id,
 		SymbolType:     FUN_USER_DEFINED,
 		FunDefArgNames: argNames,
+		FunDefDefaults: defaults,
 		Expr:           &bodyExpr,
 	}
 	functionSymbols[*fundefSeq.Id] = *funDef
@@ -255,214 +626,486 @@ func parseFunctionDefinition(fundefSeq StackSeqObject, pos *int) Stmt {
 	return Stmt{
 		Type:   AST_FUN_DEF,
 		FunDef: funDef,
-	}
+	}, nil
 }
 
-func parseFunctionCall(callSeq StackSeqObject, pos *int) Expr {
+func (d *seqDecoder) parseFunctionCall(callSeq StackSeqObject) (Expr, error) {
 	funCall := &FunCall{
-		Id:           *callSeq.Id,
-		FunNamedArgs: make(map[string]FunNamedArg),
+		Id:   *callSeq.Id,
+		Args: []FunNamedArg{},
 	}
 
 	// Parse the specified number of arguments
 	for i := 0; i < callSeq.Arity; i++ {
-		// Next should be an ARG
-		if *pos >= len(_stack.Objects) {
-			panic("Expected argument in function call")
+		if d.repair && !d.peekIs(SEQ_TYPE_ARG) {
+			repairf(callSeq.Line, "closed call %s after %d of %d arguments", *callSeq.Id, i, callSeq.Arity)
+			break
 		}
-
-		argSeq := _stack.Objects[*pos]
-		if argSeq.SeqType != SEQ_TYPE_ARG {
-			panic(fmt.Sprintf("Expected ARG, got: %v at position %d", argSeq.SeqType, *pos))
+		argSeq, err := d.expect(SEQ_TYPE_ARG, "arg of "+*callSeq.Id)
+		if err != nil {
+			return Expr{}, err
 		}
-
 		argName := *argSeq.Id
-		*pos++
+		_, duplicate := funCall.Arg(argName)
+		if duplicate && !d.repair {
+			d.pos--
+			return Expr{}, d.errorf("duplicate argument %s of %s", argName, *callSeq.Id)
+		}
+		unknown := !hasArg(funCall.Id, argName)
+		if unknown && !d.repair {
+			d.pos--
+			return Expr{}, d.errorf("function %s has no argument %s", *callSeq.Id, argName)
+		}
+		positional := argSeq.Positional
+		if positional && !unknown && !positionalFits(funCall, argName) {
+			if !d.repair {
+				d.pos--
+				return Expr{}, d.errorf("argument %s of %s can not be positional here", argName, *callSeq.Id)
+			}
+			repairf(argSeq.Line, "gave the positional argument %s of %s its name", argName, *callSeq.Id)
+			positional = false
+		}
 
 		// Parse the argument value expression
-		argExpr := parseExpression(pos)
-
-		funCall.FunNamedArgs[argName] = FunNamedArg{
-			ArgName: argName,
-			Expr:    argExpr,
+		argExpr, err := d.parseExpression()
+		if err != nil {
+			if !d.repair {
+				return Expr{}, err
+			}
+			repairf(argSeq.Line, "dropped dangling argument %s of %s", argName, *callSeq.Id)
+			continue
+		}
+		if duplicate {
+			repairf(argSeq.Line, "dropped duplicate argument %s of %s", argName, *callSeq.Id)
+			continue
 		}
+		if unknown {
+			repairf(argSeq.Line, "dropped unknown argument %s of %s", argName, *callSeq.Id)
+			continue
+		}
+
+		funCall.Args = append(funCall.Args, FunNamedArg{
+			ArgName:    argName,
+			Expr:       argExpr,
+			Positional: positional,
+		})
 	}
 
+	if d.version < 3 {
+		// older sequences stored the arguments sorted by name
+		funCall.sortArgs(functionSymbols[funCall.Id].FunDefArgNames)
+	}
 	return Expr{
 		Type:    AST_FUN_CALL,
 		FunCall: funCall,
-	}
+	}, nil
+}
+
+// hasArg tells whether the function id has an argument called name, the
+// arguments of functions the sequence does not define are not checked here
+func hasArg(id string, name string) bool {
+	funDef, ok := functionSymbols[id]
+	return !ok || slices.Contains(funDef.FunDefArgNames, name)
 }
 
-func parseValue(valSeq StackSeqObject, pos *int) Expr {
-	if valSeq.RuleType == nil {
-		panic("Value sequence missing rule type")
+// positionalFits tells whether name can be the next argument of funCall
+// without its name, positional arguments come first in the order of the
+// function definition
+func positionalFits(funCall *FunCall, name string) bool {
+	for _, arg := range funCall.Args {
+		if !arg.Positional {
+			return false
+		}
 	}
+	argNames := functionSymbols[funCall.Id].FunDefArgNames
+	return len(funCall.Args) < len(argNames) && argNames[len(funCall.Args)] == name
+}
 
+func (d *seqDecoder) parseValue(valSeq StackSeqObject) (Expr, error) {
 	switch *valSeq.RuleType {
 	case AST_NUMBER:
-		return parseNumberValue(pos)
+		return d.parseNumberValue(valSeq)
 
 	case AST_TUPLE:
-		return parseTupleValue(pos)
+		return d.parseTupleValue(valSeq)
 
 	case AST_ARR_EXPR:
-		return parseArrayValue(valSeq, pos)
+		return d.parseArrayValue(valSeq)
+
+	case AST_BINOP_TERM, AST_BINOP_FACTOR, AST_BINOP_COMPARE, AST_BINOP_LOGIC:
+		return d.parseBinop(valSeq)
 
-	case AST_BINOP_TERM:
-		return parseBinaryTerm(valSeq, pos)
+	case AST_UNOP_NOT:
+		operand, err := d.parseExpression()
+		if err != nil {
+			return Expr{}, err
+		}
+		return Expr{Type: AST_UNOP_NOT, UnopNot: &UnopNot{Expr: operand}}, nil
 
-	case AST_BINOP_FACTOR:
-		return parseBinaryFactor(valSeq, pos)
+	case AST_COND:
+		return d.parseCond(valSeq)
+
+	case AST_VEC:
+		return d.parseVec(valSeq)
+
+	case AST_VAR:
+		return Expr{Type: AST_VAR, Var: &Var{Name: *valSeq.Id}}, nil
+
+	case AST_STRING:
+		return Expr{Type: AST_STRING, String: &String{Value: *valSeq.Id}}, nil
+
+	case AST_BOOL:
+		return Expr{Type: AST_BOOL, Bool: &Bool{Value: *valSeq.Id == "true"}}, nil
+
+	case AST_FOR:
+		return d.parseFor(valSeq)
 
 	default:
-		panic(fmt.Sprintf("Unknown value rule type: %v", *valSeq.RuleType))
+		return Expr{}, fmt.Errorf("sequence line %d: unknown value rule type %s", valSeq.Line, ruleTypeToString(*valSeq.RuleType))
 	}
 }
 
-func parseNumberValue(pos *int) Expr {
-	// Next should be a literal
-	if *pos >= len(_stack.Objects) {
-		panic("Expected literal for number")
+// parseLiteral consumes the literal of a number or tuple, in repair mode fallback is used when it is missing
+func (d *seqDecoder) parseLiteral(valSeq StackSeqObject, what string, fallback string) (string, error) {
+	if d.repair && !d.peekIs(SEQ_TYPE_LIT) {
+		repairf(valSeq.Line, "added missing literal %s for %s", fallback, what)
+		return fallback, nil
+	}
+	litSeq, err := d.expect(SEQ_TYPE_LIT, "literal for "+what)
+	if err != nil {
+		return "", err
 	}
+	return *litSeq.LitValue, nil
+}
 
-	litSeq := _stack.Objects[*pos]
-	if litSeq.SeqType != SEQ_TYPE_LIT {
-		panic(fmt.Sprintf("Expected literal for number, got: %v", litSeq.SeqType))
+func (d *seqDecoder) parseNumberValue(valSeq StackSeqObject) (Expr, error) {
+	value, err := d.parseLiteral(valSeq, "number", "0")
+	if err != nil {
+		return Expr{}, err
 	}
-	*pos++
 
 	return Expr{
 		Type:   AST_NUMBER,
-		Number: &Number{Value: *litSeq.LitValue},
-	}
+		Number: &Number{Value: value},
+	}, nil
 }
 
-func parseTupleValue(pos *int) Expr {
-	// Next should be a literal
-	if *pos >= len(_stack.Objects) {
-		panic("Expected literal for tuple")
-	}
-
-	litSeq := _stack.Objects[*pos]
-	if litSeq.SeqType != SEQ_TYPE_LIT {
-		panic(fmt.Sprintf("Expected literal for tuple, got: %v", litSeq.SeqType))
+func (d *seqDecoder) parseTupleValue(valSeq StackSeqObject) (Expr, error) {
+	tupleStr, err := d.parseLiteral(valSeq, "tuple", "(0, 0, 0)")
+	if err != nil {
+		return Expr{}, err
 	}
-	*pos++
 
 	// Parse tuple string like "(0, 0, 0)"
-	tupleStr := strings.Trim(*litSeq.LitValue, "()")
-	values := strings.Split(tupleStr, ",")
-	for i := range values {
-		values[i] = strings.TrimSpace(values[i])
+	if !strings.HasPrefix(tupleStr, "(") || !strings.HasSuffix(tupleStr, ")") {
+		if !d.repair {
+			return Expr{}, fmt.Errorf("sequence line %d: invalid tuple literal %q", valSeq.Line+1, tupleStr)
+		}
+		repairf(valSeq.Line+1, "added missing parentheses to tuple literal %q", tupleStr)
+		tupleStr = "(" + strings.Trim(tupleStr, "()") + ")"
+	}
+	values := []string{}
+	if inner := strings.TrimSpace(tupleStr[1 : len(tupleStr)-1]); inner != "" {
+		values = strings.Split(inner, ",")
+		for i := range values {
+			values[i] = strings.TrimSpace(values[i])
+		}
 	}
 
 	return Expr{
 		Type:  AST_TUPLE,
 		Tuple: &Tuple{Values: values},
-	}
+	}, nil
 }
 
-func parseArrayValue(arrSeq StackSeqObject, pos *int) Expr {
+func (d *seqDecoder) parseArrayValue(arrSeq StackSeqObject) (Expr, error) {
 	exprs := make([]Expr, 0)
 
 	// Parse the specified number of array elements
 	for i := 0; i < arrSeq.Arity; i++ {
-		expr := parseExpression(pos)
+		if d.repair && !d.peekExpression() {
+			repairf(arrSeq.Line, "closed array after %d of %d elements", i, arrSeq.Arity)
+			break
+		}
+		expr, err := d.parseExpression()
+		if err != nil {
+			return Expr{}, err
+		}
 		exprs = append(exprs, expr)
 	}
 
-	// Skip "val:arr:end" if it exists
-	if *pos < len(_stack.Objects) {
-		nextSeq := _stack.Objects[*pos]
-		if nextSeq.SeqType == SEQ_TYPE_VAL && nextSeq.RuleType != nil &&
-			*nextSeq.RuleType == AST_ARR_EXPR {
-			// This might be the "end" marker, skip it
-			*pos++
+	if d.repair {
+		// elements the header did not count
+		extra := 0
+		for len(exprs) >= arrSeq.Arity && d.peekExpression() {
+			expr, err := d.parseExpression()
+			if err != nil {
+				return Expr{}, err
+			}
+			exprs = append(exprs, expr)
+			extra++
+		}
+		if extra > 0 {
+			repairf(arrSeq.Line, "array has %d more elements than declared", extra)
+		}
+		if d.peekIs(SEQ_TYPE_ARR_END) {
+			d.pos++
+		} else if d.version >= 2 {
+			repairf(d.line(), "added missing val:arr:end")
+		}
+	} else if d.version >= 2 || d.peekIs(SEQ_TYPE_ARR_END) {
+		// version 1 writers did not always terminate arrays
+		if _, err := d.expect(SEQ_TYPE_ARR_END, "val:arr:end"); err != nil {
+			return Expr{}, err
 		}
 	}
 
 	return Expr{
 		Type:    AST_ARR_EXPR,
 		ArrExpr: &ArrExpr{Exprs: exprs},
-	}
+	}, nil
 }
 
-func parseBinaryTerm(binopSeq StackSeqObject, pos *int) Expr {
-	var leftExpr, rightExpr Expr
-
-	// Look for LEFT marker and parse left expression
-	if *pos < len(_stack.Objects) && _stack.Objects[*pos].SeqType == SEQ_TYPE_LEFT {
-		*pos++ // Skip LEFT marker
-		leftExpr = parseExpression(pos)
-	} else {
-		panic("Expected LEFT marker for binary term")
+func (d *seqDecoder) parseBinop(binopSeq StackSeqObject) (Expr, error) {
+	if _, err := d.expect(SEQ_TYPE_LEFT, "left"); err != nil {
+		return Expr{}, err
+	}
+	leftExpr, err := d.parseExpression()
+	if err != nil {
+		return Expr{}, err
 	}
 
-	// Look for RIGHT marker and parse right expression
-	if *pos < len(_stack.Objects) && _stack.Objects[*pos].SeqType == SEQ_TYPE_RIGHT {
-		*pos++ // Skip RIGHT marker
-		rightExpr = parseExpression(pos)
-	} else {
-		panic("Expected RIGHT marker for binary term")
+	_, err = d.expect(SEQ_TYPE_RIGHT, "right")
+	var rightExpr Expr
+	if err == nil {
+		rightExpr, err = d.parseExpression()
+	}
+	if err != nil {
+		if !d.repair {
+			return Expr{}, err
+		}
+		repairf(binopSeq.Line, "replaced binary operation %s without right operand by its left operand", *binopSeq.BinopOp)
+		return leftExpr, nil
 	}
 
+	switch *binopSeq.RuleType {
+	case AST_BINOP_COMPARE:
+		return Expr{
+			Type:         AST_BINOP_COMPARE,
+			BinopCompare: &BinopCompare{Left: leftExpr, Right: rightExpr, Operator: *binopSeq.BinopOp},
+		}, nil
+	case AST_BINOP_LOGIC:
+		return Expr{
+			Type:       AST_BINOP_LOGIC,
+			BinopLogic: &BinopLogic{Left: leftExpr, Right: rightExpr, Operator: *binopSeq.BinopOp},
+		}, nil
+	}
+	if *binopSeq.RuleType == AST_BINOP_TERM {
+		return Expr{
+			Type:      AST_BINOP_TERM,
+			BinopTerm: &BinopTerm{Left: leftExpr, Right: rightExpr, Operator: *binopSeq.BinopOp},
+		}, nil
+	}
 	return Expr{
-		Type: AST_BINOP_TERM,
-		BinopTerm: &BinopTerm{
-			Left:     leftExpr,
-			Right:    rightExpr,
-			Operator: *binopSeq.BinopOp,
-		},
+		Type:        AST_BINOP_FACTOR,
+		BinopFactor: &BinopFactor{Left: leftExpr, Right: rightExpr, Operator: *binopSeq.BinopOp},
+	}, nil
+}
+
+// parseCond reads the condition and both branches of a conditional, in repair
+// mode a conditional without else branch is replaced by its then branch
+func (d *seqDecoder) parseCond(condSeq StackSeqObject) (Expr, error) {
+	branches := []Expr{}
+	for _, part := range []struct {
+		seqType SeqType
+		what    string
+	}{{SEQ_TYPE_COND, "cond"}, {SEQ_TYPE_THEN, "then"}, {SEQ_TYPE_ELSE, "else"}} {
+		_, err := d.expect(part.seqType, part.what)
+		var expr Expr
+		if err == nil {
+			expr, err = d.parseExpression()
+		}
+		if err != nil {
+			if !d.repair || len(branches) < 2 {
+				return Expr{}, err
+			}
+			repairf(condSeq.Line, "replaced conditional without else branch by its then branch")
+			return branches[1], nil
+		}
+		branches = append(branches, expr)
 	}
+
+	return Expr{
+		Type: AST_COND,
+		Cond: &Cond{Cond: branches[0], Then: branches[1], Else: branches[2], IfElse: *condSeq.Id == "if"},
+	}, nil
 }
 
-func parseBinaryFactor(binopSeq StackSeqObject, pos *int) Expr {
-	var leftExpr, rightExpr Expr
+func (d *seqDecoder) parseVec(vecSeq StackSeqObject) (Expr, error) {
+	exprs := []Expr{}
+	for i := 0; i < vecSeq.Arity; i++ {
+		if d.repair && !d.peekExpression() {
+			repairf(vecSeq.Line, "closed vector after %d of %d values", i, vecSeq.Arity)
+			break
+		}
+		expr, err := d.parseExpression()
+		if err != nil {
+			return Expr{}, err
+		}
+		exprs = append(exprs, expr)
+	}
+	return Expr{Type: AST_VEC, Vec: &Vec{Exprs: exprs}}, nil
+}
 
-	// Look for LEFT marker and parse left expression
-	if *pos < len(_stack.Objects) && _stack.Objects[*pos].SeqType == SEQ_TYPE_LEFT {
-		*pos++ // Skip LEFT marker
-		leftExpr = parseExpression(pos)
-	} else {
-		panic("Expected LEFT marker for binary factor")
+// parseFor reads the range and the body of a loop, the body is always an array
+func (d *seqDecoder) parseFor(forSeq StackSeqObject) (Expr, error) {
+	bounds := []Expr{}
+	for _, part := range []struct {
+		seqType SeqType
+		what    string
+	}{{SEQ_TYPE_FROM, "from"}, {SEQ_TYPE_TO, "to"}} {
+		if _, err := d.expect(part.seqType, part.what); err != nil {
+			return Expr{}, err
+		}
+		expr, err := d.parseExpression()
+		if err != nil {
+			return Expr{}, err
+		}
+		bounds = append(bounds, expr)
 	}
 
-	// Look for RIGHT marker and parse right expression
-	if *pos < len(_stack.Objects) && _stack.Objects[*pos].SeqType == SEQ_TYPE_RIGHT {
-		*pos++ // Skip RIGHT marker
-		rightExpr = parseExpression(pos)
-	} else {
-		panic("Expected RIGHT marker for binary factor")
+	line := d.line()
+	body, err := d.parseExpression()
+	if err != nil {
+		return Expr{}, err
+	}
+	if body.Type != AST_ARR_EXPR || body.HasParentheses {
+		if !d.repair {
+			return Expr{}, fmt.Errorf("sequence line %d: the body of for %s has to be an array, got %s", line, *forSeq.Id, ruleTypeToString(body.Type))
+		}
+		repairf(line, "put the %s body of for %s into an array", ruleTypeToString(body.Type), *forSeq.Id)
+		body = Expr{Type: AST_ARR_EXPR, ArrExpr: &ArrExpr{Exprs: []Expr{body}}}
 	}
 
 	return Expr{
-		Type: AST_BINOP_FACTOR,
-		BinopFactor: &BinopFactor{
-			Left:     leftExpr,
-			Right:    rightExpr,
-			Operator: *binopSeq.BinopOp,
-		},
+		Type: AST_FOR,
+		For:  &For{Var: *forSeq.Id, From: bounds[0], To: bounds[1], Body: *body.ArrExpr},
+	}, nil
+}
+
+// parseSeqHeader returns the version of a "sdfl-seq:<version>" header line, 0 if line is not a header
+func parseSeqHeader(line string) (int, error) {
+	fields := strings.Split(line, ":")
+	if len(fields) != 2 || fields[0] != "sdfl-seq" {
+		return 0, nil
 	}
+	version, err := strconv.Atoi(fields[1])
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid sequence header %q", line)
+	}
+	if version > SEQ_VERSION {
+		return 0, fmt.Errorf("sequence version %d is newer than the supported version %d", version, SEQ_VERSION)
+	}
+	return version, nil
 }
 
-func ParseSeq(filepath string) {
-	readFile, err := os.Open(filepath)
+// ReadSeq reads the lines of a sequence into the stack, sequences without a header are version 1
+func ReadSeq(r io.Reader) error {
+	_stack = Stack{Version: 1}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if lineNumber == 1 {
+			version, err := parseSeqHeader(line)
+			if err != nil {
+				return err
+			}
+			if version > 0 {
+				_stack.Version = version
+				continue
+			}
+		}
+
+		var split []string
+		if _stack.Version >= 2 {
+			split = SplitSeqLine(line)
+		} else {
+			split = strings.Split(line, ":")
+		}
+		stackObj, err := parseObject(split)
+		if err != nil && seqRepair {
+			repairf(lineNumber, "skipped line: %v", err)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("sequence line %d: %v", lineNumber, err)
+		}
+		stackObj.Line = lineNumber
+		_stack.Push(stackObj)
+		Tracef(TRACE_SEQ, "%d %s", lineNumber, stackObj.Compact())
+	}
+	return scanner.Err()
+}
 
+func ParseSeq(filepath string) error {
+	readFile, err := os.Open(filepath)
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
-	fileScanner := bufio.NewScanner(readFile)
+	defer readFile.Close()
 
-	fileScanner.Split(bufio.ScanLines)
+	return ReadSeq(readFile)
+}
 
-	for fileScanner.Scan() {
-		line := fileScanner.Text()
-		split := strings.Split(line, ":")
-		stackObj := parseObject(split)
-		_stack.Push(stackObj)
+// DecodeSeq converts a sequence produced by AST2Seq back to a program
+func DecodeSeq(seq string) (Program, error) {
+	if err := ReadSeq(strings.NewReader(seq)); err != nil {
+		return Program{}, err
 	}
+	return Seq2AST()
+}
 
-	_stack.Print()
-	readFile.Close()
+// SplitSequences splits the content of a file with multiple sequences, which are separated by empty lines
+func SplitSequences(content string) []string {
+	sequences := []string{}
+	current := []string{}
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		if strings.TrimSpace(line) == "" {
+			if len(current) > 0 {
+				sequences = append(sequences, strings.Join(current, "\n"))
+				current = []string{}
+			}
+			continue
+		}
+		current = append(current, line)
+	}
+	if len(current) > 0 {
+		sequences = append(sequences, strings.Join(current, "\n"))
+	}
+	return sequences
+}
+
+// ReadMultipleSequencesFromFile reads a file written by WriteMultipleSequencesToFile
+func ReadMultipleSequencesFromFile(filename string) ([]Program, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	programs := []Program{}
+	for i, seq := range SplitSequences(string(content)) {
+		prog, err := DecodeSeq(seq)
+		if err != nil {
+			return nil, fmt.Errorf("%s, sequence %d: %v", filename, i, err)
+		}
+		programs = append(programs, prog)
+	}
+	return programs, nil
 }
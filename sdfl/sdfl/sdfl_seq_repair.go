@@ -0,0 +1,134 @@
+package sdfl
+
+// sequence repair
+//
+// Sequences sampled from the sequence model are often truncated or ill-formed.
+// In repair mode the decoder completes them instead of failing: open arrays and
+// calls are closed, dangling arguments are dropped, and missing or mistyped
+// arguments of builtins get the defaults from their signature. Every change is
+// reported as a warning, so the program renders and the caller knows how it
+// differs from the sequence.
+
+var seqRepair = false
+
+// SetSeqRepair turns repairing of malformed sequences on or off for ReadSeq and Seq2AST
+func SetSeqRepair(enabled bool) {
+	seqRepair = enabled
+}
+
+func repairf(line int, format string, args ...any) {
+	reportWarning(Span{Row: line}, "repaired: "+format, args...)
+}
+
+// repairProgram makes the decoded program complete enough to be generated
+func repairProgram(prog *Program) {
+	if kind := ExprKind(&prog.Expr); kind != ARG_SCENE {
+		scene := DefaultCall("scene")
+		children := []Expr{}
+		switch kind {
+		case ARG_SHAPE:
+			repairf(0, "wrapped the %s call in a scene", prog.Expr.FunCall.Id)
+			children = []Expr{prog.Expr}
+		case ARG_LOCAL:
+			// the function definition of the local block was lost
+			repairf(0, "moved the children of local into a scene")
+			if arg, ok := prog.Expr.FunCall.Arg("children"); ok && arg.Expr.Type == AST_ARR_EXPR {
+				children = arg.Expr.ArrExpr.Exprs
+			}
+		default:
+			repairf(0, "replaced the %s at the top by an empty scene", argKindToString(kind))
+		}
+		scene.FunCall.SetArg("children", Expr{Type: AST_ARR_EXPR, ArrExpr: &ArrExpr{Exprs: children}})
+		prog.Expr = scene
+	}
+
+	for _, stmt := range prog.Stmts {
+		if stmt.FunDef == nil || stmt.FunDef.Expr == nil {
+			continue
+		}
+		if kind := ExprKind(stmt.FunDef.Expr); kind != ARG_LOCAL {
+			repairf(0, "function %s does not return a local block, replaced its body", stmt.FunDef.Id)
+			local := DefaultCall("local")
+			if kind == ARG_SHAPE {
+				local.FunCall.SetArg("children", Expr{Type: AST_ARR_EXPR, ArrExpr: &ArrExpr{Exprs: []Expr{*stmt.FunDef.Expr}}})
+			}
+			*stmt.FunDef.Expr = local
+		}
+		repairArgs(stmt.FunDef.Expr)
+	}
+	repairArgs(&prog.Expr)
+}
+
+// repairArgs fills missing arguments and replaces arguments of the wrong kind in every call of expr
+func repairArgs(expr *Expr) {
+	walkExpr(expr, func(e *Expr) bool {
+		switch e.Type {
+		case AST_FUN_CALL:
+			repairCall(e.FunCall)
+		case AST_NUMBER:
+			if _, err := ParseNumberLiteral(e.Number.Value); err != nil {
+				repairf(0, "replaced invalid number literal %q", e.Number.Value)
+				e.Number.Value = "0"
+			}
+		case AST_TUPLE:
+			for i, value := range e.Tuple.Values {
+				if _, err := ParseNumberLiteral(value); err != nil {
+					repairf(0, "replaced invalid tuple value %q", value)
+					e.Tuple.Values[i] = "0"
+				}
+			}
+		case AST_ARR_EXPR:
+			// arrays hold shapes, or the keys of animate or post effects when the first element is one
+			kind := ExprKind(e)
+			exprs := []Expr{}
+			for _, element := range e.ArrExpr.Exprs {
+				_, isKey := VectorLen(&element)
+				if undefinedCall(&element) {
+					repairf(0, "dropped a call to the undefined function %s", element.FunCall.Id)
+				} else if kind == ARG_KEY_LIST && (isKey || element.Type == AST_FOR) {
+					exprs = append(exprs, element)
+				} else if kind == ARG_EFFECT_LIST && (ExprKind(&element) == ARG_EFFECT || element.Type == AST_FOR) {
+					exprs = append(exprs, element)
+				} else if kind != ARG_KEY_LIST && kind != ARG_EFFECT_LIST && KindMatches(ARG_SHAPE, ExprKind(&element)) {
+					exprs = append(exprs, element)
+				} else {
+					repairf(0, "dropped a %s from a %s", argKindToString(ExprKind(&element)), argKindToString(kind))
+				}
+			}
+			e.ArrExpr.Exprs = exprs
+		}
+		return true
+	})
+}
+
+func repairCall(funCall *FunCall) {
+	signature, ok := Signature(funCall.Id)
+	if !ok {
+		return
+	}
+	for _, arg := range signature {
+		namedArg, ok := funCall.Arg(arg.Name)
+		if !ok && arg.Optional {
+			continue
+		} else if !ok {
+			repairf(0, "added missing argument %s of %s", arg.Name, funCall.Id)
+		} else if undefinedCall(&namedArg.Expr) {
+			repairf(0, "replaced argument %s of %s, %s is not defined", arg.Name, funCall.Id, namedArg.Expr.FunCall.Id)
+		} else if kind := ExprKind(&namedArg.Expr); !KindMatches(arg.Kind, kind) {
+			repairf(0, "replaced argument %s of %s, expected %s got %s", arg.Name, funCall.Id, argKindToString(arg.Kind), argKindToString(kind))
+		} else if n, ok := VectorLen(&namedArg.Expr); arg.Kind == ARG_VEC3 && ok && n != 3 {
+			repairf(0, "replaced argument %s of %s, expected 3 values got %d", arg.Name, funCall.Id, n)
+		} else {
+			continue
+		}
+		funCall.SetArg(arg.Name, DefaultArgExpr(arg))
+	}
+}
+
+func undefinedCall(expr *Expr) bool {
+	if expr.Type != AST_FUN_CALL {
+		return false
+	}
+	_, ok := functionSymbols[expr.FunCall.Id]
+	return !ok
+}
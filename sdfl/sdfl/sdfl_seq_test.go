@@ -0,0 +1,257 @@
+package sdfl
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+)
+
+// parseOnly parses src without analyzing it, like the programs AST2Seq writes
+func parseOnly(t *testing.T, src string) Program {
+	t.Helper()
+	ResetDiagnostics()
+	InitRules()
+	parser := NewParser(Tokenize(src))
+	prog := parser.Parse()
+	if parser.IsThereError() || HasErrors() {
+		t.Fatalf("parse: %v", GetDiagnostics())
+	}
+	return prog
+}
+
+// decodeSeq decodes seq in strict or repair mode
+func decodeSeq(t *testing.T, seq string, repair bool) (Program, error) {
+	t.Helper()
+	ResetDiagnostics()
+	InitRules()
+	SetSeqRepair(repair)
+	defer SetSeqRepair(false)
+	return DecodeSeq(seq)
+}
+
+func TestSeqKeepsArgumentOrder(t *testing.T) {
+	src := `def blob(a, b = 2) {
+  local(children: [sphere(radius: 1, position: (0, 1, 0))])
+}
+scene(
+  children: [blob(), box(size: (1, 1, 1), position: (2, 0, 0))],
+  camera: camera(position: (0, 0, 5)),
+  post: [toneMap("aces"), gamma(value: 2.2)]
+)
+`
+	prog := parseOnly(t, src)
+	seq := AST2Seq(prog)
+	for _, want := range []string{
+		"call:sphere:2\narg:radius\nval:number\nliteral:1\narg:position\n",
+		"call:scene:3\narg:children\n",
+		"call:toneMap:1\narg:curve:positional\n",
+		"call:gamma:1\narg:value\n",
+	} {
+		if !strings.Contains(seq, want) {
+			t.Errorf("the sequence lacks %q:\n%s", want, seq)
+		}
+	}
+
+	decoded, err := decodeSeq(t, seq, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := FormatProgram(decoded), FormatProgram(prog); got != want {
+		t.Errorf("decoded program\n%s\nwant\n%s", got, want)
+	}
+	if strings.Contains(FormatProgram(decoded), "curve:") {
+		t.Errorf("the positional argument of toneMap got a name")
+	}
+}
+
+func TestSeqVersion2SortsArguments(t *testing.T) {
+	// version 2 wrote the arguments sorted by name
+	seq := `sdfl-seq:2
+call:scene:3
+arg:bounces
+val:number
+literal:2
+arg:camera
+call:camera:1
+arg:position
+val:tuple
+literal:(0, 0, 5)
+arg:children
+val:arr:begin:1
+call:sphere:0
+val:arr:end`
+	prog, err := decodeSeq(t, seq, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, arg := range prog.Expr.FunCall.Args {
+		names = append(names, arg.ArgName)
+	}
+	if got := strings.Join(names, ", "); got != "camera, children, bounces" {
+		t.Errorf("arguments of a version 2 scene are %s, want the order of the definition", got)
+	}
+}
+
+func TestSeqPositionalChecked(t *testing.T) {
+	seq := SEQ_HEADER + `
+call:scene:2
+arg:camera
+call:camera:1
+arg:position
+val:tuple
+literal:(0, 0, 5)
+arg:children
+val:arr:begin:1
+call:sphere:1
+arg:radius:positional
+val:number
+literal:1
+val:arr:end`
+	if _, err := decodeSeq(t, seq, false); err == nil || !strings.Contains(err.Error(), "radius of sphere can not be positional") {
+		t.Errorf("strict decoding of a misplaced positional argument: %v", err)
+	}
+	prog, err := decodeSeq(t, seq, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(FormatProgram(prog), "radius: 1") {
+		t.Errorf("the repaired argument has no name:\n%s", FormatProgram(prog))
+	}
+	if diagnostics := GetDiagnostics(); len(diagnostics) != 1 || !strings.Contains(diagnostics[0].Message, "gave the positional argument radius of sphere its name") {
+		t.Errorf("diagnostics = %v", diagnostics)
+	}
+}
+
+func TestUnknownArgumentsReportedByAnalyze(t *testing.T) {
+	src := "scene(camera: camera(position: (0, 0, 5)), children: [sphere(radius: 1, bogus: 2)])"
+	prog := parseOnly(t, src)
+	if !strings.Contains(AST2Seq(prog), "arg:bogus\n") {
+		t.Errorf("the parser dropped the unknown argument")
+	}
+	diagnostics := diagnosticsOf(src)
+	if len(diagnostics) != 1 || diagnostics[0].Message != "function sphere has no argument bogus (expected position, radius, material)" {
+		t.Fatalf("diagnostics = %v", diagnostics)
+	}
+	if diagnostics[0].Row != 1 || diagnostics[0].Col != 73 {
+		t.Errorf("reported at %d:%d, want the argument at 1:73", diagnostics[0].Row, diagnostics[0].Col)
+	}
+}
+
+func TestSignatureOrder(t *testing.T) {
+	// positional arguments take the names of FunDefArgNames, the sequence
+	// grammar checks them against the signature
+	for _, name := range builtinNames() {
+		signature, ok := Signature(name)
+		if !ok {
+			t.Errorf("%s has no signature", name)
+			continue
+		}
+		names := []string{}
+		for _, arg := range signature {
+			names = append(names, arg.Name)
+		}
+		if got, want := strings.Join(names, ", "), strings.Join(functionSymbols[name].FunDefArgNames, ", "); got != want {
+			t.Errorf("signature of %s is %s, the definition %s", name, got, want)
+		}
+	}
+}
+
+// shuffleArgs reorders the named arguments of every call in prog, the
+// positional ones stay in front
+func shuffleArgs(prog *Program, r *rand.Rand) {
+	shuffle := func(expr *Expr) bool {
+		if expr.Type == AST_FUN_CALL {
+			args := expr.FunCall.Args
+			named := 0
+			for named < len(args) && args[named].Positional {
+				named++
+			}
+			r.Shuffle(len(args)-named, func(i, j int) {
+				args[named+i], args[named+j] = args[named+j], args[named+i]
+			})
+		}
+		return true
+	}
+	for _, stmt := range prog.Stmts {
+		if stmt.FunDef != nil && stmt.FunDef.Expr != nil {
+			walkExpr(stmt.FunDef.Expr, shuffle)
+		}
+	}
+	walkExpr(&prog.Expr, shuffle)
+}
+
+func TestSeqRoundTrip(t *testing.T) {
+	sources := map[string]string{}
+	for _, name := range []string{"features.sdfl", "reflections.sdfl"} {
+		src, err := os.ReadFile("testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources[name] = string(src)
+	}
+	for _, name := range builtinNames() {
+		sources[name] = builtinScene(name)
+	}
+	for seed := int64(1); seed <= 3; seed++ {
+		sources[fmt.Sprintf("grid %d", seed)] = cullScene(seed)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for name, src := range sources {
+		parsed := parseOnly(t, src)
+		for round := 0; round < 3; round++ {
+			prog := CopyProgram(parsed)
+			if round > 0 {
+				shuffleArgs(&prog, r)
+			}
+			decoded, err := decodeSeq(t, AST2Seq(prog), false)
+			if err != nil {
+				t.Errorf("%s, round %d: %v", name, round, err)
+				continue
+			}
+			if !EqualAST(prog, decoded) {
+				t.Errorf("%s, round %d: the decoded program differs\n%s", name, round, firstDifference(FormatProgram(prog), FormatProgram(decoded)))
+			}
+		}
+	}
+
+	// the order of the arguments is part of the program
+	a := parseOnly(t, "scene(camera: camera(position: (0, 0, 5)), children: [sphere(radius: 1, position: (0, 1, 0))])")
+	b := parseOnly(t, "scene(camera: camera(position: (0, 0, 5)), children: [sphere(position: (0, 1, 0), radius: 1)])")
+	if EqualAST(a, b) {
+		t.Errorf("programs with the arguments in another order are equal")
+	}
+}
+
+func TestSeqUnknownArgument(t *testing.T) {
+	seq := SEQ_HEADER + `
+call:scene:2
+arg:camera
+call:camera:1
+arg:position
+val:tuple
+literal:(0, 0, 5)
+arg:children
+val:arr:begin:1
+call:box:1
+arg:bogus
+val:number
+literal:1
+val:arr:end`
+	if _, err := decodeSeq(t, seq, false); err == nil || !strings.Contains(err.Error(), "line 11: function box has no argument bogus") {
+		t.Errorf("strict decoding of an unknown argument: %v", err)
+	}
+	prog, err := decodeSeq(t, seq, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if box := prog.Expr.FunCall.ArgExpr("children").ArrExpr.Exprs[0].FunCall; len(box.Args) != 0 {
+		t.Errorf("the unknown argument is kept: %+v", box.Args)
+	}
+	if diagnostics := GetDiagnostics(); len(diagnostics) != 1 || !strings.Contains(diagnostics[0].Message, "dropped unknown argument bogus of box") {
+		t.Errorf("diagnostics = %v", diagnostics)
+	}
+}
@@ -0,0 +1,907 @@
+package sdfl
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// shader trees
+//
+// The portable backends do not write their languages directly. The generator
+// writes one GLSL shader: the builtin library shared with the desktop shaders,
+// the scene and a plain raymarcher. It is parsed into a typed tree of
+// functions, statements and expressions, and printed by a shaderLanguage.
+// Only the subset of GLSL the generator writes is supported. While parsing,
+// the implicit conversions of GLSL are made explicit, int literals passed as
+// floats become float literals and floats mixed with vectors in builtins like
+// max are widened, as most of the other languages have neither.
+
+// shExpr is a typed expression, its type is spelled like in GLSL
+type shExpr interface {
+	shType() string
+}
+
+// shLiteral is a number or bool literal
+type shLiteral struct {
+	Value string
+	Type  string
+}
+
+// shIdent is a variable, a constant or a uniform
+type shIdent struct {
+	Name    string
+	Type    string
+	Uniform bool
+}
+
+const (
+	SH_CALL_BUILTIN = iota
+	SH_CALL_CONSTRUCTOR
+	SH_CALL_STRUCT
+	SH_CALL_FUNCTION
+)
+
+// shCall calls a builtin, a function of the shader or constructs a value
+type shCall struct {
+	Kind     int
+	Function string
+	Args     []shExpr
+	Type     string
+}
+
+// shField selects a field of a struct or components of a vector
+type shField struct {
+	X    shExpr
+	Name string
+	Type string
+}
+
+type shUnary struct {
+	Op string
+	X  shExpr
+}
+
+type shBinary struct {
+	Op    string
+	Left  shExpr
+	Right shExpr
+	Type  string
+}
+
+type shSelect struct {
+	Cond shExpr
+	Then shExpr
+	Else shExpr
+}
+
+type shParen struct {
+	X shExpr
+}
+
+func (e *shLiteral) shType() string { return e.Type }
+func (e *shIdent) shType() string   { return e.Type }
+func (e *shCall) shType() string    { return e.Type }
+func (e *shField) shType() string   { return e.Type }
+func (e *shUnary) shType() string {
+	if e.Op == "!" {
+		return "bool"
+	}
+	return e.X.shType()
+}
+func (e *shBinary) shType() string { return e.Type }
+func (e *shSelect) shType() string { return e.Then.shType() }
+func (e *shParen) shType() string  { return e.X.shType() }
+
+type shStmt interface{}
+
+// shDecl declares a local variable, Init is nil when it is not initialized
+type shDecl struct {
+	Type string
+	Name string
+	Init shExpr
+}
+
+// shAssign assigns with one of = += -= *= /=, or increments with ++ and no Value
+type shAssign struct {
+	Target shExpr
+	Op     string
+	Value  shExpr
+}
+
+type shExprStmt struct {
+	X shExpr
+}
+
+type shIf struct {
+	Cond shExpr
+	Then []shStmt
+	Else []shStmt
+}
+
+type shFor struct {
+	Init shStmt
+	Cond shExpr
+	Post shStmt
+	Body []shStmt
+}
+
+type shReturn struct {
+	X shExpr
+}
+
+type shBreak struct{}
+
+// shVar is a parameter or a field
+type shVar struct {
+	Type string
+	Name string
+}
+
+type shStruct struct {
+	Name   string
+	Fields []shVar
+}
+
+// shGlobal is a constant or a uniform, Init is nil for uniforms
+type shGlobal struct {
+	Uniform bool
+	Type    string
+	Name    string
+	Init    shExpr
+}
+
+type shFunction struct {
+	Type   string
+	Name   string
+	Params []shVar
+	Body   []shStmt
+	Calls  map[string]bool // the functions of the shader it calls
+}
+
+type shProgram struct {
+	Structs   []*shStruct
+	Globals   []*shGlobal
+	Functions []*shFunction
+}
+
+// Function returns the function name, nil when there is none
+func (prog *shProgram) Function(name string) *shFunction {
+	for _, function := range prog.Functions {
+		if function.Name == name {
+			return function
+		}
+	}
+	return nil
+}
+
+// Uniforms returns the uniforms in the order of their declaration
+func (prog *shProgram) Uniforms() []*shGlobal {
+	uniforms := []*shGlobal{}
+	for _, global := range prog.Globals {
+		if global.Uniform {
+			uniforms = append(uniforms, global)
+		}
+	}
+	return uniforms
+}
+
+// Constants returns the constants in the order of their declaration
+func (prog *shProgram) Constants() []*shGlobal {
+	constants := []*shGlobal{}
+	for _, global := range prog.Globals {
+		if !global.Uniform {
+			constants = append(constants, global)
+		}
+	}
+	return constants
+}
+
+// Reachable drops the functions that are not called from root, directly or by other functions
+func (prog *shProgram) Reachable(root string) {
+	used := map[string]bool{}
+	queue := []string{root}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if used[name] {
+			continue
+		}
+		used[name] = true
+		if function := prog.Function(name); function != nil {
+			for call := range function.Calls {
+				queue = append(queue, call)
+			}
+		}
+	}
+
+	functions := []*shFunction{}
+	for _, function := range prog.Functions {
+		if used[function.Name] {
+			functions = append(functions, function)
+		} else {
+			Tracef(TRACE_GEN, "dropping unused function %s", function.Name)
+		}
+	}
+	prog.Functions = functions
+}
+
+// Builtins returns the builtin functions called by the program
+func (prog *shProgram) Builtins() map[string]bool {
+	builtins := map[string]bool{}
+	for _, function := range prog.Functions {
+		walkShStmts(function.Body, func(e shExpr) {
+			if call, ok := e.(*shCall); ok && call.Kind == SH_CALL_BUILTIN {
+				builtins[call.Function] = true
+			}
+		})
+	}
+	return builtins
+}
+
+// walkShStmts calls visit for every expression of stmts, outer ones first
+func walkShStmts(stmts []shStmt, visit func(e shExpr)) {
+	var expr func(e shExpr)
+	expr = func(e shExpr) {
+		if e == nil {
+			return
+		}
+		visit(e)
+		switch e := e.(type) {
+		case *shCall:
+			for _, arg := range e.Args {
+				expr(arg)
+			}
+		case *shField:
+			expr(e.X)
+		case *shUnary:
+			expr(e.X)
+		case *shBinary:
+			expr(e.Left)
+			expr(e.Right)
+		case *shSelect:
+			expr(e.Cond)
+			expr(e.Then)
+			expr(e.Else)
+		case *shParen:
+			expr(e.X)
+		}
+	}
+	var stmt func(s shStmt)
+	stmt = func(s shStmt) {
+		switch s := s.(type) {
+		case *shDecl:
+			expr(s.Init)
+		case *shAssign:
+			expr(s.Target)
+			expr(s.Value)
+		case *shExprStmt:
+			expr(s.X)
+		case *shIf:
+			expr(s.Cond)
+			walkShStmts(s.Then, visit)
+			walkShStmts(s.Else, visit)
+		case *shFor:
+			stmt(s.Init)
+			expr(s.Cond)
+			stmt(s.Post)
+			walkShStmts(s.Body, visit)
+		case *shReturn:
+			expr(s.X)
+		}
+	}
+	for _, s := range stmts {
+		stmt(s)
+	}
+}
+
+// types
+
+func shVectorLen(t string) int {
+	switch t {
+	case "vec2", "ivec2":
+		return 2
+	case "vec3", "ivec3":
+		return 3
+	case "vec4", "ivec4":
+		return 4
+	}
+	return 1
+}
+
+// shScalar is the type of the components of t
+func shScalar(t string) string {
+	if strings.HasPrefix(t, "ivec") {
+		return "int"
+	}
+	if strings.HasPrefix(t, "vec") {
+		return "float"
+	}
+	return t
+}
+
+func shVector(scalar string, n int) string {
+	if n == 1 {
+		return scalar
+	}
+	if scalar == "int" {
+		return fmt.Sprintf("ivec%d", n)
+	}
+	return fmt.Sprintf("vec%d", n)
+}
+
+var shBuiltinTypes = map[string]bool{
+	"void": true, "bool": true, "int": true, "uint": true, "float": true,
+	"vec2": true, "vec3": true, "vec4": true, "ivec2": true, "ivec3": true, "ivec4": true, "mat3": true,
+}
+
+// builtins of one type applied to every component, the floats passed
+// together with a vector are widened to it
+var shComponentBuiltins = map[string]bool{
+	"abs": true, "sign": true, "floor": true, "ceil": true, "fract": true, "mod": true,
+	"min": true, "max": true, "clamp": true, "mix": true, "step": true, "smoothstep": true,
+	"sqrt": true, "inversesqrt": true, "pow": true, "exp": true, "exp2": true, "log": true, "log2": true,
+	"sin": true, "cos": true, "tan": true, "asin": true, "acos": true, "atan": true,
+	"sinh": true, "cosh": true, "tanh": true, "asinh": true, "acosh": true, "atanh": true,
+	"radians": true, "degrees": true, "normalize": true,
+}
+
+// builtins with a fixed result type
+var shTypedBuiltins = map[string]string{
+	"length": "float", "distance": "float", "dot": "float", "cross": "vec3", "reflect": "vec3", "refract": "vec3",
+}
+
+// parsing
+
+var shToken = regexp.MustCompile(`^(?:(\s+|//[^\n]*|/\*(?s:.*?)\*/)|(\d+\.\d*(?:[eE][+-]?\d+)?|\.\d+(?:[eE][+-]?\d+)?|\d+[eE][+-]?\d+)|(\d+)|([A-Za-z_]\w*)|(==|!=|<=|>=|&&|\|\||\+\+|--|[-+*/]=|[-+*/<>=!?:;,.(){}]))`)
+
+const (
+	SH_FLOAT = iota
+	SH_INT
+	SH_IDENT
+	SH_PUNCT
+	SH_EOF
+)
+
+type shTok struct {
+	kind int
+	text string
+	line int
+}
+
+func tokenizeShader(code string) ([]shTok, error) {
+	tokens := []shTok{}
+	line := 1
+	for len(code) > 0 {
+		match := shToken.FindStringSubmatch(code)
+		if match == nil {
+			return nil, fmt.Errorf("line %d: unexpected %q", line, strings.SplitN(code, "\n", 2)[0])
+		}
+		switch {
+		case match[1] != "":
+		case match[2] != "":
+			tokens = append(tokens, shTok{SH_FLOAT, match[2], line})
+		case match[3] != "":
+			tokens = append(tokens, shTok{SH_INT, match[3], line})
+		case match[4] != "":
+			tokens = append(tokens, shTok{SH_IDENT, match[4], line})
+		default:
+			tokens = append(tokens, shTok{SH_PUNCT, match[5], line})
+		}
+		line += strings.Count(match[0], "\n")
+		code = code[len(match[0]):]
+	}
+	return append(tokens, shTok{SH_EOF, "", line}), nil
+}
+
+type shParser struct {
+	tokens    []shTok
+	pos       int
+	err       error
+	prog      *shProgram
+	structs   map[string]*shStruct
+	globals   map[string]*shGlobal
+	functions map[string]*shFunction
+	scopes    []map[string]string
+	function  *shFunction
+}
+
+// parseShader parses GLSL written by the generator
+func parseShader(code string) (*shProgram, error) {
+	tokens, err := tokenizeShader(code)
+	if err != nil {
+		return nil, err
+	}
+	p := &shParser{
+		tokens:    tokens,
+		prog:      &shProgram{},
+		structs:   map[string]*shStruct{},
+		globals:   map[string]*shGlobal{},
+		functions: map[string]*shFunction{},
+	}
+	for p.peek().kind != SH_EOF {
+		p.parseTopLevel()
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.prog, nil
+}
+
+func (p *shParser) peek() shTok {
+	return p.tokens[p.pos]
+}
+
+func (p *shParser) peekAt(offset int) shTok {
+	if p.pos+offset >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *shParser) next() shTok {
+	tok := p.tokens[p.pos]
+	if tok.kind != SH_EOF {
+		p.pos++
+	}
+	return tok
+}
+
+// fail keeps the first error and skips to the end, so every loop of the parser stops
+func (p *shParser) fail(format string, args ...any) {
+	if p.err == nil {
+		p.err = fmt.Errorf("line %d: %s", p.peek().line, fmt.Sprintf(format, args...))
+	}
+	p.pos = len(p.tokens) - 1
+}
+
+func (p *shParser) is(text string) bool {
+	tok := p.peek()
+	return (tok.kind == SH_PUNCT || tok.kind == SH_IDENT) && tok.text == text
+}
+
+func (p *shParser) accept(text string) bool {
+	if p.is(text) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *shParser) expect(text string) {
+	if !p.accept(text) {
+		p.fail("expected %s, got %q", text, p.peek().text)
+	}
+}
+
+func (p *shParser) ident() string {
+	tok := p.peek()
+	if tok.kind != SH_IDENT {
+		p.fail("expected an identifier, got %q", tok.text)
+		return ""
+	}
+	return p.next().text
+}
+
+func (p *shParser) isType(name string) bool {
+	return shBuiltinTypes[name] || p.structs[name] != nil
+}
+
+func (p *shParser) typeName() string {
+	name := p.ident()
+	if !p.isType(name) {
+		p.fail("unknown type %s", name)
+	}
+	return name
+}
+
+func (p *shParser) parseTopLevel() {
+	switch {
+	case p.accept("struct"):
+		s := &shStruct{Name: p.ident()}
+		p.expect("{")
+		for p.err == nil && !p.accept("}") {
+			field := shVar{Type: p.typeName(), Name: p.ident()}
+			p.expect(";")
+			s.Fields = append(s.Fields, field)
+		}
+		p.expect(";")
+		p.structs[s.Name] = s
+		p.prog.Structs = append(p.prog.Structs, s)
+
+	case p.accept("uniform"):
+		global := &shGlobal{Uniform: true, Type: p.typeName(), Name: p.ident()}
+		p.expect(";")
+		p.declareGlobal(global)
+
+	case p.accept("const"):
+		global := &shGlobal{Type: p.typeName(), Name: p.ident()}
+		p.expect("=")
+		global.Init = p.coerce(p.parseExpr(), global.Type)
+		p.expect(";")
+		p.declareGlobal(global)
+
+	default:
+		p.parseFunction()
+	}
+}
+
+func (p *shParser) declareGlobal(global *shGlobal) {
+	p.globals[global.Name] = global
+	p.prog.Globals = append(p.prog.Globals, global)
+}
+
+func (p *shParser) parseFunction() {
+	function := &shFunction{Type: p.typeName(), Name: p.ident(), Calls: map[string]bool{}}
+	p.function = function
+	p.scopes = []map[string]string{{}}
+	p.expect("(")
+	for p.err == nil && !p.accept(")") {
+		if len(function.Params) > 0 {
+			p.expect(",")
+		}
+		param := shVar{Type: p.typeName(), Name: p.ident()}
+		p.scopes[0][param.Name] = param.Type
+		function.Params = append(function.Params, param)
+	}
+	// functions are declared before they are called, like in GLSL
+	p.functions[function.Name] = function
+	function.Body = p.parseBlock()
+	p.prog.Functions = append(p.prog.Functions, function)
+}
+
+func (p *shParser) parseBlock() []shStmt {
+	p.expect("{")
+	p.scopes = append(p.scopes, map[string]string{})
+	stmts := []shStmt{}
+	for p.err == nil && !p.accept("}") {
+		stmts = append(stmts, p.parseStmt()...)
+	}
+	p.scopes = p.scopes[:len(p.scopes)-1]
+	return stmts
+}
+
+// parseBody parses the body of an if or for, braces are optional
+func (p *shParser) parseBody() []shStmt {
+	if p.is("{") {
+		return p.parseBlock()
+	}
+	return p.parseStmt()
+}
+
+func (p *shParser) parseStmt() []shStmt {
+	switch {
+	case p.is("{"):
+		// blocks are only written as bodies
+		return p.parseBlock()
+
+	case p.accept("if"):
+		p.expect("(")
+		stmt := &shIf{Cond: p.parseExpr()}
+		p.expect(")")
+		stmt.Then = p.parseBody()
+		if p.accept("else") {
+			stmt.Else = p.parseBody()
+		}
+		return []shStmt{stmt}
+
+	case p.accept("for"):
+		p.expect("(")
+		p.scopes = append(p.scopes, map[string]string{})
+		stmt := &shFor{}
+		if p.isType(p.peek().text) {
+			decls := p.parseDecl()
+			stmt.Init = decls[0]
+		} else {
+			stmt.Init = p.parseSimpleStmt()
+		}
+		p.expect(";")
+		stmt.Cond = p.parseExpr()
+		p.expect(";")
+		stmt.Post = p.parseSimpleStmt()
+		p.expect(")")
+		stmt.Body = p.parseBody()
+		p.scopes = p.scopes[:len(p.scopes)-1]
+		return []shStmt{stmt}
+
+	case p.accept("return"):
+		stmt := &shReturn{}
+		if !p.is(";") {
+			stmt.X = p.coerce(p.parseExpr(), p.function.Type)
+		}
+		p.expect(";")
+		return []shStmt{stmt}
+
+	case p.accept("break"):
+		p.expect(";")
+		return []shStmt{&shBreak{}}
+
+	case p.isType(p.peek().text) && p.peekAt(1).kind == SH_IDENT:
+		decls := p.parseDecl()
+		p.expect(";")
+		return decls
+	}
+	stmt := p.parseSimpleStmt()
+	p.expect(";")
+	return []shStmt{stmt}
+}
+
+// parseDecl parses declarations of one type like float a = 1., b
+func (p *shParser) parseDecl() []shStmt {
+	t := p.typeName()
+	decls := []shStmt{}
+	for p.err == nil {
+		decl := &shDecl{Type: t, Name: p.ident()}
+		if p.accept("=") {
+			decl.Init = p.coerce(p.parseExpr(), t)
+		}
+		// the variable is in scope after its initializer
+		p.scopes[len(p.scopes)-1][decl.Name] = t
+		decls = append(decls, decl)
+		if !p.accept(",") {
+			break
+		}
+	}
+	return decls
+}
+
+// parseSimpleStmt parses an assignment, an increment or a call
+func (p *shParser) parseSimpleStmt() shStmt {
+	if p.accept("++") {
+		return &shAssign{Target: p.parseUnary(), Op: "++"}
+	}
+	target := p.parseExpr()
+	if p.accept("++") {
+		return &shAssign{Target: target, Op: "++"}
+	}
+	for _, op := range []string{"=", "+=", "-=", "*=", "/="} {
+		if p.accept(op) {
+			return &shAssign{Target: target, Op: op, Value: p.coerce(p.parseExpr(), target.shType())}
+		}
+	}
+	if _, ok := target.(*shCall); !ok {
+		p.fail("expected a statement")
+	}
+	return &shExprStmt{X: target}
+}
+
+func (p *shParser) parseExpr() shExpr {
+	cond := p.parseBinary(0)
+	if !p.accept("?") {
+		return cond
+	}
+	then := p.parseExpr()
+	p.expect(":")
+	els := p.parseExpr()
+	t := then.shType()
+	if t == "int" && els.shType() == "float" {
+		t = "float"
+	}
+	return &shSelect{Cond: cond, Then: p.coerce(then, t), Else: p.coerce(els, t)}
+}
+
+var shPrecedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<", ">", "<=", ">="},
+	{"+", "-"},
+	{"*", "/"},
+}
+
+func (p *shParser) parseBinary(level int) shExpr {
+	if level == len(shPrecedence) {
+		return p.parseUnary()
+	}
+	left := p.parseBinary(level + 1)
+	for p.err == nil {
+		op := ""
+		for _, candidate := range shPrecedence[level] {
+			if p.peek().kind == SH_PUNCT && p.peek().text == candidate {
+				op = candidate
+			}
+		}
+		if op == "" {
+			return left
+		}
+		p.next()
+		left = p.binary(op, left, p.parseBinary(level+1))
+	}
+	return left
+}
+
+// binary types an operation, int literals next to floats become floats
+func (p *shParser) binary(op string, left shExpr, right shExpr) shExpr {
+	lt, rt := left.shType(), right.shType()
+	if shScalar(lt) == "float" || lt == "mat3" {
+		right = p.coerceScalar(right, "float")
+	}
+	if shScalar(rt) == "float" || rt == "mat3" {
+		left = p.coerceScalar(left, "float")
+	}
+	lt, rt = left.shType(), right.shType()
+
+	t := lt
+	switch {
+	case op == "&&" || op == "||" || op == "==" || op == "!=" || op == "<" || op == ">" || op == "<=" || op == ">=":
+		t = "bool"
+	case lt == "mat3" && rt == "vec3":
+		t = "vec3"
+	case shVectorLen(rt) > shVectorLen(lt):
+		t = rt
+	}
+	return &shBinary{Op: op, Left: left, Right: right, Type: t}
+}
+
+func (p *shParser) parseUnary() shExpr {
+	for _, op := range []string{"-", "+", "!"} {
+		if p.peek().kind == SH_PUNCT && p.peek().text == op {
+			p.next()
+			return &shUnary{Op: op, X: p.parseUnary()}
+		}
+	}
+	return p.parsePostfix()
+}
+
+func (p *shParser) parsePostfix() shExpr {
+	x := p.parsePrimary()
+	for p.err == nil && p.accept(".") {
+		name := p.ident()
+		x = &shField{X: x, Name: name, Type: p.fieldType(x.shType(), name)}
+	}
+	return x
+}
+
+var shSwizzle = regexp.MustCompile(`^(?:[xyzw]{1,4}|[rgba]{1,4})$`)
+
+func (p *shParser) fieldType(t string, name string) string {
+	if s, ok := p.structs[t]; ok {
+		for _, field := range s.Fields {
+			if field.Name == name {
+				return field.Type
+			}
+		}
+		p.fail("%s has no field %s", t, name)
+		return ""
+	}
+	if shVectorLen(t) > 1 && shSwizzle.MatchString(name) {
+		return shVector(shScalar(t), len(name))
+	}
+	p.fail("%s has no field %s", t, name)
+	return ""
+}
+
+func (p *shParser) parsePrimary() shExpr {
+	tok := p.next()
+	switch tok.kind {
+	case SH_FLOAT:
+		return &shLiteral{Value: tok.text, Type: "float"}
+	case SH_INT:
+		return &shLiteral{Value: tok.text, Type: "int"}
+	case SH_IDENT:
+		if tok.text == "true" || tok.text == "false" {
+			return &shLiteral{Value: tok.text, Type: "bool"}
+		}
+		if p.is("(") {
+			return p.parseCall(tok.text)
+		}
+		return p.lookup(tok.text)
+	case SH_PUNCT:
+		if tok.text == "(" {
+			x := p.parseExpr()
+			p.expect(")")
+			return &shParen{X: x}
+		}
+	}
+	p.fail("unexpected %q", tok.text)
+	return &shLiteral{Type: "float"}
+}
+
+func (p *shParser) lookup(name string) shExpr {
+	for i := len(p.scopes) - 1; i >= 0; i-- {
+		if t, ok := p.scopes[i][name]; ok {
+			return &shIdent{Name: name, Type: t}
+		}
+	}
+	if global, ok := p.globals[name]; ok {
+		return &shIdent{Name: name, Type: global.Type, Uniform: global.Uniform}
+	}
+	p.fail("%s is not declared", name)
+	return &shIdent{Name: name, Type: "float"}
+}
+
+func (p *shParser) parseCall(name string) shExpr {
+	p.expect("(")
+	args := []shExpr{}
+	for p.err == nil && !p.accept(")") {
+		if len(args) > 0 {
+			p.expect(",")
+		}
+		args = append(args, p.parseExpr())
+	}
+
+	switch {
+	case shBuiltinTypes[name]:
+		if name != "int" && name != "float" && name != "bool" {
+			for i := range args {
+				args[i] = p.coerceScalar(args[i], shScalar(name))
+			}
+		}
+		return &shCall{Kind: SH_CALL_CONSTRUCTOR, Function: name, Args: args, Type: name}
+
+	case p.structs[name] != nil:
+		fields := p.structs[name].Fields
+		if len(args) != len(fields) {
+			p.fail("%s has %d fields, got %d values", name, len(fields), len(args))
+			return &shLiteral{Type: name}
+		}
+		for i := range args {
+			args[i] = p.coerce(args[i], fields[i].Type)
+		}
+		return &shCall{Kind: SH_CALL_STRUCT, Function: name, Args: args, Type: name}
+
+	case p.functions[name] != nil:
+		function := p.functions[name]
+		if len(args) != len(function.Params) {
+			p.fail("%s takes %d arguments, got %d", name, len(function.Params), len(args))
+			return &shLiteral{Type: function.Type}
+		}
+		for i := range args {
+			args[i] = p.coerce(args[i], function.Params[i].Type)
+		}
+		if p.function != nil {
+			p.function.Calls[name] = true
+		}
+		return &shCall{Kind: SH_CALL_FUNCTION, Function: name, Args: args, Type: function.Type}
+
+	case shComponentBuiltins[name]:
+		t := "float"
+		for _, arg := range args {
+			if shVectorLen(arg.shType()) > 1 {
+				t = arg.shType()
+				break
+			}
+		}
+		for i := range args {
+			args[i] = p.coerce(args[i], t)
+		}
+		return &shCall{Kind: SH_CALL_BUILTIN, Function: name, Args: args, Type: t}
+
+	case shTypedBuiltins[name] != "":
+		for i := range args {
+			args[i] = p.coerceScalar(args[i], "float")
+		}
+		return &shCall{Kind: SH_CALL_BUILTIN, Function: name, Args: args, Type: shTypedBuiltins[name]}
+	}
+	p.fail("unknown function %s", name)
+	return &shLiteral{Type: "float"}
+}
+
+// coerce converts x to t like GLSL does implicitly: ints become floats
+// and floats passed as vectors are widened
+func (p *shParser) coerce(x shExpr, t string) shExpr {
+	xt := x.shType()
+	if xt == t {
+		return x
+	}
+	if shVectorLen(t) > 1 && shVectorLen(xt) == 1 {
+		return &shCall{Kind: SH_CALL_CONSTRUCTOR, Function: t, Args: []shExpr{p.coerceScalar(x, shScalar(t))}, Type: t}
+	}
+	return p.coerceScalar(x, t)
+}
+
+// coerceScalar converts an int to a float, anything else is returned as it is
+func (p *shParser) coerceScalar(x shExpr, t string) shExpr {
+	if t != "float" || x.shType() != "int" {
+		return x
+	}
+	switch x := x.(type) {
+	case *shLiteral:
+		return &shLiteral{Value: x.Value + ".0", Type: "float"}
+	case *shUnary:
+		return &shUnary{Op: x.Op, X: p.coerceScalar(x.X, t)}
+	case *shParen:
+		return &shParen{X: p.coerceScalar(x.X, t)}
+	}
+	return &shCall{Kind: SH_CALL_CONSTRUCTOR, Function: "float", Args: []shExpr{x}, Type: "float"}
+}
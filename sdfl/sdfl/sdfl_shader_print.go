@@ -0,0 +1,249 @@
+package sdfl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// printing shader trees
+//
+// A shaderLanguage spells what differs between the languages: types,
+// declarations, builtins, constructors and the code around the functions.
+// The statements and operators are shared, the C like languages (GLSL ES,
+// HLSL, Metal) mostly use the c* helpers below.
+
+type shaderLanguage interface {
+	typeName(t string) string
+	// keywords of the language, identifiers spelled like one get a trailing underscore
+	keywords() map[string]bool
+	// program writes the whole shader
+	program(p *shPrinter, prog *shProgram)
+	function(p *shPrinter, function *shFunction)
+	decl(p *shPrinter, t string, name string, init shExpr) string
+	ident(p *shPrinter, ident *shIdent) string
+	call(p *shPrinter, call *shCall) string
+	binary(p *shPrinter, binary *shBinary) string
+	selectValue(p *shPrinter, s *shSelect) string
+}
+
+type shPrinter struct {
+	lang   shaderLanguage
+	code   strings.Builder
+	indent int
+}
+
+func printShader(lang shaderLanguage, prog *shProgram) string {
+	p := &shPrinter{lang: lang}
+	lang.program(p, prog)
+	return p.code.String()
+}
+
+// line writes one indented line
+func (p *shPrinter) line(format string, args ...any) {
+	if format == "" {
+		p.code.WriteString("\n")
+		return
+	}
+	p.code.WriteString(strings.Repeat("    ", p.indent))
+	p.code.WriteString(fmt.Sprintf(format, args...))
+	p.code.WriteString("\n")
+}
+
+func (p *shPrinter) name(name string) string {
+	if p.lang.keywords()[name] {
+		return name + "_"
+	}
+	return name
+}
+
+func (p *shPrinter) expr(e shExpr) string {
+	switch e := e.(type) {
+	case *shLiteral:
+		return e.Value
+	case *shIdent:
+		return p.lang.ident(p, e)
+	case *shCall:
+		return p.lang.call(p, e)
+	case *shField:
+		if shVectorLen(e.X.shType()) > 1 {
+			return p.atom(e.X) + "." + e.Name
+		}
+		return p.atom(e.X) + "." + p.name(e.Name)
+	case *shUnary:
+		if e.Op == "+" {
+			// a no-op, WGSL does not have it
+			return p.expr(e.X)
+		}
+		return e.Op + p.atom(e.X)
+	case *shBinary:
+		return p.lang.binary(p, e)
+	case *shSelect:
+		return p.lang.selectValue(p, e)
+	case *shParen:
+		return "(" + p.expr(e.X) + ")"
+	}
+	panic(fmt.Sprintf("unknown shader expression %T", e))
+}
+
+// atom is e in parentheses unless it binds tighter than any operator
+func (p *shPrinter) atom(e shExpr) string {
+	switch e := e.(type) {
+	case *shLiteral, *shIdent, *shCall, *shField, *shParen:
+		return p.expr(e)
+	case *shUnary:
+		if e.Op == "+" {
+			return p.atom(e.X)
+		}
+	}
+	return "(" + p.expr(e) + ")"
+}
+
+func (p *shPrinter) args(args []shExpr) string {
+	code := []string{}
+	for _, arg := range args {
+		code = append(code, p.expr(arg))
+	}
+	return strings.Join(code, ", ")
+}
+
+func (p *shPrinter) block(stmts []shStmt) {
+	p.indent++
+	for _, stmt := range stmts {
+		p.stmt(stmt)
+	}
+	p.indent--
+}
+
+func (p *shPrinter) stmt(stmt shStmt) {
+	switch s := stmt.(type) {
+	case *shIf:
+		p.line("if (%s) {", p.expr(s.Cond))
+		p.block(s.Then)
+		for len(s.Else) == 1 {
+			// else if chains stay flat
+			next, ok := s.Else[0].(*shIf)
+			if !ok {
+				break
+			}
+			s = next
+			p.line("} else if (%s) {", p.expr(s.Cond))
+			p.block(s.Then)
+		}
+		if len(s.Else) > 0 {
+			p.line("} else {")
+			p.block(s.Else)
+		}
+		p.line("}")
+	case *shFor:
+		p.line("for (%s; %s; %s) {", p.simpleStmt(s.Init), p.expr(s.Cond), p.simpleStmt(s.Post))
+		p.block(s.Body)
+		p.line("}")
+	case *shReturn:
+		if s.X == nil {
+			p.line("return;")
+		} else {
+			p.line("return %s;", p.expr(s.X))
+		}
+	case *shBreak:
+		p.line("break;")
+	default:
+		p.line("%s;", p.simpleStmt(stmt))
+	}
+}
+
+// simpleStmt spells a declaration, an assignment or a call without the semicolon
+func (p *shPrinter) simpleStmt(stmt shStmt) string {
+	switch s := stmt.(type) {
+	case *shDecl:
+		return p.lang.decl(p, s.Type, p.name(s.Name), s.Init)
+	case *shAssign:
+		if s.Op == "++" {
+			return p.expr(s.Target) + "++"
+		}
+		return fmt.Sprintf("%s %s %s", p.expr(s.Target), s.Op, p.expr(s.Value))
+	case *shExprStmt:
+		return p.expr(s.X)
+	}
+	panic(fmt.Sprintf("unknown shader statement %T", stmt))
+}
+
+// C like languages
+
+func cStruct(p *shPrinter, s *shStruct) {
+	p.line("struct %s {", s.Name)
+	p.indent++
+	for _, field := range s.Fields {
+		p.line("%s %s;", p.lang.typeName(field.Type), p.name(field.Name))
+	}
+	p.indent--
+	p.line("};")
+	p.line("")
+}
+
+func cParams(p *shPrinter, params []shVar) string {
+	code := []string{}
+	for _, param := range params {
+		code = append(code, p.lang.typeName(param.Type)+" "+p.name(param.Name))
+	}
+	return strings.Join(code, ", ")
+}
+
+func cFunction(p *shPrinter, function *shFunction) {
+	p.line("%s %s(%s) {", p.lang.typeName(function.Type), p.name(function.Name), cParams(p, function.Params))
+	p.block(function.Body)
+	p.line("}")
+	p.line("")
+}
+
+func cDecl(p *shPrinter, t string, name string, init shExpr) string {
+	if init == nil {
+		return p.lang.typeName(t) + " " + name
+	}
+	return fmt.Sprintf("%s %s = %s", p.lang.typeName(t), name, p.expr(init))
+}
+
+// cCall spells calls with the builtins renamed, mod is floored like in GLSL
+// where the languages only have a truncating one
+func cCall(p *shPrinter, call *shCall, builtins map[string]string) string {
+	switch call.Kind {
+	case SH_CALL_FUNCTION:
+		return fmt.Sprintf("%s(%s)", p.name(call.Function), p.args(call.Args))
+	case SH_CALL_CONSTRUCTOR:
+		return fmt.Sprintf("%s(%s)", p.lang.typeName(call.Function), p.args(call.Args))
+	case SH_CALL_BUILTIN:
+		if call.Function == "mod" && builtins["mod"] == "" {
+			x, y := p.atom(call.Args[0]), p.atom(call.Args[1])
+			return fmt.Sprintf("(%s - %s * floor(%s / %s))", x, y, x, y)
+		}
+		if name, ok := builtins[call.Function]; ok {
+			return fmt.Sprintf("%s(%s)", name, p.args(call.Args))
+		}
+	}
+	return fmt.Sprintf("%s(%s)", call.Function, p.args(call.Args))
+}
+
+func cBinary(p *shPrinter, binary *shBinary) string {
+	return fmt.Sprintf("%s %s %s", p.expr(binary.Left), binary.Op, p.expr(binary.Right))
+}
+
+func cSelect(p *shPrinter, s *shSelect) string {
+	return fmt.Sprintf("%s ? %s : %s", p.expr(s.Cond), p.expr(s.Then), p.expr(s.Else))
+}
+
+// cKeywords are reserved in every C like language
+var cKeywords = []string{
+	"auto", "case", "char", "class", "const", "default", "delete", "do", "double", "enum", "extern",
+	"friend", "goto", "inline", "long", "namespace", "new", "operator", "private", "protected", "public",
+	"register", "short", "signed", "sizeof", "static", "switch", "template", "this", "typedef", "union",
+	"unsigned", "using", "virtual", "volatile", "while", "input", "output", "half", "sample", "filter",
+}
+
+func keywordSet(lists ...[]string) map[string]bool {
+	set := map[string]bool{}
+	for _, list := range lists {
+		for _, word := range list {
+			set[word] = true
+		}
+	}
+	return set
+}
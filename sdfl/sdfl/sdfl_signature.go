@@ -0,0 +1,342 @@
+package sdfl
+
+import (
+	"sort"
+	"strconv"
+)
+
+// argument kinds and defaults of the builtin functions
+//
+// functionSymbols only knows the argument names, this table adds what kind of
+// value every argument takes and its default value. Float and vec3 arguments
+// are optional, Analyze fills them in when a call leaves them out; shapes, shape
+// lists and the camera have to be given, only the post effects of a scene may
+// be left out. Value arguments take a float or a
+// vec3, the calls of the animation helpers produce the kind they are given. The defaults also complete programs
+// (e.g. a sequence sampled from a model that is missing arguments).
+
+type ArgKind int
+
+const (
+	ARG_ANY ArgKind = iota
+	ARG_FLOAT
+	ARG_VEC3
+	ARG_SHAPE
+	ARG_SHAPE_LIST
+	ARG_CAMERA
+	ARG_LOCAL
+	ARG_SCENE
+	ARG_BOOL
+	ARG_VALUE
+	ARG_STRING
+	ARG_KEY_LIST
+	ARG_EFFECT
+	ARG_EFFECT_LIST
+)
+
+func argKindToString(k ArgKind) string {
+	switch k {
+	case ARG_FLOAT:
+		return "float"
+	case ARG_VEC3:
+		return "vec3"
+	case ARG_SHAPE:
+		return "shape"
+	case ARG_SHAPE_LIST:
+		return "shape list"
+	case ARG_CAMERA:
+		return "camera"
+	case ARG_LOCAL:
+		return "local"
+	case ARG_SCENE:
+		return "scene"
+	case ARG_BOOL:
+		return "condition"
+	case ARG_VALUE:
+		return "float or vec3"
+	case ARG_STRING:
+		return "string"
+	case ARG_KEY_LIST:
+		return "key list"
+	case ARG_EFFECT:
+		return "post effect"
+	case ARG_EFFECT_LIST:
+		return "post effect list"
+	default:
+		return "any"
+	}
+}
+
+func (k ArgKind) String() string {
+	return argKindToString(k)
+}
+
+type ArgSignature struct {
+	Name        string
+	Kind        ArgKind
+	Default     []float64 // value of float, vec3 and bool arguments
+	DefaultText string    // value of string arguments
+	DefaultExpr *Expr     // default value of a user defined parameter, `b = 2`
+	Optional    bool      // calls may leave it out, Analyze fills in the default
+}
+
+func floatArg(name string, v float64) ArgSignature {
+	return ArgSignature{Name: name, Kind: ARG_FLOAT, Default: []float64{v}, Optional: true}
+}
+
+func vec3Arg(name string, x, y, z float64) ArgSignature {
+	return ArgSignature{Name: name, Kind: ARG_VEC3, Default: []float64{x, y, z}, Optional: true}
+}
+
+func valueArg(name string, v float64) ArgSignature {
+	return ArgSignature{Name: name, Kind: ARG_VALUE, Default: []float64{v}, Optional: true}
+}
+
+func boolArg(name string, v bool) ArgSignature {
+	arg := ArgSignature{Name: name, Kind: ARG_BOOL, Default: []float64{0}, Optional: true}
+	if v {
+		arg.Default[0] = 1
+	}
+	return arg
+}
+
+func stringArg(name string, v string) ArgSignature {
+	return ArgSignature{Name: name, Kind: ARG_STRING, DefaultText: v, Optional: true}
+}
+
+var builtinSignatures = map[string][]ArgSignature{
+	"scene":              {vec3Arg("background", 0, 0, 0), {Name: "camera", Kind: ARG_CAMERA}, {Name: "children", Kind: ARG_SHAPE_LIST}, stringArg("render", "normal,anaglyph,vr"), {Name: "post", Kind: ARG_EFFECT_LIST, Optional: true}, floatArg("bounces", 0)},
+	"local":              {{Name: "children", Kind: ARG_SHAPE_LIST}},
+	"camera":             {vec3Arg("position", 0, 5, 10)},
+	"plane":              {floatArg("height", 0), stringArg("material", "default")},
+	"sphere":             {vec3Arg("position", 0, 0, 0), floatArg("radius", 1), stringArg("material", "default")},
+	"cylinder":           {vec3Arg("begin", 0, 0, 0), vec3Arg("end", 0, 1, 0), floatArg("radius", 0.5), stringArg("material", "default")},
+	"ellipsoid":          {vec3Arg("position", 0, 0, 0), vec3Arg("radius", 1, 0.5, 1), stringArg("material", "default")},
+	"box":                {vec3Arg("position", 0, 0, 0), vec3Arg("size", 1, 1, 1), stringArg("material", "default")},
+	"torus":              {vec3Arg("position", 0, 0, 0), floatArg("radius", 1), floatArg("thickness", 0.25), stringArg("material", "default")},
+	"rotateAround":       {vec3Arg("position", 0, 0, 0), vec3Arg("rotation", 0, 0, 0), {Name: "child", Kind: ARG_SHAPE}},
+	"smoothUnion":        {{Name: "child1", Kind: ARG_SHAPE}, {Name: "child2", Kind: ARG_SHAPE}, floatArg("smooth_transition", 0.1)},
+	"smoothSubtraction":  {{Name: "child1", Kind: ARG_SHAPE}, {Name: "child2", Kind: ARG_SHAPE}, floatArg("smooth_transition", 0.1)},
+	"smoothIntersection": {{Name: "child1", Kind: ARG_SHAPE}, {Name: "child2", Kind: ARG_SHAPE}, floatArg("smooth_transition", 0.1)},
+	"union":              {{Name: "child1", Kind: ARG_SHAPE}, {Name: "child2", Kind: ARG_SHAPE}},
+	"subtraction":        {{Name: "child1", Kind: ARG_SHAPE}, {Name: "child2", Kind: ARG_SHAPE}},
+	"intersection":       {{Name: "child1", Kind: ARG_SHAPE}, {Name: "child2", Kind: ARG_SHAPE}},
+	"pow":                {floatArg("val", 1), floatArg("exp", 1)},
+	"animate":            {{Name: "keys", Kind: ARG_KEY_LIST}, stringArg("ease", "linear"), boolArg("loop", false)},
+	"lerp":               {valueArg("from", 0), valueArg("to", 1), floatArg("t", 0.5)},
+	"smoothstep":         {valueArg("from", 0), valueArg("to", 1), valueArg("x", 0.5)},
+	"oscillate":          {floatArg("freq", 1), valueArg("amp", 1)},
+	"fog":                {floatArg("density", 0.05), vec3Arg("color", 0.5, 0.6, 0.7)},
+	"ambientOcclusion":   {floatArg("samples", 5), floatArg("strength", 1)},
+	"toneMap":            {stringArg("curve", "aces")},
+	"gamma":              {floatArg("value", 2.2)},
+	"vignette":           {floatArg("strength", 0.5), floatArg("radius", 0.5)},
+	"bloom":              {floatArg("threshold", 0.8), floatArg("intensity", 0.5)},
+}
+
+// Signature returns the arguments of a function, GLSL builtins not in the table
+// take floats and the parameters of user defined functions can be anything
+func Signature(funId string) ([]ArgSignature, bool) {
+	return functionSymbols.signature(funId)
+}
+
+func (functions symbols) signature(funId string) ([]ArgSignature, bool) {
+	if signature, ok := builtinSignatures[funId]; ok {
+		return signature, true
+	}
+	funDef, ok := functions[funId]
+	if !ok {
+		return nil, false
+	}
+
+	signature := []ArgSignature{}
+	for _, argName := range funDef.FunDefArgNames {
+		if funDef.SymbolType == FUN_BUILTIN_GLSL {
+			arg := floatArg(argName, 0)
+			arg.Optional = false
+			signature = append(signature, arg)
+		} else if value, ok := funDef.FunDefDefaults[argName]; ok {
+			signature = append(signature, ArgSignature{Name: argName, Kind: ARG_ANY, Default: []float64{0}, DefaultExpr: &value, Optional: true})
+		} else {
+			signature = append(signature, ArgSignature{Name: argName, Kind: ARG_ANY, Default: []float64{0}})
+		}
+	}
+	return signature, true
+}
+
+// BuiltinFunctions returns the ids of all builtin functions, sorted
+func BuiltinFunctions() []string {
+	ids := []string{}
+	for id, funDef := range functionSymbols {
+		if funDef.SymbolType != FUN_USER_DEFINED {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// ReturnKind is the kind of value a call to funId produces
+func ReturnKind(funId string) ArgKind {
+	return functionSymbols.returnKind(funId)
+}
+
+func (functions symbols) returnKind(funId string) ArgKind {
+	funDef, ok := functions[funId]
+	if !ok {
+		return ARG_ANY
+	}
+	switch funDef.SymbolType {
+	case FUN_BUILTIN_SHAPE, FUN_BUILTIN_OP, FUN_BUILTIN_ROTATE_AROUND, FUN_USER_DEFINED:
+		return ARG_SHAPE
+	case FUN_BUILTIN_LOCAL:
+		return ARG_LOCAL
+	case FUN_BUILTIN_SCENE:
+		return ARG_SCENE
+	case FUN_BUILTIN_CAMERA:
+		return ARG_CAMERA
+	case FUN_BUILTIN_SDFL, FUN_BUILTIN_GLSL:
+		return ARG_FLOAT
+	case FUN_BUILTIN_ANIM:
+		return ARG_VALUE
+	case FUN_BUILTIN_POST:
+		return ARG_EFFECT
+	}
+	return ARG_ANY
+}
+
+// ExprKind is the kind of value expr produces, ARG_ANY when it can not be told
+func ExprKind(expr *Expr) ArgKind {
+	return functionSymbols.exprKind(expr)
+}
+
+func (functions symbols) exprKind(expr *Expr) ArgKind {
+	switch expr.Type {
+	case AST_NUMBER, AST_VAR:
+		return ARG_FLOAT
+	case AST_BINOP_TERM:
+		return functions.arithmeticKind(&expr.BinopTerm.Left, &expr.BinopTerm.Right)
+	case AST_BINOP_FACTOR:
+		return functions.arithmeticKind(&expr.BinopFactor.Left, &expr.BinopFactor.Right)
+	case AST_TUPLE, AST_VEC:
+		return ARG_VEC3
+	case AST_FOR:
+		// a loop stands for the shapes it unrolls to
+		return ARG_SHAPE
+	case AST_ARR_EXPR:
+		if len(expr.ArrExpr.Exprs) == 0 {
+			// an empty array is a shape list as well as an effect list
+			return ARG_ANY
+		}
+		if _, ok := keyLen(expr.ArrExpr.Exprs); ok {
+			return ARG_KEY_LIST
+		}
+		first := &expr.ArrExpr.Exprs[0]
+		for first.Type == AST_FOR && len(first.For.Body.Exprs) > 0 {
+			first = &first.For.Body.Exprs[0]
+		}
+		if functions.exprKind(first) == ARG_EFFECT {
+			return ARG_EFFECT_LIST
+		}
+		return ARG_SHAPE_LIST
+	case AST_FUN_CALL:
+		if kind := functions.returnKind(expr.FunCall.Id); kind != ARG_VALUE {
+			return kind
+		}
+		return functions.animKind(expr.FunCall)
+	case AST_BINOP_COMPARE, AST_BINOP_LOGIC, AST_UNOP_NOT, AST_BOOL:
+		return ARG_BOOL
+	case AST_STRING:
+		return ARG_STRING
+	case AST_COND:
+		// the kind both branches agree on
+		then, els := functions.exprKind(&expr.Cond.Then), functions.exprKind(&expr.Cond.Else)
+		if then == ARG_ANY || then == els {
+			return els
+		} else if els == ARG_ANY {
+			return then
+		}
+	}
+	return ARG_ANY
+}
+
+// VectorLen is the number of values of a tuple or a vector, false for other expressions
+func VectorLen(expr *Expr) (int, bool) {
+	switch expr.Type {
+	case AST_TUPLE:
+		return len(expr.Tuple.Values), true
+	case AST_VEC:
+		return len(expr.Vec.Exprs), true
+	}
+	return 0, false
+}
+
+// arithmeticKind is the kind of an arithmetic operation, a vec3 when one of
+// its operands is
+func (functions symbols) arithmeticKind(left *Expr, right *Expr) ArgKind {
+	l, r := functions.exprKind(left), functions.exprKind(right)
+	switch {
+	case l == ARG_VEC3 || r == ARG_VEC3:
+		return ARG_VEC3
+	case l == ARG_VALUE || r == ARG_VALUE:
+		return ARG_VALUE
+	}
+	return ARG_FLOAT
+}
+
+// KindMatches reports if a value of kind actual can be used where expected is
+func KindMatches(expected ArgKind, actual ArgKind) bool {
+	if expected == ARG_VALUE || actual == ARG_VALUE {
+		// a value is a float or a vec3
+		isValue := func(k ArgKind) bool { return k == ARG_FLOAT || k == ARG_VEC3 || k == ARG_VALUE }
+		return expected == ARG_ANY || actual == ARG_ANY || (isValue(expected) && isValue(actual))
+	}
+	return expected == ARG_ANY || actual == ARG_ANY || expected == actual
+}
+
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// DefaultCall is a call to funId with the default value of every argument
+func DefaultCall(funId string) Expr {
+	funCall := &FunCall{Id: funId}
+	signature, _ := Signature(funId)
+	for _, arg := range signature {
+		funCall.SetArg(arg.Name, DefaultArgExpr(arg))
+	}
+	return Expr{Type: AST_FUN_CALL, FunCall: funCall}
+}
+
+// DefaultArgExpr builds the default value of an argument
+func DefaultArgExpr(arg ArgSignature) Expr {
+	if arg.DefaultExpr != nil {
+		return CopyExpr(*arg.DefaultExpr)
+	}
+	switch arg.Kind {
+	case ARG_VEC3:
+		values := []string{}
+		for _, v := range arg.Default {
+			values = append(values, formatNumber(v))
+		}
+		return Expr{Type: AST_TUPLE, Tuple: &Tuple{Values: values}}
+	case ARG_SHAPE:
+		return DefaultCall("sphere")
+	case ARG_SHAPE_LIST, ARG_EFFECT_LIST:
+		return Expr{Type: AST_ARR_EXPR, ArrExpr: &ArrExpr{Exprs: []Expr{}}}
+	case ARG_CAMERA:
+		return DefaultCall("camera")
+	case ARG_STRING:
+		return Expr{Type: AST_STRING, String: &String{Value: arg.DefaultText}}
+	case ARG_BOOL:
+		return Expr{Type: AST_BOOL, Bool: &Bool{Value: len(arg.Default) > 0 && arg.Default[0] != 0}}
+	case ARG_KEY_LIST:
+		return Expr{Type: AST_ARR_EXPR, ArrExpr: &ArrExpr{Exprs: []Expr{{Type: AST_TUPLE, Tuple: &Tuple{Values: []string{"0", "0"}}}}}}
+	}
+
+	value := 0.0
+	if len(arg.Default) > 0 {
+		value = arg.Default[0]
+	}
+	return Expr{Type: AST_NUMBER, Number: &Number{Value: formatNumber(value)}}
+}
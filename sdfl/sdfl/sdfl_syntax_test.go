@@ -0,0 +1,124 @@
+package sdfl
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// checks of the generated shaders
+//
+// checkShaderSyntax is a quick check that runs everywhere: the version line,
+// balanced brackets and builtins of one language leaking into another, like
+// mix in HLSL or mod in WGSL. The compilers of the shading languages check the
+// rest, TestBackendValidators runs the ones found on the PATH.
+
+// synVersions are the first lines the languages require
+var synVersions = map[string]string{
+	"glsl-es300": "#version 300 es",
+}
+
+// synLeaks are the builtins of other languages a target does not have
+var synLeaks = map[string][]string{
+	"glsl-es300": {"lerp", "frac", "fmod", "saturate", "atan2"},
+	"shadertoy":  {"lerp", "frac", "fmod", "saturate", "atan2"},
+	"hlsl":       {"mix", "mod", "fract", "inversesqrt"},
+	"msl":        {"mod", "lerp", "frac", "inversesqrt", "radians", "degrees"},
+	"wgsl":       {"mod", "lerp", "frac", "fmod", "inversesqrt"},
+}
+
+var synComment = regexp.MustCompile(`//.*|(?s:/\*.*?\*/)`)
+
+// checkShaderSyntax checks the shader code written in the language of target
+func checkShaderSyntax(target string, code string) error {
+	leaks, ok := synLeaks[target]
+	if !ok {
+		return fmt.Errorf("no syntax check for %s", target)
+	}
+	if version := synVersions[target]; version != "" && !strings.HasPrefix(code, version+"\n") {
+		return fmt.Errorf("%s shaders have to start with %s", target, version)
+	}
+	code = synComment.ReplaceAllString(code, "")
+	open := []rune{}
+	for i, line := range strings.Split(code, "\n") {
+		for _, r := range line {
+			switch r {
+			case '(', '[', '{':
+				open = append(open, r)
+			case ')', ']', '}':
+				want := map[rune]rune{')': '(', ']': '[', '}': '{'}[r]
+				if len(open) == 0 || open[len(open)-1] != want {
+					return fmt.Errorf("%s line %d: unbalanced %c", target, i+1, r)
+				}
+				open = open[:len(open)-1]
+			}
+		}
+		if target == "wgsl" && strings.Contains(line, "?") {
+			return fmt.Errorf("%s line %d: no conditional operator, use select", target, i+1)
+		}
+	}
+	if len(open) > 0 {
+		return fmt.Errorf("%s: %c is not closed", target, open[len(open)-1])
+	}
+	for _, name := range leaks {
+		if regexp.MustCompile(`\b` + name + `\s*\(`).MatchString(code) {
+			return fmt.Errorf("%s: undeclared function %s", target, name)
+		}
+	}
+	return nil
+}
+
+// shadertoyMain declares the inputs of shadertoy so its shaders compile as GLSL ES
+const shadertoyMain = `#version 300 es
+precision highp float;
+uniform vec3 iResolution;
+uniform float iTime;
+uniform float iTimeDelta;
+uniform int iFrame;
+uniform vec4 iMouse;
+uniform vec4 iDate;
+out vec4 sdfl_color;
+%s
+void main() { mainImage(sdfl_color, gl_FragCoord.xy); }
+`
+
+// synValidators are the commands that compile a shader of a target, the file
+// name replaces {}
+var synValidators = map[string]struct {
+	file    string
+	command []string
+}{
+	"glsl-es300": {"shader.frag", []string{"glslangValidator", "{}"}},
+	"shadertoy":  {"shader.frag", []string{"glslangValidator", "{}"}},
+	"wgsl":       {"shader.wgsl", []string{"naga", "{}"}},
+	"hlsl":       {"shader.hlsl", []string{"dxc", "-T", "ps_6_0", "-E", "main", "{}"}},
+	"msl":        {"shader.metal", []string{"xcrun", "-sdk", "macosx", "metal", "-c", "{}", "-o", os.DevNull}},
+}
+
+// validateShader compiles code with the validator of target, it skips the test
+// when the validator is not installed
+func validateShader(t *testing.T, target string, code string) {
+	t.Helper()
+	validator := synValidators[target]
+	if _, err := exec.LookPath(validator.command[0]); err != nil {
+		t.Skipf("%s is not on the PATH", validator.command[0])
+	}
+	if target == "shadertoy" {
+		code = fmt.Sprintf(shadertoyMain, code)
+	}
+	path := filepath.Join(t.TempDir(), validator.file)
+	if err := os.WriteFile(path, []byte(code), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{}
+	for _, arg := range validator.command[1:] {
+		args = append(args, strings.ReplaceAll(arg, "{}", path))
+	}
+	if out, err := exec.Command(validator.command[0], args...).CombinedOutput(); err != nil {
+		t.Errorf("%s rejects the shader: %v\n%s", validator.command[0], err, out)
+	}
+}
@@ -0,0 +1,67 @@
+package sdfl
+
+import (
+	"os"
+	"testing"
+)
+
+// helpers shared by the tests of the package
+
+// parseSource parses and analyzes src like sdflc does, any diagnostic fails the test
+func parseSource(t *testing.T, src string) Program {
+	t.Helper()
+	ResetDiagnostics()
+	InitRules()
+	parser := NewParser(Tokenize(src))
+	prog := parser.Parse()
+	if parser.IsThereError() || HasErrors() {
+		t.Fatalf("parse: %v", GetDiagnostics())
+	}
+	Analyze(&prog)
+	if HasErrors() {
+		t.Fatalf("analyze: %v", GetDiagnostics())
+	}
+	return prog
+}
+
+// parseFile parses and analyzes a scene of testdata
+func parseFile(t *testing.T, name string) Program {
+	t.Helper()
+	src, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parseSource(t, string(src))
+}
+
+// generateTarget generates the shaders of prog for the target name, the
+// variable names start from scratch so the code does not depend on the tests
+// that ran before
+func generateTarget(t *testing.T, prog *Program, name string) []ShaderFile {
+	t.Helper()
+	varCounters = map[string]int{}
+	ClearCache()
+	previous := target.Name()
+	if err := SetTarget(name); err != nil {
+		t.Fatal(err)
+	}
+	defer SetTarget(previous)
+	Reset()
+	Generate(prog)
+	if HasErrors() {
+		t.Fatalf("generate %s: %v", name, GetDiagnostics())
+	}
+	return GetShaders()
+}
+
+// diagnosticsOf parses and analyzes src and returns the diagnostics it reports
+func diagnosticsOf(src string) []Diagnostic {
+	ResetDiagnostics()
+	InitRules()
+	parser := NewParser(Tokenize(src))
+	prog := parser.Parse()
+	if !parser.IsThereError() && !HasErrors() {
+		Analyze(&prog)
+	}
+	return GetDiagnostics()
+}
@@ -0,0 +1,160 @@
+package sdfl
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// literal hoisting
+//
+// In tweak mode numeric literals are emitted as uniforms instead of being
+// inlined, so the runtime can change them without recompiling the shader.
+// The uniforms are described in a side table which maps them back to source.
+
+type TweakMode int
+
+const (
+	TWEAK_NONE TweakMode = iota
+	TWEAK_MARKED
+	TWEAK_ALL
+)
+
+type TweakUniform struct {
+	Name    string    `json:"name"`
+	Type    string    `json:"type"`
+	Row     int       `json:"row"`
+	Col     int       `json:"col"`
+	Len     int       `json:"len"`
+	Default []float64 `json:"default"`
+	Min     []float64 `json:"min"`
+	Max     []float64 `json:"max"`
+}
+
+var tweakMode = TWEAK_NONE
+var tweakUniforms = []TweakUniform{}
+var tweakDeclared = map[string]bool{}
+
+// uniform declarations are inserted right after the shader headers
+var tweakInsertFragment = 0
+var tweakInsertCompute = 0
+
+func SetTweakMode(mode TweakMode) {
+	tweakMode = mode
+}
+
+func GetTweakUniforms() []TweakUniform {
+	return tweakUniforms
+}
+
+func resetTweaks() {
+	tweakUniforms = []TweakUniform{}
+	tweakDeclared = map[string]bool{}
+}
+
+func shouldTweak(marked bool) bool {
+	return tweakMode == TWEAK_ALL || (tweakMode == TWEAK_MARKED && marked)
+}
+
+// ParseNumberLiteral converts a literal accepted by the lexer (`1.5`, `2f`, `0x10`, `3u`) to a float
+func ParseNumberLiteral(value string) (float64, error) {
+	v := strings.TrimRight(value, "fFuU")
+	sign := 1.0
+	if strings.HasPrefix(v, "-") {
+		sign = -1.0
+		v = v[1:]
+	} else if strings.HasPrefix(v, "+") {
+		v = v[1:]
+	}
+	if strings.HasPrefix(v, "0x") || strings.HasPrefix(v, "0X") {
+		i, err := strconv.ParseInt(v[2:], 16, 64)
+		return sign * float64(i), err
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	return sign * f, err
+}
+
+func tweakRange(value float64) (float64, float64) {
+	extent := math.Max(math.Abs(value), 1.0)
+	return value - extent, value + extent
+}
+
+func tweakName(span Span) string {
+	if span.Row == 0 {
+		return freshVar("sdfl_tweak_")
+	}
+	return fmt.Sprintf("sdfl_tweak_%d_%d", span.Row, span.Col)
+}
+
+// declareTweak registers a uniform for the literal values and returns its name
+func declareTweak(glslType string, values []string, span Span) string {
+	name := tweakName(span)
+	if tweakDeclared[name] {
+		return name
+	}
+
+	uniform := TweakUniform{Name: name, Type: glslType, Row: span.Row, Col: span.Col, Len: span.Len}
+	for _, value := range values {
+		v, err := ParseNumberLiteral(value)
+		if err != nil {
+			reportError(span, "invalid number literal %s", value)
+		}
+		min, max := tweakRange(v)
+		uniform.Default = append(uniform.Default, v)
+		uniform.Min = append(uniform.Min, min)
+		uniform.Max = append(uniform.Max, max)
+	}
+
+	tweakDeclared[name] = true
+	tweakUniforms = append(tweakUniforms, uniform)
+	return name
+}
+
+// generateGlslTweakUniforms inserts the declarations of all hoisted literals into both shaders
+func generateGlslTweakUniforms() {
+	if len(tweakUniforms) == 0 {
+		return
+	}
+
+	code := "\n// tweakable literals\n"
+	for _, uniform := range tweakUniforms {
+		code += fmt.Sprintf("uniform %s %s;\n", uniform.Type, uniform.Name)
+	}
+
+	generatedCodeFragmentShader = generatedCodeFragmentShader[:tweakInsertFragment] + code + generatedCodeFragmentShader[tweakInsertFragment:]
+	generatedCodeComputeShader = generatedCodeComputeShader[:tweakInsertCompute] + code + generatedCodeComputeShader[tweakInsertCompute:]
+}
+
+// GetTweakTable returns the JSON side table of the hoisted literals
+func GetTweakTable() (string, error) {
+	table := struct {
+		Uniforms []TweakUniform `json:"uniforms"`
+	}{Uniforms: tweakUniforms}
+
+	bytes, err := json.MarshalIndent(table, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+// tweakFingerprint lists the source positions of the hoisted literals in expr, the
+// uniform names depend on them so cached code is only valid while they do not move
+func tweakFingerprint(expr *Expr) string {
+	if tweakMode == TWEAK_NONE {
+		return ""
+	}
+
+	fingerprint := ""
+	walkExpr(expr, func(e *Expr) bool {
+		if e.Type == AST_NUMBER && shouldTweak(e.Number.Tweak) {
+			fingerprint += fmt.Sprintf("%d:%d ", e.Number.Span.Row, e.Number.Span.Col)
+		} else if e.Type == AST_TUPLE && shouldTweak(e.Tuple.Tweak) {
+			fingerprint += fmt.Sprintf("%d:%d ", e.Tuple.Span.Row, e.Tuple.Span.Col)
+		}
+		return true
+	})
+	return fingerprint
+}
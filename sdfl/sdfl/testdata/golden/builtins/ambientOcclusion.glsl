@@ -0,0 +1,143 @@
+// out_frag.glsl
+
+float sdfl_builtin_sphere(vec3 p, vec3 pos, float r) {    
+    return distance(pos, p) - r;
+}
+
+SceneResult sdfl_GetDistScene(vec3 p) {
+    // reset
+    _scene_result = SceneResult(SDFL_MAX_DISTANCE, 0);
+    
+	SceneResult d;
+
+
+	if (render_mode == RENDER_MODE_VR) {
+		SceneResult editor = SceneResult(
+			editor_sdfl_builtin_plane(
+				p,
+				vec3(-3, 5, 2),
+				vec3(0, 0, 1),
+				vec2(3)
+			), 3
+		);
+		d = sdfl_PushScene(editor);
+	}
+    SceneResult sd0 = SceneResult(sdfl_builtin_sphere(p, vec3(0, 0, 0), 1), 0);
+    d = sdfl_PushScene(sd0);
+    // reset
+
+    return d;
+}
+
+vec3 sdfl_post_ambientOcclusion(vec3 color, vec3 p, float samples, float strength) {
+    vec3 normal = sdfl_GetNormal(p);
+    float occlusion = 0.;
+    float falloff = 1.;
+    for (int i = 0; i < 16; i++) {
+        if (float(i) >= samples) {
+            break;
+        }
+        float h = .01 + .12 * float(i) / max(samples - 1., 1.);
+        float d = sdfl_GetDistScene(p + normal * h).distance;
+        occlusion += (h - d) * falloff;
+        falloff *= .95;
+    }
+    return color * mix(1., clamp(1. - 3. * occlusion, 0., 1.), strength);
+}
+
+vec3 calc_color(vec3 cam_pos, vec2 uv) {
+    uv.y *= float(window_size.y) / float(window_size.x);
+    // generated camera position
+    vec3 ray_origin = cam_pos;
+    vec3 ray_dir = vec3(0.);
+    if (!ht_tracking_enabled) {
+        ray_dir = normalize(vec3(uv, -1)); // ray direction for the each pixel
+    } else {
+        ray_origin = ray_origin + ht_head_center;
+
+		// Calculate view target (looking at scene center)
+		vec3 target = vec3(0, 1, 0);  // adjust to your scene center
+		vec3 forward = normalize(target - ray_origin);
+
+		// Build camera basis
+		vec3 right = normalize(cross(forward, vec3(0, 1, 0)));
+		vec3 up = cross(right, forward);
+
+		// Calculate ray direction using proper camera matrix
+		float fov = 0.5;  // adjust for field of view (lower = more zoom)
+		ray_dir = normalize(forward + right * uv.x * fov + up * uv.y * fov);
+	}
+
+    SceneResult result = sdfl_RayMarch(ray_origin, ray_dir);
+    
+    vec3 color = vec3(0.0);
+    
+    if (result.distance < SDFL_MAX_DISTANCE) {
+        vec3 p = ray_origin + ray_dir * result.distance;
+        vec3 view_dir = -ray_dir;
+        
+        Material mat = sdfl_GetMaterial(result.materialId);
+        color = sdfl_CalculateLighting(p, view_dir, mat);
+    } else {
+        // Background/sky
+        color = mix(vec3(0.5, 0.7, 1.0), vec3(0, 0, 0), uv.y * 0.5 + 0.5);
+    }
+
+    // post processing
+    if (result.distance < SDFL_MAX_DISTANCE) {
+        color = sdfl_post_ambientOcclusion(color, ray_origin + ray_dir * result.distance, 5, 1);
+    }
+
+    return color;
+}
+// out_compute.glsl
+
+// sdfl generated code
+
+#version 430
+
+layout(local_size_x = 8, local_size_y = 8, local_size_z = 8) in;
+
+// SSBO
+layout(std430, binding = 0) buffer SDFBuffer {
+    float sdfData[];
+};
+
+uniform vec3 minBound;
+uniform vec3 maxBound;
+uniform int resolution;
+uniform float time;
+
+#define SDFL_MAX_DISTANCE 100.
+
+struct SceneResult {
+    float distance;
+    int materialId;
+};
+
+float sdfl_builtin_sphere(vec3 p, vec3 pos, float r) {    
+    return distance(pos, p) - r;
+}
+
+SceneResult _scene_result = SceneResult(SDFL_MAX_DISTANCE, 0);
+
+SceneResult sdfl_PushScene(SceneResult sr) {
+    if (sr.distance < _scene_result.distance) {
+        _scene_result.distance = sr.distance;
+        _scene_result.materialId = sr.materialId;
+    }
+    return _scene_result;
+}	
+
+SceneResult sdfl_GetDistScene(vec3 p) {
+    // reset
+    _scene_result = SceneResult(SDFL_MAX_DISTANCE, 0);
+    
+	SceneResult d;
+
+    SceneResult sd0 = SceneResult(sdfl_builtin_sphere(p, vec3(0, 0, 0), 1), 0);
+    d = sdfl_PushScene(sd0);
+    // reset
+
+    return d;
+}
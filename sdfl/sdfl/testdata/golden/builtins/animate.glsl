@@ -0,0 +1,115 @@
+// out_frag.glsl
+
+float sdfl_builtin_sphere(vec3 p, vec3 pos, float r) {    
+    return distance(pos, p) - r;
+}
+
+float sdfl_builtin_time(vec2 p){
+    return elapsed_time;
+}
+
+float sdfl_AnimTime(float start, float end, bool loop) {
+    float t = sdfl_builtin_time(vec2(0.));
+    return loop && end > start ? start + mod(t - start, end - start) : t;
+}
+
+float sdfl_AnimSegment(float t, float start, float end) {
+    return end > start ? clamp((t - start) / (end - start), 0., 1.) : step(start, t);
+}
+
+float sdfl_ease_cubicInOut(float x) {
+    return x < .5 ? 4. * x * x * x : 1. - pow(-2. * x + 2., 3.) / 2.;
+}
+
+SceneResult sdfl_GetDistScene(vec3 p) {
+    // reset
+    _scene_result = SceneResult(SDFL_MAX_DISTANCE, 0);
+    
+	SceneResult d;
+
+
+	if (render_mode == RENDER_MODE_VR) {
+		SceneResult editor = SceneResult(
+			editor_sdfl_builtin_plane(
+				p,
+				vec3(-3, 5, 2),
+				vec3(0, 0, 1),
+				vec2(3)
+			), 3
+		);
+		d = sdfl_PushScene(editor);
+	}
+    SceneResult sd0 = SceneResult(sdfl_builtin_sphere(p, vec3(0, 0, 0), mix(0.5, 1.0, sdfl_ease_cubicInOut(sdfl_AnimSegment(sdfl_AnimTime(0.0, 2.0, true), 0.0, 2.0)))), 0);
+    d = sdfl_PushScene(sd0);
+    // reset
+
+    return d;
+}
+// out_compute.glsl
+
+// sdfl generated code
+
+#version 430
+
+layout(local_size_x = 8, local_size_y = 8, local_size_z = 8) in;
+
+// SSBO
+layout(std430, binding = 0) buffer SDFBuffer {
+    float sdfData[];
+};
+
+uniform vec3 minBound;
+uniform vec3 maxBound;
+uniform int resolution;
+uniform float time;
+
+#define SDFL_MAX_DISTANCE 100.
+
+struct SceneResult {
+    float distance;
+    int materialId;
+};
+
+float sdfl_builtin_sphere(vec3 p, vec3 pos, float r) {    
+    return distance(pos, p) - r;
+}
+
+float sdfl_builtin_time(vec2 p){
+    return time;
+}
+
+float sdfl_AnimTime(float start, float end, bool loop) {
+    float t = sdfl_builtin_time(vec2(0.));
+    return loop && end > start ? start + mod(t - start, end - start) : t;
+}
+
+float sdfl_AnimSegment(float t, float start, float end) {
+    return end > start ? clamp((t - start) / (end - start), 0., 1.) : step(start, t);
+}
+
+float sdfl_ease_cubicInOut(float x) {
+    return x < .5 ? 4. * x * x * x : 1. - pow(-2. * x + 2., 3.) / 2.;
+}
+
+SceneResult _scene_result = SceneResult(SDFL_MAX_DISTANCE, 0);
+
+SceneResult sdfl_PushScene(SceneResult sr) {
+    if (sr.distance < _scene_result.distance) {
+        _scene_result.distance = sr.distance;
+        _scene_result.materialId = sr.materialId;
+    }
+    return _scene_result;
+}	
+
+SceneResult sdfl_GetDistScene(vec3 p) {
+    // reset
+    _scene_result = SceneResult(SDFL_MAX_DISTANCE, 0);
+    
+	SceneResult d;
+
+    SceneResult sd0 = SceneResult(sdfl_builtin_sphere(p, vec3(0, 0, 0), mix(0.5, 1.0, sdfl_ease_cubicInOut(sdfl_AnimSegment(sdfl_AnimTime(0.0, 2.0, true), 0.0, 2.0)))), 0);
+    d = sdfl_PushScene(sd0);
+    // reset
+
+    return d;
+}
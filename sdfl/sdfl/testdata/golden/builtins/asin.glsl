@@ -0,0 +1,81 @@
+// out_frag.glsl
+
+float sdfl_builtin_sphere(vec3 p, vec3 pos, float r) {    
+    return distance(pos, p) - r;
+}
+
+SceneResult sdfl_GetDistScene(vec3 p) {
+    // reset
+    _scene_result = SceneResult(SDFL_MAX_DISTANCE, 0);
+    
+	SceneResult d;
+
+
+	if (render_mode == RENDER_MODE_VR) {
+		SceneResult editor = SceneResult(
+			editor_sdfl_builtin_plane(
+				p,
+				vec3(-3, 5, 2),
+				vec3(0, 0, 1),
+				vec2(3)
+			), 3
+		);
+		d = sdfl_PushScene(editor);
+	}
+    SceneResult sd0 = SceneResult(sdfl_builtin_sphere(p, vec3(0, 0, 0), asin(0.5)), 0);
+    d = sdfl_PushScene(sd0);
+    // reset
+
+    return d;
+}
+// out_compute.glsl
+
+// sdfl generated code
+
+#version 430
+
+layout(local_size_x = 8, local_size_y = 8, local_size_z = 8) in;
+
+// SSBO
+layout(std430, binding = 0) buffer SDFBuffer {
+    float sdfData[];
+};
+
+uniform vec3 minBound;
+uniform vec3 maxBound;
+uniform int resolution;
+uniform float time;
+
+#define SDFL_MAX_DISTANCE 100.
+
+struct SceneResult {
+    float distance;
+    int materialId;
+};
+
+float sdfl_builtin_sphere(vec3 p, vec3 pos, float r) {    
+    return distance(pos, p) - r;
+}
+
+SceneResult _scene_result = SceneResult(SDFL_MAX_DISTANCE, 0);
+
+SceneResult sdfl_PushScene(SceneResult sr) {
+    if (sr.distance < _scene_result.distance) {
+        _scene_result.distance = sr.distance;
+        _scene_result.materialId = sr.materialId;
+    }
+    return _scene_result;
+}	
+
+SceneResult sdfl_GetDistScene(vec3 p) {
+    // reset
+    _scene_result = SceneResult(SDFL_MAX_DISTANCE, 0);
+    
+	SceneResult d;
+
+    SceneResult sd0 = SceneResult(sdfl_builtin_sphere(p, vec3(0, 0, 0), asin(0.5)), 0);
+    d = sdfl_PushScene(sd0);
+    // reset
+
+    return d;
+}
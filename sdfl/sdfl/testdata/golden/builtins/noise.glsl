@@ -0,0 +1,145 @@
+// out_frag.glsl
+
+float sdfl_builtin_sphere(vec3 p, vec3 pos, float r) {    
+    return distance(pos, p) - r;
+}
+
+float sdfl_builtin_hash(vec2 co){
+    return fract(sin(dot(co, vec2(12.9898, 78.233))) * 43758.5453);
+}
+
+float sdfl_builtin_noise_simple(vec2 point) {
+    vec2 p = fract(point);
+    p = smoothstep(0., 1., p);
+    vec2 id = floor(point);
+
+    vec2 off = vec2(1., 0.);
+    vec2 bl = id + off.yy;
+    vec2 br = id + off.xy;
+    vec2 tl = id + off.yx;
+    vec2 tr = id + off.xx;
+
+    float b = mix(sdfl_builtin_hash(bl), sdfl_builtin_hash(br), p.x);
+    float t = mix(sdfl_builtin_hash(tl), sdfl_builtin_hash(tr), p.x);
+
+    float val = mix(b, t, p.y);
+    return val;
+}
+
+float sdfl_builtin_noise(vec2 point) {
+    float noise = sdfl_builtin_noise_simple(point) * 
+    + sdfl_builtin_noise_simple(point*4.) * 0.5
+    + sdfl_builtin_noise_simple(point*8.) * 0.25
+    + sdfl_builtin_noise_simple(point*16.) * 0.125
+    + sdfl_builtin_noise_simple(point*32.) * 0.0625
+    + sdfl_builtin_noise_simple(point*64.) * 0.03125;
+	return noise;
+}
+
+SceneResult sdfl_GetDistScene(vec3 p) {
+    // reset
+    _scene_result = SceneResult(SDFL_MAX_DISTANCE, 0);
+    
+	SceneResult d;
+
+
+	if (render_mode == RENDER_MODE_VR) {
+		SceneResult editor = SceneResult(
+			editor_sdfl_builtin_plane(
+				p,
+				vec3(-3, 5, 2),
+				vec3(0, 0, 1),
+				vec2(3)
+			), 3
+		);
+		d = sdfl_PushScene(editor);
+	}
+    SceneResult sd0 = SceneResult(sdfl_builtin_sphere(p, vec3(0, 0, 0), 1+0.1*sdfl_builtin_noise(p.xy)), 0);
+    d = sdfl_PushScene(sd0);
+    // reset
+
+    return d;
+}
+// out_compute.glsl
+
+// sdfl generated code
+
+#version 430
+
+layout(local_size_x = 8, local_size_y = 8, local_size_z = 8) in;
+
+// SSBO
+layout(std430, binding = 0) buffer SDFBuffer {
+    float sdfData[];
+};
+
+uniform vec3 minBound;
+uniform vec3 maxBound;
+uniform int resolution;
+uniform float time;
+
+#define SDFL_MAX_DISTANCE 100.
+
+struct SceneResult {
+    float distance;
+    int materialId;
+};
+
+float sdfl_builtin_sphere(vec3 p, vec3 pos, float r) {    
+    return distance(pos, p) - r;
+}
+
+float sdfl_builtin_hash(vec2 co){
+    return fract(sin(dot(co, vec2(12.9898, 78.233))) * 43758.5453);
+}
+
+float sdfl_builtin_noise_simple(vec2 point) {
+    vec2 p = fract(point);
+    p = smoothstep(0., 1., p);
+    vec2 id = floor(point);
+
+    vec2 off = vec2(1., 0.);
+    vec2 bl = id + off.yy;
+    vec2 br = id + off.xy;
+    vec2 tl = id + off.yx;
+    vec2 tr = id + off.xx;
+
+    float b = mix(sdfl_builtin_hash(bl), sdfl_builtin_hash(br), p.x);
+    float t = mix(sdfl_builtin_hash(tl), sdfl_builtin_hash(tr), p.x);
+
+    float val = mix(b, t, p.y);
+    return val;
+}
+
+float sdfl_builtin_noise(vec2 point) {
+    float noise = sdfl_builtin_noise_simple(point) * 
+    + sdfl_builtin_noise_simple(point*4.) * 0.5
+    + sdfl_builtin_noise_simple(point*8.) * 0.25
+    + sdfl_builtin_noise_simple(point*16.) * 0.125
+    + sdfl_builtin_noise_simple(point*32.) * 0.0625
+    + sdfl_builtin_noise_simple(point*64.) * 0.03125;
+	return noise;
+}
+
+SceneResult _scene_result = SceneResult(SDFL_MAX_DISTANCE, 0);
+
+SceneResult sdfl_PushScene(SceneResult sr) {
+    if (sr.distance < _scene_result.distance) {
+        _scene_result.distance = sr.distance;
+        _scene_result.materialId = sr.materialId;
+    }
+    return _scene_result;
+}	
+
+SceneResult sdfl_GetDistScene(vec3 p) {
+    // reset
+    _scene_result = SceneResult(SDFL_MAX_DISTANCE, 0);
+    
+	SceneResult d;
+
+    SceneResult sd0 = SceneResult(sdfl_builtin_sphere(p, vec3(0, 0, 0), 1+0.1*sdfl_builtin_noise(p.xy)), 0);
+    d = sdfl_PushScene(sd0);
+    // reset
+
+    return d;
+}
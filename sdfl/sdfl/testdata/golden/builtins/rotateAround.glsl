@@ -0,0 +1,121 @@
+// out_frag.glsl
+
+float sdfl_builtin_box(vec3 p, vec3 bpos, vec3 bsize) {
+    // Shift point into the box's local coordinate system
+    vec3 q = abs(p - bpos) - bsize;
+    // Outside distance + inside distance
+    return length(max(q, 0.0)) + min(max(q.x, max(q.y, q.z)), 0.0);
+}
+
+mat3 sdfl_RotationMatrix(vec3 angles) {
+    // angles = (rx, ry, rz) in radians
+    float cx = cos(angles.x), sx = sin(angles.x);
+    float cy = cos(angles.y), sy = sin(angles.y);
+    float cz = cos(angles.z), sz = sin(angles.z);
+
+    // compose rotation: Rz * Ry * Rx
+    return mat3(
+        cy*cz, cz*sx*sy - cx*sz, sx*sz + cx*cz*sy,
+        cy*sz, cx*cz + sx*sy*sz, cx*sy*sz - cz*sx,
+        -sy,   cy*sx,            cx*cy
+    );
+}
+
+SceneResult sdfl_GetDistScene(vec3 p) {
+    // reset
+    _scene_result = SceneResult(SDFL_MAX_DISTANCE, 0);
+    
+	SceneResult d;
+
+
+	if (render_mode == RENDER_MODE_VR) {
+		SceneResult editor = SceneResult(
+			editor_sdfl_builtin_plane(
+				p,
+				vec3(-3, 5, 2),
+				vec3(0, 0, 1),
+				vec2(3)
+			), 3
+		);
+		d = sdfl_PushScene(editor);
+	}
+    vec3 pivot0 = vec3(0, 0, 0);
+    mat3 rotation0 = sdfl_RotationMatrix(radians(vec3(0, 45, 0)));
+    vec3 q0 = rotation0 * (p - pivot0) + pivot0;
+    SceneResult sd0 = SceneResult(sdfl_builtin_box(q0, vec3(0, 0, 0), vec3(1, 1, 1)), 0);
+    d = sdfl_PushScene(sd0);
+    // reset
+
+    return d;
+}
+// out_compute.glsl
+
+// sdfl generated code
+
+#version 430
+
+layout(local_size_x = 8, local_size_y = 8, local_size_z = 8) in;
+
+// SSBO
+layout(std430, binding = 0) buffer SDFBuffer {
+    float sdfData[];
+};
+
+uniform vec3 minBound;
+uniform vec3 maxBound;
+uniform int resolution;
+uniform float time;
+
+#define SDFL_MAX_DISTANCE 100.
+
+struct SceneResult {
+    float distance;
+    int materialId;
+};
+
+float sdfl_builtin_box(vec3 p, vec3 bpos, vec3 bsize) {
+    // Shift point into the box's local coordinate system
+    vec3 q = abs(p - bpos) - bsize;
+    // Outside distance + inside distance
+    return length(max(q, 0.0)) + min(max(q.x, max(q.y, q.z)), 0.0);
+}
+
+mat3 sdfl_RotationMatrix(vec3 angles) {
+    // angles = (rx, ry, rz) in radians
+    float cx = cos(angles.x), sx = sin(angles.x);
+    float cy = cos(angles.y), sy = sin(angles.y);
+    float cz = cos(angles.z), sz = sin(angles.z);
+
+    // compose rotation: Rz * Ry * Rx
+    return mat3(
+        cy*cz, cz*sx*sy - cx*sz, sx*sz + cx*cz*sy,
+        cy*sz, cx*cz + sx*sy*sz, cx*sy*sz - cz*sx,
+        -sy,   cy*sx,            cx*cy
+    );
+}
+
+SceneResult _scene_result = SceneResult(SDFL_MAX_DISTANCE, 0);
+
+SceneResult sdfl_PushScene(SceneResult sr) {
+    if (sr.distance < _scene_result.distance) {
+        _scene_result.distance = sr.distance;
+        _scene_result.materialId = sr.materialId;
+    }
+    return _scene_result;
+}	
+
+SceneResult sdfl_GetDistScene(vec3 p) {
+    // reset
+    _scene_result = SceneResult(SDFL_MAX_DISTANCE, 0);
+    
+	SceneResult d;
+
+    vec3 pivot0 = vec3(0, 0, 0);
+    mat3 rotation0 = sdfl_RotationMatrix(radians(vec3(0, 45, 0)));
+    vec3 q0 = rotation0 * (p - pivot0) + pivot0;
+    SceneResult sd0 = SceneResult(sdfl_builtin_box(q0, vec3(0, 0, 0), vec3(1, 1, 1)), 0);
+    d = sdfl_PushScene(sd0);
+    // reset
+
+    return d;
+}
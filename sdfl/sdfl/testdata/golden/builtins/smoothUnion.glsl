@@ -0,0 +1,121 @@
+// out_frag.glsl
+
+float sdfl_builtin_sphere(vec3 p, vec3 pos, float r) {    
+    return distance(pos, p) - r;
+}
+
+float sdfl_builtin_box(vec3 p, vec3 bpos, vec3 bsize) {
+    // Shift point into the box's local coordinate system
+    vec3 q = abs(p - bpos) - bsize;
+    // Outside distance + inside distance
+    return length(max(q, 0.0)) + min(max(q.x, max(q.y, q.z)), 0.0);
+}
+
+// https://iquilezles.org/articles/distfunctions/
+
+SceneResult sdfl_builtin_smoothUnion(SceneResult d1, SceneResult d2, float k) {
+    float h = clamp(0.5 + 0.5*(d2.distance-d1.distance)/k, 0.0, 1.0);
+    float dist = mix(d2.distance, d1.distance, h) - k*h*(1.0-h);
+    int matId = (h > 0.5) ? d1.materialId : d2.materialId;
+    return SceneResult(dist, matId);
+}
+
+SceneResult sdfl_GetDistScene(vec3 p) {
+    // reset
+    _scene_result = SceneResult(SDFL_MAX_DISTANCE, 0);
+    
+	SceneResult d;
+
+
+	if (render_mode == RENDER_MODE_VR) {
+		SceneResult editor = SceneResult(
+			editor_sdfl_builtin_plane(
+				p,
+				vec3(-3, 5, 2),
+				vec3(0, 0, 1),
+				vec2(3)
+			), 3
+		);
+		d = sdfl_PushScene(editor);
+	}
+    if (sdfl_builtin_box(p, vec3(0.5, 0.0, 0.0), vec3(1.551, 1.051, 1.051)) < _scene_result.distance) {
+    SceneResult sd0 = SceneResult(sdfl_builtin_sphere(p, vec3(0, 0, 0), 1), 0);
+    SceneResult sd1 = SceneResult(sdfl_builtin_box(p, vec3(1, 0, 0), vec3(1, 1, 1)), 0);
+    SceneResult sd2 = sdfl_builtin_smoothUnion(sd0, sd1, 0.2);
+    d = sdfl_PushScene(sd2);
+    }
+    // reset
+
+    return _scene_result;
+}
+// out_compute.glsl
+
+// sdfl generated code
+
+#version 430
+
+layout(local_size_x = 8, local_size_y = 8, local_size_z = 8) in;
+
+// SSBO
+layout(std430, binding = 0) buffer SDFBuffer {
+    float sdfData[];
+};
+
+uniform vec3 minBound;
+uniform vec3 maxBound;
+uniform int resolution;
+uniform float time;
+
+#define SDFL_MAX_DISTANCE 100.
+
+struct SceneResult {
+    float distance;
+    int materialId;
+};
+
+float sdfl_builtin_sphere(vec3 p, vec3 pos, float r) {    
+    return distance(pos, p) - r;
+}
+
+float sdfl_builtin_box(vec3 p, vec3 bpos, vec3 bsize) {
+    // Shift point into the box's local coordinate system
+    vec3 q = abs(p - bpos) - bsize;
+    // Outside distance + inside distance
+    return length(max(q, 0.0)) + min(max(q.x, max(q.y, q.z)), 0.0);
+}
+
+// https://iquilezles.org/articles/distfunctions/
+
+SceneResult sdfl_builtin_smoothUnion(SceneResult d1, SceneResult d2, float k) {
+    float h = clamp(0.5 + 0.5*(d2.distance-d1.distance)/k, 0.0, 1.0);
+    float dist = mix(d2.distance, d1.distance, h) - k*h*(1.0-h);
+    int matId = (h > 0.5) ? d1.materialId : d2.materialId;
+    return SceneResult(dist, matId);
+}
+
+SceneResult _scene_result = SceneResult(SDFL_MAX_DISTANCE, 0);
+
+SceneResult sdfl_PushScene(SceneResult sr) {
+    if (sr.distance < _scene_result.distance) {
+        _scene_result.distance = sr.distance;
+        _scene_result.materialId = sr.materialId;
+    }
+    return _scene_result;
+}	
+
+SceneResult sdfl_GetDistScene(vec3 p) {
+    // reset
+    _scene_result = SceneResult(SDFL_MAX_DISTANCE, 0);
+    
+	SceneResult d;
+
+    if (sdfl_builtin_box(p, vec3(0.5, 0.0, 0.0), vec3(1.551, 1.051, 1.051)) < _scene_result.distance) {
+    SceneResult sd0 = SceneResult(sdfl_builtin_sphere(p, vec3(0, 0, 0), 1), 0);
+    SceneResult sd1 = SceneResult(sdfl_builtin_box(p, vec3(1, 0, 0), vec3(1, 1, 1)), 0);
+    SceneResult sd2 = sdfl_builtin_smoothUnion(sd0, sd1, 0.2);
+    d = sdfl_PushScene(sd2);
+    }
+    // reset
+
+    return _scene_result;
+}
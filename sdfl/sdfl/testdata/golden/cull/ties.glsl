@@ -0,0 +1,63 @@
+// culled
+
+SceneResult sdfl_GetDistScene(vec3 p) {
+    // reset
+    _scene_result = SceneResult(SDFL_MAX_DISTANCE, 0);
+    
+	SceneResult d;
+
+
+	if (render_mode == RENDER_MODE_VR) {
+		SceneResult editor = SceneResult(
+			editor_sdfl_builtin_plane(
+				p,
+				vec3(-3, 5, 2),
+				vec3(0, 0, 1),
+				vec2(3)
+			), 3
+		);
+		d = sdfl_PushScene(editor);
+	}
+    SceneResult sd0 = SceneResult(sdfl_builtin_sphere(p, vec3(0, 0, 0), 1+0*sdfl_builtin_time(p.xy)), 5);
+    d = sdfl_PushScene(sd0);
+    if (sdfl_builtin_box(p, vec3(1.5, 0.0, 0.0), vec3(2.502, 1.001, 1.001)) < _scene_result.distance) {
+    SceneResult sd1 = SceneResult(sdfl_builtin_sphere(p, vec3(0, 0, 0), 1), 4);
+    d = sdfl_PushScene(sd1);
+    SceneResult sd2 = SceneResult(sdfl_builtin_sphere(p, vec3(3, 0, 0), 1), 0);
+    d = sdfl_PushScene(sd2);
+    }
+    // reset
+
+    return _scene_result;
+}
+
+// --no-cull
+
+SceneResult sdfl_GetDistScene(vec3 p) {
+    // reset
+    _scene_result = SceneResult(SDFL_MAX_DISTANCE, 0);
+    
+	SceneResult d;
+
+
+	if (render_mode == RENDER_MODE_VR) {
+		SceneResult editor = SceneResult(
+			editor_sdfl_builtin_plane(
+				p,
+				vec3(-3, 5, 2),
+				vec3(0, 0, 1),
+				vec2(3)
+			), 3
+		);
+		d = sdfl_PushScene(editor);
+	}
+    SceneResult sd0 = SceneResult(sdfl_builtin_sphere(p, vec3(0, 0, 0), 1), 4);
+    d = sdfl_PushScene(sd0);
+    SceneResult sd1 = SceneResult(sdfl_builtin_sphere(p, vec3(3, 0, 0), 1), 0);
+    d = sdfl_PushScene(sd1);
+    SceneResult sd2 = SceneResult(sdfl_builtin_sphere(p, vec3(0, 0, 0), 1+0*sdfl_builtin_time(p.xy)), 5);
+    d = sdfl_PushScene(sd2);
+    // reset
+
+    return d;
+}
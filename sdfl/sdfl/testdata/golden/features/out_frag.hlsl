@@ -0,0 +1,520 @@
+// sdfl generated code
+
+cbuffer SdflUniforms : register(b0) {
+    int2 window_size;
+    float elapsed_time;
+};
+
+struct Material {
+    float3 albedo;
+    float roughness;
+    float metallic;
+    float3 emission;
+    float reflectivity;
+    float ior;
+    float transparency;
+};
+
+Material sdfl_make_Material(float3 albedo, float roughness, float metallic, float3 emission, float reflectivity, float ior, float transparency) {
+    Material result;
+    result.albedo = albedo;
+    result.roughness = roughness;
+    result.metallic = metallic;
+    result.emission = emission;
+    result.reflectivity = reflectivity;
+    result.ior = ior;
+    result.transparency = transparency;
+    return result;
+}
+
+struct SceneResult {
+    float distance;
+    int materialId;
+};
+
+SceneResult sdfl_make_SceneResult(float distance, int materialId) {
+    SceneResult result;
+    result.distance = distance;
+    result.materialId = materialId;
+    return result;
+}
+
+static const int SDFL_MAX_STEPS = 100;
+static const float SDFL_MAX_DISTANCE = 100.;
+static const float SDFL_HIT_DISTANCE = .01;
+static const float SDFL_SHADOW_CAST_DISTANCE = .05;
+
+float sdfl_asinh(float x) {
+    return log(x + sqrt(x * x + 1.0));
+}
+
+float2 sdfl_asinh(float2 x) {
+    return log(x + sqrt(x * x + 1.0));
+}
+
+float3 sdfl_asinh(float3 x) {
+    return log(x + sqrt(x * x + 1.0));
+}
+
+float sdfl_builtin_plane(float3 p, float height) {
+    return p.y - height;
+}
+
+float sdfl_builtin_sphere(float3 p, float3 pos, float r) {
+    return distance(pos, p) - r;
+}
+
+float sdfl_builtin_cylinder(float3 p, float3 a, float3 b, float r) {
+    float3 ba = b - a;
+    float3 pa = p - a;
+    float baba = dot(ba, ba);
+    float paba = dot(pa, ba);
+    float x = length(pa * baba - ba * paba) - r * baba;
+    float y = abs(paba - baba * 0.5) - baba * 0.5;
+    float x2 = x * x;
+    float y2 = y * y * baba;
+    float d = (max(x, y) < 0.0) ? -min(x2, y2) : (((x > 0.0) ? x2 : 0.0) + ((y > 0.0) ? y2 : 0.0));
+    return sign(d) * sqrt(abs(d)) / baba;
+}
+
+float sdfl_builtin_ellipsoid(float3 p, float3 pos, float3 r) {
+    float3 q = (p - pos) / r;
+    return (length(q) - 1.0) * min(min(r.x, r.y), r.z);
+}
+
+float sdfl_builtin_box(float3 p, float3 bpos, float3 bsize) {
+    float3 q = abs(p - bpos) - bsize;
+    return length(max(q, ((float3)0.0))) + min(max(q.x, max(q.y, q.z)), 0.0);
+}
+
+float sdfl_builtin_torus(float3 p, float3 pos, float radius, float thickness) {
+    float3 wp = p - pos;
+    float2 t = float2(radius, thickness);
+    float2 q = float2(length(wp.xz) - t.x, wp.y);
+    return length(q) - t.y;
+}
+
+float3x3 sdfl_RotationMatrix(float3 angles) {
+    float cx = cos(angles.x);
+    float sx = sin(angles.x);
+    float cy = cos(angles.y);
+    float sy = sin(angles.y);
+    float cz = cos(angles.z);
+    float sz = sin(angles.z);
+    return float3x3(cy * cz, cz * sx * sy - cx * sz, sx * sz + cx * cz * sy, cy * sz, cx * cz + sx * sy * sz, cx * sy * sz - cz * sx, -sy, cy * sx, cx * cy);
+}
+
+SceneResult sdfl_builtin_union(SceneResult d1, SceneResult d2) {
+    if (d1.distance < d2.distance) {
+        return sdfl_make_SceneResult(d1.distance, d1.materialId);
+    } else {
+        return sdfl_make_SceneResult(d2.distance, d2.materialId);
+    }
+}
+
+SceneResult sdfl_builtin_subtraction(SceneResult d1, SceneResult d2) {
+    float dist = max(d2.distance, -d1.distance);
+    return sdfl_make_SceneResult(dist, d2.materialId);
+}
+
+SceneResult sdfl_builtin_intersection(SceneResult d1, SceneResult d2) {
+    if (d1.distance > d2.distance) {
+        return sdfl_make_SceneResult(d1.distance, d1.materialId);
+    } else {
+        return sdfl_make_SceneResult(d2.distance, d2.materialId);
+    }
+}
+
+SceneResult sdfl_builtin_smoothUnion(SceneResult d1, SceneResult d2, float k) {
+    float h = clamp(0.5 + 0.5 * (d2.distance - d1.distance) / k, 0.0, 1.0);
+    float dist = lerp(d2.distance, d1.distance, h) - k * h * (1.0 - h);
+    int matId = (h > 0.5) ? d1.materialId : d2.materialId;
+    return sdfl_make_SceneResult(dist, matId);
+}
+
+SceneResult sdfl_builtin_smoothSubtraction(SceneResult d1, SceneResult d2, float k) {
+    float h = clamp(0.5 - 0.5 * (d2.distance + d1.distance) / k, 0.0, 1.0);
+    float dist = lerp(d2.distance, -d1.distance, h) + k * h * (1.0 - h);
+    return sdfl_make_SceneResult(dist, d2.materialId);
+}
+
+SceneResult sdfl_builtin_smoothIntersection(SceneResult d1, SceneResult d2, float k) {
+    float h = clamp(0.5 - 0.5 * (d2.distance - d1.distance) / k, 0.0, 1.0);
+    float dist = lerp(d2.distance, d1.distance, h) + k * h * (1.0 - h);
+    int matId = (h > 0.5) ? d1.materialId : d2.materialId;
+    return sdfl_make_SceneResult(dist, matId);
+}
+
+float sdfl_builtin_hash(float2 co) {
+    return frac(sin(dot(co, float2(12.9898, 78.233))) * 43758.5453);
+}
+
+float sdfl_builtin_noise_simple(float2 point_) {
+    float2 p = frac(point_);
+    p = smoothstep(((float2)0.), ((float2)1.), p);
+    float2 id = floor(point_);
+    float2 off = float2(1., 0.);
+    float2 bl = id + off.yy;
+    float2 br = id + off.xy;
+    float2 tl = id + off.yx;
+    float2 tr = id + off.xx;
+    float b = lerp(sdfl_builtin_hash(bl), sdfl_builtin_hash(br), p.x);
+    float t = lerp(sdfl_builtin_hash(tl), sdfl_builtin_hash(tr), p.x);
+    float val = lerp(b, t, p.y);
+    return val;
+}
+
+float sdfl_builtin_noise(float2 point_) {
+    float noise_ = sdfl_builtin_noise_simple(point_) * sdfl_builtin_noise_simple(point_ * 4.) * 0.5 + sdfl_builtin_noise_simple(point_ * 8.) * 0.25 + sdfl_builtin_noise_simple(point_ * 16.) * 0.125 + sdfl_builtin_noise_simple(point_ * 32.) * 0.0625 + sdfl_builtin_noise_simple(point_ * 64.) * 0.03125;
+    return noise_;
+}
+
+float sdfl_builtin_time(float2 p) {
+    return elapsed_time;
+}
+
+float sdfl_AnimTime(float start, float end, bool loop) {
+    float t = sdfl_builtin_time(((float2)0.));
+    return loop && end > start ? start + ((t - start) - (end - start) * floor((t - start) / (end - start))) : t;
+}
+
+float sdfl_AnimSegment(float t, float start, float end) {
+    return end > start ? clamp((t - start) / (end - start), 0., 1.) : step(start, t);
+}
+
+float sdfl_Oscillate(float freq) {
+    return sin(6.28318530718 * freq * sdfl_builtin_time(((float2)0.)));
+}
+
+float sdfl_ease_cubicInOut(float x) {
+    return x < .5 ? 4. * x * x * x : 1. - pow(-2. * x + 2., 3.) / 2.;
+}
+
+Material sdfl_GetMaterial(int id) {
+    Material mat;
+    if (id == 0) {
+        mat.albedo = float3(0.8, 0.8, 0.8);
+        mat.roughness = 0.9;
+        mat.metallic = 0.0;
+        mat.emission = float3(0.0, 0.0, 0.0);
+        mat.reflectivity = 0.0;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    } else if (id == 1) {
+        mat.albedo = float3(0.2, 0.6, 1.0);
+        mat.roughness = 0.3;
+        mat.metallic = 0.1;
+        mat.emission = float3(0.0, 0.0, 0.0);
+        mat.reflectivity = 0.0;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    } else if (id == 2) {
+        mat.albedo = float3(1.0, 0.3, 0.2);
+        mat.roughness = 0.1;
+        mat.metallic = 0.0;
+        mat.emission = float3(0.1, 0.0, 0.0);
+        mat.reflectivity = 0.0;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    } else if (id == 3) {
+        mat.albedo = float3(0.0, 0.0, 0.0);
+        mat.roughness = 1.0;
+        mat.metallic = 10.0;
+        mat.emission = float3(0.2, 0.2, 0.2);
+        mat.reflectivity = 0.0;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    } else if (id == 4) {
+        mat.albedo = float3(0.9, 0.9, 0.9);
+        mat.roughness = 0.1;
+        mat.metallic = 1.0;
+        mat.emission = float3(0.0, 0.0, 0.0);
+        mat.reflectivity = 0.8;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    } else if (id == 5) {
+        mat.albedo = float3(0.95, 0.97, 1.0);
+        mat.roughness = 0.05;
+        mat.metallic = 0.0;
+        mat.emission = float3(0.0, 0.0, 0.0);
+        mat.reflectivity = 0.1;
+        mat.ior = 1.5;
+        mat.transparency = 0.9;
+    } else {
+        mat.albedo = float3(0.5, 0.5, 0.5);
+        mat.roughness = 0.5;
+        mat.metallic = 0.0;
+        mat.emission = float3(0.0, 0.0, 0.0);
+        mat.reflectivity = 0.0;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    }
+    return mat;
+}
+
+SceneResult blob(float3 p) {
+    SceneResult best = sdfl_make_SceneResult(SDFL_MAX_DISTANCE, 0);
+    SceneResult sd0 = sdfl_make_SceneResult(sdfl_builtin_sphere(p, float3(0.0, 0.5, 0.0), 0.6), 0);
+    SceneResult sd1 = sdfl_make_SceneResult(sdfl_builtin_ellipsoid(p, float3(0.0, 0.0, 0.0), float3(1.0, 0.4, 0.6)), 0);
+    SceneResult sd2 = sdfl_builtin_smoothUnion(sd0, sd1, 0.3);
+    best = sdfl_builtin_union(sd2, best);
+    return best;
+}
+
+SceneResult sdfl_GetDistScene(float3 p) {
+    SceneResult best = sdfl_make_SceneResult(SDFL_MAX_DISTANCE, 0);
+    SceneResult sd3 = sdfl_make_SceneResult(sdfl_builtin_plane(p, -1.0), 0);
+    best = sdfl_builtin_union(sd3, best);
+    SceneResult sd4 = blob(p);
+    best = sdfl_builtin_union(sd4, best);
+    float3 pivot0 = float3(2.0, 0.0, 0.0);
+    float3x3 rotation0 = sdfl_RotationMatrix(radians(float3(30.0, sdfl_builtin_time(p.xy) * 20.0, 0.0)));
+    float3 q0 = mul((p - pivot0), rotation0) + pivot0;
+    SceneResult sd5 = sdfl_make_SceneResult(sdfl_builtin_torus(q0, float3(2.0, 0.0, 0.0), 1.0 + (0.25 * sdfl_Oscillate(0.5)), 0.2), 4);
+    best = sdfl_builtin_union(sd5, best);
+    SceneResult sd6 = sdfl_make_SceneResult(sdfl_builtin_cylinder(p, float3(3.0, -1.0, -2.0), float3(3.0, 1.0 + 0.1 * sdfl_asinh(sdfl_builtin_time(p.xy)), -2.0), 0.2), 0);
+    SceneResult sd7 = sdfl_make_SceneResult(sdfl_builtin_sphere(p, lerp(float3(3.0, 1.0, -2.0), float3(3.0, 2.0, -2.0), ((float3)(0.5 + 0.5 * sin(sdfl_builtin_time(p.xy))))), 0.3 * exp(0.1)), 5);
+    SceneResult sd8 = sdfl_builtin_union(sd6, sd7);
+    best = sdfl_builtin_union(sd8, best);
+    SceneResult sd9 = sdfl_make_SceneResult(sdfl_builtin_box(p, float3(-3.0, 0.0, -2.0), float3(0.5, 0.5, 0.5)), 0);
+    SceneResult sd10 = sdfl_make_SceneResult(sdfl_builtin_sphere(p, float3(-3.0, 0.5, -2.0), pow(0.5, 2.0) + sdfl_builtin_hash(p.xy)), 0);
+    SceneResult sd11 = sdfl_builtin_subtraction(sd9, sd10);
+    best = sdfl_builtin_union(sd11, best);
+    SceneResult sd12 = sdfl_make_SceneResult(sdfl_builtin_sphere(p, lerp(float3(0.0, 2.0, 0.0), float3(0.0, 3.0, 0.0), ((float3)sdfl_ease_cubicInOut(sdfl_AnimSegment(sdfl_AnimTime(0.0, 2.0, true), 0.0, 2.0)))), (sdfl_builtin_time(p.xy) < 2.0 ? 0.3 : 0.4)), 0);
+    best = sdfl_builtin_union(sd12, best);
+    if (sdfl_builtin_box(p, float3(-0.6, 0.8, -0.175), float3(1.901, 1.801, 4.426)) < best.distance) {
+        if (sdfl_builtin_box(p, float3(-0.85, 0.9, -2.05), float3(1.651, 1.701, 2.551)) < best.distance) {
+            if (sdfl_builtin_box(p, float3(0.0, 2.0, -4.0), float3(0.601, 0.601, 0.601)) < best.distance) {
+                SceneResult sd13 = sdfl_make_SceneResult(sdfl_builtin_sphere(p, float3(0.0, 2.0, -4.0), 0.8), 0);
+                SceneResult sd14 = sdfl_make_SceneResult(sdfl_builtin_box(p, float3(0.0, 2.0, -4.0), float3(0.6, 0.6, 0.6)), 0);
+                SceneResult sd15 = sdfl_builtin_intersection(sd13, sd14);
+                best = sdfl_builtin_union(sd15, best);
+            }
+            if (sdfl_builtin_box(p, float3(-0.85, 0.0, -1.65), float3(1.651, 0.801, 2.151)) < best.distance) {
+                if (sdfl_builtin_box(p, float3(0.0, 0.0, -3.0), float3(0.801, 0.801, 0.801)) < best.distance) {
+                    SceneResult sd16 = sdfl_make_SceneResult(sdfl_builtin_sphere(p, float3(0.0, 0.0, -3.0), 1.0), 0);
+                    SceneResult sd17 = sdfl_make_SceneResult(sdfl_builtin_box(p, float3(0.0, 0.0, -3.0), float3(0.8, 0.8, 0.8)), 0);
+                    SceneResult sd18 = sdfl_builtin_smoothIntersection(sd16, sd17, 0.05);
+                    best = sdfl_builtin_union(sd18, best);
+                }
+                if (sdfl_builtin_box(p, float3(-2.0, 0.0, 0.0), float3(0.501, 0.158, 0.501)) < best.distance) {
+                    SceneResult sd19 = sdfl_make_SceneResult(sdfl_builtin_sphere(p, float3(-2.0, 0.0, 0.0), 0.7 + 0.1 * sdfl_builtin_noise(p.xy)), 0);
+                    SceneResult sd20 = sdfl_make_SceneResult(sdfl_builtin_box(p, float3(-2.0, 0.0, 0.0), smoothstep(((float3)0.4), float3(0.6, 0.8, 0.6), ((float3)0.5))), 0);
+                    SceneResult sd21 = sdfl_builtin_smoothSubtraction(sd19, sd20, 0.1);
+                    best = sdfl_builtin_union(sd21, best);
+                }
+            }
+        }
+        if (sdfl_builtin_box(p, float3(0.025, -0.35, 2.975), float3(1.276, 0.651, 1.277)) < best.distance) {
+            if (sdfl_builtin_box(p, float3(-0.475, -0.7, 2.0), float3(0.726, 0.251, 0.251)) < best.distance) {
+                SceneResult sd22 = sdfl_make_SceneResult(sdfl_builtin_sphere(p, float3(-1.0, -0.7, 2.0), 0.2 + 0.0 / 20.0), 0);
+                best = sdfl_builtin_union(sd22, best);
+                SceneResult sd23 = sdfl_make_SceneResult(sdfl_builtin_sphere(p, float3(0.0, -0.7, 2.0), 0.2 + 1.0 / 20.0), 0);
+                best = sdfl_builtin_union(sd23, best);
+            }
+            if (sdfl_builtin_box(p, float3(0.025, -0.35, 2.975), float3(1.276, 0.651, 1.277)) < best.distance) {
+                if (sdfl_builtin_box(p, float3(0.0, 0.0, 3.0), float3(1.251, 0.301, 1.252)) < best.distance) {
+                    SceneResult sd24 = sdfl_make_SceneResult(SDFL_MAX_DISTANCE, 0);
+                    if (sdfl_builtin_time(p.xy) > 4.0 && !((sdfl_builtin_time(p.xy) > 8.0))) {
+                        SceneResult sd25 = sdfl_make_SceneResult(sdfl_builtin_torus(p, float3(0.0, 0.0, 3.0), 1.0, 0.25), 0);
+                        sd24 = sd25;
+                    } else {
+                        SceneResult sd26 = sdfl_make_SceneResult(sdfl_builtin_box(p, float3(0.0, 0.0, 3.0), float3(0.3, 0.3, 0.3)), 0);
+                        sd24 = sd26;
+                    }
+                    best = sdfl_builtin_union(sd24, best);
+                }
+                SceneResult sd27 = sdfl_make_SceneResult(sdfl_builtin_sphere(p, float3(1.0, -0.7, 2.0), 0.2 + 2.0 / 20.0), 0);
+                best = sdfl_builtin_union(sd27, best);
+            }
+        }
+    }
+    return best;
+}
+
+SceneResult sdfl_RayMarch(float3 ray_origin, float3 ray_dir) {
+    float dfo = 0.;
+    SceneResult result = sdfl_make_SceneResult(SDFL_MAX_DISTANCE, 0);
+    for (int i = 0; i < SDFL_MAX_STEPS; i++) {
+        float3 p = ray_origin + ray_dir * dfo;
+        SceneResult scene = sdfl_GetDistScene(p);
+        dfo += scene.distance;
+        result.materialId = scene.materialId;
+        if (dfo > SDFL_MAX_DISTANCE || scene.distance < SDFL_HIT_DISTANCE) {
+            break;
+        }
+    }
+    result.distance = dfo;
+    return result;
+}
+
+float3 sdfl_GetNormal(float3 p) {
+    float d = sdfl_GetDistScene(p).distance;
+    float2 off = float2(.01, 0.);
+    float3 normal = float3(d - sdfl_GetDistScene(p - off.xyy).distance, d - sdfl_GetDistScene(p - off.yxy).distance, d - sdfl_GetDistScene(p - off.yyx).distance);
+    return normalize(normal);
+}
+
+float sdfl_GetShadow(float3 p, float3 light_dir, float light_distance) {
+    float shadow = 1.0;
+    float penumbra_factor = 10.0;
+    float3 start_pos = p + sdfl_GetNormal(p) * SDFL_SHADOW_CAST_DISTANCE;
+    float t = 0.0;
+    for (int i = 0; i < 32; i++) {
+        float3 ray_pos = start_pos + light_dir * t;
+        SceneResult result = sdfl_GetDistScene(ray_pos);
+        if (result.distance + SDFL_SHADOW_CAST_DISTANCE < SDFL_SHADOW_CAST_DISTANCE) {
+            return 0.1;
+        }
+        shadow = min(shadow, penumbra_factor * result.distance / t);
+        t += result.distance;
+        if (t >= light_distance) {
+            break;
+        }
+    }
+    return clamp(shadow, 0.1, 1.0);
+}
+
+float3 sdfl_CalculateLighting(float3 p, float3 view_dir, Material mat) {
+    float3 light_pos = float3(0.0, 8.0, 8.0);
+    float3 light_color = float3(1.0, 0.95, 0.8);
+    float light_intensity = 2.0;
+    float3 light_dir = normalize(light_pos - p);
+    float3 normal = sdfl_GetNormal(p);
+    float3 half_dir = normalize(light_dir + view_dir);
+    float light_distance = distance(light_pos, p);
+    float attenuation = 1.0 / (1.0 + 0.1 * light_distance + 0.01 * light_distance * light_distance);
+    float ndotl = max(dot(normal, light_dir), 0.0);
+    float3 diffuse = mat.albedo * light_color * ndotl * light_intensity * attenuation;
+    float ndoth = max(dot(normal, half_dir), 0.0);
+    float roughness2 = mat.roughness * mat.roughness;
+    float spec_power = 2.0 / (roughness2 * roughness2) - 2.0;
+    float3 specular = lerp(((float3)0.04), mat.albedo, ((float3)mat.metallic)) * light_color * pow(ndoth, spec_power) * light_intensity * attenuation;
+    float shadow = sdfl_GetShadow(p, light_dir, light_distance);
+    float3 ambient = mat.albedo * 0.1;
+    return ambient + (diffuse + specular) * shadow + mat.emission;
+}
+
+SceneResult sdfl_RayMarchInside(float3 ray_origin, float3 ray_dir) {
+    float dfo = 0.;
+    SceneResult result = sdfl_make_SceneResult(SDFL_MAX_DISTANCE, 0);
+    for (int i = 0; i < SDFL_MAX_STEPS; i++) {
+        float3 p = ray_origin + ray_dir * dfo;
+        SceneResult scene = sdfl_GetDistScene(p);
+        dfo -= scene.distance;
+        result.materialId = scene.materialId;
+        if (dfo > SDFL_MAX_DISTANCE || -scene.distance < SDFL_HIT_DISTANCE) {
+            break;
+        }
+    }
+    result.distance = dfo;
+    return result;
+}
+
+float3 sdfl_Trace(float3 p, float3 ray_dir, Material mat, float3 background) {
+    float3 color = ((float3)0.);
+    float3 throughput = ((float3)1.);
+    bool inside = false;
+    for (int bounce = 0; bounce < 2; bounce++) {
+        float3 normal = sdfl_GetNormal(p);
+        if (!inside) {
+            color += throughput * sdfl_CalculateLighting(p, -ray_dir, mat) * max(1. - mat.reflectivity - mat.transparency, 0.);
+        }
+        if (mat.transparency > 0.) {
+            float3 n = inside ? -normal : normal;
+            float3 refracted = refract(ray_dir, n, inside ? mat.ior : 1. / mat.ior);
+            if (dot(refracted, refracted) == 0.) {
+                ray_dir = reflect(ray_dir, n);
+                p += n * SDFL_SHADOW_CAST_DISTANCE;
+            } else {
+                if (!inside) {
+                    throughput *= mat.transparency * mat.albedo;
+                }
+                ray_dir = refracted;
+                p -= n * SDFL_SHADOW_CAST_DISTANCE;
+                inside = !inside;
+            }
+        } else if (mat.reflectivity > 0.) {
+            throughput *= mat.reflectivity * lerp(((float3)1.), mat.albedo, ((float3)mat.metallic));
+            ray_dir = reflect(ray_dir, normal);
+            p += normal * SDFL_SHADOW_CAST_DISTANCE;
+        } else {
+            return color;
+        }
+        SceneResult result;
+        if (inside) {
+            result = sdfl_RayMarchInside(p, ray_dir);
+        } else {
+            result = sdfl_RayMarch(p, ray_dir);
+        }
+        if (result.distance >= SDFL_MAX_DISTANCE) {
+            return color + throughput * lerp(float3(0.5, 0.7, 1.0), background, ((float3)(ray_dir.y * 0.5 + 0.5)));
+        }
+        p += ray_dir * result.distance;
+        mat = sdfl_GetMaterial(result.materialId);
+    }
+    return color + throughput * sdfl_CalculateLighting(p, -ray_dir, mat);
+}
+
+float3 sdfl_post_fog(float3 color, float dist, float density, float3 fog_color) {
+    return lerp(color, fog_color, ((float3)(1. - exp(-density * dist))));
+}
+
+float3 sdfl_post_ambientOcclusion(float3 color, float3 p, float samples, float strength) {
+    float3 normal = sdfl_GetNormal(p);
+    float occlusion = 0.;
+    float falloff = 1.;
+    for (int i = 0; i < 16; i++) {
+        if (float(i) >= samples) {
+            break;
+        }
+        float h = .01 + .12 * float(i) / max(samples - 1., 1.);
+        float d = sdfl_GetDistScene(p + normal * h).distance;
+        occlusion += (h - d) * falloff;
+        falloff *= .95;
+    }
+    return color * lerp(1., clamp(1. - 3. * occlusion, 0., 1.), strength);
+}
+
+float3 sdfl_post_toneMap_aces(float3 color) {
+    return clamp(color * (2.51 * color + .03) / (color * (2.43 * color + .59) + .14), ((float3)0.), ((float3)1.));
+}
+
+float3 sdfl_post_bloom(float3 color, float threshold, float intensity) {
+    return color + max(color - threshold, ((float3)0.)) * intensity;
+}
+
+float3 sdfl_post_gamma(float3 color, float value) {
+    return pow(max(color, ((float3)0.)), ((float3)(1. / value)));
+}
+
+float3 sdfl_post_vignette(float3 color, float2 uv, float strength, float radius) {
+    float v = max(length(uv) - radius, 0.);
+    return color * max(1. - strength * v * v, 0.);
+}
+
+float4 sdfl_Render(float2 vertex_uv) {
+    float3 cam_pos = float3(0.0, 3.0, 9.0);
+    float2 uv = vertex_uv * 2. - 1.;
+    uv.y *= float(window_size.y) / float(window_size.x);
+    float3 ray_dir = normalize(float3(uv, -1.0));
+    SceneResult result = sdfl_RayMarch(cam_pos, ray_dir);
+    float3 color = lerp(float3(0.5, 0.7, 1.0), float3(0.6, 0.7, 0.8), ((float3)(uv.y * 0.5 + 0.5)));
+    if (result.distance < SDFL_MAX_DISTANCE) {
+        float3 p = cam_pos + ray_dir * result.distance;
+        color = sdfl_Trace(p, ray_dir, sdfl_GetMaterial(result.materialId), float3(0.6, 0.7, 0.8));
+    }
+    color = sdfl_post_fog(color, result.distance, 0.04, float3(0.6, 0.7, 0.8));
+    if (result.distance < SDFL_MAX_DISTANCE) {
+        color = sdfl_post_ambientOcclusion(color, cam_pos + ray_dir * result.distance, 5.0, 1.0);
+    }
+    color = sdfl_post_toneMap_aces(color);
+    color = sdfl_post_bloom(color, 0.8, 0.5);
+    color = sdfl_post_gamma(color, 2.2);
+    color = sdfl_post_vignette(color, uv, 0.5, 0.5);
+    return float4(color, 1.0);
+}
+
+float4 main(float2 o_vertex_uv : TEXCOORD0) : SV_Target {
+    return sdfl_Render(o_vertex_uv);
+}
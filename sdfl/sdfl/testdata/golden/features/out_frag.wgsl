@@ -0,0 +1,495 @@
+// sdfl generated code
+
+struct SdflUniforms {
+    window_size: vec2i,
+    elapsed_time: f32,
+}
+
+@group(0) @binding(0) var<uniform> sdfl_uniforms: SdflUniforms;
+
+struct Material {
+    albedo: vec3f,
+    roughness: f32,
+    metallic: f32,
+    emission: vec3f,
+    reflectivity: f32,
+    ior: f32,
+    transparency: f32,
+}
+
+struct SceneResult {
+    distance: f32,
+    materialId: i32,
+}
+
+const SDFL_MAX_STEPS: i32 = 100;
+const SDFL_MAX_DISTANCE: f32 = 100.;
+const SDFL_HIT_DISTANCE: f32 = .01;
+const SDFL_SHADOW_CAST_DISTANCE: f32 = .05;
+
+fn sdfl_builtin_plane(p: vec3f, height: f32) -> f32 {
+    return p.y - height;
+}
+
+fn sdfl_builtin_sphere(p: vec3f, pos: vec3f, r: f32) -> f32 {
+    return distance(pos, p) - r;
+}
+
+fn sdfl_builtin_cylinder(p: vec3f, a: vec3f, b: vec3f, r: f32) -> f32 {
+    var ba: vec3f = b - a;
+    var pa: vec3f = p - a;
+    var baba: f32 = dot(ba, ba);
+    var paba: f32 = dot(pa, ba);
+    var x: f32 = length(pa * baba - ba * paba) - r * baba;
+    var y: f32 = abs(paba - baba * 0.5) - baba * 0.5;
+    var x2: f32 = x * x;
+    var y2: f32 = y * y * baba;
+    var d: f32 = select(((select(0.0, x2, (x > 0.0))) + (select(0.0, y2, (y > 0.0)))), -min(x2, y2), (max(x, y) < 0.0));
+    return sign(d) * sqrt(abs(d)) / baba;
+}
+
+fn sdfl_builtin_ellipsoid(p: vec3f, pos: vec3f, r: vec3f) -> f32 {
+    var q: vec3f = (p - pos) / r;
+    return (length(q) - 1.0) * min(min(r.x, r.y), r.z);
+}
+
+fn sdfl_builtin_box(p: vec3f, bpos: vec3f, bsize: vec3f) -> f32 {
+    var q: vec3f = abs(p - bpos) - bsize;
+    return length(max(q, vec3f(0.0))) + min(max(q.x, max(q.y, q.z)), 0.0);
+}
+
+fn sdfl_builtin_torus(p: vec3f, pos: vec3f, radius: f32, thickness: f32) -> f32 {
+    var wp: vec3f = p - pos;
+    var t: vec2f = vec2f(radius, thickness);
+    var q: vec2f = vec2f(length(wp.xz) - t.x, wp.y);
+    return length(q) - t.y;
+}
+
+fn sdfl_RotationMatrix(angles: vec3f) -> mat3x3f {
+    var cx: f32 = cos(angles.x);
+    var sx: f32 = sin(angles.x);
+    var cy: f32 = cos(angles.y);
+    var sy: f32 = sin(angles.y);
+    var cz: f32 = cos(angles.z);
+    var sz: f32 = sin(angles.z);
+    return mat3x3f(cy * cz, cz * sx * sy - cx * sz, sx * sz + cx * cz * sy, cy * sz, cx * cz + sx * sy * sz, cx * sy * sz - cz * sx, -sy, cy * sx, cx * cy);
+}
+
+fn sdfl_builtin_union(d1: SceneResult, d2: SceneResult) -> SceneResult {
+    if (d1.distance < d2.distance) {
+        return SceneResult(d1.distance, d1.materialId);
+    } else {
+        return SceneResult(d2.distance, d2.materialId);
+    }
+}
+
+fn sdfl_builtin_subtraction(d1: SceneResult, d2: SceneResult) -> SceneResult {
+    var dist: f32 = max(d2.distance, -d1.distance);
+    return SceneResult(dist, d2.materialId);
+}
+
+fn sdfl_builtin_intersection(d1: SceneResult, d2: SceneResult) -> SceneResult {
+    if (d1.distance > d2.distance) {
+        return SceneResult(d1.distance, d1.materialId);
+    } else {
+        return SceneResult(d2.distance, d2.materialId);
+    }
+}
+
+fn sdfl_builtin_smoothUnion(d1: SceneResult, d2: SceneResult, k: f32) -> SceneResult {
+    var h: f32 = clamp(0.5 + 0.5 * (d2.distance - d1.distance) / k, 0.0, 1.0);
+    var dist: f32 = mix(d2.distance, d1.distance, h) - k * h * (1.0 - h);
+    var matId: i32 = select(d2.materialId, d1.materialId, (h > 0.5));
+    return SceneResult(dist, matId);
+}
+
+fn sdfl_builtin_smoothSubtraction(d1: SceneResult, d2: SceneResult, k: f32) -> SceneResult {
+    var h: f32 = clamp(0.5 - 0.5 * (d2.distance + d1.distance) / k, 0.0, 1.0);
+    var dist: f32 = mix(d2.distance, -d1.distance, h) + k * h * (1.0 - h);
+    return SceneResult(dist, d2.materialId);
+}
+
+fn sdfl_builtin_smoothIntersection(d1: SceneResult, d2: SceneResult, k: f32) -> SceneResult {
+    var h: f32 = clamp(0.5 - 0.5 * (d2.distance - d1.distance) / k, 0.0, 1.0);
+    var dist: f32 = mix(d2.distance, d1.distance, h) + k * h * (1.0 - h);
+    var matId: i32 = select(d2.materialId, d1.materialId, (h > 0.5));
+    return SceneResult(dist, matId);
+}
+
+fn sdfl_builtin_hash(co: vec2f) -> f32 {
+    return fract(sin(dot(co, vec2f(12.9898, 78.233))) * 43758.5453);
+}
+
+fn sdfl_builtin_noise_simple(point: vec2f) -> f32 {
+    var p: vec2f = fract(point);
+    p = smoothstep(vec2f(0.), vec2f(1.), p);
+    var id: vec2f = floor(point);
+    var off: vec2f = vec2f(1., 0.);
+    var bl: vec2f = id + off.yy;
+    var br: vec2f = id + off.xy;
+    var tl: vec2f = id + off.yx;
+    var tr: vec2f = id + off.xx;
+    var b: f32 = mix(sdfl_builtin_hash(bl), sdfl_builtin_hash(br), p.x);
+    var t: f32 = mix(sdfl_builtin_hash(tl), sdfl_builtin_hash(tr), p.x);
+    var val: f32 = mix(b, t, p.y);
+    return val;
+}
+
+fn sdfl_builtin_noise(point: vec2f) -> f32 {
+    var noise: f32 = sdfl_builtin_noise_simple(point) * sdfl_builtin_noise_simple(point * 4.) * 0.5 + sdfl_builtin_noise_simple(point * 8.) * 0.25 + sdfl_builtin_noise_simple(point * 16.) * 0.125 + sdfl_builtin_noise_simple(point * 32.) * 0.0625 + sdfl_builtin_noise_simple(point * 64.) * 0.03125;
+    return noise;
+}
+
+fn sdfl_builtin_time(p: vec2f) -> f32 {
+    return sdfl_uniforms.elapsed_time;
+}
+
+fn sdfl_AnimTime(start: f32, end: f32, loop_: bool) -> f32 {
+    var t: f32 = sdfl_builtin_time(vec2f(0.));
+    return select(t, start + ((t - start) - (end - start) * floor((t - start) / (end - start))), loop_ && end > start);
+}
+
+fn sdfl_AnimSegment(t: f32, start: f32, end: f32) -> f32 {
+    return select(step(start, t), clamp((t - start) / (end - start), 0., 1.), end > start);
+}
+
+fn sdfl_Oscillate(freq: f32) -> f32 {
+    return sin(6.28318530718 * freq * sdfl_builtin_time(vec2f(0.)));
+}
+
+fn sdfl_ease_cubicInOut(x: f32) -> f32 {
+    return select(1. - pow(-2. * x + 2., 3.) / 2., 4. * x * x * x, x < .5);
+}
+
+fn sdfl_GetMaterial(id: i32) -> Material {
+    var mat: Material;
+    if (id == 0) {
+        mat.albedo = vec3f(0.8, 0.8, 0.8);
+        mat.roughness = 0.9;
+        mat.metallic = 0.0;
+        mat.emission = vec3f(0.0, 0.0, 0.0);
+        mat.reflectivity = 0.0;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    } else if (id == 1) {
+        mat.albedo = vec3f(0.2, 0.6, 1.0);
+        mat.roughness = 0.3;
+        mat.metallic = 0.1;
+        mat.emission = vec3f(0.0, 0.0, 0.0);
+        mat.reflectivity = 0.0;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    } else if (id == 2) {
+        mat.albedo = vec3f(1.0, 0.3, 0.2);
+        mat.roughness = 0.1;
+        mat.metallic = 0.0;
+        mat.emission = vec3f(0.1, 0.0, 0.0);
+        mat.reflectivity = 0.0;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    } else if (id == 3) {
+        mat.albedo = vec3f(0.0, 0.0, 0.0);
+        mat.roughness = 1.0;
+        mat.metallic = 10.0;
+        mat.emission = vec3f(0.2, 0.2, 0.2);
+        mat.reflectivity = 0.0;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    } else if (id == 4) {
+        mat.albedo = vec3f(0.9, 0.9, 0.9);
+        mat.roughness = 0.1;
+        mat.metallic = 1.0;
+        mat.emission = vec3f(0.0, 0.0, 0.0);
+        mat.reflectivity = 0.8;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    } else if (id == 5) {
+        mat.albedo = vec3f(0.95, 0.97, 1.0);
+        mat.roughness = 0.05;
+        mat.metallic = 0.0;
+        mat.emission = vec3f(0.0, 0.0, 0.0);
+        mat.reflectivity = 0.1;
+        mat.ior = 1.5;
+        mat.transparency = 0.9;
+    } else {
+        mat.albedo = vec3f(0.5, 0.5, 0.5);
+        mat.roughness = 0.5;
+        mat.metallic = 0.0;
+        mat.emission = vec3f(0.0, 0.0, 0.0);
+        mat.reflectivity = 0.0;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    }
+    return mat;
+}
+
+fn blob(p: vec3f) -> SceneResult {
+    var best: SceneResult = SceneResult(SDFL_MAX_DISTANCE, 0);
+    var sd0: SceneResult = SceneResult(sdfl_builtin_sphere(p, vec3f(0.0, 0.5, 0.0), 0.6), 0);
+    var sd1: SceneResult = SceneResult(sdfl_builtin_ellipsoid(p, vec3f(0.0, 0.0, 0.0), vec3f(1.0, 0.4, 0.6)), 0);
+    var sd2: SceneResult = sdfl_builtin_smoothUnion(sd0, sd1, 0.3);
+    best = sdfl_builtin_union(sd2, best);
+    return best;
+}
+
+fn sdfl_GetDistScene(p: vec3f) -> SceneResult {
+    var best: SceneResult = SceneResult(SDFL_MAX_DISTANCE, 0);
+    var sd3: SceneResult = SceneResult(sdfl_builtin_plane(p, -1.0), 0);
+    best = sdfl_builtin_union(sd3, best);
+    var sd4: SceneResult = blob(p);
+    best = sdfl_builtin_union(sd4, best);
+    var pivot0: vec3f = vec3f(2.0, 0.0, 0.0);
+    var rotation0: mat3x3f = sdfl_RotationMatrix(radians(vec3f(30.0, sdfl_builtin_time(p.xy) * 20.0, 0.0)));
+    var q0: vec3f = rotation0 * (p - pivot0) + pivot0;
+    var sd5: SceneResult = SceneResult(sdfl_builtin_torus(q0, vec3f(2.0, 0.0, 0.0), 1.0 + (0.25 * sdfl_Oscillate(0.5)), 0.2), 4);
+    best = sdfl_builtin_union(sd5, best);
+    var sd6: SceneResult = SceneResult(sdfl_builtin_cylinder(p, vec3f(3.0, -1.0, -2.0), vec3f(3.0, 1.0 + 0.1 * asinh(sdfl_builtin_time(p.xy)), -2.0), 0.2), 0);
+    var sd7: SceneResult = SceneResult(sdfl_builtin_sphere(p, mix(vec3f(3.0, 1.0, -2.0), vec3f(3.0, 2.0, -2.0), vec3f(0.5 + 0.5 * sin(sdfl_builtin_time(p.xy)))), 0.3 * exp(0.1)), 5);
+    var sd8: SceneResult = sdfl_builtin_union(sd6, sd7);
+    best = sdfl_builtin_union(sd8, best);
+    var sd9: SceneResult = SceneResult(sdfl_builtin_box(p, vec3f(-3.0, 0.0, -2.0), vec3f(0.5, 0.5, 0.5)), 0);
+    var sd10: SceneResult = SceneResult(sdfl_builtin_sphere(p, vec3f(-3.0, 0.5, -2.0), pow(0.5, 2.0) + sdfl_builtin_hash(p.xy)), 0);
+    var sd11: SceneResult = sdfl_builtin_subtraction(sd9, sd10);
+    best = sdfl_builtin_union(sd11, best);
+    var sd12: SceneResult = SceneResult(sdfl_builtin_sphere(p, mix(vec3f(0.0, 2.0, 0.0), vec3f(0.0, 3.0, 0.0), vec3f(sdfl_ease_cubicInOut(sdfl_AnimSegment(sdfl_AnimTime(0.0, 2.0, true), 0.0, 2.0)))), (select(0.4, 0.3, sdfl_builtin_time(p.xy) < 2.0))), 0);
+    best = sdfl_builtin_union(sd12, best);
+    if (sdfl_builtin_box(p, vec3f(-0.6, 0.8, -0.175), vec3f(1.901, 1.801, 4.426)) < best.distance) {
+        if (sdfl_builtin_box(p, vec3f(-0.85, 0.9, -2.05), vec3f(1.651, 1.701, 2.551)) < best.distance) {
+            if (sdfl_builtin_box(p, vec3f(0.0, 2.0, -4.0), vec3f(0.601, 0.601, 0.601)) < best.distance) {
+                var sd13: SceneResult = SceneResult(sdfl_builtin_sphere(p, vec3f(0.0, 2.0, -4.0), 0.8), 0);
+                var sd14: SceneResult = SceneResult(sdfl_builtin_box(p, vec3f(0.0, 2.0, -4.0), vec3f(0.6, 0.6, 0.6)), 0);
+                var sd15: SceneResult = sdfl_builtin_intersection(sd13, sd14);
+                best = sdfl_builtin_union(sd15, best);
+            }
+            if (sdfl_builtin_box(p, vec3f(-0.85, 0.0, -1.65), vec3f(1.651, 0.801, 2.151)) < best.distance) {
+                if (sdfl_builtin_box(p, vec3f(0.0, 0.0, -3.0), vec3f(0.801, 0.801, 0.801)) < best.distance) {
+                    var sd16: SceneResult = SceneResult(sdfl_builtin_sphere(p, vec3f(0.0, 0.0, -3.0), 1.0), 0);
+                    var sd17: SceneResult = SceneResult(sdfl_builtin_box(p, vec3f(0.0, 0.0, -3.0), vec3f(0.8, 0.8, 0.8)), 0);
+                    var sd18: SceneResult = sdfl_builtin_smoothIntersection(sd16, sd17, 0.05);
+                    best = sdfl_builtin_union(sd18, best);
+                }
+                if (sdfl_builtin_box(p, vec3f(-2.0, 0.0, 0.0), vec3f(0.501, 0.158, 0.501)) < best.distance) {
+                    var sd19: SceneResult = SceneResult(sdfl_builtin_sphere(p, vec3f(-2.0, 0.0, 0.0), 0.7 + 0.1 * sdfl_builtin_noise(p.xy)), 0);
+                    var sd20: SceneResult = SceneResult(sdfl_builtin_box(p, vec3f(-2.0, 0.0, 0.0), smoothstep(vec3f(0.4), vec3f(0.6, 0.8, 0.6), vec3f(0.5))), 0);
+                    var sd21: SceneResult = sdfl_builtin_smoothSubtraction(sd19, sd20, 0.1);
+                    best = sdfl_builtin_union(sd21, best);
+                }
+            }
+        }
+        if (sdfl_builtin_box(p, vec3f(0.025, -0.35, 2.975), vec3f(1.276, 0.651, 1.277)) < best.distance) {
+            if (sdfl_builtin_box(p, vec3f(-0.475, -0.7, 2.0), vec3f(0.726, 0.251, 0.251)) < best.distance) {
+                var sd22: SceneResult = SceneResult(sdfl_builtin_sphere(p, vec3f(-1.0, -0.7, 2.0), 0.2 + 0.0 / 20.0), 0);
+                best = sdfl_builtin_union(sd22, best);
+                var sd23: SceneResult = SceneResult(sdfl_builtin_sphere(p, vec3f(0.0, -0.7, 2.0), 0.2 + 1.0 / 20.0), 0);
+                best = sdfl_builtin_union(sd23, best);
+            }
+            if (sdfl_builtin_box(p, vec3f(0.025, -0.35, 2.975), vec3f(1.276, 0.651, 1.277)) < best.distance) {
+                if (sdfl_builtin_box(p, vec3f(0.0, 0.0, 3.0), vec3f(1.251, 0.301, 1.252)) < best.distance) {
+                    var sd24: SceneResult = SceneResult(SDFL_MAX_DISTANCE, 0);
+                    if (sdfl_builtin_time(p.xy) > 4.0 && !((sdfl_builtin_time(p.xy) > 8.0))) {
+                        var sd25: SceneResult = SceneResult(sdfl_builtin_torus(p, vec3f(0.0, 0.0, 3.0), 1.0, 0.25), 0);
+                        sd24 = sd25;
+                    } else {
+                        var sd26: SceneResult = SceneResult(sdfl_builtin_box(p, vec3f(0.0, 0.0, 3.0), vec3f(0.3, 0.3, 0.3)), 0);
+                        sd24 = sd26;
+                    }
+                    best = sdfl_builtin_union(sd24, best);
+                }
+                var sd27: SceneResult = SceneResult(sdfl_builtin_sphere(p, vec3f(1.0, -0.7, 2.0), 0.2 + 2.0 / 20.0), 0);
+                best = sdfl_builtin_union(sd27, best);
+            }
+        }
+    }
+    return best;
+}
+
+fn sdfl_RayMarch(ray_origin: vec3f, ray_dir: vec3f) -> SceneResult {
+    var dfo: f32 = 0.;
+    var result: SceneResult = SceneResult(SDFL_MAX_DISTANCE, 0);
+    for (var i: i32 = 0; i < SDFL_MAX_STEPS; i++) {
+        var p: vec3f = ray_origin + ray_dir * dfo;
+        var scene: SceneResult = sdfl_GetDistScene(p);
+        dfo += scene.distance;
+        result.materialId = scene.materialId;
+        if (dfo > SDFL_MAX_DISTANCE || scene.distance < SDFL_HIT_DISTANCE) {
+            break;
+        }
+    }
+    result.distance = dfo;
+    return result;
+}
+
+fn sdfl_GetNormal(p: vec3f) -> vec3f {
+    var d: f32 = sdfl_GetDistScene(p).distance;
+    var off: vec2f = vec2f(.01, 0.);
+    var normal: vec3f = vec3f(d - sdfl_GetDistScene(p - off.xyy).distance, d - sdfl_GetDistScene(p - off.yxy).distance, d - sdfl_GetDistScene(p - off.yyx).distance);
+    return normalize(normal);
+}
+
+fn sdfl_GetShadow(p: vec3f, light_dir: vec3f, light_distance: f32) -> f32 {
+    var shadow: f32 = 1.0;
+    var penumbra_factor: f32 = 10.0;
+    var start_pos: vec3f = p + sdfl_GetNormal(p) * SDFL_SHADOW_CAST_DISTANCE;
+    var t: f32 = 0.0;
+    for (var i: i32 = 0; i < 32; i++) {
+        var ray_pos: vec3f = start_pos + light_dir * t;
+        var result: SceneResult = sdfl_GetDistScene(ray_pos);
+        if (result.distance + SDFL_SHADOW_CAST_DISTANCE < SDFL_SHADOW_CAST_DISTANCE) {
+            return 0.1;
+        }
+        shadow = min(shadow, penumbra_factor * result.distance / t);
+        t += result.distance;
+        if (t >= light_distance) {
+            break;
+        }
+    }
+    return clamp(shadow, 0.1, 1.0);
+}
+
+fn sdfl_CalculateLighting(p: vec3f, view_dir: vec3f, mat: Material) -> vec3f {
+    var light_pos: vec3f = vec3f(0.0, 8.0, 8.0);
+    var light_color: vec3f = vec3f(1.0, 0.95, 0.8);
+    var light_intensity: f32 = 2.0;
+    var light_dir: vec3f = normalize(light_pos - p);
+    var normal: vec3f = sdfl_GetNormal(p);
+    var half_dir: vec3f = normalize(light_dir + view_dir);
+    var light_distance: f32 = distance(light_pos, p);
+    var attenuation: f32 = 1.0 / (1.0 + 0.1 * light_distance + 0.01 * light_distance * light_distance);
+    var ndotl: f32 = max(dot(normal, light_dir), 0.0);
+    var diffuse: vec3f = mat.albedo * light_color * ndotl * light_intensity * attenuation;
+    var ndoth: f32 = max(dot(normal, half_dir), 0.0);
+    var roughness2: f32 = mat.roughness * mat.roughness;
+    var spec_power: f32 = 2.0 / (roughness2 * roughness2) - 2.0;
+    var specular: vec3f = mix(vec3f(0.04), mat.albedo, vec3f(mat.metallic)) * light_color * pow(ndoth, spec_power) * light_intensity * attenuation;
+    var shadow: f32 = sdfl_GetShadow(p, light_dir, light_distance);
+    var ambient: vec3f = mat.albedo * 0.1;
+    return ambient + (diffuse + specular) * shadow + mat.emission;
+}
+
+fn sdfl_RayMarchInside(ray_origin: vec3f, ray_dir: vec3f) -> SceneResult {
+    var dfo: f32 = 0.;
+    var result: SceneResult = SceneResult(SDFL_MAX_DISTANCE, 0);
+    for (var i: i32 = 0; i < SDFL_MAX_STEPS; i++) {
+        var p: vec3f = ray_origin + ray_dir * dfo;
+        var scene: SceneResult = sdfl_GetDistScene(p);
+        dfo -= scene.distance;
+        result.materialId = scene.materialId;
+        if (dfo > SDFL_MAX_DISTANCE || -scene.distance < SDFL_HIT_DISTANCE) {
+            break;
+        }
+    }
+    result.distance = dfo;
+    return result;
+}
+
+fn sdfl_Trace(p_in: vec3f, ray_dir_in: vec3f, mat_in: Material, background: vec3f) -> vec3f {
+    var p: vec3f = p_in;
+    var ray_dir: vec3f = ray_dir_in;
+    var mat: Material = mat_in;
+    var color: vec3f = vec3f(0.);
+    var throughput: vec3f = vec3f(1.);
+    var inside: bool = false;
+    for (var bounce: i32 = 0; bounce < 2; bounce++) {
+        var normal: vec3f = sdfl_GetNormal(p);
+        if (!inside) {
+            color += throughput * sdfl_CalculateLighting(p, -ray_dir, mat) * max(1. - mat.reflectivity - mat.transparency, 0.);
+        }
+        if (mat.transparency > 0.) {
+            var n: vec3f = select(normal, -normal, inside);
+            var refracted: vec3f = refract(ray_dir, n, select(1. / mat.ior, mat.ior, inside));
+            if (dot(refracted, refracted) == 0.) {
+                ray_dir = reflect(ray_dir, n);
+                p += n * SDFL_SHADOW_CAST_DISTANCE;
+            } else {
+                if (!inside) {
+                    throughput *= mat.transparency * mat.albedo;
+                }
+                ray_dir = refracted;
+                p -= n * SDFL_SHADOW_CAST_DISTANCE;
+                inside = !inside;
+            }
+        } else if (mat.reflectivity > 0.) {
+            throughput *= mat.reflectivity * mix(vec3f(1.), mat.albedo, vec3f(mat.metallic));
+            ray_dir = reflect(ray_dir, normal);
+            p += normal * SDFL_SHADOW_CAST_DISTANCE;
+        } else {
+            return color;
+        }
+        var result: SceneResult;
+        if (inside) {
+            result = sdfl_RayMarchInside(p, ray_dir);
+        } else {
+            result = sdfl_RayMarch(p, ray_dir);
+        }
+        if (result.distance >= SDFL_MAX_DISTANCE) {
+            return color + throughput * mix(vec3f(0.5, 0.7, 1.0), background, vec3f(ray_dir.y * 0.5 + 0.5));
+        }
+        p += ray_dir * result.distance;
+        mat = sdfl_GetMaterial(result.materialId);
+    }
+    return color + throughput * sdfl_CalculateLighting(p, -ray_dir, mat);
+}
+
+fn sdfl_post_fog(color: vec3f, dist: f32, density: f32, fog_color: vec3f) -> vec3f {
+    return mix(color, fog_color, vec3f(1. - exp(-density * dist)));
+}
+
+fn sdfl_post_ambientOcclusion(color: vec3f, p: vec3f, samples: f32, strength: f32) -> vec3f {
+    var normal: vec3f = sdfl_GetNormal(p);
+    var occlusion: f32 = 0.;
+    var falloff: f32 = 1.;
+    for (var i: i32 = 0; i < 16; i++) {
+        if (f32(i) >= samples) {
+            break;
+        }
+        var h: f32 = .01 + .12 * f32(i) / max(samples - 1., 1.);
+        var d: f32 = sdfl_GetDistScene(p + normal * h).distance;
+        occlusion += (h - d) * falloff;
+        falloff *= .95;
+    }
+    return color * mix(1., clamp(1. - 3. * occlusion, 0., 1.), strength);
+}
+
+fn sdfl_post_toneMap_aces(color: vec3f) -> vec3f {
+    return clamp(color * (2.51 * color + .03) / (color * (2.43 * color + .59) + .14), vec3f(0.), vec3f(1.));
+}
+
+fn sdfl_post_bloom(color: vec3f, threshold: f32, intensity: f32) -> vec3f {
+    return color + max(color - threshold, vec3f(0.)) * intensity;
+}
+
+fn sdfl_post_gamma(color: vec3f, value: f32) -> vec3f {
+    return pow(max(color, vec3f(0.)), vec3f(1. / value));
+}
+
+fn sdfl_post_vignette(color: vec3f, uv: vec2f, strength: f32, radius: f32) -> vec3f {
+    var v: f32 = max(length(uv) - radius, 0.);
+    return color * max(1. - strength * v * v, 0.);
+}
+
+fn sdfl_Render(vertex_uv: vec2f) -> vec4f {
+    var cam_pos: vec3f = vec3f(0.0, 3.0, 9.0);
+    var uv: vec2f = vertex_uv * 2. - 1.;
+    uv.y *= f32(sdfl_uniforms.window_size.y) / f32(sdfl_uniforms.window_size.x);
+    var ray_dir: vec3f = normalize(vec3f(uv, -1.0));
+    var result: SceneResult = sdfl_RayMarch(cam_pos, ray_dir);
+    var color: vec3f = mix(vec3f(0.5, 0.7, 1.0), vec3f(0.6, 0.7, 0.8), vec3f(uv.y * 0.5 + 0.5));
+    if (result.distance < SDFL_MAX_DISTANCE) {
+        var p: vec3f = cam_pos + ray_dir * result.distance;
+        color = sdfl_Trace(p, ray_dir, sdfl_GetMaterial(result.materialId), vec3f(0.6, 0.7, 0.8));
+    }
+    color = sdfl_post_fog(color, result.distance, 0.04, vec3f(0.6, 0.7, 0.8));
+    if (result.distance < SDFL_MAX_DISTANCE) {
+        color = sdfl_post_ambientOcclusion(color, cam_pos + ray_dir * result.distance, 5.0, 1.0);
+    }
+    color = sdfl_post_toneMap_aces(color);
+    color = sdfl_post_bloom(color, 0.8, 0.5);
+    color = sdfl_post_gamma(color, 2.2);
+    color = sdfl_post_vignette(color, uv, 0.5, 0.5);
+    return vec4f(color, 1.0);
+}
+
+@fragment
+fn main(@location(0) o_vertex_uv: vec2f) -> @location(0) vec4f {
+    return sdfl_Render(o_vertex_uv);
+}
@@ -0,0 +1,484 @@
+// sdfl generated code, paste it into the Image tab of Shadertoy
+
+struct Material {
+    vec3 albedo;
+    float roughness;
+    float metallic;
+    vec3 emission;
+    float reflectivity;
+    float ior;
+    float transparency;
+};
+
+struct SceneResult {
+    float distance;
+    int materialId;
+};
+
+const int SDFL_MAX_STEPS = 100;
+const float SDFL_MAX_DISTANCE = 100.;
+const float SDFL_HIT_DISTANCE = .01;
+const float SDFL_SHADOW_CAST_DISTANCE = .05;
+
+float sdfl_builtin_plane(vec3 p, float height) {
+    return p.y - height;
+}
+
+float sdfl_builtin_sphere(vec3 p, vec3 pos, float r) {
+    return distance(pos, p) - r;
+}
+
+float sdfl_builtin_cylinder(vec3 p, vec3 a, vec3 b, float r) {
+    vec3 ba = b - a;
+    vec3 pa = p - a;
+    float baba = dot(ba, ba);
+    float paba = dot(pa, ba);
+    float x = length(pa * baba - ba * paba) - r * baba;
+    float y = abs(paba - baba * 0.5) - baba * 0.5;
+    float x2 = x * x;
+    float y2 = y * y * baba;
+    float d = (max(x, y) < 0.0) ? -min(x2, y2) : (((x > 0.0) ? x2 : 0.0) + ((y > 0.0) ? y2 : 0.0));
+    return sign(d) * sqrt(abs(d)) / baba;
+}
+
+float sdfl_builtin_ellipsoid(vec3 p, vec3 pos, vec3 r) {
+    vec3 q = (p - pos) / r;
+    return (length(q) - 1.0) * min(min(r.x, r.y), r.z);
+}
+
+float sdfl_builtin_box(vec3 p, vec3 bpos, vec3 bsize) {
+    vec3 q = abs(p - bpos) - bsize;
+    return length(max(q, vec3(0.0))) + min(max(q.x, max(q.y, q.z)), 0.0);
+}
+
+float sdfl_builtin_torus(vec3 p, vec3 pos, float radius, float thickness) {
+    vec3 wp = p - pos;
+    vec2 t = vec2(radius, thickness);
+    vec2 q = vec2(length(wp.xz) - t.x, wp.y);
+    return length(q) - t.y;
+}
+
+mat3 sdfl_RotationMatrix(vec3 angles) {
+    float cx = cos(angles.x);
+    float sx = sin(angles.x);
+    float cy = cos(angles.y);
+    float sy = sin(angles.y);
+    float cz = cos(angles.z);
+    float sz = sin(angles.z);
+    return mat3(cy * cz, cz * sx * sy - cx * sz, sx * sz + cx * cz * sy, cy * sz, cx * cz + sx * sy * sz, cx * sy * sz - cz * sx, -sy, cy * sx, cx * cy);
+}
+
+SceneResult sdfl_builtin_union(SceneResult d1, SceneResult d2) {
+    if (d1.distance < d2.distance) {
+        return SceneResult(d1.distance, d1.materialId);
+    } else {
+        return SceneResult(d2.distance, d2.materialId);
+    }
+}
+
+SceneResult sdfl_builtin_subtraction(SceneResult d1, SceneResult d2) {
+    float dist = max(d2.distance, -d1.distance);
+    return SceneResult(dist, d2.materialId);
+}
+
+SceneResult sdfl_builtin_intersection(SceneResult d1, SceneResult d2) {
+    if (d1.distance > d2.distance) {
+        return SceneResult(d1.distance, d1.materialId);
+    } else {
+        return SceneResult(d2.distance, d2.materialId);
+    }
+}
+
+SceneResult sdfl_builtin_smoothUnion(SceneResult d1, SceneResult d2, float k) {
+    float h = clamp(0.5 + 0.5 * (d2.distance - d1.distance) / k, 0.0, 1.0);
+    float dist = mix(d2.distance, d1.distance, h) - k * h * (1.0 - h);
+    int matId = (h > 0.5) ? d1.materialId : d2.materialId;
+    return SceneResult(dist, matId);
+}
+
+SceneResult sdfl_builtin_smoothSubtraction(SceneResult d1, SceneResult d2, float k) {
+    float h = clamp(0.5 - 0.5 * (d2.distance + d1.distance) / k, 0.0, 1.0);
+    float dist = mix(d2.distance, -d1.distance, h) + k * h * (1.0 - h);
+    return SceneResult(dist, d2.materialId);
+}
+
+SceneResult sdfl_builtin_smoothIntersection(SceneResult d1, SceneResult d2, float k) {
+    float h = clamp(0.5 - 0.5 * (d2.distance - d1.distance) / k, 0.0, 1.0);
+    float dist = mix(d2.distance, d1.distance, h) + k * h * (1.0 - h);
+    int matId = (h > 0.5) ? d1.materialId : d2.materialId;
+    return SceneResult(dist, matId);
+}
+
+float sdfl_builtin_hash(vec2 co) {
+    return fract(sin(dot(co, vec2(12.9898, 78.233))) * 43758.5453);
+}
+
+float sdfl_builtin_noise_simple(vec2 point) {
+    vec2 p = fract(point);
+    p = smoothstep(vec2(0.), vec2(1.), p);
+    vec2 id = floor(point);
+    vec2 off = vec2(1., 0.);
+    vec2 bl = id + off.yy;
+    vec2 br = id + off.xy;
+    vec2 tl = id + off.yx;
+    vec2 tr = id + off.xx;
+    float b = mix(sdfl_builtin_hash(bl), sdfl_builtin_hash(br), p.x);
+    float t = mix(sdfl_builtin_hash(tl), sdfl_builtin_hash(tr), p.x);
+    float val = mix(b, t, p.y);
+    return val;
+}
+
+float sdfl_builtin_noise(vec2 point) {
+    float noise = sdfl_builtin_noise_simple(point) * sdfl_builtin_noise_simple(point * 4.) * 0.5 + sdfl_builtin_noise_simple(point * 8.) * 0.25 + sdfl_builtin_noise_simple(point * 16.) * 0.125 + sdfl_builtin_noise_simple(point * 32.) * 0.0625 + sdfl_builtin_noise_simple(point * 64.) * 0.03125;
+    return noise;
+}
+
+float sdfl_builtin_time(vec2 p) {
+    return iTime;
+}
+
+float sdfl_AnimTime(float start, float end, bool loop) {
+    float t = sdfl_builtin_time(vec2(0.));
+    return loop && end > start ? start + mod(t - start, end - start) : t;
+}
+
+float sdfl_AnimSegment(float t, float start, float end) {
+    return end > start ? clamp((t - start) / (end - start), 0., 1.) : step(start, t);
+}
+
+float sdfl_Oscillate(float freq) {
+    return sin(6.28318530718 * freq * sdfl_builtin_time(vec2(0.)));
+}
+
+float sdfl_ease_cubicInOut(float x) {
+    return x < .5 ? 4. * x * x * x : 1. - pow(-2. * x + 2., 3.) / 2.;
+}
+
+Material sdfl_GetMaterial(int id) {
+    Material mat;
+    if (id == 0) {
+        mat.albedo = vec3(0.8, 0.8, 0.8);
+        mat.roughness = 0.9;
+        mat.metallic = 0.0;
+        mat.emission = vec3(0.0, 0.0, 0.0);
+        mat.reflectivity = 0.0;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    } else if (id == 1) {
+        mat.albedo = vec3(0.2, 0.6, 1.0);
+        mat.roughness = 0.3;
+        mat.metallic = 0.1;
+        mat.emission = vec3(0.0, 0.0, 0.0);
+        mat.reflectivity = 0.0;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    } else if (id == 2) {
+        mat.albedo = vec3(1.0, 0.3, 0.2);
+        mat.roughness = 0.1;
+        mat.metallic = 0.0;
+        mat.emission = vec3(0.1, 0.0, 0.0);
+        mat.reflectivity = 0.0;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    } else if (id == 3) {
+        mat.albedo = vec3(0.0, 0.0, 0.0);
+        mat.roughness = 1.0;
+        mat.metallic = 10.0;
+        mat.emission = vec3(0.2, 0.2, 0.2);
+        mat.reflectivity = 0.0;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    } else if (id == 4) {
+        mat.albedo = vec3(0.9, 0.9, 0.9);
+        mat.roughness = 0.1;
+        mat.metallic = 1.0;
+        mat.emission = vec3(0.0, 0.0, 0.0);
+        mat.reflectivity = 0.8;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    } else if (id == 5) {
+        mat.albedo = vec3(0.95, 0.97, 1.0);
+        mat.roughness = 0.05;
+        mat.metallic = 0.0;
+        mat.emission = vec3(0.0, 0.0, 0.0);
+        mat.reflectivity = 0.1;
+        mat.ior = 1.5;
+        mat.transparency = 0.9;
+    } else {
+        mat.albedo = vec3(0.5, 0.5, 0.5);
+        mat.roughness = 0.5;
+        mat.metallic = 0.0;
+        mat.emission = vec3(0.0, 0.0, 0.0);
+        mat.reflectivity = 0.0;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    }
+    return mat;
+}
+
+SceneResult blob(vec3 p) {
+    SceneResult best = SceneResult(SDFL_MAX_DISTANCE, 0);
+    SceneResult sd0 = SceneResult(sdfl_builtin_sphere(p, vec3(0.0, 0.5, 0.0), 0.6), 0);
+    SceneResult sd1 = SceneResult(sdfl_builtin_ellipsoid(p, vec3(0.0, 0.0, 0.0), vec3(1.0, 0.4, 0.6)), 0);
+    SceneResult sd2 = sdfl_builtin_smoothUnion(sd0, sd1, 0.3);
+    best = sdfl_builtin_union(sd2, best);
+    return best;
+}
+
+SceneResult sdfl_GetDistScene(vec3 p) {
+    SceneResult best = SceneResult(SDFL_MAX_DISTANCE, 0);
+    SceneResult sd3 = SceneResult(sdfl_builtin_plane(p, -1.0), 0);
+    best = sdfl_builtin_union(sd3, best);
+    SceneResult sd4 = blob(p);
+    best = sdfl_builtin_union(sd4, best);
+    vec3 pivot0 = vec3(2.0, 0.0, 0.0);
+    mat3 rotation0 = sdfl_RotationMatrix(radians(vec3(30.0, sdfl_builtin_time(p.xy) * 20.0, 0.0)));
+    vec3 q0 = rotation0 * (p - pivot0) + pivot0;
+    SceneResult sd5 = SceneResult(sdfl_builtin_torus(q0, vec3(2.0, 0.0, 0.0), 1.0 + (0.25 * sdfl_Oscillate(0.5)), 0.2), 4);
+    best = sdfl_builtin_union(sd5, best);
+    SceneResult sd6 = SceneResult(sdfl_builtin_cylinder(p, vec3(3.0, -1.0, -2.0), vec3(3.0, 1.0 + 0.1 * asinh(sdfl_builtin_time(p.xy)), -2.0), 0.2), 0);
+    SceneResult sd7 = SceneResult(sdfl_builtin_sphere(p, mix(vec3(3.0, 1.0, -2.0), vec3(3.0, 2.0, -2.0), vec3(0.5 + 0.5 * sin(sdfl_builtin_time(p.xy)))), 0.3 * exp(0.1)), 5);
+    SceneResult sd8 = sdfl_builtin_union(sd6, sd7);
+    best = sdfl_builtin_union(sd8, best);
+    SceneResult sd9 = SceneResult(sdfl_builtin_box(p, vec3(-3.0, 0.0, -2.0), vec3(0.5, 0.5, 0.5)), 0);
+    SceneResult sd10 = SceneResult(sdfl_builtin_sphere(p, vec3(-3.0, 0.5, -2.0), pow(0.5, 2.0) + sdfl_builtin_hash(p.xy)), 0);
+    SceneResult sd11 = sdfl_builtin_subtraction(sd9, sd10);
+    best = sdfl_builtin_union(sd11, best);
+    SceneResult sd12 = SceneResult(sdfl_builtin_sphere(p, mix(vec3(0.0, 2.0, 0.0), vec3(0.0, 3.0, 0.0), vec3(sdfl_ease_cubicInOut(sdfl_AnimSegment(sdfl_AnimTime(0.0, 2.0, true), 0.0, 2.0)))), (sdfl_builtin_time(p.xy) < 2.0 ? 0.3 : 0.4)), 0);
+    best = sdfl_builtin_union(sd12, best);
+    if (sdfl_builtin_box(p, vec3(-0.6, 0.8, -0.175), vec3(1.901, 1.801, 4.426)) < best.distance) {
+        if (sdfl_builtin_box(p, vec3(-0.85, 0.9, -2.05), vec3(1.651, 1.701, 2.551)) < best.distance) {
+            if (sdfl_builtin_box(p, vec3(0.0, 2.0, -4.0), vec3(0.601, 0.601, 0.601)) < best.distance) {
+                SceneResult sd13 = SceneResult(sdfl_builtin_sphere(p, vec3(0.0, 2.0, -4.0), 0.8), 0);
+                SceneResult sd14 = SceneResult(sdfl_builtin_box(p, vec3(0.0, 2.0, -4.0), vec3(0.6, 0.6, 0.6)), 0);
+                SceneResult sd15 = sdfl_builtin_intersection(sd13, sd14);
+                best = sdfl_builtin_union(sd15, best);
+            }
+            if (sdfl_builtin_box(p, vec3(-0.85, 0.0, -1.65), vec3(1.651, 0.801, 2.151)) < best.distance) {
+                if (sdfl_builtin_box(p, vec3(0.0, 0.0, -3.0), vec3(0.801, 0.801, 0.801)) < best.distance) {
+                    SceneResult sd16 = SceneResult(sdfl_builtin_sphere(p, vec3(0.0, 0.0, -3.0), 1.0), 0);
+                    SceneResult sd17 = SceneResult(sdfl_builtin_box(p, vec3(0.0, 0.0, -3.0), vec3(0.8, 0.8, 0.8)), 0);
+                    SceneResult sd18 = sdfl_builtin_smoothIntersection(sd16, sd17, 0.05);
+                    best = sdfl_builtin_union(sd18, best);
+                }
+                if (sdfl_builtin_box(p, vec3(-2.0, 0.0, 0.0), vec3(0.501, 0.158, 0.501)) < best.distance) {
+                    SceneResult sd19 = SceneResult(sdfl_builtin_sphere(p, vec3(-2.0, 0.0, 0.0), 0.7 + 0.1 * sdfl_builtin_noise(p.xy)), 0);
+                    SceneResult sd20 = SceneResult(sdfl_builtin_box(p, vec3(-2.0, 0.0, 0.0), smoothstep(vec3(0.4), vec3(0.6, 0.8, 0.6), vec3(0.5))), 0);
+                    SceneResult sd21 = sdfl_builtin_smoothSubtraction(sd19, sd20, 0.1);
+                    best = sdfl_builtin_union(sd21, best);
+                }
+            }
+        }
+        if (sdfl_builtin_box(p, vec3(0.025, -0.35, 2.975), vec3(1.276, 0.651, 1.277)) < best.distance) {
+            if (sdfl_builtin_box(p, vec3(-0.475, -0.7, 2.0), vec3(0.726, 0.251, 0.251)) < best.distance) {
+                SceneResult sd22 = SceneResult(sdfl_builtin_sphere(p, vec3(-1.0, -0.7, 2.0), 0.2 + 0.0 / 20.0), 0);
+                best = sdfl_builtin_union(sd22, best);
+                SceneResult sd23 = SceneResult(sdfl_builtin_sphere(p, vec3(0.0, -0.7, 2.0), 0.2 + 1.0 / 20.0), 0);
+                best = sdfl_builtin_union(sd23, best);
+            }
+            if (sdfl_builtin_box(p, vec3(0.025, -0.35, 2.975), vec3(1.276, 0.651, 1.277)) < best.distance) {
+                if (sdfl_builtin_box(p, vec3(0.0, 0.0, 3.0), vec3(1.251, 0.301, 1.252)) < best.distance) {
+                    SceneResult sd24 = SceneResult(SDFL_MAX_DISTANCE, 0);
+                    if (sdfl_builtin_time(p.xy) > 4.0 && !((sdfl_builtin_time(p.xy) > 8.0))) {
+                        SceneResult sd25 = SceneResult(sdfl_builtin_torus(p, vec3(0.0, 0.0, 3.0), 1.0, 0.25), 0);
+                        sd24 = sd25;
+                    } else {
+                        SceneResult sd26 = SceneResult(sdfl_builtin_box(p, vec3(0.0, 0.0, 3.0), vec3(0.3, 0.3, 0.3)), 0);
+                        sd24 = sd26;
+                    }
+                    best = sdfl_builtin_union(sd24, best);
+                }
+                SceneResult sd27 = SceneResult(sdfl_builtin_sphere(p, vec3(1.0, -0.7, 2.0), 0.2 + 2.0 / 20.0), 0);
+                best = sdfl_builtin_union(sd27, best);
+            }
+        }
+    }
+    return best;
+}
+
+SceneResult sdfl_RayMarch(vec3 ray_origin, vec3 ray_dir) {
+    float dfo = 0.;
+    SceneResult result = SceneResult(SDFL_MAX_DISTANCE, 0);
+    for (int i = 0; i < SDFL_MAX_STEPS; i++) {
+        vec3 p = ray_origin + ray_dir * dfo;
+        SceneResult scene = sdfl_GetDistScene(p);
+        dfo += scene.distance;
+        result.materialId = scene.materialId;
+        if (dfo > SDFL_MAX_DISTANCE || scene.distance < SDFL_HIT_DISTANCE) {
+            break;
+        }
+    }
+    result.distance = dfo;
+    return result;
+}
+
+vec3 sdfl_GetNormal(vec3 p) {
+    float d = sdfl_GetDistScene(p).distance;
+    vec2 off = vec2(.01, 0.);
+    vec3 normal = vec3(d - sdfl_GetDistScene(p - off.xyy).distance, d - sdfl_GetDistScene(p - off.yxy).distance, d - sdfl_GetDistScene(p - off.yyx).distance);
+    return normalize(normal);
+}
+
+float sdfl_GetShadow(vec3 p, vec3 light_dir, float light_distance) {
+    float shadow = 1.0;
+    float penumbra_factor = 10.0;
+    vec3 start_pos = p + sdfl_GetNormal(p) * SDFL_SHADOW_CAST_DISTANCE;
+    float t = 0.0;
+    for (int i = 0; i < 32; i++) {
+        vec3 ray_pos = start_pos + light_dir * t;
+        SceneResult result = sdfl_GetDistScene(ray_pos);
+        if (result.distance + SDFL_SHADOW_CAST_DISTANCE < SDFL_SHADOW_CAST_DISTANCE) {
+            return 0.1;
+        }
+        shadow = min(shadow, penumbra_factor * result.distance / t);
+        t += result.distance;
+        if (t >= light_distance) {
+            break;
+        }
+    }
+    return clamp(shadow, 0.1, 1.0);
+}
+
+vec3 sdfl_CalculateLighting(vec3 p, vec3 view_dir, Material mat) {
+    vec3 light_pos = vec3(0.0, 8.0, 8.0);
+    vec3 light_color = vec3(1.0, 0.95, 0.8);
+    float light_intensity = 2.0;
+    vec3 light_dir = normalize(light_pos - p);
+    vec3 normal = sdfl_GetNormal(p);
+    vec3 half_dir = normalize(light_dir + view_dir);
+    float light_distance = distance(light_pos, p);
+    float attenuation = 1.0 / (1.0 + 0.1 * light_distance + 0.01 * light_distance * light_distance);
+    float ndotl = max(dot(normal, light_dir), 0.0);
+    vec3 diffuse = mat.albedo * light_color * ndotl * light_intensity * attenuation;
+    float ndoth = max(dot(normal, half_dir), 0.0);
+    float roughness2 = mat.roughness * mat.roughness;
+    float spec_power = 2.0 / (roughness2 * roughness2) - 2.0;
+    vec3 specular = mix(vec3(0.04), mat.albedo, vec3(mat.metallic)) * light_color * pow(ndoth, spec_power) * light_intensity * attenuation;
+    float shadow = sdfl_GetShadow(p, light_dir, light_distance);
+    vec3 ambient = mat.albedo * 0.1;
+    return ambient + (diffuse + specular) * shadow + mat.emission;
+}
+
+SceneResult sdfl_RayMarchInside(vec3 ray_origin, vec3 ray_dir) {
+    float dfo = 0.;
+    SceneResult result = SceneResult(SDFL_MAX_DISTANCE, 0);
+    for (int i = 0; i < SDFL_MAX_STEPS; i++) {
+        vec3 p = ray_origin + ray_dir * dfo;
+        SceneResult scene = sdfl_GetDistScene(p);
+        dfo -= scene.distance;
+        result.materialId = scene.materialId;
+        if (dfo > SDFL_MAX_DISTANCE || -scene.distance < SDFL_HIT_DISTANCE) {
+            break;
+        }
+    }
+    result.distance = dfo;
+    return result;
+}
+
+vec3 sdfl_Trace(vec3 p, vec3 ray_dir, Material mat, vec3 background) {
+    vec3 color = vec3(0.);
+    vec3 throughput = vec3(1.);
+    bool inside = false;
+    for (int bounce = 0; bounce < 2; bounce++) {
+        vec3 normal = sdfl_GetNormal(p);
+        if (!inside) {
+            color += throughput * sdfl_CalculateLighting(p, -ray_dir, mat) * max(1. - mat.reflectivity - mat.transparency, 0.);
+        }
+        if (mat.transparency > 0.) {
+            vec3 n = inside ? -normal : normal;
+            vec3 refracted = refract(ray_dir, n, inside ? mat.ior : 1. / mat.ior);
+            if (dot(refracted, refracted) == 0.) {
+                ray_dir = reflect(ray_dir, n);
+                p += n * SDFL_SHADOW_CAST_DISTANCE;
+            } else {
+                if (!inside) {
+                    throughput *= mat.transparency * mat.albedo;
+                }
+                ray_dir = refracted;
+                p -= n * SDFL_SHADOW_CAST_DISTANCE;
+                inside = !inside;
+            }
+        } else if (mat.reflectivity > 0.) {
+            throughput *= mat.reflectivity * mix(vec3(1.), mat.albedo, vec3(mat.metallic));
+            ray_dir = reflect(ray_dir, normal);
+            p += normal * SDFL_SHADOW_CAST_DISTANCE;
+        } else {
+            return color;
+        }
+        SceneResult result;
+        if (inside) {
+            result = sdfl_RayMarchInside(p, ray_dir);
+        } else {
+            result = sdfl_RayMarch(p, ray_dir);
+        }
+        if (result.distance >= SDFL_MAX_DISTANCE) {
+            return color + throughput * mix(vec3(0.5, 0.7, 1.0), background, vec3(ray_dir.y * 0.5 + 0.5));
+        }
+        p += ray_dir * result.distance;
+        mat = sdfl_GetMaterial(result.materialId);
+    }
+    return color + throughput * sdfl_CalculateLighting(p, -ray_dir, mat);
+}
+
+vec3 sdfl_post_fog(vec3 color, float dist, float density, vec3 fog_color) {
+    return mix(color, fog_color, vec3(1. - exp(-density * dist)));
+}
+
+vec3 sdfl_post_ambientOcclusion(vec3 color, vec3 p, float samples, float strength) {
+    vec3 normal = sdfl_GetNormal(p);
+    float occlusion = 0.;
+    float falloff = 1.;
+    for (int i = 0; i < 16; i++) {
+        if (float(i) >= samples) {
+            break;
+        }
+        float h = .01 + .12 * float(i) / max(samples - 1., 1.);
+        float d = sdfl_GetDistScene(p + normal * h).distance;
+        occlusion += (h - d) * falloff;
+        falloff *= .95;
+    }
+    return color * mix(1., clamp(1. - 3. * occlusion, 0., 1.), strength);
+}
+
+vec3 sdfl_post_toneMap_aces(vec3 color) {
+    return clamp(color * (2.51 * color + .03) / (color * (2.43 * color + .59) + .14), vec3(0.), vec3(1.));
+}
+
+vec3 sdfl_post_bloom(vec3 color, float threshold, float intensity) {
+    return color + max(color - threshold, vec3(0.)) * intensity;
+}
+
+vec3 sdfl_post_gamma(vec3 color, float value) {
+    return pow(max(color, vec3(0.)), vec3(1. / value));
+}
+
+vec3 sdfl_post_vignette(vec3 color, vec2 uv, float strength, float radius) {
+    float v = max(length(uv) - radius, 0.);
+    return color * max(1. - strength * v * v, 0.);
+}
+
+vec4 sdfl_Render(vec2 vertex_uv) {
+    vec3 cam_pos = vec3(0.0, 3.0, 9.0);
+    vec2 uv = vertex_uv * 2. - 1.;
+    uv.y *= float(ivec2(iResolution.xy).y) / float(ivec2(iResolution.xy).x);
+    vec3 ray_dir = normalize(vec3(uv, -1.0));
+    SceneResult result = sdfl_RayMarch(cam_pos, ray_dir);
+    vec3 color = mix(vec3(0.5, 0.7, 1.0), vec3(0.6, 0.7, 0.8), vec3(uv.y * 0.5 + 0.5));
+    if (result.distance < SDFL_MAX_DISTANCE) {
+        vec3 p = cam_pos + ray_dir * result.distance;
+        color = sdfl_Trace(p, ray_dir, sdfl_GetMaterial(result.materialId), vec3(0.6, 0.7, 0.8));
+    }
+    color = sdfl_post_fog(color, result.distance, 0.04, vec3(0.6, 0.7, 0.8));
+    if (result.distance < SDFL_MAX_DISTANCE) {
+        color = sdfl_post_ambientOcclusion(color, cam_pos + ray_dir * result.distance, 5.0, 1.0);
+    }
+    color = sdfl_post_toneMap_aces(color);
+    color = sdfl_post_bloom(color, 0.8, 0.5);
+    color = sdfl_post_gamma(color, 2.2);
+    color = sdfl_post_vignette(color, uv, 0.5, 0.5);
+    return vec4(color, 1.0);
+}
+
+void mainImage(out vec4 fragColor, in vec2 fragCoord) {
+    fragColor = sdfl_Render(fragCoord / iResolution.xy);
+}
@@ -0,0 +1,281 @@
+// sdfl generated code
+
+#include <metal_stdlib>
+using namespace metal;
+
+struct SdflUniforms {
+    int2 window_size;
+    float elapsed_time;
+};
+
+struct Material {
+    float3 albedo;
+    float roughness;
+    float metallic;
+    float3 emission;
+    float reflectivity;
+    float ior;
+    float transparency;
+};
+
+struct SceneResult {
+    float distance;
+    int materialId;
+};
+
+constant int SDFL_MAX_STEPS = 100;
+constant float SDFL_MAX_DISTANCE = 100.;
+constant float SDFL_HIT_DISTANCE = .01;
+constant float SDFL_SHADOW_CAST_DISTANCE = .05;
+
+struct SdflShader {
+    SdflUniforms uniforms;
+
+    float sdfl_builtin_plane(float3 p, float height) {
+        return p.y - height;
+    }
+
+    float sdfl_builtin_sphere(float3 p, float3 pos, float r) {
+        return distance(pos, p) - r;
+    }
+
+    float sdfl_builtin_box(float3 p, float3 bpos, float3 bsize) {
+        float3 q = abs(p - bpos) - bsize;
+        return length(max(q, float3(0.0))) + min(max(q.x, max(q.y, q.z)), 0.0);
+    }
+
+    SceneResult sdfl_builtin_union(SceneResult d1, SceneResult d2) {
+        if (d1.distance < d2.distance) {
+            return SceneResult{d1.distance, d1.materialId};
+        } else {
+            return SceneResult{d2.distance, d2.materialId};
+        }
+    }
+
+    Material sdfl_GetMaterial(int id) {
+        Material mat;
+        if (id == 0) {
+            mat.albedo = float3(0.8, 0.8, 0.8);
+            mat.roughness = 0.9;
+            mat.metallic = 0.0;
+            mat.emission = float3(0.0, 0.0, 0.0);
+            mat.reflectivity = 0.0;
+            mat.ior = 1.0;
+            mat.transparency = 0.0;
+        } else if (id == 1) {
+            mat.albedo = float3(0.2, 0.6, 1.0);
+            mat.roughness = 0.3;
+            mat.metallic = 0.1;
+            mat.emission = float3(0.0, 0.0, 0.0);
+            mat.reflectivity = 0.0;
+            mat.ior = 1.0;
+            mat.transparency = 0.0;
+        } else if (id == 2) {
+            mat.albedo = float3(1.0, 0.3, 0.2);
+            mat.roughness = 0.1;
+            mat.metallic = 0.0;
+            mat.emission = float3(0.1, 0.0, 0.0);
+            mat.reflectivity = 0.0;
+            mat.ior = 1.0;
+            mat.transparency = 0.0;
+        } else if (id == 3) {
+            mat.albedo = float3(0.0, 0.0, 0.0);
+            mat.roughness = 1.0;
+            mat.metallic = 10.0;
+            mat.emission = float3(0.2, 0.2, 0.2);
+            mat.reflectivity = 0.0;
+            mat.ior = 1.0;
+            mat.transparency = 0.0;
+        } else if (id == 4) {
+            mat.albedo = float3(0.9, 0.9, 0.9);
+            mat.roughness = 0.1;
+            mat.metallic = 1.0;
+            mat.emission = float3(0.0, 0.0, 0.0);
+            mat.reflectivity = 0.8;
+            mat.ior = 1.0;
+            mat.transparency = 0.0;
+        } else if (id == 5) {
+            mat.albedo = float3(0.95, 0.97, 1.0);
+            mat.roughness = 0.05;
+            mat.metallic = 0.0;
+            mat.emission = float3(0.0, 0.0, 0.0);
+            mat.reflectivity = 0.1;
+            mat.ior = 1.5;
+            mat.transparency = 0.9;
+        } else {
+            mat.albedo = float3(0.5, 0.5, 0.5);
+            mat.roughness = 0.5;
+            mat.metallic = 0.0;
+            mat.emission = float3(0.0, 0.0, 0.0);
+            mat.reflectivity = 0.0;
+            mat.ior = 1.0;
+            mat.transparency = 0.0;
+        }
+        return mat;
+    }
+
+    SceneResult sdfl_GetDistScene(float3 p) {
+        SceneResult best = SceneResult{SDFL_MAX_DISTANCE, 0};
+        SceneResult sd0 = SceneResult{sdfl_builtin_plane(p, -1.0), 0};
+        best = sdfl_builtin_union(sd0, best);
+        if (sdfl_builtin_box(p, float3(0.0, 0.0, -1.25), float3(2.201, 1.001, 2.251)) < best.distance) {
+            SceneResult sd1 = SceneResult{sdfl_builtin_box(p, float3(0.0, -0.5, -3.0), float3(0.5, 0.5, 0.5)), 0};
+            best = sdfl_builtin_union(sd1, best);
+            if (sdfl_builtin_box(p, float3(0.0, 0.0, 0.0), float3(2.201, 1.001, 1.001)) < best.distance) {
+                SceneResult sd2 = SceneResult{sdfl_builtin_sphere(p, float3(-1.2, 0.0, 0.0), 1.0), 4};
+                best = sdfl_builtin_union(sd2, best);
+                SceneResult sd3 = SceneResult{sdfl_builtin_sphere(p, float3(1.2, 0.0, 0.0), 1.0), 5};
+                best = sdfl_builtin_union(sd3, best);
+            }
+        }
+        return best;
+    }
+
+    SceneResult sdfl_RayMarch(float3 ray_origin, float3 ray_dir) {
+        float dfo = 0.;
+        SceneResult result = SceneResult{SDFL_MAX_DISTANCE, 0};
+        for (int i = 0; i < SDFL_MAX_STEPS; i++) {
+            float3 p = ray_origin + ray_dir * dfo;
+            SceneResult scene = sdfl_GetDistScene(p);
+            dfo += scene.distance;
+            result.materialId = scene.materialId;
+            if (dfo > SDFL_MAX_DISTANCE || scene.distance < SDFL_HIT_DISTANCE) {
+                break;
+            }
+        }
+        result.distance = dfo;
+        return result;
+    }
+
+    float3 sdfl_GetNormal(float3 p) {
+        float d = sdfl_GetDistScene(p).distance;
+        float2 off = float2(.01, 0.);
+        float3 normal = float3(d - sdfl_GetDistScene(p - off.xyy).distance, d - sdfl_GetDistScene(p - off.yxy).distance, d - sdfl_GetDistScene(p - off.yyx).distance);
+        return normalize(normal);
+    }
+
+    float sdfl_GetShadow(float3 p, float3 light_dir, float light_distance) {
+        float shadow = 1.0;
+        float penumbra_factor = 10.0;
+        float3 start_pos = p + sdfl_GetNormal(p) * SDFL_SHADOW_CAST_DISTANCE;
+        float t = 0.0;
+        for (int i = 0; i < 32; i++) {
+            float3 ray_pos = start_pos + light_dir * t;
+            SceneResult result = sdfl_GetDistScene(ray_pos);
+            if (result.distance + SDFL_SHADOW_CAST_DISTANCE < SDFL_SHADOW_CAST_DISTANCE) {
+                return 0.1;
+            }
+            shadow = min(shadow, penumbra_factor * result.distance / t);
+            t += result.distance;
+            if (t >= light_distance) {
+                break;
+            }
+        }
+        return clamp(shadow, 0.1, 1.0);
+    }
+
+    float3 sdfl_CalculateLighting(float3 p, float3 view_dir, Material mat) {
+        float3 light_pos = float3(0.0, 8.0, 8.0);
+        float3 light_color = float3(1.0, 0.95, 0.8);
+        float light_intensity = 2.0;
+        float3 light_dir = normalize(light_pos - p);
+        float3 normal = sdfl_GetNormal(p);
+        float3 half_dir = normalize(light_dir + view_dir);
+        float light_distance = distance(light_pos, p);
+        float attenuation = 1.0 / (1.0 + 0.1 * light_distance + 0.01 * light_distance * light_distance);
+        float ndotl = max(dot(normal, light_dir), 0.0);
+        float3 diffuse = mat.albedo * light_color * ndotl * light_intensity * attenuation;
+        float ndoth = max(dot(normal, half_dir), 0.0);
+        float roughness2 = mat.roughness * mat.roughness;
+        float spec_power = 2.0 / (roughness2 * roughness2) - 2.0;
+        float3 specular = mix(float3(0.04), mat.albedo, float3(mat.metallic)) * light_color * pow(ndoth, spec_power) * light_intensity * attenuation;
+        float shadow = sdfl_GetShadow(p, light_dir, light_distance);
+        float3 ambient = mat.albedo * 0.1;
+        return ambient + (diffuse + specular) * shadow + mat.emission;
+    }
+
+    SceneResult sdfl_RayMarchInside(float3 ray_origin, float3 ray_dir) {
+        float dfo = 0.;
+        SceneResult result = SceneResult{SDFL_MAX_DISTANCE, 0};
+        for (int i = 0; i < SDFL_MAX_STEPS; i++) {
+            float3 p = ray_origin + ray_dir * dfo;
+            SceneResult scene = sdfl_GetDistScene(p);
+            dfo -= scene.distance;
+            result.materialId = scene.materialId;
+            if (dfo > SDFL_MAX_DISTANCE || -scene.distance < SDFL_HIT_DISTANCE) {
+                break;
+            }
+        }
+        result.distance = dfo;
+        return result;
+    }
+
+    float3 sdfl_Trace(float3 p, float3 ray_dir, Material mat, float3 background) {
+        float3 color = float3(0.);
+        float3 throughput = float3(1.);
+        bool inside = false;
+        for (int bounce = 0; bounce < 4; bounce++) {
+            float3 normal = sdfl_GetNormal(p);
+            if (!inside) {
+                color += throughput * sdfl_CalculateLighting(p, -ray_dir, mat) * max(1. - mat.reflectivity - mat.transparency, 0.);
+            }
+            if (mat.transparency > 0.) {
+                float3 n = inside ? -normal : normal;
+                float3 refracted = refract(ray_dir, n, inside ? mat.ior : 1. / mat.ior);
+                if (dot(refracted, refracted) == 0.) {
+                    ray_dir = reflect(ray_dir, n);
+                    p += n * SDFL_SHADOW_CAST_DISTANCE;
+                } else {
+                    if (!inside) {
+                        throughput *= mat.transparency * mat.albedo;
+                    }
+                    ray_dir = refracted;
+                    p -= n * SDFL_SHADOW_CAST_DISTANCE;
+                    inside = !inside;
+                }
+            } else if (mat.reflectivity > 0.) {
+                throughput *= mat.reflectivity * mix(float3(1.), mat.albedo, float3(mat.metallic));
+                ray_dir = reflect(ray_dir, normal);
+                p += normal * SDFL_SHADOW_CAST_DISTANCE;
+            } else {
+                return color;
+            }
+            SceneResult result;
+            if (inside) {
+                result = sdfl_RayMarchInside(p, ray_dir);
+            } else {
+                result = sdfl_RayMarch(p, ray_dir);
+            }
+            if (result.distance >= SDFL_MAX_DISTANCE) {
+                return color + throughput * mix(float3(0.5, 0.7, 1.0), background, float3(ray_dir.y * 0.5 + 0.5));
+            }
+            p += ray_dir * result.distance;
+            mat = sdfl_GetMaterial(result.materialId);
+        }
+        return color + throughput * sdfl_CalculateLighting(p, -ray_dir, mat);
+    }
+
+    float4 sdfl_Render(float2 vertex_uv) {
+        float3 cam_pos = float3(0.0, 1.5, 6.0);
+        float2 uv = vertex_uv * 2. - 1.;
+        uv.y *= float(uniforms.window_size.y) / float(uniforms.window_size.x);
+        float3 ray_dir = normalize(float3(uv, -1.0));
+        SceneResult result = sdfl_RayMarch(cam_pos, ray_dir);
+        float3 color = mix(float3(0.5, 0.7, 1.0), float3(0.1, 0.1, 0.15), float3(uv.y * 0.5 + 0.5));
+        if (result.distance < SDFL_MAX_DISTANCE) {
+            float3 p = cam_pos + ray_dir * result.distance;
+            color = sdfl_Trace(p, ray_dir, sdfl_GetMaterial(result.materialId), float3(0.1, 0.1, 0.15));
+        }
+        return float4(color, 1.0);
+    }
+
+};
+
+struct SdflFragmentIn {
+    float2 o_vertex_uv;
+};
+
+fragment float4 sdfl_fragment(SdflFragmentIn fragment_in [[stage_in]], constant SdflUniforms& uniforms [[buffer(0)]]) {
+    SdflShader shader = {uniforms};
+    return shader.sdfl_Render(fragment_in.o_vertex_uv);
+}
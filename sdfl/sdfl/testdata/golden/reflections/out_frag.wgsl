@@ -0,0 +1,274 @@
+// sdfl generated code
+
+struct SdflUniforms {
+    window_size: vec2i,
+    elapsed_time: f32,
+}
+
+@group(0) @binding(0) var<uniform> sdfl_uniforms: SdflUniforms;
+
+struct Material {
+    albedo: vec3f,
+    roughness: f32,
+    metallic: f32,
+    emission: vec3f,
+    reflectivity: f32,
+    ior: f32,
+    transparency: f32,
+}
+
+struct SceneResult {
+    distance: f32,
+    materialId: i32,
+}
+
+const SDFL_MAX_STEPS: i32 = 100;
+const SDFL_MAX_DISTANCE: f32 = 100.;
+const SDFL_HIT_DISTANCE: f32 = .01;
+const SDFL_SHADOW_CAST_DISTANCE: f32 = .05;
+
+fn sdfl_builtin_plane(p: vec3f, height: f32) -> f32 {
+    return p.y - height;
+}
+
+fn sdfl_builtin_sphere(p: vec3f, pos: vec3f, r: f32) -> f32 {
+    return distance(pos, p) - r;
+}
+
+fn sdfl_builtin_box(p: vec3f, bpos: vec3f, bsize: vec3f) -> f32 {
+    var q: vec3f = abs(p - bpos) - bsize;
+    return length(max(q, vec3f(0.0))) + min(max(q.x, max(q.y, q.z)), 0.0);
+}
+
+fn sdfl_builtin_union(d1: SceneResult, d2: SceneResult) -> SceneResult {
+    if (d1.distance < d2.distance) {
+        return SceneResult(d1.distance, d1.materialId);
+    } else {
+        return SceneResult(d2.distance, d2.materialId);
+    }
+}
+
+fn sdfl_GetMaterial(id: i32) -> Material {
+    var mat: Material;
+    if (id == 0) {
+        mat.albedo = vec3f(0.8, 0.8, 0.8);
+        mat.roughness = 0.9;
+        mat.metallic = 0.0;
+        mat.emission = vec3f(0.0, 0.0, 0.0);
+        mat.reflectivity = 0.0;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    } else if (id == 1) {
+        mat.albedo = vec3f(0.2, 0.6, 1.0);
+        mat.roughness = 0.3;
+        mat.metallic = 0.1;
+        mat.emission = vec3f(0.0, 0.0, 0.0);
+        mat.reflectivity = 0.0;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    } else if (id == 2) {
+        mat.albedo = vec3f(1.0, 0.3, 0.2);
+        mat.roughness = 0.1;
+        mat.metallic = 0.0;
+        mat.emission = vec3f(0.1, 0.0, 0.0);
+        mat.reflectivity = 0.0;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    } else if (id == 3) {
+        mat.albedo = vec3f(0.0, 0.0, 0.0);
+        mat.roughness = 1.0;
+        mat.metallic = 10.0;
+        mat.emission = vec3f(0.2, 0.2, 0.2);
+        mat.reflectivity = 0.0;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    } else if (id == 4) {
+        mat.albedo = vec3f(0.9, 0.9, 0.9);
+        mat.roughness = 0.1;
+        mat.metallic = 1.0;
+        mat.emission = vec3f(0.0, 0.0, 0.0);
+        mat.reflectivity = 0.8;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    } else if (id == 5) {
+        mat.albedo = vec3f(0.95, 0.97, 1.0);
+        mat.roughness = 0.05;
+        mat.metallic = 0.0;
+        mat.emission = vec3f(0.0, 0.0, 0.0);
+        mat.reflectivity = 0.1;
+        mat.ior = 1.5;
+        mat.transparency = 0.9;
+    } else {
+        mat.albedo = vec3f(0.5, 0.5, 0.5);
+        mat.roughness = 0.5;
+        mat.metallic = 0.0;
+        mat.emission = vec3f(0.0, 0.0, 0.0);
+        mat.reflectivity = 0.0;
+        mat.ior = 1.0;
+        mat.transparency = 0.0;
+    }
+    return mat;
+}
+
+fn sdfl_GetDistScene(p: vec3f) -> SceneResult {
+    var best: SceneResult = SceneResult(SDFL_MAX_DISTANCE, 0);
+    var sd0: SceneResult = SceneResult(sdfl_builtin_plane(p, -1.0), 0);
+    best = sdfl_builtin_union(sd0, best);
+    if (sdfl_builtin_box(p, vec3f(0.0, 0.0, -1.25), vec3f(2.201, 1.001, 2.251)) < best.distance) {
+        var sd1: SceneResult = SceneResult(sdfl_builtin_box(p, vec3f(0.0, -0.5, -3.0), vec3f(0.5, 0.5, 0.5)), 0);
+        best = sdfl_builtin_union(sd1, best);
+        if (sdfl_builtin_box(p, vec3f(0.0, 0.0, 0.0), vec3f(2.201, 1.001, 1.001)) < best.distance) {
+            var sd2: SceneResult = SceneResult(sdfl_builtin_sphere(p, vec3f(-1.2, 0.0, 0.0), 1.0), 4);
+            best = sdfl_builtin_union(sd2, best);
+            var sd3: SceneResult = SceneResult(sdfl_builtin_sphere(p, vec3f(1.2, 0.0, 0.0), 1.0), 5);
+            best = sdfl_builtin_union(sd3, best);
+        }
+    }
+    return best;
+}
+
+fn sdfl_RayMarch(ray_origin: vec3f, ray_dir: vec3f) -> SceneResult {
+    var dfo: f32 = 0.;
+    var result: SceneResult = SceneResult(SDFL_MAX_DISTANCE, 0);
+    for (var i: i32 = 0; i < SDFL_MAX_STEPS; i++) {
+        var p: vec3f = ray_origin + ray_dir * dfo;
+        var scene: SceneResult = sdfl_GetDistScene(p);
+        dfo += scene.distance;
+        result.materialId = scene.materialId;
+        if (dfo > SDFL_MAX_DISTANCE || scene.distance < SDFL_HIT_DISTANCE) {
+            break;
+        }
+    }
+    result.distance = dfo;
+    return result;
+}
+
+fn sdfl_GetNormal(p: vec3f) -> vec3f {
+    var d: f32 = sdfl_GetDistScene(p).distance;
+    var off: vec2f = vec2f(.01, 0.);
+    var normal: vec3f = vec3f(d - sdfl_GetDistScene(p - off.xyy).distance, d - sdfl_GetDistScene(p - off.yxy).distance, d - sdfl_GetDistScene(p - off.yyx).distance);
+    return normalize(normal);
+}
+
+fn sdfl_GetShadow(p: vec3f, light_dir: vec3f, light_distance: f32) -> f32 {
+    var shadow: f32 = 1.0;
+    var penumbra_factor: f32 = 10.0;
+    var start_pos: vec3f = p + sdfl_GetNormal(p) * SDFL_SHADOW_CAST_DISTANCE;
+    var t: f32 = 0.0;
+    for (var i: i32 = 0; i < 32; i++) {
+        var ray_pos: vec3f = start_pos + light_dir * t;
+        var result: SceneResult = sdfl_GetDistScene(ray_pos);
+        if (result.distance + SDFL_SHADOW_CAST_DISTANCE < SDFL_SHADOW_CAST_DISTANCE) {
+            return 0.1;
+        }
+        shadow = min(shadow, penumbra_factor * result.distance / t);
+        t += result.distance;
+        if (t >= light_distance) {
+            break;
+        }
+    }
+    return clamp(shadow, 0.1, 1.0);
+}
+
+fn sdfl_CalculateLighting(p: vec3f, view_dir: vec3f, mat: Material) -> vec3f {
+    var light_pos: vec3f = vec3f(0.0, 8.0, 8.0);
+    var light_color: vec3f = vec3f(1.0, 0.95, 0.8);
+    var light_intensity: f32 = 2.0;
+    var light_dir: vec3f = normalize(light_pos - p);
+    var normal: vec3f = sdfl_GetNormal(p);
+    var half_dir: vec3f = normalize(light_dir + view_dir);
+    var light_distance: f32 = distance(light_pos, p);
+    var attenuation: f32 = 1.0 / (1.0 + 0.1 * light_distance + 0.01 * light_distance * light_distance);
+    var ndotl: f32 = max(dot(normal, light_dir), 0.0);
+    var diffuse: vec3f = mat.albedo * light_color * ndotl * light_intensity * attenuation;
+    var ndoth: f32 = max(dot(normal, half_dir), 0.0);
+    var roughness2: f32 = mat.roughness * mat.roughness;
+    var spec_power: f32 = 2.0 / (roughness2 * roughness2) - 2.0;
+    var specular: vec3f = mix(vec3f(0.04), mat.albedo, vec3f(mat.metallic)) * light_color * pow(ndoth, spec_power) * light_intensity * attenuation;
+    var shadow: f32 = sdfl_GetShadow(p, light_dir, light_distance);
+    var ambient: vec3f = mat.albedo * 0.1;
+    return ambient + (diffuse + specular) * shadow + mat.emission;
+}
+
+fn sdfl_RayMarchInside(ray_origin: vec3f, ray_dir: vec3f) -> SceneResult {
+    var dfo: f32 = 0.;
+    var result: SceneResult = SceneResult(SDFL_MAX_DISTANCE, 0);
+    for (var i: i32 = 0; i < SDFL_MAX_STEPS; i++) {
+        var p: vec3f = ray_origin + ray_dir * dfo;
+        var scene: SceneResult = sdfl_GetDistScene(p);
+        dfo -= scene.distance;
+        result.materialId = scene.materialId;
+        if (dfo > SDFL_MAX_DISTANCE || -scene.distance < SDFL_HIT_DISTANCE) {
+            break;
+        }
+    }
+    result.distance = dfo;
+    return result;
+}
+
+fn sdfl_Trace(p_in: vec3f, ray_dir_in: vec3f, mat_in: Material, background: vec3f) -> vec3f {
+    var p: vec3f = p_in;
+    var ray_dir: vec3f = ray_dir_in;
+    var mat: Material = mat_in;
+    var color: vec3f = vec3f(0.);
+    var throughput: vec3f = vec3f(1.);
+    var inside: bool = false;
+    for (var bounce: i32 = 0; bounce < 4; bounce++) {
+        var normal: vec3f = sdfl_GetNormal(p);
+        if (!inside) {
+            color += throughput * sdfl_CalculateLighting(p, -ray_dir, mat) * max(1. - mat.reflectivity - mat.transparency, 0.);
+        }
+        if (mat.transparency > 0.) {
+            var n: vec3f = select(normal, -normal, inside);
+            var refracted: vec3f = refract(ray_dir, n, select(1. / mat.ior, mat.ior, inside));
+            if (dot(refracted, refracted) == 0.) {
+                ray_dir = reflect(ray_dir, n);
+                p += n * SDFL_SHADOW_CAST_DISTANCE;
+            } else {
+                if (!inside) {
+                    throughput *= mat.transparency * mat.albedo;
+                }
+                ray_dir = refracted;
+                p -= n * SDFL_SHADOW_CAST_DISTANCE;
+                inside = !inside;
+            }
+        } else if (mat.reflectivity > 0.) {
+            throughput *= mat.reflectivity * mix(vec3f(1.), mat.albedo, vec3f(mat.metallic));
+            ray_dir = reflect(ray_dir, normal);
+            p += normal * SDFL_SHADOW_CAST_DISTANCE;
+        } else {
+            return color;
+        }
+        var result: SceneResult;
+        if (inside) {
+            result = sdfl_RayMarchInside(p, ray_dir);
+        } else {
+            result = sdfl_RayMarch(p, ray_dir);
+        }
+        if (result.distance >= SDFL_MAX_DISTANCE) {
+            return color + throughput * mix(vec3f(0.5, 0.7, 1.0), background, vec3f(ray_dir.y * 0.5 + 0.5));
+        }
+        p += ray_dir * result.distance;
+        mat = sdfl_GetMaterial(result.materialId);
+    }
+    return color + throughput * sdfl_CalculateLighting(p, -ray_dir, mat);
+}
+
+fn sdfl_Render(vertex_uv: vec2f) -> vec4f {
+    var cam_pos: vec3f = vec3f(0.0, 1.5, 6.0);
+    var uv: vec2f = vertex_uv * 2. - 1.;
+    uv.y *= f32(sdfl_uniforms.window_size.y) / f32(sdfl_uniforms.window_size.x);
+    var ray_dir: vec3f = normalize(vec3f(uv, -1.0));
+    var result: SceneResult = sdfl_RayMarch(cam_pos, ray_dir);
+    var color: vec3f = mix(vec3f(0.5, 0.7, 1.0), vec3f(0.1, 0.1, 0.15), vec3f(uv.y * 0.5 + 0.5));
+    if (result.distance < SDFL_MAX_DISTANCE) {
+        var p: vec3f = cam_pos + ray_dir * result.distance;
+        color = sdfl_Trace(p, ray_dir, sdfl_GetMaterial(result.materialId), vec3f(0.1, 0.1, 0.15));
+    }
+    return vec4f(color, 1.0);
+}
+
+@fragment
+fn main(@location(0) o_vertex_uv: vec2f) -> @location(0) vec4f {
+    return sdfl_Render(o_vertex_uv);
+}
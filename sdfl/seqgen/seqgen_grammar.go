@@ -0,0 +1,833 @@
+// Package seqgen generates AST sequences that follow the SDFL grammar.
+//
+// Grammar tracks a sequence prefix line by line and tells which lines may come
+// next, so any sequence model can be masked to only produce valid programs.
+// Model is a small n-gram model over sequence lines that samples through it.
+package seqgen
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	sdfl "../sdfl"
+)
+
+// the longest array and the most params the grammar accepts
+const maxArity = 64
+
+var identifier = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z_0-9]*$`)
+
+var builtins = map[string]bool{}
+
+func init() {
+	for _, id := range sdfl.BuiltinFunctions() {
+		builtins[id] = true
+	}
+}
+
+// Candidate is a line that may come next. When Open is set, Line is only the
+// prefix of the line and a free value (a literal or a name) has to follow,
+// Default is then a complete line that can be used when nothing better is known.
+type Candidate struct {
+	Line    string `json:"line"`
+	Open    bool   `json:"open,omitempty"`
+	Default string `json:"default,omitempty"`
+	cost    int
+}
+
+type frameType int
+
+const (
+	FRAME_HEADER frameType = iota
+	FRAME_TOP              // function definitions or the scene
+	FRAME_DONE
+	FRAME_EXPR
+	FRAME_ARGS
+	FRAME_LITERAL
+	FRAME_PARAM
+	FRAME_DEFINE // registers the function once its body is complete
+	FRAME_EXACT  // a fixed line like left, right, paren:close or val:arr:end
+	FRAME_BIND   // brings the variable of a loop into scope for its body
+	FRAME_UNBIND // drops the variable of a loop once its body is complete
+)
+
+type frame struct {
+	Type frameType
+	Kind sdfl.ArgKind
+
+	// FRAME_EXPR
+	inParen     bool
+	annotated   bool
+	literalOnly bool
+	element     bool // element of an array, where loops are allowed
+	bodyOnly    bool // body of a loop, only an array
+	constant    bool // range of a loop, no calls
+	key         bool // element of a key list, a tuple of a time and a float or a vec3
+	// then branch of a conditional where a float as well as a vec3 fit: the
+	// indexes of the else branches on the stack, they take the kind it has
+	branches []int
+	// value of an animation helper which has no vec3 value yet: the index of
+	// its FRAME_ARGS on the stack, 0 for none as the bottom is never a call
+	helper int
+
+	// FRAME_ARGS of an animation helper, key lists and their elements: the
+	// kind of the values, ARG_VALUE when both floats and vec3 fit
+	values sdfl.ArgKind
+	// default of a string argument
+	text string
+
+	// FRAME_ARGS
+	funId      string
+	signature  []sdfl.ArgSignature
+	used       []string // shared by clones, only replaced
+	positional int      // leading arguments given without their name
+	remaining  int
+	needsValue bool // an animation helper where a vec3 is expected, without a vec3 value yet
+
+	// FRAME_DEFINE
+	defId string
+
+	// FRAME_BIND, FRAME_UNBIND
+	varName string
+
+	// FRAME_EXACT
+	line string
+}
+
+// Grammar is a pushdown automaton over sequence lines, the top of the stack is what comes next
+type Grammar struct {
+	stack  []frame
+	defs   map[string][]sdfl.ArgSignature // user defined functions and their params
+	params []sdfl.ArgSignature            // params of the function being defined
+	vars   []string                       // variables of the enclosing loops
+	lines  int
+}
+
+func NewGrammar() *Grammar {
+	return &Grammar{stack: []frame{{Type: FRAME_TOP}, {Type: FRAME_HEADER}}, defs: map[string][]sdfl.ArgSignature{}}
+}
+
+func (g *Grammar) Clone() *Grammar {
+	c := &Grammar{stack: append([]frame{}, g.stack...), defs: map[string][]sdfl.ArgSignature{}, params: append([]sdfl.ArgSignature{}, g.params...), vars: append([]string{}, g.vars...), lines: g.lines}
+	for id, params := range g.defs {
+		c.defs[id] = params
+	}
+	return c
+}
+
+// Done reports if the prefix is a complete program
+func (g *Grammar) Done() bool {
+	return g.top().Type == FRAME_DONE
+}
+
+func (g *Grammar) top() *frame {
+	return &g.stack[len(g.stack)-1]
+}
+
+func (g *Grammar) pop() {
+	g.stack = g.stack[:len(g.stack)-1]
+}
+
+func (g *Grammar) push(frames ...frame) {
+	g.stack = append(g.stack, frames...)
+}
+
+// settle pops the frames which do not need a line
+func (g *Grammar) settle() {
+	for {
+		switch f := g.top(); f.Type {
+		case FRAME_DEFINE:
+			g.defs[f.defId] = g.params
+			g.params = nil
+		case FRAME_BIND:
+			g.vars = append(g.vars, f.varName)
+		case FRAME_UNBIND:
+			g.vars = g.vars[:len(g.vars)-1]
+		default:
+			return
+		}
+		g.pop()
+	}
+}
+
+// Accepts reports if line may come next
+func (g *Grammar) Accepts(line string) bool {
+	return g.Clone().Feed(line) == nil
+}
+
+// Feed advances the grammar by one line
+func (g *Grammar) Feed(line string) error {
+	if err := g.feed(line, sdfl.SplitSeqLine(line)); err != nil {
+		return fmt.Errorf("line %d %q: %v", g.lines+1, line, err)
+	}
+	g.lines++
+	g.settle()
+	return nil
+}
+
+// FeedAll advances the grammar by every line of prefix
+func (g *Grammar) FeedAll(prefix []string) error {
+	for _, line := range prefix {
+		if err := g.Feed(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *Grammar) feed(line string, fields []string) error {
+	f := g.top()
+	switch f.Type {
+	case FRAME_HEADER:
+		if line != sdfl.SEQ_HEADER {
+			return fmt.Errorf("expected %s", sdfl.SEQ_HEADER)
+		}
+		g.pop()
+		return nil
+
+	case FRAME_TOP:
+		if fields[0] == "fundef" {
+			return g.feedFunDef(fields)
+		}
+		// the scene is the last expression
+		f.Type = FRAME_DONE
+		g.push(frame{Type: FRAME_EXPR, Kind: sdfl.ARG_SCENE})
+		if err := g.feed(line, fields); err != nil {
+			g.pop()
+			g.top().Type = FRAME_TOP
+			return err
+		}
+		return nil
+
+	case FRAME_DONE:
+		return fmt.Errorf("the program is complete")
+
+	case FRAME_EXPR:
+		return g.feedExpr(fields)
+
+	case FRAME_ARGS:
+		return g.feedArg(fields)
+
+	case FRAME_LITERAL:
+		if len(fields) != 2 || fields[0] != "literal" {
+			return fmt.Errorf("expected literal")
+		}
+		if err := checkLiteral(f.Kind, f.values, fields[1]); err != nil {
+			return err
+		}
+		g.pop()
+		return nil
+
+	case FRAME_PARAM:
+		withDefault := len(fields) == 3 && fields[2] == "default"
+		if (len(fields) != 2 && !withDefault) || fields[0] != "param" || !identifier.MatchString(fields[1]) {
+			return fmt.Errorf("expected param:<name>")
+		}
+		for _, param := range g.params {
+			if param.Name == fields[1] {
+				return fmt.Errorf("duplicate param %s", param.Name)
+			}
+		}
+		g.params = append(g.params, sdfl.ArgSignature{Name: fields[1], Kind: sdfl.ARG_ANY, Default: []float64{0}, Optional: withDefault})
+		g.pop()
+		if withDefault {
+			g.push(frame{Type: FRAME_EXPR, Kind: sdfl.ARG_ANY})
+		}
+		return nil
+
+	case FRAME_EXACT:
+		if line != f.line {
+			return fmt.Errorf("expected %s", f.line)
+		}
+		g.pop()
+		return nil
+	}
+	return fmt.Errorf("unexpected line")
+}
+
+func (g *Grammar) feedFunDef(fields []string) error {
+	if len(fields) != 3 || !identifier.MatchString(fields[1]) {
+		return fmt.Errorf("expected fundef:<name>:<params>")
+	}
+	id := fields[1]
+	if builtins[id] {
+		return fmt.Errorf("%s is a builtin function", id)
+	}
+	if _, ok := g.defs[id]; ok {
+		return fmt.Errorf("function %s is already defined", id)
+	}
+	n, err := strconv.Atoi(fields[2])
+	if err != nil || n < 0 || n > maxArity {
+		return fmt.Errorf("invalid param count %s", fields[2])
+	}
+
+	g.params = []sdfl.ArgSignature{}
+	g.push(frame{Type: FRAME_DEFINE, defId: id}, frame{Type: FRAME_EXPR, Kind: sdfl.ARG_LOCAL})
+	for i := 0; i < n; i++ {
+		g.push(frame{Type: FRAME_PARAM})
+	}
+	return nil
+}
+
+var compareOperators = []string{"<", "<=", "==", "!=", ">", ">="}
+var logicOperators = []string{"and", "or"}
+
+// conditional reports if a conditional can stand where kind is expected
+func conditional(kind sdfl.ArgKind) bool {
+	return kind == sdfl.ARG_ANY || kind == sdfl.ARG_FLOAT || kind == sdfl.ARG_VEC3 || kind == sdfl.ARG_VALUE || kind == sdfl.ARG_SHAPE
+}
+
+// valueKind reports if a value of kind can be used where expected is
+func valueKind(expected sdfl.ArgKind, kind sdfl.ArgKind) bool {
+	isValue := kind == sdfl.ARG_FLOAT || kind == sdfl.ARG_VEC3 || kind == sdfl.ARG_VALUE
+	if expected == sdfl.ARG_ANY || expected == sdfl.ARG_VALUE {
+		// params of user defined functions take plain values
+		return isValue
+	}
+	if kind == sdfl.ARG_VALUE {
+		// the animation helpers produce the kind they are given
+		return expected == sdfl.ARG_FLOAT || expected == sdfl.ARG_VEC3
+	}
+	return expected == kind
+}
+
+func (g *Grammar) feedExpr(fields []string) error {
+	base := len(g.stack) - 1
+	f := *g.top()
+	if err := g.feedValue(fields); err != nil {
+		return err
+	}
+	// the operands of a constant expression are constant too
+	for i := base; f.constant && i < len(g.stack); i++ {
+		g.stack[i].constant = g.stack[i].Type == FRAME_EXPR
+	}
+	// both branches of a conditional have the same kind
+	if kind, ok := g.branchKind(fields); ok {
+		for _, i := range f.branches {
+			g.stack[i].Kind = kind
+		}
+		if kind == sdfl.ARG_VEC3 && f.helper > 0 {
+			g.stack[f.helper].needsValue = false
+		}
+	}
+	return nil
+}
+
+// branchKind is the kind of the expression starting with fields, false while
+// it is not known yet
+func (g *Grammar) branchKind(fields []string) (sdfl.ArgKind, bool) {
+	switch {
+	case fields[0] == "call" && len(fields) == 3:
+		_, kind, _ := g.function(fields[1])
+		if kind == sdfl.ARG_VALUE {
+			// the animation helpers of a branch are given floats
+			return sdfl.ARG_FLOAT, true
+		}
+		return kind, true
+	case len(fields) == 2 && fields[0] == "val" && fields[1] == "number":
+		return sdfl.ARG_FLOAT, true
+	case len(fields) == 3 && fields[0] == "val" && (fields[1] == "var" || fields[1] == "binopt" || fields[1] == "binopf"):
+		return sdfl.ARG_FLOAT, true
+	case len(fields) == 2 && fields[0] == "val" && fields[1] == "tuple":
+		return sdfl.ARG_VEC3, true
+	case len(fields) == 3 && fields[0] == "val" && fields[1] == "vec":
+		return sdfl.ARG_VEC3, true
+	}
+	return sdfl.ARG_ANY, false
+}
+
+func (g *Grammar) feedValue(fields []string) error {
+	f := *g.top()
+	join := strings.Join(fields, ":")
+
+	if f.bodyOnly && !(len(fields) == 4 && fields[0] == "val" && fields[1] == "arr" && fields[2] == "begin") {
+		return fmt.Errorf("expected the array of the loop body")
+	}
+	if f.key {
+		return g.feedKey(f, fields)
+	}
+
+	switch {
+	case join == "paren:open" && !f.inParen && !f.annotated:
+		g.pop()
+		f.inParen = true
+		g.push(frame{Type: FRAME_EXACT, line: "paren:close"}, f)
+		return nil
+
+	case join == "annot:tweak" && !f.annotated && (valueKind(f.Kind, sdfl.ARG_FLOAT) || valueKind(f.Kind, sdfl.ARG_VEC3)):
+		g.top().annotated = true
+		g.top().literalOnly = true
+		return nil
+
+	case fields[0] == "call" && len(fields) == 3 && !f.literalOnly && !f.constant:
+		signature, kind, ok := g.function(fields[1])
+		if !ok {
+			return fmt.Errorf("function %s is not defined", fields[1])
+		}
+		if !valueKind(f.Kind, kind) {
+			return fmt.Errorf("%s returns a %s, expected a %s", fields[1], kindName(kind), kindName(f.Kind))
+		}
+		n, err := strconv.Atoi(fields[2])
+		if err != nil || n < requiredArgs(signature) || n > len(signature) {
+			return fmt.Errorf("%s takes %d to %d arguments", fields[1], requiredArgs(signature), len(signature))
+		}
+		values := sdfl.ARG_VALUE
+		if kind == sdfl.ARG_VALUE && (f.Kind == sdfl.ARG_FLOAT || f.Kind == sdfl.ARG_VEC3) {
+			values = f.Kind
+		} else if kind == sdfl.ARG_VALUE && len(f.branches) > 0 {
+			values = sdfl.ARG_FLOAT
+		}
+		// a helper only produces a vec3 when one of its values is one
+		needsValue := kind == sdfl.ARG_VALUE && values == sdfl.ARG_VEC3 && fields[1] != "animate"
+		if needsValue && n == 0 {
+			return fmt.Errorf("%s needs a vec3 value here", fields[1])
+		}
+		g.pop()
+		if n > 0 {
+			g.push(frame{Type: FRAME_ARGS, funId: fields[1], signature: signature, remaining: n, values: values, needsValue: needsValue})
+		}
+		return nil
+
+	case join == "val:number" && valueKind(f.Kind, sdfl.ARG_FLOAT):
+		g.pop()
+		g.push(frame{Type: FRAME_LITERAL, Kind: sdfl.ARG_FLOAT})
+		return nil
+
+	case join == "val:tuple" && valueKind(f.Kind, sdfl.ARG_VEC3):
+		g.pop()
+		g.push(frame{Type: FRAME_LITERAL, Kind: sdfl.ARG_VEC3})
+		return nil
+
+	case len(fields) == 4 && fields[0] == "val" && fields[1] == "arr" && fields[2] == "begin" && (f.Kind == sdfl.ARG_SHAPE_LIST || f.Kind == sdfl.ARG_KEY_LIST || f.Kind == sdfl.ARG_EFFECT_LIST) && !f.literalOnly:
+		n, err := strconv.Atoi(fields[3])
+		if err != nil || n < 0 || n > maxArity {
+			return fmt.Errorf("invalid array length %s", fields[3])
+		}
+		g.pop()
+		element := sdfl.ARG_SHAPE
+		if f.Kind == sdfl.ARG_EFFECT_LIST {
+			element = sdfl.ARG_EFFECT
+		}
+		g.push(frame{Type: FRAME_EXACT, line: "val:arr:end"})
+		for i := 0; i < n; i++ {
+			g.push(frame{Type: FRAME_EXPR, Kind: element, element: true, key: f.Kind == sdfl.ARG_KEY_LIST, values: f.values})
+		}
+		return nil
+
+	case len(fields) == 3 && fields[0] == "val" && fields[1] == "for" && f.element && !f.inParen && !f.annotated:
+		return g.feedFor(f, fields[2])
+
+	case len(fields) == 3 && fields[0] == "val" && fields[1] == "bool" && (fields[2] == "true" || fields[2] == "false") && f.Kind == sdfl.ARG_BOOL && !f.literalOnly:
+		g.pop()
+		return nil
+
+	case len(fields) == 3 && fields[0] == "val" && fields[1] == "string" && f.Kind == sdfl.ARG_STRING && !f.literalOnly:
+		g.pop()
+		return nil
+
+	case len(fields) == 3 && fields[0] == "val" && fields[1] == "var" && valueKind(f.Kind, sdfl.ARG_FLOAT) && !f.literalOnly:
+		if !slices.Contains(g.vars, fields[2]) {
+			return fmt.Errorf("variable %s is not defined", fields[2])
+		}
+		g.pop()
+		return nil
+
+	case join == "val:vec:3" && valueKind(f.Kind, sdfl.ARG_VEC3) && !f.literalOnly:
+		g.pop()
+		g.push(frame{Type: FRAME_EXPR, Kind: sdfl.ARG_FLOAT}, frame{Type: FRAME_EXPR, Kind: sdfl.ARG_FLOAT}, frame{Type: FRAME_EXPR, Kind: sdfl.ARG_FLOAT})
+		return nil
+
+	case len(fields) == 3 && fields[0] == "val" && valueKind(f.Kind, sdfl.ARG_FLOAT) && !f.literalOnly &&
+		((fields[1] == "binopt" && (fields[2] == "+" || fields[2] == "-")) || (fields[1] == "binopf" && (fields[2] == "*" || fields[2] == "/"))):
+		g.pop()
+		g.push(frame{Type: FRAME_EXPR, Kind: sdfl.ARG_FLOAT}, frame{Type: FRAME_EXACT, line: "right"},
+			frame{Type: FRAME_EXPR, Kind: sdfl.ARG_FLOAT}, frame{Type: FRAME_EXACT, line: "left"})
+		return nil
+
+	case len(fields) == 3 && fields[0] == "val" && f.Kind == sdfl.ARG_BOOL && !f.literalOnly &&
+		((fields[1] == "cmp" && slices.Contains(compareOperators, fields[2])) || (fields[1] == "logic" && slices.Contains(logicOperators, fields[2]))):
+		operand := sdfl.ARG_FLOAT
+		if fields[1] == "logic" {
+			operand = sdfl.ARG_BOOL
+		}
+		g.pop()
+		g.push(frame{Type: FRAME_EXPR, Kind: operand}, frame{Type: FRAME_EXACT, line: "right"},
+			frame{Type: FRAME_EXPR, Kind: operand}, frame{Type: FRAME_EXACT, line: "left"})
+		return nil
+
+	case join == "val:not" && f.Kind == sdfl.ARG_BOOL && !f.literalOnly:
+		g.pop()
+		g.push(frame{Type: FRAME_EXPR, Kind: sdfl.ARG_BOOL})
+		return nil
+
+	case len(fields) == 3 && fields[0] == "val" && fields[1] == "cond" && (fields[2] == "ternary" || fields[2] == "if") && conditional(f.Kind) && !f.literalOnly:
+		g.pop()
+		then := frame{Type: FRAME_EXPR, Kind: f.Kind, branches: f.branches}
+		if f.Kind == sdfl.ARG_ANY || f.Kind == sdfl.ARG_VALUE {
+			then.branches = append(slices.Clone(f.branches), len(g.stack))
+		}
+		g.push(frame{Type: FRAME_EXPR, Kind: f.Kind}, frame{Type: FRAME_EXACT, line: "else"},
+			then, frame{Type: FRAME_EXACT, line: "then"},
+			frame{Type: FRAME_EXPR, Kind: sdfl.ARG_BOOL}, frame{Type: FRAME_EXACT, line: "cond"})
+		return nil
+	}
+	return fmt.Errorf("expected a %s expression", kindName(f.Kind))
+}
+
+// feedFor starts a loop, its body is a list of the elements of the enclosing array
+func (g *Grammar) feedFor(f frame, name string) error {
+	if !identifier.MatchString(name) || slices.Contains(g.vars, name) {
+		return fmt.Errorf("invalid loop variable %s", name)
+	}
+	body := sdfl.ARG_SHAPE_LIST
+	if f.key {
+		body = sdfl.ARG_KEY_LIST
+	} else if f.Kind == sdfl.ARG_EFFECT {
+		body = sdfl.ARG_EFFECT_LIST
+	}
+	g.pop()
+	g.push(frame{Type: FRAME_UNBIND}, frame{Type: FRAME_EXPR, Kind: body, bodyOnly: true, values: f.values}, frame{Type: FRAME_BIND, varName: name},
+		frame{Type: FRAME_EXPR, Kind: sdfl.ARG_FLOAT, constant: true}, frame{Type: FRAME_EXACT, line: "to"},
+		frame{Type: FRAME_EXPR, Kind: sdfl.ARG_FLOAT, constant: true}, frame{Type: FRAME_EXACT, line: "from"})
+	return nil
+}
+
+// keyLens are the numbers of values a key may have, a time and a float or a vec3
+func keyLens(values sdfl.ArgKind) []int {
+	switch values {
+	case sdfl.ARG_FLOAT:
+		return []int{2}
+	case sdfl.ARG_VEC3:
+		return []int{4}
+	}
+	return []int{2, 4}
+}
+
+// feedKey accepts a key of animate, a tuple or a vector of constant values
+func (g *Grammar) feedKey(f frame, fields []string) error {
+	join := strings.Join(fields, ":")
+	switch {
+	case join == "paren:open" && !f.inParen:
+		g.pop()
+		f.inParen = true
+		g.push(frame{Type: FRAME_EXACT, line: "paren:close"}, f)
+		return nil
+	case len(fields) == 3 && fields[0] == "val" && fields[1] == "for" && f.element && !f.inParen:
+		return g.feedFor(f, fields[2])
+	case join == "val:tuple":
+		g.pop()
+		g.push(frame{Type: FRAME_LITERAL, Kind: sdfl.ARG_KEY_LIST, values: f.values})
+		return nil
+	case len(fields) == 3 && fields[0] == "val" && fields[1] == "vec":
+		n, err := strconv.Atoi(fields[2])
+		if err != nil || !slices.Contains(keyLens(f.values), n) {
+			return fmt.Errorf("a key has %v values", keyLens(f.values))
+		}
+		g.pop()
+		for i := 0; i < n; i++ {
+			g.push(frame{Type: FRAME_EXPR, Kind: sdfl.ARG_FLOAT, constant: true})
+		}
+		return nil
+	}
+	return fmt.Errorf("expected a key")
+}
+
+func (g *Grammar) feedArg(fields []string) error {
+	f := g.top()
+	positional := len(fields) == 3 && fields[2] == "positional"
+	if len(fields) != 2 && !positional || fields[0] != "arg" {
+		return fmt.Errorf("expected arg of %s", f.funId)
+	}
+	arg, ok := nextArg(f, fields[1])
+	if !ok {
+		return fmt.Errorf("argument %s of %s is not allowed here", fields[1], f.funId)
+	}
+	if positional {
+		if len(f.used) != f.positional || f.signature[f.positional].Name != arg.Name {
+			return fmt.Errorf("argument %s of %s can not be positional here", fields[1], f.funId)
+		}
+		f.positional++
+	}
+
+	kind := arg.Kind
+	helper := 0
+	if kind == sdfl.ARG_VALUE && f.values == sdfl.ARG_FLOAT {
+		// where a vec3 is expected floats are widened, where a float is expected vec3 do not fit
+		kind = sdfl.ARG_FLOAT
+	} else if kind == sdfl.ARG_VALUE && f.needsValue && f.remaining == 1 {
+		// the last value has to be the vec3 none of the others was
+		kind = sdfl.ARG_VEC3
+	} else if kind == sdfl.ARG_VALUE && f.needsValue {
+		helper = len(g.stack) - 1
+	}
+	values := f.values
+	f.used = append(slices.Clone(f.used), arg.Name)
+	f.remaining--
+	if f.remaining == 0 {
+		g.pop()
+	}
+	g.push(frame{Type: FRAME_EXPR, Kind: kind, values: values, text: arg.DefaultText, helper: helper})
+	return nil
+}
+
+// function looks up a builtin or a function defined in the prefix
+func (g *Grammar) function(id string) ([]sdfl.ArgSignature, sdfl.ArgKind, bool) {
+	if params, ok := g.defs[id]; ok {
+		return params, sdfl.ARG_SHAPE, true
+	}
+	if !builtins[id] {
+		return nil, sdfl.ARG_ANY, false
+	}
+	signature, _ := sdfl.Signature(id)
+	return signature, sdfl.ReturnKind(id), true
+}
+
+func requiredArgs(signature []sdfl.ArgSignature) int {
+	n := 0
+	for _, arg := range signature {
+		if !arg.Optional {
+			n++
+		}
+	}
+	return n
+}
+
+// nextArg checks if name can be the next argument. Every argument is given
+// once and every required argument has to fit into the remaining ones.
+func nextArg(f *frame, name string) (sdfl.ArgSignature, bool) {
+	var found *sdfl.ArgSignature
+	unused, required := 0, 0
+	for i, arg := range f.signature {
+		if slices.Contains(f.used, arg.Name) {
+			continue
+		}
+		if arg.Name == name {
+			found = &f.signature[i]
+			continue
+		}
+		unused++
+		if !arg.Optional {
+			required++
+		}
+	}
+	if found == nil {
+		return sdfl.ArgSignature{}, false
+	}
+	if f.needsValue && f.remaining == 1 && found.Kind != sdfl.ARG_VALUE {
+		return *found, false
+	}
+	return *found, unused >= f.remaining-1 && required <= f.remaining-1
+}
+
+func checkLiteral(kind sdfl.ArgKind, keyValues sdfl.ArgKind, value string) error {
+	if kind == sdfl.ARG_FLOAT {
+		_, err := sdfl.ParseNumberLiteral(value)
+		return err
+	}
+	if !strings.HasPrefix(value, "(") || !strings.HasSuffix(value, ")") {
+		return fmt.Errorf("expected a tuple literal")
+	}
+	values := strings.Split(value[1:len(value)-1], ",")
+	if kind == sdfl.ARG_KEY_LIST && !slices.Contains(keyLens(keyValues), len(values)) {
+		return fmt.Errorf("expected %v values, got %d", keyLens(keyValues), len(values))
+	} else if kind != sdfl.ARG_KEY_LIST && len(values) != 3 {
+		return fmt.Errorf("expected 3 values, got %d", len(values))
+	}
+	for _, v := range values {
+		if _, err := sdfl.ParseNumberLiteral(strings.TrimSpace(v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func kindName(kind sdfl.ArgKind) string {
+	switch kind {
+	case sdfl.ARG_FLOAT:
+		return "float"
+	case sdfl.ARG_VEC3:
+		return "vec3"
+	case sdfl.ARG_SHAPE:
+		return "shape"
+	case sdfl.ARG_SHAPE_LIST:
+		return "shape list"
+	case sdfl.ARG_CAMERA:
+		return "camera"
+	case sdfl.ARG_LOCAL:
+		return "local"
+	case sdfl.ARG_SCENE:
+		return "scene"
+	case sdfl.ARG_BOOL:
+		return "condition"
+	case sdfl.ARG_STRING:
+		return "string"
+	case sdfl.ARG_KEY_LIST:
+		return "key list"
+	case sdfl.ARG_EFFECT:
+		return "post effect"
+	case sdfl.ARG_EFFECT_LIST:
+		return "post effect list"
+	}
+	return "value"
+}
+
+// Candidates returns every line that may come next, cheapest first
+func (g *Grammar) Candidates() []Candidate {
+	f := g.top()
+	candidates := []Candidate{}
+	switch f.Type {
+	case FRAME_HEADER:
+		candidates = append(candidates, Candidate{Line: sdfl.SEQ_HEADER})
+	case FRAME_TOP:
+		candidates = append(candidates, Candidate{Line: "fundef:", Open: true, Default: sdfl.SeqLine("fundef", fmt.Sprintf("shape%d", len(g.defs)), "0"), cost: 10})
+		candidates = append(candidates, g.exprCandidates(frame{Type: FRAME_EXPR, Kind: sdfl.ARG_SCENE})...)
+	case FRAME_EXPR:
+		candidates = append(candidates, g.exprCandidates(*f)...)
+	case FRAME_ARGS:
+		for _, arg := range f.signature {
+			if _, ok := nextArg(f, arg.Name); ok {
+				candidates = append(candidates, Candidate{Line: sdfl.SeqLine("arg", arg.Name)})
+			}
+		}
+		// the next argument of the definition may be given without its name
+		if len(f.used) == f.positional && f.positional < len(f.signature) {
+			if arg, ok := nextArg(f, f.signature[f.positional].Name); ok {
+				candidates = append(candidates, Candidate{Line: sdfl.SeqLine("arg", arg.Name, "positional"), cost: 1})
+			}
+		}
+	case FRAME_LITERAL:
+		if f.Kind == sdfl.ARG_FLOAT {
+			candidates = append(candidates, Candidate{Line: "literal:", Open: true, Default: "literal:1"})
+		} else if f.Kind == sdfl.ARG_KEY_LIST && f.values == sdfl.ARG_VEC3 {
+			candidates = append(candidates, Candidate{Line: "literal:", Open: true, Default: "literal:(0, 0, 0, 0)"})
+		} else if f.Kind == sdfl.ARG_KEY_LIST {
+			candidates = append(candidates, Candidate{Line: "literal:", Open: true, Default: "literal:(0, 0)"})
+		} else {
+			candidates = append(candidates, Candidate{Line: "literal:", Open: true, Default: "literal:(0, 0, 0)"})
+		}
+	case FRAME_PARAM:
+		candidates = append(candidates, Candidate{Line: "param:", Open: true, Default: sdfl.SeqLine("param", fmt.Sprintf("p%d", len(g.params)))})
+	case FRAME_EXACT:
+		candidates = append(candidates, Candidate{Line: f.line})
+	}
+
+	// stable insertion sort by cost, the order of equal candidates is kept
+	for i := 1; i < len(candidates); i++ {
+		for j := i; j > 0 && candidates[j].cost < candidates[j-1].cost; j-- {
+			candidates[j], candidates[j-1] = candidates[j-1], candidates[j]
+		}
+	}
+	return candidates
+}
+
+// exprCandidates lists the first lines of every expression f accepts, the
+// cost estimates how many lines the expression needs to be complete
+func (g *Grammar) exprCandidates(f frame) []Candidate {
+	candidates := []Candidate{}
+	if f.bodyOnly {
+		return []Candidate{{Line: "val:arr:begin:", Open: true, Default: "val:arr:begin:1", cost: 1}}
+	}
+	if f.key {
+		candidates = append(candidates, Candidate{Line: "val:tuple", cost: 1})
+		for _, n := range keyLens(f.values) {
+			candidates = append(candidates, Candidate{Line: sdfl.SeqLine("val", "vec", strconv.Itoa(n)), cost: 1 + 2*n})
+		}
+		if !f.inParen {
+			candidates = append(candidates, Candidate{Line: "paren:open", cost: 9})
+		}
+		if f.element && !f.inParen {
+			candidates = append(candidates, Candidate{Line: "val:for:", Open: true, Default: sdfl.SeqLine("val", "for", fmt.Sprintf("i%d", len(g.vars))), cost: 12})
+		}
+		return candidates
+	}
+	isValue := valueKind(f.Kind, sdfl.ARG_FLOAT) || valueKind(f.Kind, sdfl.ARG_VEC3)
+
+	if valueKind(f.Kind, sdfl.ARG_FLOAT) {
+		candidates = append(candidates, Candidate{Line: "val:number", cost: 1})
+	}
+	if valueKind(f.Kind, sdfl.ARG_VEC3) {
+		candidates = append(candidates, Candidate{Line: "val:tuple", cost: 1})
+	}
+	if isValue && !f.annotated {
+		candidates = append(candidates, Candidate{Line: "annot:tweak", cost: 8})
+	}
+	if !f.inParen && !f.annotated {
+		candidates = append(candidates, Candidate{Line: "paren:open", cost: 9})
+	}
+	if f.literalOnly {
+		return candidates
+	}
+
+	if f.Kind == sdfl.ARG_SHAPE_LIST || f.Kind == sdfl.ARG_EFFECT_LIST {
+		candidates = append(candidates, Candidate{Line: "val:arr:begin:", Open: true, Default: "val:arr:begin:0", cost: 1})
+	}
+	if f.Kind == sdfl.ARG_KEY_LIST {
+		candidates = append(candidates, Candidate{Line: "val:arr:begin:", Open: true, Default: "val:arr:begin:1", cost: 3})
+	}
+	if f.Kind == sdfl.ARG_STRING {
+		candidates = append(candidates, Candidate{Line: "val:string:", Open: true, Default: sdfl.SeqLine("val", "string", f.text), cost: 1})
+	}
+	if valueKind(f.Kind, sdfl.ARG_FLOAT) {
+		for _, name := range g.vars {
+			candidates = append(candidates, Candidate{Line: sdfl.SeqLine("val", "var", name), cost: 1})
+		}
+		for _, op := range []string{"val:binopt:+", "val:binopt:-", "val:binopf:*", "val:binopf:/"} {
+			candidates = append(candidates, Candidate{Line: op, cost: 9})
+		}
+	}
+	if valueKind(f.Kind, sdfl.ARG_VEC3) {
+		candidates = append(candidates, Candidate{Line: "val:vec:3", cost: 7})
+	}
+	if f.element && !f.inParen && !f.annotated {
+		candidates = append(candidates, Candidate{Line: "val:for:", Open: true, Default: sdfl.SeqLine("val", "for", fmt.Sprintf("i%d", len(g.vars))), cost: 12})
+	}
+	if f.Kind == sdfl.ARG_BOOL {
+		for _, op := range compareOperators {
+			candidates = append(candidates, Candidate{Line: sdfl.SeqLine("val", "cmp", op), cost: 9})
+		}
+		for _, op := range logicOperators {
+			candidates = append(candidates, Candidate{Line: sdfl.SeqLine("val", "logic", op), cost: 17})
+		}
+		candidates = append(candidates, Candidate{Line: "val:not", cost: 9})
+		candidates = append(candidates, Candidate{Line: "val:bool:false", cost: 1}, Candidate{Line: "val:bool:true", cost: 1})
+	}
+	if conditional(f.Kind) {
+		for _, style := range []string{"ternary", "if"} {
+			candidates = append(candidates, Candidate{Line: sdfl.SeqLine("val", "cond", style), cost: 20})
+		}
+	}
+
+	if f.constant {
+		return candidates
+	}
+	ids := sdfl.BuiltinFunctions()
+	defIds := []string{}
+	for id := range g.defs {
+		defIds = append(defIds, id)
+	}
+	sort.Strings(defIds)
+	ids = append(ids, defIds...)
+	for _, id := range ids {
+		signature, kind, ok := g.function(id)
+		if !ok || !valueKind(f.Kind, kind) {
+			continue
+		}
+		for n := requiredArgs(signature); n <= len(signature); n++ {
+			candidates = append(candidates, Candidate{Line: sdfl.SeqLine("call", id, strconv.Itoa(n)), cost: 1 + 3*n})
+		}
+	}
+	return candidates
+}
+
+// ValidNext returns the lines that may follow prefix
+func ValidNext(prefix []string) ([]Candidate, error) {
+	g := NewGrammar()
+	if err := g.FeedAll(prefix); err != nil {
+		return nil, err
+	}
+	return g.Candidates(), nil
+}
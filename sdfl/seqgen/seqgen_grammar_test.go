@@ -0,0 +1,128 @@
+package seqgen
+
+import (
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+
+	sdfl "../sdfl"
+)
+
+// sequenceOf returns the lines of the testdata scene name of the compiler
+func sequenceOf(t *testing.T, name string) []string {
+	t.Helper()
+	lines, err := SequenceOfFile("../sdfl/testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+func TestGrammarAcceptsScenes(t *testing.T) {
+	for _, name := range []string{"features.sdfl", "reflections.sdfl"} {
+		g := NewGrammar()
+		if err := g.FeedAll(sequenceOf(t, name)); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !g.Done() {
+			t.Errorf("%s: the sequence is not complete", name)
+		}
+	}
+}
+
+func TestGrammarPositionalArguments(t *testing.T) {
+	lines := sequenceOf(t, "features.sdfl")
+	at := -1
+	for i, line := range lines {
+		if line == "call:toneMap:1" {
+			at = i
+		}
+	}
+	if at < 0 || lines[at+1] != "arg:curve:positional" {
+		t.Fatalf("features.sdfl has no positional argument of toneMap")
+	}
+
+	g := NewGrammar()
+	if err := g.FeedAll(lines[:at+1]); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Accepts("arg:curve:positional") || !g.Accepts("arg:curve") {
+		t.Errorf("the first argument of toneMap can be given with or without its name")
+	}
+	found := false
+	for _, candidate := range g.Candidates() {
+		found = found || candidate.Line == "arg:curve:positional"
+	}
+	if !found {
+		t.Errorf("arg:curve:positional is not a candidate")
+	}
+
+	// only the arguments in the order of the definition can be positional
+	g = NewGrammar()
+	prefix := strings.Split("sdfl-seq:3\ncall:scene:2\narg:camera\ncall:camera:1\narg:position\nval:tuple\nliteral:(0, 0, 5)\narg:children\nval:arr:begin:1\ncall:sphere:2", "\n")
+	if err := g.FeedAll(prefix); err != nil {
+		t.Fatal(err)
+	}
+	if g.Accepts("arg:radius:positional") {
+		t.Errorf("radius is not the first argument of sphere")
+	}
+	if err := g.Feed("arg:position:positional"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.FeedAll([]string{"val:tuple", "literal:(0, 0, 0)"}); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Accepts("arg:radius:positional") {
+		t.Errorf("radius follows the positional position")
+	}
+}
+
+func TestGrammarConditionalBranches(t *testing.T) {
+	// where a float as well as a vec3 fit, the else branch takes the kind of the then branch
+	prefix := strings.Split("sdfl-seq:3\nfundef:f:1\nparam:r:default\nval:cond:ternary\ncond\nval:bool:true\nthen", "\n")
+	for _, tc := range []struct {
+		then   []string
+		accept string
+		reject string
+	}{
+		{[]string{"val:number", "literal:1"}, "val:number", "val:tuple"},
+		{[]string{"val:tuple", "literal:(1, 2, 3)"}, "val:tuple", "val:number"},
+		{[]string{"paren:open", "val:vec:3", "val:number", "literal:1", "val:number", "literal:2", "val:number", "literal:3", "paren:close"}, "val:tuple", "val:number"},
+		{[]string{"val:cond:ternary", "cond", "val:bool:false", "then", "val:tuple", "literal:(1, 2, 3)", "else", "val:tuple", "literal:(0, 0, 0)"}, "val:tuple", "val:number"},
+	} {
+		g := NewGrammar()
+		if err := g.FeedAll(append(append(slices.Clone(prefix), tc.then...), "else")); err != nil {
+			t.Fatal(err)
+		}
+		if !g.Accepts(tc.accept) || g.Accepts(tc.reject) {
+			t.Errorf("after %v the else branch takes %s, not %s", tc.then, tc.accept, tc.reject)
+		}
+	}
+}
+
+func TestSampledProgramsCompile(t *testing.T) {
+	// every sequence the grammar lets through is a program the compiler takes
+	// without a diagnostic, the kinds of the grammar follow the ones of Analyze
+	model := NewModel(3)
+	if _, err := model.Train([]string{"../sdfl/testdata/features.sdfl", "../sdfl/testdata/reflections.sdfl"}); err != nil {
+		t.Fatal(err)
+	}
+	for seed := int64(0); seed < 500; seed++ {
+		lines, err := model.Sample(rand.New(rand.NewSource(seed)), 300)
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		sdfl.ResetDiagnostics()
+		prog, err := sdfl.DecodeSeq(strings.Join(lines, "\n") + "\n")
+		if err != nil {
+			t.Errorf("seed %d: %v", seed, err)
+			continue
+		}
+		sdfl.Analyze(&prog)
+		if diagnostics := sdfl.GetDiagnostics(); len(diagnostics) > 0 {
+			t.Errorf("seed %d: %v\n%s", seed, diagnostics, sdfl.FormatProgram(prog))
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package seqgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	sdfl "../sdfl"
+)
+
+// n-gram model over sequence lines
+//
+// The model counts which line follows the previous Order-1 lines in a corpus.
+// Sampling backs off to shorter contexts when the longer ones have no line the
+// grammar accepts, so every sampled sequence is a complete, valid program.
+
+const startToken = "<s>"
+
+type Model struct {
+	Order  int                       `json:"order"`
+	Counts map[string]map[string]int `json:"counts"` // context (lines joined by \n) to next line counts
+}
+
+func NewModel(order int) *Model {
+	if order < 1 {
+		order = 1
+	}
+	return &Model{Order: order, Counts: map[string]map[string]int{}}
+}
+
+func contextKey(history []string, n int) string {
+	return strings.Join(history[len(history)-n:], "\n")
+}
+
+// Add counts the n-grams of one sequence
+func (m *Model) Add(lines []string) {
+	history := []string{}
+	for i := 0; i < m.Order-1; i++ {
+		history = append(history, startToken)
+	}
+
+	for _, line := range lines {
+		for n := 0; n < m.Order; n++ {
+			key := contextKey(history, n)
+			if m.Counts[key] == nil {
+				m.Counts[key] = map[string]int{}
+			}
+			m.Counts[key][line]++
+		}
+		history = append(history, line)
+	}
+}
+
+// SequenceOfFile returns the sequence lines of a .sdfl source, or of a sequence file
+func SequenceOfFile(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if filepath.Ext(path) != ".sdfl" {
+		prog, err := sdfl.DecodeSeq(string(content))
+		if err != nil {
+			return nil, err
+		}
+		return strings.Split(sdfl.AST2Seq(prog), "\n"), nil
+	}
+
+	sdfl.ResetDiagnostics()
+	sdfl.InitRules()
+	parser := sdfl.NewParser(sdfl.Tokenize(string(content)))
+	prog := parser.Parse()
+	if parser.IsThereError() || sdfl.HasErrors() {
+		return nil, fmt.Errorf("%s does not parse: %v", path, sdfl.GetDiagnostics())
+	}
+	return strings.Split(sdfl.AST2Seq(prog), "\n"), nil
+}
+
+// Train adds every file to the model, files which do not parse are skipped and returned
+func (m *Model) Train(paths []string) ([]string, error) {
+	skipped := []string{}
+	for _, path := range paths {
+		lines, err := SequenceOfFile(path)
+		if err != nil {
+			sdfl.Warnf("skipping %s: %v", path, err)
+			skipped = append(skipped, path)
+			continue
+		}
+		m.Add(lines)
+	}
+	if len(skipped) == len(paths) && len(paths) > 0 {
+		return skipped, fmt.Errorf("none of the %d files could be used", len(paths))
+	}
+	return skipped, nil
+}
+
+func (m *Model) Save(path string) error {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, bytes, 0644)
+}
+
+func LoadModel(path string) (*Model, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &Model{}
+	if err := json.Unmarshal(bytes, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// next picks the line following history among the ones g accepts
+func (m *Model) next(g *Grammar, history []string, r *rand.Rand) (string, bool) {
+	for n := m.Order - 1; n >= 0; n-- {
+		counts := m.Counts[contextKey(history, n)]
+
+		// sorted so that sampling only depends on the seed
+		lines := make([]string, 0, len(counts))
+		for line := range counts {
+			lines = append(lines, line)
+		}
+		sort.Strings(lines)
+
+		total := 0
+		accepted := []string{}
+		for _, line := range lines {
+			if g.Accepts(line) {
+				accepted = append(accepted, line)
+				total += counts[line]
+			}
+		}
+		if total == 0 {
+			continue
+		}
+
+		pick := r.Intn(total)
+		for _, line := range accepted {
+			pick -= counts[line]
+			if pick < 0 {
+				return line, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Sample generates a complete sequence. After maxLines lines the cheapest
+// candidates are taken, so the program is closed as soon as possible.
+func (m *Model) Sample(r *rand.Rand, maxLines int) ([]string, error) {
+	g := NewGrammar()
+	history := []string{}
+	for i := 0; i < m.Order-1; i++ {
+		history = append(history, startToken)
+	}
+
+	lines := []string{}
+	for !g.Done() {
+		line, ok := "", false
+		if len(lines) < maxLines {
+			line, ok = m.next(g, history, r)
+		}
+		if !ok {
+			candidates := g.Candidates()
+			if len(candidates) == 0 {
+				return lines, fmt.Errorf("no valid line after %d lines", len(lines))
+			}
+			candidate := candidates[0]
+			if len(lines) < maxLines {
+				candidate = candidates[r.Intn(len(candidates))]
+			}
+			line = candidate.Line
+			if candidate.Open {
+				line = candidate.Default
+			}
+		}
+
+		if err := g.Feed(line); err != nil {
+			return lines, err
+		}
+		lines = append(lines, line)
+		history = append(history, line)
+	}
+	return lines, nil
+}